@@ -0,0 +1,211 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+// derived is a structure computed from a dataset, such as a spatial index
+// or an LOD tree. Its memory is charged to the dataset it was built from and
+// it is evicted together with it.
+type derived interface {
+	Bytes() int64
+}
+
+// datasetCache keeps loaded datasets and their derived structures in memory
+// up to a byte budget, evicting the least recently used datasets when the
+// budget is exceeded. Evicted datasets are reloaded transparently on the
+// next request. The most recently used dataset is never evicted, so a single
+// dataset larger than the budget still loads.
+type datasetCache struct {
+	load   func(ctx context.Context, name string, params url.Values) (*pointcloud.Cloud, error)
+	budget int64
+
+	mu       sync.Mutex
+	used     int64
+	lru      *list.List // of *cacheEntry, most recently used first
+	entries  map[string]*list.Element
+	inflight map[string]*loadCall
+
+	hits, misses, evictions int64
+}
+
+type cacheEntry struct {
+	key     string
+	cloud   *pointcloud.Cloud
+	derived map[string]derived
+	size    int64
+}
+
+// loadCall lets concurrent requests for the same dataset share one load.
+type loadCall struct {
+	done  chan struct{}
+	cloud *pointcloud.Cloud
+	err   error
+}
+
+func newDatasetCache(budget int64, load func(context.Context, string, url.Values) (*pointcloud.Cloud, error)) *datasetCache {
+	c := &datasetCache{
+		load:     load,
+		budget:   budget,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*loadCall{},
+	}
+	c.registerMetrics()
+	return c
+}
+
+// cacheKey identifies a dataset together with its loader options.
+func cacheKey(name string, params url.Values) string {
+	if len(params) == 0 {
+		return name
+	}
+	return name + "?" + params.Encode()
+}
+
+// Get returns the named dataset, loading it if it is not cached. A load is
+// traced as a child of the span in ctx.
+func (c *datasetCache) Get(ctx context.Context, name string, params url.Values) (*pointcloud.Cloud, error) {
+	e, err := c.entry(ctx, name, params)
+	if err != nil {
+		return nil, err
+	}
+	return e.cloud, nil
+}
+
+// Derived returns the structure of the given kind built from the named
+// dataset, building it with build on first use.
+func (c *datasetCache) Derived(ctx context.Context, name string, params url.Values, kind string, build func(*pointcloud.Cloud) (derived, error)) (derived, error) {
+	e, err := c.entry(ctx, name, params)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	d, ok := e.derived[kind]
+	c.mu.Unlock()
+	if ok {
+		return d, nil
+	}
+	_, span := trace.Start(ctx, "dataset.derive")
+	span.Set("dataset", e.key, "kind", kind)
+	d, err = build(e.cloud)
+	span.Fail(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if prev, ok := e.derived[kind]; ok {
+		// Built concurrently by another request.
+		return prev, nil
+	}
+	e.derived[kind] = d
+	e.size += d.Bytes()
+	if el, ok := c.entries[e.key]; ok && el.Value.(*cacheEntry) == e {
+		c.used += d.Bytes()
+		c.evict()
+	}
+	return d, nil
+}
+
+// entry returns the cache entry for a dataset, loading it on a miss. The
+// span in ctx, if any, records whether the cache was hit.
+func (c *datasetCache) entry(ctx context.Context, name string, params url.Values) (*cacheEntry, error) {
+	key := cacheKey(name, params)
+	span := trace.FromContext(ctx)
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.hits++
+		if span != nil {
+			span.Set("cache.hit", true)
+		}
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*cacheEntry), nil
+	}
+	c.misses++
+	if span != nil {
+		span.Set("cache.hit", false)
+	}
+	call, ok := c.inflight[key]
+	if !ok {
+		call = &loadCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		c.mu.Unlock()
+		call.cloud, call.err = c.load(ctx, name, params)
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if call.err == nil {
+			e := &cacheEntry{key: key, cloud: call.cloud, derived: map[string]derived{}, size: call.cloud.Bytes()}
+			c.entries[key] = c.lru.PushFront(e)
+			c.used += e.size
+			c.evict()
+		}
+		close(call.done)
+	}
+	c.mu.Unlock()
+	<-call.done
+	if call.err != nil {
+		return nil, call.err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		return el.Value.(*cacheEntry), nil
+	}
+	// Evicted before this caller got to it; hand out an uncached entry.
+	return &cacheEntry{key: key, cloud: call.cloud, derived: map[string]derived{}}, nil
+}
+
+// evict drops least recently used entries until the cache fits its budget.
+// c.mu must be held.
+func (c *datasetCache) evict() {
+	for c.used > c.budget && c.lru.Len() > 1 {
+		el := c.lru.Back()
+		e := el.Value.(*cacheEntry)
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		c.used -= e.size
+		c.evictions++
+	}
+}
+
+func (c *datasetCache) registerMetrics() {
+	locked := func(fn func() float64) func() float64 {
+		return func() float64 {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return fn()
+		}
+	}
+	registerMetric("threedistvis_cache_budget_bytes", "gauge", "Memory budget of the dataset cache.",
+		value(func() float64 { return float64(c.budget) }))
+	registerMetric("threedistvis_cache_used_bytes", "gauge", "Memory held by cached datasets and derived structures.",
+		value(locked(func() float64 { return float64(c.used) })))
+	registerMetric("threedistvis_cache_entries", "gauge", "Number of cached datasets.",
+		value(locked(func() float64 { return float64(c.lru.Len()) })))
+	registerMetric("threedistvis_cache_hits_total", "counter", "Dataset requests served from the cache.",
+		value(locked(func() float64 { return float64(c.hits) })))
+	registerMetric("threedistvis_cache_misses_total", "counter", "Dataset requests that required a load.",
+		value(locked(func() float64 { return float64(c.misses) })))
+	registerMetric("threedistvis_cache_evictions_total", "counter", "Datasets evicted to stay within the budget.",
+		value(locked(func() float64 { return float64(c.evictions) })))
+	registerMetric("threedistvis_cache_dataset_bytes", "gauge", "Memory held by each cached dataset, including derived structures.",
+		func() []sample {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			var samples []sample
+			for el := c.lru.Front(); el != nil; el = el.Next() {
+				e := el.Value.(*cacheEntry)
+				samples = append(samples, sample{labels("dataset", e.key), float64(e.size)})
+			}
+			return samples
+		})
+}
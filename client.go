@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// staticDir holds the client: index.html, styles and the WASM builds.
+const staticDir = "wasm"
+
+// clientBuild is a compiled WASM client together with the runtime JS it
+// was built against. The two must always be served as a pair.
+type clientBuild struct {
+	name    string
+	wasm    string
+	runtime string
+}
+
+// clientBuilds lists the known builds in order of preference for "auto":
+// TinyGo first, as its output is several times smaller.
+var clientBuilds = []clientBuild{
+	{"tinygo", "main-tinygo.wasm", "wasm_exec_tinygo.js"},
+	{"go", "main.wasm", "wasm_exec.js"},
+}
+
+// clientMode selects the build to serve: "auto", "tinygo" or "go".
+var clientMode = "auto"
+
+// selectClient returns the build to serve. Presence is checked per request
+// so a rebuild takes effect without restarting the server.
+func selectClient() (clientBuild, error) {
+	for _, b := range clientBuilds {
+		if clientMode != "auto" && clientMode != b.name {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(staticDir, b.wasm)); err == nil {
+			return b, nil
+		}
+	}
+	return clientBuild{}, fmt.Errorf("no %s client build found in %s", clientMode, staticDir)
+}
+
+// handleClientFile serves the WASM binary (runtime false) or runtime JS
+// (runtime true) of the selected build under its generic name, so
+// index.html does not need to know which build is present.
+func handleClientFile(runtime bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := selectClient()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		name := b.wasm
+		if runtime {
+			name = b.runtime
+		}
+		w.Header().Set("X-Client-Build", b.name)
+		// The same URL may serve different builds over time.
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFile(w, r, filepath.Join(staticDir, name))
+	}
+}
@@ -0,0 +1,149 @@
+// Command orderbench measures the effect of Morton and Hilbert ordering on
+// a synthetic dataset: buffer compressibility (raw and delta-encoded), chunk tightness, box query
+// speed and the distance between consecutive points, a proxy for GPU
+// vertex cache locality.
+//
+//	go run ./cmd/orderbench -kind swissroll -n 1000000
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/spatial"
+	"github.com/sbecker11/threedistvis-go/synth"
+)
+
+func main() {
+	kind := flag.String("kind", "swissroll", "synthetic manifold to benchmark")
+	n := flag.Int("n", 1000000, "number of points")
+	chunk := flag.Int("chunk", 4096, "points per chunk")
+	queries := flag.Int("queries", 1000, "number of box queries")
+	extent := flag.Float64("extent", 0.05, "query box size as a fraction of the bounding box")
+	flag.Parse()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "order\treorder\tgzip ratio\tdelta ratio\tchunk volume\tquery\tscanned/query\tstep\t")
+	for _, order := range []spatial.Order{"", spatial.Morton, spatial.Hilbert} {
+		c, err := synth.Generate(*kind, synth.Options{N: *n, Seed: 1})
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		start := time.Now()
+		if order != "" {
+			spatial.Reorder(c, order)
+		}
+		reorder := time.Since(start)
+
+		idx := spatial.NewChunkIndex(c, *chunk)
+		lo, hi := c.Bounds()
+		queryTime, scanned := runQueries(idx, lo, hi, *queries, *extent)
+
+		name := string(order)
+		if name == "" {
+			name = "original"
+		}
+		fmt.Fprintf(w, "%s\t%v\t%.3f\t%.3f\t%.4f\t%v\t%d\t%.5f\t\n",
+			name, reorder.Round(time.Millisecond), gzipRatio(c), deltaRatio(c, lo, hi), chunkVolume(idx, lo, hi),
+			queryTime.Round(time.Microsecond), scanned, meanStep(c, lo, hi))
+	}
+	w.Flush()
+	fmt.Println()
+	fmt.Println("gzip ratio:    compressed/raw size of the position buffer")
+	fmt.Println("delta ratio:   the same after quantizing to 16 bits and delta-encoding consecutive points")
+	fmt.Println("chunk volume:  mean chunk bounding box volume relative to the whole cloud")
+	fmt.Println("query:         mean time of a box query using the chunk index")
+	fmt.Println("step:          mean distance between consecutive points relative to the bounding box diagonal")
+}
+
+func gzipRatio(c *pointcloud.Cloud) float64 {
+	raw := make([]byte, 4*len(c.Positions))
+	for i, v := range c.Positions {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(v))
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(raw)
+	zw.Close()
+	return float64(buf.Len()) / float64(len(raw))
+}
+
+func deltaRatio(c *pointcloud.Cloud, lo, hi [3]float32) float64 {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	var prev [3]int64
+	var tmp [binary.MaxVarintLen64]byte
+	for i := 0; i < c.Len(); i++ {
+		for k := 0; k < 3; k++ {
+			q := int64(0)
+			if hi[k] > lo[k] {
+				q = int64(float64(c.Positions[3*i+k]-lo[k]) / float64(hi[k]-lo[k]) * 65535)
+			}
+			zw.Write(tmp[:binary.PutVarint(tmp[:], q-prev[k])])
+			prev[k] = q
+		}
+	}
+	zw.Close()
+	return float64(buf.Len()) / float64(4*len(c.Positions))
+}
+
+func chunkVolume(idx *spatial.ChunkIndex, lo, hi [3]float32) float64 {
+	total := volume(lo, hi)
+	sum := 0.0
+	for _, ch := range idx.Chunks {
+		sum += volume(ch.Min, ch.Max) / total
+	}
+	return sum / float64(len(idx.Chunks))
+}
+
+func volume(lo, hi [3]float32) float64 {
+	v := 1.0
+	for k := 0; k < 3; k++ {
+		v *= float64(hi[k] - lo[k])
+	}
+	return v
+}
+
+func runQueries(idx *spatial.ChunkIndex, lo, hi [3]float32, n int, extent float64) (time.Duration, int) {
+	rng := rand.New(rand.NewSource(2))
+	boxes := make([][2][3]float32, n)
+	for i := range boxes {
+		for k := 0; k < 3; k++ {
+			size := float32(extent) * (hi[k] - lo[k])
+			min := lo[k] + rng.Float32()*(hi[k]-lo[k]-size)
+			boxes[i][0][k], boxes[i][1][k] = min, min+size
+		}
+	}
+	scanned := 0
+	start := time.Now()
+	for _, b := range boxes {
+		_, s := idx.Box(b[0], b[1])
+		scanned += s
+	}
+	return time.Since(start) / time.Duration(n), scanned / n
+}
+
+func meanStep(c *pointcloud.Cloud, lo, hi [3]float32) float64 {
+	diag := 0.0
+	for k := 0; k < 3; k++ {
+		diag += float64((hi[k] - lo[k]) * (hi[k] - lo[k]))
+	}
+	sum := 0.0
+	for i := 1; i < c.Len(); i++ {
+		x0, y0, z0 := c.Point(i - 1)
+		x1, y1, z1 := c.Point(i)
+		dx, dy, dz := float64(x1-x0), float64(y1-y0), float64(z1-z0)
+		sum += math.Sqrt(dx*dx + dy*dy + dz*dz)
+	}
+	return sum / float64(c.Len()-1) / math.Sqrt(diag)
+}
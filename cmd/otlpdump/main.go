@@ -0,0 +1,141 @@
+// Command otlpdump is a stand-in OTLP/HTTP trace collector for testing the
+// server's trace export locally. It accepts OTLP JSON on /v1/traces and
+// prints one line per span.
+//
+//	go run ./cmd/otlpdump -addr :4318
+//	go run . -otlp-endpoint http://localhost:4318
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type request struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []keyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []span `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+type span struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId"`
+	Name         string     `json:"name"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []keyValue `json:"attributes"`
+	Events       []struct {
+		Name       string     `json:"name"`
+		Attributes []keyValue `json:"attributes"`
+	} `json:"events"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type keyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func (kv keyValue) String() string {
+	for _, v := range kv.Value {
+		return fmt.Sprintf("%s=%v", kv.Key, v)
+	}
+	return kv.Key + "="
+}
+
+func main() {
+	addr := flag.String("addr", ":4318", "address to listen on")
+	raw := flag.Bool("raw", false, "print request bodies instead of spans")
+	flag.Parse()
+
+	http.HandleFunc("/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			http.Error(w, "only OTLP JSON is supported", http.StatusUnsupportedMediaType)
+			return
+		}
+		if *raw {
+			fmt.Println(string(body))
+		} else if err := dump(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	})
+	fmt.Println("Collecting traces at http://localhost" + *addr + "/v1/traces")
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// dump prints the spans of a request in start order:
+//
+//	trace-id span-id parent-id duration name [ERROR: message] attributes
+func dump(body []byte) error {
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return err
+	}
+	var spans []span
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			spans = append(spans, ss.Spans...)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return nanos(spans[i].Start) < nanos(spans[j].Start) })
+	for _, s := range spans {
+		parent := s.ParentSpanID
+		if parent == "" {
+			parent = "-"
+		}
+		line := fmt.Sprintf("%s %s %-16s %9s %s", s.TraceID, s.SpanID, parent,
+			time.Duration(nanos(s.End)-nanos(s.Start)).Round(time.Microsecond), s.Name)
+		if s.Status.Code == 2 {
+			line += " ERROR: " + s.Status.Message
+		}
+		for _, kv := range s.Attributes {
+			line += " " + kv.String()
+		}
+		for _, e := range s.Events {
+			if e.Name == "log" {
+				for _, kv := range e.Attributes {
+					line += " log: " + fmt.Sprint(kv.Value["stringValue"])
+				}
+			}
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
+
+func nanos(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -0,0 +1,187 @@
+// Package colormap maps normalized scalar values to colors. It is shared by
+// the WASM client and the server so both color points identically.
+package colormap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RGB is an sRGB color with components in [0, 1].
+type RGB struct {
+	R, G, B float64
+}
+
+// ParseHex parses a color written as "#rrggbb".
+func ParseHex(s string) (RGB, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return RGB{}, fmt.Errorf("colormap: invalid color %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return RGB{}, fmt.Errorf("colormap: invalid color %q", s)
+	}
+	return RGB{float64(v>>16&0xff) / 255, float64(v>>8&0xff) / 255, float64(v&0xff) / 255}, nil
+}
+
+// Hex formats c as "#rrggbb".
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", to8(c.R), to8(c.G), to8(c.B))
+}
+
+func to8(v float64) int {
+	return int(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+func mustHex(s string) RGB {
+	c, err := ParseHex(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Stop is a control point of a colormap.
+type Stop struct {
+	Pos   float64
+	Color RGB
+}
+
+// Space is the color space a colormap interpolates in.
+type Space string
+
+const (
+	SpaceRGB   Space = "rgb"
+	SpaceLab   Space = "lab"
+	SpaceOKLab Space = "oklab"
+)
+
+// Colormap maps [0, 1] to colors, defined by control points sorted by
+// position. It may be quantized into discrete bins, and a diverging map
+// places its midpoint at a data value rather than the middle of the range.
+type Colormap struct {
+	Name      string
+	Stops     []Stop
+	Space     Space   // interpolation space; "" means SpaceRGB
+	Bins      int     // if positive, the number of flat color bins
+	Diverging bool    // whether Normalize centers values on Center
+	Center    float64 // data value mapped to 0.5 by a diverging map
+}
+
+// Normalize maps a data value in [lo, hi] to [0, 1]. A diverging map sends
+// Center to 0.5 and scales both sides equally, so the side with the smaller
+// extent does not reach the end of the map.
+func (m *Colormap) Normalize(v, lo, hi float64) float64 {
+	if m.Diverging {
+		r := math.Max(hi-m.Center, m.Center-lo)
+		if r <= 0 {
+			return 0.5
+		}
+		return 0.5 + (v-m.Center)/(2*r)
+	}
+	if hi <= lo {
+		return 0.5
+	}
+	return (v - lo) / (hi - lo)
+}
+
+// At returns the color at t, clamped to [0, 1], interpolating between the
+// surrounding control points in the colormap's space.
+func (m *Colormap) At(t float64) RGB {
+	stops := m.Stops
+	if len(stops) == 0 {
+		return RGB{1, 1, 1}
+	}
+	if m.Bins > 0 && t == t {
+		// Sample each bin at its center.
+		bin := math.Min(math.Floor(t*float64(m.Bins)), float64(m.Bins-1))
+		t = (math.Max(bin, 0) + 0.5) / float64(m.Bins)
+	}
+	if t <= stops[0].Pos || t != t {
+		return stops[0].Color
+	}
+	i := sort.Search(len(stops), func(i int) bool { return stops[i].Pos >= t })
+	if i == len(stops) {
+		return stops[len(stops)-1].Color
+	}
+	a, b := stops[i-1], stops[i]
+	f := (t - a.Pos) / (b.Pos - a.Pos)
+	lerp := func(x, y float64) float64 { return x + f*(y-x) }
+	switch m.Space {
+	case SpaceLab:
+		p, q := a.Color.ToLab(), b.Color.ToLab()
+		return FromLab(Lab{lerp(p.L, q.L), lerp(p.A, q.A), lerp(p.B, q.B)})
+	case SpaceOKLab:
+		p, q := a.Color.ToOKLab(), b.Color.ToOKLab()
+		return FromOKLab(OKLab{lerp(p.L, q.L), lerp(p.A, q.A), lerp(p.B, q.B)})
+	}
+	return RGB{lerp(a.Color.R, b.Color.R), lerp(a.Color.G, b.Color.G), lerp(a.Color.B, b.Color.B)}
+}
+
+// Validate checks that m has at least two stops with positions in [0, 1]
+// in increasing order, and a known space.
+func (m *Colormap) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("colormap: missing name")
+	}
+	if len(m.Stops) < 2 {
+		return fmt.Errorf("colormap %s: need at least two stops", m.Name)
+	}
+	for i, s := range m.Stops {
+		if s.Pos < 0 || s.Pos > 1 || s.Pos != s.Pos {
+			return fmt.Errorf("colormap %s: stop %d position %g outside [0, 1]", m.Name, i+1, s.Pos)
+		}
+		if i > 0 && s.Pos <= m.Stops[i-1].Pos {
+			return fmt.Errorf("colormap %s: stop positions must increase", m.Name)
+		}
+	}
+	switch m.Space {
+	case "", SpaceRGB, SpaceLab, SpaceOKLab:
+	default:
+		return fmt.Errorf("colormap %s: unknown color space %q", m.Name, m.Space)
+	}
+	if m.Bins < 0 {
+		return fmt.Errorf("colormap %s: negative bin count", m.Name)
+	}
+	return nil
+}
+
+// uniform builds a colormap from evenly spaced hex colors.
+func uniform(name string, hex ...string) *Colormap {
+	m := &Colormap{Name: name}
+	for i, h := range hex {
+		m.Stops = append(m.Stops, Stop{float64(i) / float64(len(hex)-1), mustHex(h)})
+	}
+	return m
+}
+
+var builtins = []*Colormap{
+	uniform("viridis", "#440154", "#472d7b", "#3b528b", "#2c728e", "#21918c", "#28ae80", "#5ec962", "#addc30", "#fde725"),
+	uniform("magma", "#000004", "#1c1044", "#4f127b", "#812581", "#b5367a", "#e55064", "#fb8761", "#fec287", "#fcfdbf"),
+	uniform("plasma", "#0d0887", "#4c02a1", "#7e03a8", "#a92395", "#cc4778", "#e56b5d", "#f89441", "#fdc328", "#f0f921"),
+	uniform("coolwarm", "#3b4cc0", "#dddddd", "#b40426"),
+	uniform("grayscale", "#000000", "#ffffff"),
+}
+
+// Get returns the built-in colormap with the given name.
+func Get(name string) (*Colormap, bool) {
+	for _, m := range builtins {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Names returns the names of the built-in colormaps.
+func Names() []string {
+	names := make([]string, len(builtins))
+	for i, m := range builtins {
+		names[i] = m.Name
+	}
+	return names
+}
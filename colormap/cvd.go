@@ -0,0 +1,113 @@
+package colormap
+
+import "fmt"
+
+// Deficiency is a type of color vision deficiency.
+type Deficiency int
+
+const (
+	NormalVision Deficiency = iota
+	Protanopia
+	Deuteranopia
+	Tritanopia
+)
+
+var deficiencyNames = [...]string{"none", "protanopia", "deuteranopia", "tritanopia"}
+
+func (d Deficiency) String() string {
+	return deficiencyNames[d]
+}
+
+// ParseDeficiency parses a name returned by Deficiency.String.
+func ParseDeficiency(name string) (Deficiency, error) {
+	for i, n := range deficiencyNames {
+		if n == name {
+			return Deficiency(i), nil
+		}
+	}
+	return NormalVision, fmt.Errorf("colormap: unknown color vision deficiency %q", name)
+}
+
+// Deficiencies lists the simulated deficiencies, excluding normal vision.
+var Deficiencies = []Deficiency{Protanopia, Deuteranopia, Tritanopia}
+
+// cvdMatrices are the full-severity simulation matrices of Machado,
+// Oliveira and Fernandes (2009), applied to linear RGB, in row-major order.
+var cvdMatrices = [...][9]float64{
+	NormalVision: {1, 0, 0, 0, 1, 0, 0, 0, 1},
+	Protanopia: {
+		0.152286, 1.052583, -0.204868,
+		0.114503, 0.786281, 0.099216,
+		-0.003882, -0.048116, 1.051998,
+	},
+	Deuteranopia: {
+		0.367322, 0.860646, -0.227968,
+		0.280085, 0.672501, 0.047413,
+		-0.011820, 0.042940, 0.968881,
+	},
+	Tritanopia: {
+		1.255528, -0.076749, -0.178779,
+		-0.078411, 0.930809, 0.147602,
+		0.004733, 0.691367, 0.303900,
+	},
+}
+
+// Matrix returns the row-major linear-RGB simulation matrix for d, for use
+// in shaders.
+func (d Deficiency) Matrix() [9]float64 {
+	return cvdMatrices[d]
+}
+
+// Simulate returns how c appears to a viewer with deficiency d.
+func Simulate(c RGB, d Deficiency) RGB {
+	m := &cvdMatrices[d]
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	return fromLinear(
+		m[0]*r+m[1]*g+m[2]*b,
+		m[3]*r+m[4]*g+m[5]*b,
+		m[6]*r+m[7]*g+m[8]*b,
+	)
+}
+
+// MinDeltaE is the CIEDE2000 difference below which CheckPalette reports
+// two categorical colors as indistinguishable.
+const MinDeltaE = 10
+
+// Conflict reports two palette entries that are hard to tell apart.
+type Conflict struct {
+	I, J       int
+	Deficiency Deficiency
+	DeltaE     float64
+}
+
+func (c Conflict) String() string {
+	if c.Deficiency == NormalVision {
+		return fmt.Sprintf("colors %d and %d are hard to distinguish (ΔE %.1f)", c.I+1, c.J+1, c.DeltaE)
+	}
+	return fmt.Sprintf("colors %d and %d are hard to distinguish under %s (ΔE %.1f)", c.I+1, c.J+1, c.Deficiency, c.DeltaE)
+}
+
+// CheckPalette compares every pair of colors under normal vision and each
+// simulated deficiency and returns the pairs closer than MinDeltaE. Each
+// pair is reported once, for the first condition under which it fails.
+func CheckPalette(colors []RGB) []Conflict {
+	var conflicts []Conflict
+	conditions := append([]Deficiency{NormalVision}, Deficiencies...)
+	labs := make([][]Lab, len(conditions))
+	for k, d := range conditions {
+		for _, c := range colors {
+			labs[k] = append(labs[k], Simulate(c, d).ToLab())
+		}
+	}
+	for i := range colors {
+		for j := i + 1; j < len(colors); j++ {
+			for k, d := range conditions {
+				if de := DeltaE2000(labs[k][i], labs[k][j]); de < MinDeltaE {
+					conflicts = append(conflicts, Conflict{i, j, d, de})
+					break
+				}
+			}
+		}
+	}
+	return conflicts
+}
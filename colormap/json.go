@@ -0,0 +1,78 @@
+package colormap
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The JSON form of a colormap is
+//
+//	{"name": "ice", "space": "oklab", "bins": 0,
+//	 "diverging": true, "center": 0,
+//	 "stops": [{"pos": 0, "color": "#08306b"}, {"pos": 1, "color": "#f7fbff"}]}
+//
+// Conversion goes through the generic values produced by decoding JSON
+// into an interface{} rather than struct tags, which keeps the package free
+// of reflection for the TinyGo client build.
+
+// ToJSON returns m as a value ready for JSON encoding.
+func (m *Colormap) ToJSON() map[string]interface{} {
+	stops := make([]interface{}, len(m.Stops))
+	for i, s := range m.Stops {
+		stops[i] = map[string]interface{}{"pos": s.Pos, "color": s.Color.Hex()}
+	}
+	space := m.Space
+	if space == "" {
+		space = SpaceRGB
+	}
+	return map[string]interface{}{
+		"name":      m.Name,
+		"space":     string(space),
+		"bins":      float64(m.Bins),
+		"diverging": m.Diverging,
+		"center":    m.Center,
+		"stops":     stops,
+	}
+}
+
+// FromJSON builds a colormap from a decoded JSON object. Stops are sorted
+// by position and the result is validated.
+func FromJSON(v interface{}) (*Colormap, error) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("colormap: definition is not an object")
+	}
+	m := &Colormap{}
+	m.Name, _ = obj["name"].(string)
+	space, _ := obj["space"].(string)
+	m.Space = Space(space)
+	bins, _ := obj["bins"].(float64)
+	m.Bins = int(bins)
+	m.Diverging, _ = obj["diverging"].(bool)
+	m.Center, _ = obj["center"].(float64)
+	stops, ok := obj["stops"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("colormap %s: missing stops", m.Name)
+	}
+	for i, sv := range stops {
+		so, ok := sv.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("colormap %s: stop %d is not an object", m.Name, i+1)
+		}
+		pos, ok := so["pos"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("colormap %s: stop %d has no position", m.Name, i+1)
+		}
+		hex, _ := so["color"].(string)
+		c, err := ParseHex(hex)
+		if err != nil {
+			return nil, fmt.Errorf("colormap %s: stop %d: %v", m.Name, i+1, err)
+		}
+		m.Stops = append(m.Stops, Stop{pos, c})
+	}
+	sort.SliceStable(m.Stops, func(i, j int) bool { return m.Stops[i].Pos < m.Stops[j].Pos })
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,166 @@
+package colormap
+
+import "math"
+
+// Lab is a color in CIELAB (D65 white point).
+type Lab struct {
+	L, A, B float64
+}
+
+// linear converts an sRGB component to linear light.
+func linear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// gamma converts a linear-light component to sRGB.
+func gamma(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// D65 reference white in XYZ.
+const xn, yn, zn = 0.95047, 1.0, 1.08883
+
+// ToLab converts c to CIELAB.
+func (c RGB) ToLab() Lab {
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / xn
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / yn
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / zn
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return Lab{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// DeltaE2000 returns the CIEDE2000 color difference between a and b. A
+// difference below about 10 is hard to tell apart on small marks such as
+// points.
+func DeltaE2000(a, b Lab) float64 {
+	const pow25_7 = 6103515625.0 // 25^7
+	deg := math.Pi / 180
+
+	c1, c2 := math.Hypot(a.A, a.B), math.Hypot(b.A, b.B)
+	cbar7 := math.Pow((c1+c2)/2, 7)
+	g := 0.5 * (1 - math.Sqrt(cbar7/(cbar7+pow25_7)))
+	a1, a2 := (1+g)*a.A, (1+g)*b.A
+	c1p, c2p := math.Hypot(a1, a.B), math.Hypot(a2, b.B)
+	hue := func(b, a float64) float64 {
+		if a == 0 && b == 0 {
+			return 0
+		}
+		h := math.Atan2(b, a) / deg
+		if h < 0 {
+			h += 360
+		}
+		return h
+	}
+	h1p, h2p := hue(a.B, a1), hue(b.B, a2)
+
+	dL := b.L - a.L
+	dC := c2p - c1p
+	var dh float64
+	if c1p*c2p != 0 {
+		dh = h2p - h1p
+		if dh > 180 {
+			dh -= 360
+		} else if dh < -180 {
+			dh += 360
+		}
+	}
+	dH := 2 * math.Sqrt(c1p*c2p) * math.Sin(dh/2*deg)
+
+	lbar := (a.L + b.L) / 2
+	cbar := (c1p + c2p) / 2
+	hbar := h1p + h2p
+	if c1p*c2p != 0 {
+		switch {
+		case math.Abs(h1p-h2p) <= 180:
+			hbar /= 2
+		case h1p+h2p < 360:
+			hbar = (hbar + 360) / 2
+		default:
+			hbar = (hbar - 360) / 2
+		}
+	}
+	t := 1 - 0.17*math.Cos((hbar-30)*deg) + 0.24*math.Cos(2*hbar*deg) +
+		0.32*math.Cos((3*hbar+6)*deg) - 0.20*math.Cos((4*hbar-63)*deg)
+	dTheta := 30 * math.Exp(-math.Pow((hbar-275)/25, 2))
+	cbarp7 := math.Pow(cbar, 7)
+	rc := 2 * math.Sqrt(cbarp7/(cbarp7+pow25_7))
+	sl := 1 + 0.015*(lbar-50)*(lbar-50)/math.Sqrt(20+(lbar-50)*(lbar-50))
+	sc := 1 + 0.045*cbar
+	sh := 1 + 0.015*cbar*t
+	rt := -math.Sin(2*dTheta*deg) * rc
+
+	l, c, h := dL/sl, dC/sc, dH/sh
+	return math.Sqrt(l*l + c*c + h*h + rt*c*h)
+}
+
+// FromLab converts a CIELAB color to sRGB, clamping out-of-gamut colors.
+func FromLab(l Lab) RGB {
+	fy := (l.L + 16) / 116
+	fx := fy + l.A/500
+	fz := fy - l.B/200
+	finv := func(f float64) float64 {
+		if f*f*f > 216.0/24389 {
+			return f * f * f
+		}
+		return (116*f - 16) * 27 / 24389
+	}
+	x, y, z := finv(fx)*xn, finv(fy)*yn, finv(fz)*zn
+	return fromLinear(
+		3.2404542*x-1.5371385*y-0.4985314*z,
+		-0.9692660*x+1.8760108*y+0.0415560*z,
+		0.0556434*x-0.2040259*y+1.0572252*z,
+	)
+}
+
+// OKLab is a color in Björn Ottosson's OKLab space, which is more
+// perceptually uniform than CIELAB for interpolation.
+type OKLab struct {
+	L, A, B float64
+}
+
+// ToOKLab converts c to OKLab.
+func (c RGB) ToOKLab() OKLab {
+	r, g, b := linear(c.R), linear(c.G), linear(c.B)
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return OKLab{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+// FromOKLab converts an OKLab color to sRGB, clamping out-of-gamut colors.
+func FromOKLab(o OKLab) RGB {
+	l := o.L + 0.3963377774*o.A + 0.2158037573*o.B
+	m := o.L - 0.1055613458*o.A - 0.0638541728*o.B
+	s := o.L - 0.0894841775*o.A - 1.2914855480*o.B
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return fromLinear(
+		4.0767416621*l-3.3077115913*m+0.2309699292*s,
+		-1.2684380046*l+2.6097574011*m-0.3413193965*s,
+		-0.0041960863*l-0.7034186147*m+1.7076147010*s,
+	)
+}
+
+// fromLinear clamps linear RGB to the gamut and encodes it as sRGB.
+func fromLinear(r, g, b float64) RGB {
+	clamp := func(v float64) float64 {
+		return gamma(math.Max(0, math.Min(1, v)))
+	}
+	return RGB{clamp(r), clamp(g), clamp(b)}
+}
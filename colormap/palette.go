@@ -0,0 +1,47 @@
+package colormap
+
+// Palette is an ordered list of colors for categorical data.
+type Palette struct {
+	Name   string
+	Colors []RGB
+}
+
+// At returns the color for category i, cycling when there are more
+// categories than colors.
+func (p *Palette) At(i int) RGB {
+	return p.Colors[i%len(p.Colors)]
+}
+
+func palette(name string, hex ...string) *Palette {
+	p := &Palette{Name: name}
+	for _, h := range hex {
+		p.Colors = append(p.Colors, mustHex(h))
+	}
+	return p
+}
+
+var palettes = []*Palette{
+	palette("tab10", "#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"),
+	// Okabe and Ito's palette, designed to stay distinct under color vision
+	// deficiencies, with gray in place of black for dark backgrounds.
+	palette("okabe-ito", "#e69f00", "#56b4e9", "#009e73", "#f0e442", "#0072b2", "#d55e00", "#cc79a7", "#999999"),
+}
+
+// GetPalette returns the built-in palette with the given name.
+func GetPalette(name string) (*Palette, bool) {
+	for _, p := range palettes {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// PaletteNames returns the names of the built-in palettes.
+func PaletteNames() []string {
+	names := make([]string, len(palettes))
+	for i, p := range palettes {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+// A thread is a review comment on a dataset with its replies. Datasets are
+// identified as the client loads them: the name plus the options query
+// string, if any, since the same generator with other options produces
+// other points.
+type thread struct {
+	ID       string    `json:"id"`
+	Dataset  string    `json:"dataset"`
+	Anchor   anchor    `json:"anchor"`
+	Author   string    `json:"author"`
+	Text     string    `json:"text"` // Markdown
+	Created  time.Time `json:"created"`
+	Resolved bool      `json:"resolved"`
+	Replies  []reply   `json:"replies"`
+}
+
+type reply struct {
+	Author  string    `json:"author"`
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+}
+
+// An anchor is what a thread is about: a point, by its original ID; a
+// location in data coordinates; or a view, as captured by the client.
+type anchor struct {
+	Kind  string                 `json:"kind"` // "point", "location" or "view"
+	Point *uint32                `json:"point,omitempty"`
+	At    []float64              `json:"at,omitempty"`
+	View  map[string]interface{} `json:"view,omitempty"`
+}
+
+// Limits on what clients may post. Posts over the size limits are
+// answered with 413 and posts past the count limits with 429.
+const (
+	maxAuthorLen  = 100
+	maxCommentLen = 10000
+	maxDatasetLen = 2000
+	maxViewLen    = 16 << 10 // bytes of view JSON
+	maxThreads    = 10000
+	maxReplies    = 1000 // per thread
+)
+
+// commentStore holds the comment threads, saved as JSON to path after
+// every change. An empty path keeps them in memory only.
+type commentStore struct {
+	path string
+
+	mu      sync.Mutex
+	threads map[string]*thread
+}
+
+// comments is the server's comment store; it is set up in main.
+var comments *commentStore
+
+// openCommentStore loads the threads saved at path, if any.
+func openCommentStore(path string) (*commentStore, error) {
+	s := &commentStore{path: path, threads: map[string]*thread{}}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if len(b) > 0 {
+			var list []*thread
+			if err := json.Unmarshal(b, &list); err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			for _, t := range list {
+				s.threads[t.ID] = t
+			}
+		}
+	}
+	registerMetric("threedistvis_comment_threads", "gauge", "Comment threads by resolve status.", func() []sample {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var open, resolved float64
+		for _, t := range s.threads {
+			if t.Resolved {
+				resolved++
+			} else {
+				open++
+			}
+		}
+		return []sample{{labels: labels("status", "open"), value: open}, {labels: labels("status", "resolved"), value: resolved}}
+	})
+	return s, nil
+}
+
+// save writes all threads to the store's file, replacing it atomically.
+// The caller holds s.mu.
+func (s *commentStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(s.sorted(""), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".comments-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// sorted returns the threads on dataset, or all threads if dataset is
+// empty, oldest first. The caller holds s.mu.
+func (s *commentStore) sorted(dataset string) []*thread {
+	list := []*thread{}
+	for _, t := range s.threads {
+		if dataset == "" || t.Dataset == dataset {
+			list = append(list, t)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.Before(list[j].Created)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// list returns copies of the threads on dataset, safe to use after the
+// store changes.
+func (s *commentStore) list(dataset string) []thread {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []thread{}
+	for _, t := range s.sorted(dataset) {
+		c := *t
+		c.Replies = append([]reply{}, t.Replies...)
+		list = append(list, c)
+	}
+	return list
+}
+
+// update applies change to a copy of the thread with the given ID and
+// saves the store, returning a copy of the updated thread. A nil change
+// adds t as a new thread. If change fails or saving fails the store is
+// left as it was.
+func (s *commentStore) update(id string, t *thread, change func(*thread) error) (thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if change != nil {
+		old, ok := s.threads[id]
+		if !ok {
+			return thread{}, errNoThread
+		}
+		c := *old
+		c.Replies = append([]reply{}, old.Replies...)
+		t = &c
+		if err := change(t); err != nil {
+			return thread{}, err
+		}
+	} else if len(s.threads) >= maxThreads {
+		return thread{}, errTooManyThreads
+	}
+	old, existed := s.threads[t.ID]
+	s.threads[t.ID] = t
+	if err := s.save(); err != nil {
+		if existed {
+			s.threads[t.ID] = old
+		} else {
+			delete(s.threads, t.ID)
+		}
+		return thread{}, err
+	}
+	c := *t
+	c.Replies = append([]reply{}, t.Replies...)
+	return c, nil
+}
+
+func (s *commentStore) delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.threads[id]
+	if !ok {
+		return errNoThread
+	}
+	delete(s.threads, id)
+	if err := s.save(); err != nil {
+		s.threads[id] = t
+		return err
+	}
+	return nil
+}
+
+var (
+	errNoThread       = errors.New("no such comment thread")
+	errTooManyThreads = fmt.Errorf("at most %d comment threads", maxThreads)
+	errTooManyReplies = fmt.Errorf("at most %d replies per thread", maxReplies)
+)
+
+func newThreadID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// checkPost validates the author and text of a comment or reply.
+func checkPost(author, text string) error {
+	switch {
+	case strings.TrimSpace(author) == "":
+		return errors.New("author is required")
+	case len(author) > maxAuthorLen:
+		return fmt.Errorf("author is longer than %d bytes", maxAuthorLen)
+	case strings.TrimSpace(text) == "":
+		return errors.New("text is required")
+	case len(text) > maxCommentLen:
+		return fmt.Errorf("text is longer than %d bytes", maxCommentLen)
+	}
+	return nil
+}
+
+func (a anchor) check() error {
+	switch a.Kind {
+	case "point":
+		if a.Point == nil {
+			return errors.New("a point anchor needs a point ID")
+		}
+	case "location":
+		if len(a.At) != 3 {
+			return errors.New("a location anchor needs x, y and z")
+		}
+	case "view":
+		if a.View == nil {
+			return errors.New("a view anchor needs a view")
+		}
+	default:
+		return fmt.Errorf("unknown anchor kind %q", a.Kind)
+	}
+	return nil
+}
+
+// handleComments serves the comments API:
+//
+//	GET    /api/comments/?dataset=name      threads on a dataset
+//	POST   /api/comments/                   new thread: {dataset, anchor, author, text}
+//	POST   /api/comments/{id}/replies       reply: {author, text}
+//	PATCH  /api/comments/{id}               {resolved}
+//	DELETE /api/comments/{id}
+//
+// Changed and created threads are returned as JSON.
+func handleComments(w http.ResponseWriter, r *http.Request) {
+	id, op, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/comments/"), "/")
+	body := http.MaxBytesReader(w, r.Body, 1<<20)
+	var (
+		t      thread
+		err    error
+		status = http.StatusOK
+	)
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		dataset := r.URL.Query().Get("dataset")
+		if dataset == "" {
+			http.Error(w, "dataset is required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(comments.list(dataset))
+		return
+	case id == "" && r.Method == http.MethodPost:
+		var post thread
+		if err := json.NewDecoder(body).Decode(&post); err != nil {
+			http.Error(w, fmt.Sprintf("comment: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := checkPost(post.Author, post.Text); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := post.Anchor.check(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if post.Dataset == "" {
+			http.Error(w, "dataset is required", http.StatusBadRequest)
+			return
+		}
+		if len(post.Dataset) > maxDatasetLen {
+			http.Error(w, fmt.Sprintf("dataset is longer than %d bytes", maxDatasetLen), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if view, _ := json.Marshal(post.Anchor.View); len(view) > maxViewLen {
+			http.Error(w, fmt.Sprintf("view is longer than %d bytes", maxViewLen), http.StatusRequestEntityTooLarge)
+			return
+		}
+		post.ID, post.Created, post.Resolved, post.Replies = newThreadID(), time.Now().UTC(), false, []reply{}
+		if span := trace.FromContext(r.Context()); span != nil {
+			span.Set("comment.id", post.ID, "comment.dataset", post.Dataset)
+		}
+		t, err = comments.update("", &post, nil)
+		status = http.StatusCreated
+	case id != "" && op == "replies" && r.Method == http.MethodPost:
+		var post reply
+		if err := json.NewDecoder(body).Decode(&post); err != nil {
+			http.Error(w, fmt.Sprintf("reply: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := checkPost(post.Author, post.Text); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		post.Created = time.Now().UTC()
+		t, err = comments.update(id, nil, func(t *thread) error {
+			if len(t.Replies) >= maxReplies {
+				return errTooManyReplies
+			}
+			t.Replies = append(t.Replies, post)
+			return nil
+		})
+	case id != "" && op == "" && r.Method == http.MethodPatch:
+		var patch struct {
+			Resolved *bool `json:"resolved"`
+		}
+		if err := json.NewDecoder(body).Decode(&patch); err != nil || patch.Resolved == nil {
+			http.Error(w, "expected {\"resolved\": true|false}", http.StatusBadRequest)
+			return
+		}
+		t, err = comments.update(id, nil, func(t *thread) error {
+			t.Resolved = *patch.Resolved
+			return nil
+		})
+	case id != "" && op == "" && r.Method == http.MethodDelete:
+		if err = comments.delete(id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case errors.Is(err, errNoThread):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errTooManyThreads), errors.Is(err, errTooManyReplies):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	case err != nil:
+		trace.Println(r.Context(), "Comment store error:", err)
+		http.Error(w, "could not save comments", http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(t)
+	}
+}
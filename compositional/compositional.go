@@ -0,0 +1,341 @@
+// Package compositional handles compositional data: vectors of positive
+// parts that carry only relative information, such as the proportions of a
+// mixture. It provides the log-ratio transforms, the Dirichlet and
+// logistic-normal distributions, and the embedding of 3-part compositions
+// in a triangle and 4-part compositions in a tetrahedron.
+package compositional
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/sampling"
+)
+
+// Closure rescales x to sum to 1.
+func Closure(x []float64) []float64 {
+	var sum float64
+	for _, v := range x {
+		sum += v
+	}
+	c := make([]float64, len(x))
+	for i, v := range x {
+		c[i] = v / sum
+	}
+	return c
+}
+
+// positive reports whether every part is positive, as the log-ratio
+// transforms require.
+func positive(x []float64) bool {
+	for _, v := range x {
+		if !(v > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// CLR returns the centered log-ratio transform: the log of each part over
+// the geometric mean of all parts. The coordinates sum to 0.
+func CLR(x []float64) []float64 {
+	var mean float64
+	for _, v := range x {
+		mean += math.Log(v)
+	}
+	mean /= float64(len(x))
+	z := make([]float64, len(x))
+	for i, v := range x {
+		z[i] = math.Log(v) - mean
+	}
+	return z
+}
+
+// ALR returns the additive log-ratio transform: the log of each part but
+// the last over the last.
+func ALR(x []float64) []float64 {
+	d := len(x) - 1
+	z := make([]float64, d)
+	for i := range z {
+		z[i] = math.Log(x[i] / x[d])
+	}
+	return z
+}
+
+// ILR returns the isometric log-ratio transform in the pivot basis:
+// coordinate i balances part i against the geometric mean of the parts
+// after it. Unlike ALR it preserves distances between compositions.
+func ILR(x []float64) []float64 {
+	d := len(x)
+	z := make([]float64, d-1)
+	for i := range z {
+		var rest float64
+		for _, v := range x[i+1:] {
+			rest += math.Log(v)
+		}
+		m := float64(d - i - 1)
+		z[i] = math.Sqrt(m/(m+1)) * (math.Log(x[i]) - rest/m)
+	}
+	return z
+}
+
+// Vertices returns the corners of the simplex that compositions of d
+// parts are drawn in: an equilateral triangle in the xy-plane for three
+// parts and a regular tetrahedron standing on its base for four. Both are
+// centered at the origin with circumradius 1.
+func Vertices(d int) [][3]float64 {
+	switch d {
+	case 3:
+		s := math.Sqrt(3) / 2
+		return [][3]float64{{0, 1, 0}, {-s, -0.5, 0}, {s, -0.5, 0}}
+	case 4:
+		r := math.Sqrt(8) / 3
+		v := [][3]float64{{0, 1, 0}}
+		for _, a := range []float64{90, 210, 330} {
+			t := a * math.Pi / 180
+			v = append(v, [3]float64{r * math.Cos(t), -1.0 / 3, r * math.Sin(t)})
+		}
+		return v
+	}
+	return nil
+}
+
+// Embed returns the point of the simplex with barycentric coordinates
+// given by the closed composition x.
+func Embed(x []float64) [3]float64 {
+	var p [3]float64
+	vertices := Vertices(len(x))
+	for i, w := range Closure(x) {
+		for k := range p {
+			p[k] += w * vertices[i][k]
+		}
+	}
+	return p
+}
+
+// Transforms lists the coordinates compositions can be shown in: the
+// simplex itself or one of the log-ratio transforms.
+var Transforms = []string{"simplex", "ilr", "alr", "clr"}
+
+// coordinates returns the 3D position of x under the named transform.
+func coordinates(transform string, x []float64) ([3]float64, error) {
+	var p [3]float64
+	var z []float64
+	switch transform {
+	case "simplex":
+		return Embed(x), nil
+	case "ilr":
+		z = ILR(x)
+	case "alr":
+		z = ALR(x)
+	case "clr":
+		if len(x) > 3 {
+			return p, errors.New("compositional: clr of more than 3 parts has too many coordinates to show; use ilr, which is clr in an orthonormal basis")
+		}
+		z = CLR(x)
+	default:
+		return p, fmt.Errorf("compositional: unknown transform %q", transform)
+	}
+	copy(p[:], z)
+	return p, nil
+}
+
+// Cloud returns compositions of three or four named parts as points in the
+// coordinates of the named transform, with the parts of the closed
+// compositions and their clr coordinates as attributes. In the simplex
+// the cloud records the part names, which label the simplex vertices.
+func Cloud(name string, parts []string, comps [][]float64, transform string) (*pointcloud.Cloud, error) {
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, fmt.Errorf("compositional: need 3 or 4 parts, got %d", len(parts))
+	}
+	c := pointcloud.New(name, len(comps))
+	values := make([][]float32, 2*len(parts))
+	for k := range values {
+		values[k] = make([]float32, len(comps))
+	}
+	for i, x := range comps {
+		if len(x) != len(parts) {
+			return nil, fmt.Errorf("compositional: composition %d has %d parts, want %d", i+1, len(x), len(parts))
+		}
+		ok := positive(x)
+		if !ok && transform != "simplex" {
+			return nil, fmt.Errorf("compositional: composition %d has a part that is not positive, which log-ratios cannot show", i+1)
+		}
+		p, err := coordinates(transform, x)
+		if err != nil {
+			return nil, err
+		}
+		c.SetPoint(i, float32(p[0]), float32(p[1]), float32(p[2]))
+		for k, v := range Closure(x) {
+			values[k][i] = float32(v)
+		}
+		for k := range parts {
+			values[len(parts)+k][i] = float32(math.NaN())
+		}
+		if ok {
+			for k, v := range CLR(x) {
+				values[len(parts)+k][i] = float32(v)
+			}
+		}
+	}
+	for k, part := range parts {
+		c.SetAttribute(part, values[k])
+	}
+	for k, part := range parts {
+		c.SetAttribute("clr "+part, values[len(parts)+k])
+	}
+	if transform == "simplex" {
+		c.Parts = parts
+	}
+	return c, nil
+}
+
+// Parts returns the default part names x1, x2, … for d parts.
+func Parts(d int) []string {
+	parts := make([]string, d)
+	for k := range parts {
+		parts[k] = "x" + strconv.Itoa(k+1)
+	}
+	return parts
+}
+
+// Dirichlet draws n compositions of three or four parts from the
+// Dirichlet distribution with the given concentrations, one per part.
+func Dirichlet(alpha []float64, n int, rng *rand.Rand) ([][]float64, error) {
+	if len(alpha) < 3 || len(alpha) > 4 {
+		return nil, fmt.Errorf("compositional: need 3 or 4 concentrations, got %d", len(alpha))
+	}
+	for _, a := range alpha {
+		if !(a > 0) || math.IsInf(a, 1) {
+			return nil, fmt.Errorf("compositional: concentration %v is not positive", a)
+		}
+	}
+	comps := make([][]float64, n)
+	for i := range comps {
+		// Small concentrations give gamma variates too small for a
+		// float64, so they are drawn as logs and scaled by the largest
+		// before closing: that part is 1 and the sum cannot vanish.
+		x := make([]float64, len(alpha))
+		largest := math.Inf(-1)
+		for k, a := range alpha {
+			x[k] = logGammaVariate(a, rng)
+			largest = math.Max(largest, x[k])
+		}
+		for k := range x {
+			x[k] = math.Exp(x[k] - largest)
+		}
+		comps[i] = Closure(x)
+	}
+	return comps, nil
+}
+
+// logGammaVariate draws the log of a variate from the gamma distribution
+// with shape a and scale 1 by the method of Marsaglia and Tsang.
+func logGammaVariate(a float64, rng *rand.Rand) float64 {
+	if a < 1 {
+		// Boost the shape and correct with a uniform power.
+		return logGammaVariate(a+1, rng) + math.Log(rng.Float64())/a
+	}
+	d := a - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		z := rng.NormFloat64()
+		v := 1 + c*z
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if math.Log(u) < z*z/2+d-d*v+d*math.Log(v) {
+			return math.Log(d * v)
+		}
+	}
+}
+
+// LogisticNormal draws n compositions whose alr coordinates are Gaussian
+// with the given mean, one per part but the last, and covariance
+// sigma²((1-rho)I + rho 11ᵀ): equal variances and equal correlations rho.
+func LogisticNormal(mean []float64, sigma, rho float64, n int, rng *rand.Rand) ([][]float64, error) {
+	d := len(mean)
+	if d < 2 || d > 3 {
+		return nil, fmt.Errorf("compositional: need 2 or 3 alr means, got %d", d)
+	}
+	if !(sigma > 0) {
+		return nil, fmt.Errorf("compositional: sigma %v is not positive", sigma)
+	}
+	// Pad the covariance to 3x3 with a unit variance for an unused
+	// coordinate.
+	cov := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for i := 0; i < d; i++ {
+		for j := 0; j < d; j++ {
+			cov[i][j] = sigma * sigma * rho
+			if i == j {
+				cov[i][j] = sigma * sigma
+			}
+		}
+	}
+	l, ok := sampling.Cholesky(cov)
+	if !ok {
+		return nil, fmt.Errorf("compositional: correlation %v is not valid for %d coordinates", rho, d)
+	}
+	comps := make([][]float64, n)
+	for i := range comps {
+		var z [3]float64
+		for k := range z {
+			z[k] = rng.NormFloat64()
+		}
+		x := make([]float64, d+1)
+		x[d] = 1
+		for r := 0; r < d; r++ {
+			s := mean[r]
+			for k := 0; k <= r; k++ {
+				s += l[r][k] * z[k]
+			}
+			x[r] = math.Exp(s)
+		}
+		comps[i] = Closure(x)
+	}
+	return comps, nil
+}
+
+// ReadTable reads compositions from a table with a header naming three or
+// four parts and one row per composition, comma- or tab-separated. Lines
+// starting with # are comments. Rows need not be closed.
+func ReadTable(r io.Reader) (parts []string, comps [][]float64, err error) {
+	records, err := pointcloud.ReadRecords(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("compositional: %v", err)
+	}
+	if len(records) < 2 {
+		return nil, nil, errors.New("compositional: table has no rows")
+	}
+	for _, p := range records[0] {
+		parts = append(parts, strings.TrimSpace(p))
+	}
+	if len(parts) < 3 || len(parts) > 4 {
+		return nil, nil, fmt.Errorf("compositional: need 3 or 4 parts, got %d columns", len(parts))
+	}
+	for i, row := range records[1:] {
+		x := make([]float64, len(row))
+		var sum float64
+		for k, f := range row {
+			v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+			if err != nil || !(v >= 0) || math.IsInf(v, 1) {
+				return nil, nil, fmt.Errorf("compositional: row %d: invalid part %q", i+2, f)
+			}
+			x[k] = v
+			sum += v
+		}
+		if sum == 0 {
+			return nil, nil, fmt.Errorf("compositional: row %d is empty", i+2)
+		}
+		comps = append(comps, x)
+	}
+	return parts, comps, nil
+}
@@ -0,0 +1,179 @@
+package compositional
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func dist(a, b []float64) float64 {
+	var s float64
+	for i := range a {
+		s += (a[i] - b[i]) * (a[i] - b[i])
+	}
+	return math.Sqrt(s)
+}
+
+func sum(x []float64) float64 {
+	var s float64
+	for _, v := range x {
+		s += v
+	}
+	return s
+}
+
+func randomComposition(d int, rng *rand.Rand) []float64 {
+	x := make([]float64, d)
+	for k := range x {
+		x[k] = math.Exp(2 * rng.NormFloat64())
+	}
+	return x
+}
+
+// TestILRIsometry checks that ILR coordinates preserve the Aitchison
+// distance, which is the Euclidean distance between clr coordinates, and
+// that the transforms ignore the scale of a composition.
+func TestILRIsometry(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, d := range []int{3, 4, 6} {
+		for i := 0; i < 100; i++ {
+			x, y := randomComposition(d, rng), randomComposition(d, rng)
+			aitchison := dist(CLR(x), CLR(y))
+			if got := dist(ILR(x), ILR(y)); math.Abs(got-aitchison) > 1e-9*(1+aitchison) {
+				t.Fatalf("%d parts: ILR distance %v, Aitchison distance %v", d, got, aitchison)
+			}
+			if s := sum(CLR(x)); math.Abs(s) > 1e-9 {
+				t.Fatalf("%d parts: clr coordinates sum to %v", d, s)
+			}
+			scaled := make([]float64, d)
+			for k, v := range x {
+				scaled[k] = 7 * v
+			}
+			if dist(ILR(x), ILR(scaled)) > 1e-9 || dist(ALR(x), ALR(scaled)) > 1e-9 || dist(CLR(x), CLR(scaled)) > 1e-9 {
+				t.Fatalf("%d parts: transforms depend on the scale of %v", d, x)
+			}
+		}
+	}
+}
+
+// TestInverses recovers the closed composition from its alr and clr
+// coordinates.
+func TestInverses(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 100; i++ {
+		x := randomComposition(4, rng)
+		closed := Closure(x)
+		var fromALR, fromCLR []float64
+		for _, z := range ALR(x) {
+			fromALR = append(fromALR, math.Exp(z))
+		}
+		fromALR = append(fromALR, 1)
+		for _, z := range CLR(x) {
+			fromCLR = append(fromCLR, math.Exp(z))
+		}
+		if dist(Closure(fromALR), closed) > 1e-12 || dist(Closure(fromCLR), closed) > 1e-12 {
+			t.Fatalf("inverse transforms of %v give %v and %v", closed, Closure(fromALR), Closure(fromCLR))
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	for _, d := range []int{3, 4} {
+		vertices := Vertices(d)
+		x := make([]float64, d)
+		for k := range x {
+			x[k] = 2
+		}
+		if c := Embed(x); math.Abs(c[0])+math.Abs(c[1])+math.Abs(c[2]) > 1e-12 {
+			t.Errorf("%d parts: the barycenter embeds at %v, not the origin", d, c)
+		}
+		for k := range x {
+			e := make([]float64, d)
+			e[k] = 3
+			if p := Embed(e); dist(p[:], vertices[k][:]) > 1e-12 {
+				t.Errorf("%d parts: part %d alone embeds at %v, not vertex %v", d, k+1, p, vertices[k])
+			}
+			if r := dist(vertices[k][:], []float64{0, 0, 0}); math.Abs(r-1) > 1e-12 {
+				t.Errorf("%d parts: vertex %d is at distance %v from the center", d, k+1, r)
+			}
+		}
+	}
+}
+
+func TestDirichlet(t *testing.T) {
+	alpha := []float64{2, 3, 4, 5}
+	const n = 20000
+	comps, err := Dirichlet(alpha, n, rand.New(rand.NewSource(3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mean := make([]float64, len(alpha))
+	for _, x := range comps {
+		if math.Abs(sum(x)-1) > 1e-12 {
+			t.Fatalf("composition %v is not closed", x)
+		}
+		for k, v := range x {
+			mean[k] += v / n
+		}
+	}
+	// The mean of part k is alpha_k over the total concentration, here 14,
+	// with a standard deviation of at most 0.13 for one draw.
+	for k, a := range alpha {
+		if want := a / 14; math.Abs(mean[k]-want) > 4*0.13/math.Sqrt(n) {
+			t.Errorf("mean of part %d = %v, want %v", k+1, mean[k], want)
+		}
+	}
+}
+
+// TestDirichletSmallConcentrations draws with concentrations whose gamma
+// variates underflow a float64.
+func TestDirichletSmallConcentrations(t *testing.T) {
+	for _, a := range []float64{0.001, 1e-6} {
+		comps, err := Dirichlet([]float64{a, a, a}, 1000, rand.New(rand.NewSource(4)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, x := range comps {
+			if s := sum(x); math.IsNaN(s) || math.Abs(s-1) > 1e-12 {
+				t.Fatalf("alpha %v: composition %v", a, x)
+			}
+		}
+		if _, err := Cloud("dirichlet", Parts(3), comps, "simplex"); err != nil {
+			t.Errorf("alpha %v: %v", a, err)
+		}
+	}
+}
+
+func TestDistributionErrors(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	for _, alpha := range [][]float64{nil, {1, 1}, {1, 1, 1, 1, 1}, {1, 0, 1}, {1, math.NaN(), 1}, {1, math.Inf(1), 1}} {
+		if _, err := Dirichlet(alpha, 1<<40, rng); err == nil {
+			t.Errorf("Dirichlet(%v): no error", alpha)
+		}
+	}
+	if _, err := LogisticNormal([]float64{0}, 1, 0, 10, rng); err == nil {
+		t.Error("LogisticNormal with one mean: no error")
+	}
+	if _, err := LogisticNormal([]float64{0, 0, 0}, 1, -0.9, 10, rng); err == nil {
+		t.Error("LogisticNormal with correlation -0.9 in 3 coordinates: no error")
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	parts, comps, err := ReadTable(strings.NewReader("# sand, silt and clay\nsand,silt,clay\n1,2,1\n0,5,5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(parts, " ") != "sand silt clay" || len(comps) != 2 || comps[1][1] != 5 {
+		t.Errorf("ReadTable = %v, %v", parts, comps)
+	}
+	if _, err := Cloud("soil", parts, comps, "ilr"); err == nil {
+		t.Error("ilr of a composition with a zero part: no error")
+	}
+	for _, table := range []string{"a,b\n1,1\n", "a,b,c\n", "a,b,c\n1,-1,1\n", "a,b,c\n0,0,0\n", "a,b,c\n1,x,1\n"} {
+		if _, _, err := ReadTable(strings.NewReader(table)); err == nil {
+			t.Errorf("ReadTable(%q): no error", table)
+		}
+	}
+}
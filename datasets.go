@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/compositional"
+	"github.com/sbecker11/threedistvis-go/discrete"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/spatial"
+	"github.com/sbecker11/threedistvis-go/synth"
+	"github.com/sbecker11/threedistvis-go/trace"
+	"github.com/sbecker11/threedistvis-go/volume"
+)
+
+// dataDir holds dataset files served under "volume/", PMF tables served
+// under "discrete/" and composition tables served under "simplex/".
+var dataDir = "data"
+
+// maxDatasetPoints bounds the points a generated or sampled dataset may
+// ask for, so that one request cannot allocate unbounded memory.
+const maxDatasetPoints = 5000000
+
+// unknownDatasetError reports a dataset name that loadDataset does not
+// know. Other load errors are about the parameters or the file's contents.
+type unknownDatasetError string
+
+func (e unknownDatasetError) Error() string {
+	return fmt.Sprintf("unknown dataset %q", string(e))
+}
+
+// datasetStatus returns the HTTP status for an error loading a dataset:
+// 404 for an unknown dataset and 400 otherwise.
+func datasetStatus(err error) int {
+	var unknown unknownDatasetError
+	if errors.As(err, &unknown) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// datasets caches loaded datasets; it is set up in main.
+var datasets *datasetCache
+
+// listDatasets returns the dataset names accepted by loadDataset.
+func listDatasets() []string {
+	var names []string
+	for _, kind := range synth.Kinds() {
+		names = append(names, "synth/"+kind)
+	}
+	for _, kind := range discrete.Kinds() {
+		names = append(names, "discrete/"+kind)
+	}
+	names = append(names, "simplex/dirichlet", "simplex/logisticnormal")
+	filepath.WalkDir(dataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(dataDir, path)
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".nrrd", ".nhdr", ".mhd", ".mha":
+			names = append(names, "volume/"+filepath.ToSlash(rel))
+		case ".csv", ".tsv":
+			names = append(names, "discrete/"+filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return names
+}
+
+// loadDataset resolves a dataset name such as "synth/swissroll" to a point
+// cloud. Query parameters carry loader options; order=morton or
+// order=hilbert additionally reorders the points along that curve.
+func loadDataset(ctx context.Context, name string, params url.Values) (c *pointcloud.Cloud, err error) {
+	ctx, span := trace.Start(ctx, "dataset.load")
+	span.Set("dataset", name, "options", params.Encode())
+	defer func() {
+		if c != nil {
+			span.Set("points", c.Len())
+		}
+		span.Fail(err)
+		span.End()
+	}()
+	if c, err = loadSource(ctx, name, params); err != nil {
+		return nil, err
+	}
+	if order := params.Get("order"); order != "" {
+		_, reorder := trace.Start(ctx, "spatial.reorder")
+		reorder.Set("order", order)
+		err := spatial.Reorder(c, spatial.Order(order))
+		reorder.Fail(err)
+		reorder.End()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func loadSource(ctx context.Context, name string, params url.Values) (*pointcloud.Cloud, error) {
+	switch {
+	case strings.HasPrefix(name, "synth/"):
+		if !slices.Contains(synth.Kinds(), strings.TrimPrefix(name, "synth/")) {
+			return nil, unknownDatasetError(name)
+		}
+		opts := synth.Options{N: 5000}
+		var err error
+		if opts.N, err = intParam(params, "n", opts.N); err != nil {
+			return nil, err
+		}
+		if opts.Noise, err = floatParam(params, "noise", 0); err != nil {
+			return nil, err
+		}
+		if opts.Outliers, err = floatParam(params, "outliers", 0); err != nil {
+			return nil, err
+		}
+		if opts.N < 1 || float64(opts.N)*(1+opts.Outliers) > maxDatasetPoints {
+			return nil, fmt.Errorf("parameters n and outliers must give between 1 and %d points", maxDatasetPoints)
+		}
+		seed, err := intParam(params, "seed", 1)
+		if err != nil {
+			return nil, err
+		}
+		opts.Seed = int64(seed)
+		_, span := trace.Start(ctx, "synth.generate")
+		defer span.End()
+		c, err := synth.Generate(strings.TrimPrefix(name, "synth/"), opts)
+		span.Fail(err)
+		return c, err
+	case strings.HasPrefix(name, "volume/"):
+		return loadVolume(ctx, strings.TrimPrefix(name, "volume/"), params)
+	case strings.HasPrefix(name, "discrete/"):
+		return loadDiscrete(ctx, strings.TrimPrefix(name, "discrete/"), params)
+	case strings.HasPrefix(name, "simplex/"):
+		return loadCompositions(ctx, strings.TrimPrefix(name, "simplex/"), params)
+	}
+	return nil, unknownDatasetError(name)
+}
+
+// loadVolume reads a volume file below dataDir and converts it to points.
+// With threshold=lo or threshold=lo,hi every voxel in range becomes a point;
+// otherwise sample=n points (default 50000) are drawn proportionally to
+// intensity.
+func loadVolume(ctx context.Context, rel string, params url.Values) (*pointcloud.Cloud, error) {
+	if !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("invalid volume path %q", rel)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, rel)); err != nil {
+		return nil, unknownDatasetError("volume/" + rel)
+	}
+	_, parse := trace.Start(ctx, "volume.parse")
+	v, err := volume.Open(filepath.Join(dataDir, rel))
+	parse.Fail(err)
+	parse.End()
+	if err != nil {
+		return nil, err
+	}
+	_, span := trace.Start(ctx, "volume.points")
+	defer span.End()
+	name := "volume/" + rel
+	if t := params.Get("threshold"); t != "" {
+		lo, hi, _ := strings.Cut(t, ",")
+		min, err := strconv.ParseFloat(lo, 32)
+		if err != nil {
+			return nil, fmt.Errorf("parameter threshold: %v", err)
+		}
+		_, max := v.Range()
+		if hi != "" {
+			m, err := strconv.ParseFloat(hi, 32)
+			if err != nil {
+				return nil, fmt.Errorf("parameter threshold: %v", err)
+			}
+			max = float32(m)
+		}
+		return v.Threshold(name, float32(min), max), nil
+	}
+	n, err := intParam(params, "sample", 50000)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > maxDatasetPoints {
+		return nil, fmt.Errorf("parameter sample must be between 1 and %d", maxDatasetPoints)
+	}
+	seed, err := intParam(params, "seed", 1)
+	if err != nil {
+		return nil, err
+	}
+	return v.Sample(name, n, rand.New(rand.NewSource(int64(seed))))
+}
+
+// loadDiscrete returns the lattice of a discrete distribution: a PMF table
+// below dataDir, or a generator with parameters n (trials), p and lambda
+// (comma-separated, one per variable) and r (stopping count).
+func loadDiscrete(ctx context.Context, rel string, params url.Values) (*pointcloud.Cloud, error) {
+	_, span := trace.Start(ctx, "discrete.load")
+	defer span.End()
+	name := "discrete/" + rel
+	var j *discrete.Joint
+	switch ext := strings.ToLower(filepath.Ext(rel)); {
+	case ext == ".csv" || ext == ".tsv":
+		if !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("invalid table path %q", rel)
+		}
+		f, err := os.Open(filepath.Join(dataDir, rel))
+		if err != nil {
+			return nil, unknownDatasetError(name)
+		}
+		defer f.Close()
+		if j, err = discrete.ReadTable(f); err != nil {
+			span.Fail(err)
+			return nil, err
+		}
+	default:
+		if !slices.Contains(discrete.Kinds(), rel) {
+			return nil, unknownDatasetError(name)
+		}
+		var opts discrete.Options
+		var err error
+		if opts.N, err = intParam(params, "n", 0); err != nil {
+			return nil, err
+		}
+		if opts.P, err = floatsParam(params, "p"); err != nil {
+			return nil, err
+		}
+		if opts.Lambda, err = floatsParam(params, "lambda"); err != nil {
+			return nil, err
+		}
+		if opts.R, err = floatParam(params, "r", 0); err != nil {
+			return nil, err
+		}
+		if j, err = discrete.Generate(rel, opts); err != nil {
+			span.Fail(err)
+			return nil, err
+		}
+	}
+	span.Set("mass", j.Total())
+	return j.Cloud(name), nil
+}
+
+// loadCompositions returns compositions of three or four parts: a table
+// below dataDir (any CSV or TSV file, unlisted since the same files are
+// listed as PMF tables), or n (default 5000) draws from the Dirichlet
+// distribution with concentrations alpha or the logistic-normal
+// distribution with alr means mean, scale sigma and correlation rho. parts
+// names the parts and transform chooses the coordinates: the simplex
+// (default) or ilr, alr or clr.
+func loadCompositions(ctx context.Context, rel string, params url.Values) (*pointcloud.Cloud, error) {
+	_, span := trace.Start(ctx, "compositional.load")
+	defer span.End()
+	name := "simplex/" + rel
+	var parts []string
+	var comps [][]float64
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(rel)); {
+	case ext == ".csv" || ext == ".tsv":
+		if !filepath.IsLocal(rel) {
+			return nil, fmt.Errorf("invalid table path %q", rel)
+		}
+		f, err := os.Open(filepath.Join(dataDir, rel))
+		if err != nil {
+			return nil, unknownDatasetError(name)
+		}
+		defer f.Close()
+		if parts, comps, err = compositional.ReadTable(f); err != nil {
+			span.Fail(err)
+			return nil, err
+		}
+	case rel == "dirichlet" || rel == "logisticnormal":
+		if comps, err = drawCompositions(rel, params); err != nil {
+			span.Fail(err)
+			return nil, err
+		}
+		parts = compositional.Parts(len(comps[0]))
+	default:
+		return nil, unknownDatasetError(name)
+	}
+	if names := params.Get("parts"); names != "" {
+		if parts = strings.Split(names, ","); len(parts) != len(comps[0]) {
+			return nil, fmt.Errorf("parameter parts: %d names for %d parts", len(parts), len(comps[0]))
+		}
+	}
+	transform := params.Get("transform")
+	if transform == "" {
+		transform = "simplex"
+	}
+	span.Set("parts", len(parts), "transform", transform)
+	c, err := compositional.Cloud(name, parts, comps, transform)
+	span.Fail(err)
+	return c, err
+}
+
+// drawCompositions draws compositions from the named distribution.
+func drawCompositions(kind string, params url.Values) ([][]float64, error) {
+	n, err := intParam(params, "n", 5000)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 || n > maxDatasetPoints {
+		return nil, fmt.Errorf("parameter n must be between 1 and %d", maxDatasetPoints)
+	}
+	seed, err := intParam(params, "seed", 1)
+	if err != nil {
+		return nil, err
+	}
+	rng := rand.New(rand.NewSource(int64(seed)))
+	if kind == "dirichlet" {
+		alpha, err := floatsParam(params, "alpha")
+		if err != nil {
+			return nil, err
+		}
+		if alpha == nil {
+			alpha = []float64{2, 3, 4, 5}
+		}
+		if len(alpha) < 3 || len(alpha) > 4 {
+			return nil, fmt.Errorf("parameter alpha: need 3 or 4 concentrations, got %d", len(alpha))
+		}
+		return compositional.Dirichlet(alpha, n, rng)
+	}
+	mean, err := floatsParam(params, "mean")
+	if err != nil {
+		return nil, err
+	}
+	if mean == nil {
+		mean = []float64{0, 0, 0}
+	}
+	sigma, err := floatParam(params, "sigma", 1)
+	if err != nil {
+		return nil, err
+	}
+	rho, err := floatParam(params, "rho", 0)
+	if err != nil {
+		return nil, err
+	}
+	return compositional.LogisticNormal(mean, sigma, rho, n, rng)
+}
+
+// handleDataset serves GET /api/datasets/ (a JSON list of names) and
+// GET /api/datasets/<name> (the encoded point cloud).
+func handleDataset(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/datasets/")
+	if name == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(listDatasets())
+		return
+	}
+	ctx := r.Context()
+	cloud, err := datasets.Get(ctx, name, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), datasetStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	ctx, span := trace.Start(ctx, "dataset.encode")
+	defer span.End()
+	if err := cloud.Encode(w); err != nil {
+		span.Fail(err)
+		trace.Println(ctx, "Encode error:", err)
+	}
+}
+
+func intParam(params url.Values, key string, def int) (int, error) {
+	s := params.Get(key)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return v, nil
+}
+
+func floatParam(params url.Values, key string, def float64) (float64, error) {
+	s := params.Get(key)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parameter %s: %v", key, err)
+	}
+	return v, nil
+}
+
+// floatsParam parses a comma-separated list of numbers, or returns nil if
+// the parameter is absent.
+func floatsParam(params url.Values, key string) ([]float64, error) {
+	s := params.Get(key)
+	if s == "" {
+		return nil, nil
+	}
+	var values []float64
+	for _, f := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %s: %v", key, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
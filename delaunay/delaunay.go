@@ -0,0 +1,573 @@
+// Package delaunay computes the Delaunay triangulation of 3D points and,
+// from it, their Voronoi tessellation. The triangulation is built by
+// Bowyer–Watson insertion inside a large enclosing tetrahedron: each point
+// removes the tetrahedra whose circumsphere contains it and fills the
+// cavity with tetrahedra joining it to the cavity's boundary. The Voronoi
+// cell of a point has a vertex at the circumcenter of every tetrahedron
+// around it and a face for every Delaunay edge from it, lying in the
+// bisecting plane of the edge.
+package delaunay
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// tet is a tetrahedron with positive orientation. Face k is the one
+// opposite v[k], and adj[k] is the tetrahedron across it, or -1.
+type tet struct {
+	v      [4]int32
+	adj    [4]int32
+	center [3]float64 // circumcenter
+	r2     float64    // squared circumradius
+	dead   bool
+}
+
+// Triangulation is the Delaunay triangulation of a point set. Coincident
+// points share one vertex.
+type Triangulation struct {
+	n      int          // distinct points; vertices n to n+3 enclose them
+	points [][3]float64 // vertices, normalized to the unit cube
+	index  []int        // vertex of each input point
+	first  []int        // first input point of each vertex
+	count  []int        // input points at each vertex
+	tets   []tet
+	free   []int32 // indices of dead tetrahedra for reuse
+	last   int32   // where the next point location starts
+
+	offset [3]float64 // of the normalized coordinates
+	scale  float64
+	extent [3]float64 // of the points, normalized
+
+	incident  [][]int32 // tetrahedra around each vertex
+	unbounded []bool    // vertices on the convex hull
+}
+
+// jitter is the relative size of the random displacement that breaks the
+// ties of cospherical points, such as those of a grid, which floating-point
+// circumsphere tests cannot decide consistently.
+const jitter = 1e-9
+
+// flat is the relative extent below which the points are taken to lie in a
+// plane or on a line. It is well above jitter, which would otherwise give
+// such points a volume of noise.
+const flat = 100 * jitter
+
+// Triangulate returns the Delaunay triangulation of points.
+func Triangulate(points [][3]float64) (*Triangulation, error) {
+	t := &Triangulation{index: make([]int, len(points))}
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range points {
+		for k := range p {
+			lo[k], hi[k] = math.Min(lo[k], p[k]), math.Max(hi[k], p[k])
+		}
+	}
+	t.offset = lo
+	for k := range lo {
+		t.scale = math.Max(t.scale, hi[k]-lo[k])
+	}
+	if !(t.scale > 0) || math.IsInf(t.scale, 1) {
+		return nil, errors.New("delaunay: the points span no volume")
+	}
+	for k := range lo {
+		t.extent[k] = (hi[k] - lo[k]) / t.scale
+	}
+
+	seen := map[[3]float64]int{}
+	for i, p := range points {
+		if v, ok := seen[p]; ok {
+			t.index[i] = v
+			t.count[v]++
+			continue
+		}
+		v := len(t.points)
+		seen[p] = v
+		t.index[i] = v
+		t.first = append(t.first, i)
+		t.count = append(t.count, 1)
+		var q [3]float64
+		for k := range q {
+			q[k] = (p[k] - lo[k]) / t.scale
+		}
+		t.points = append(t.points, q)
+	}
+	t.n = len(t.points)
+	if t.n < 4 {
+		return nil, errors.New("delaunay: need at least 4 distinct points")
+	}
+	if affineRank(t.points) < 3 {
+		return nil, errors.New("delaunay: the points span no volume")
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := range t.points {
+		for k := range t.points[i] {
+			t.points[i][k] += jitter * (rng.Float64() - 0.5)
+		}
+	}
+
+	// Enclose the unit cube in a tetrahedron far larger than it, so that
+	// the tetrahedra it adds barely constrain those of the points.
+	const far = 100
+	t.points = append(t.points,
+		[3]float64{0.5, 0.5 + 3*far, 0.5},
+		[3]float64{0.5 - 3*far, 0.5 - far, 0.5 - 2*far},
+		[3]float64{0.5 + 3*far, 0.5 - far, 0.5 - 2*far},
+		[3]float64{0.5, 0.5 - far, 0.5 + 3*far},
+	)
+	n := int32(t.n)
+	t.tets = append(t.tets, t.newTet([4]int32{n, n + 1, n + 2, n + 3}))
+
+	for _, v := range t.insertionOrder() {
+		t.insert(int32(v))
+	}
+	t.link()
+	return t, nil
+}
+
+// affineRank returns the dimension of the space the points span about
+// their centroid, counting only directions in which some point lies
+// farther than flat from the directions already found. The points are in
+// normalized coordinates. Each direction is that of the point farthest
+// from the span of the previous ones, as in QR with column pivoting.
+func affineRank(points [][3]float64) int {
+	var c [3]float64
+	for _, p := range points {
+		c = [3]float64{c[0] + p[0], c[1] + p[1], c[2] + p[2]}
+	}
+	c = scale(c, 1/float64(len(points)))
+	var basis [][3]float64
+	for len(basis) < 3 {
+		var best [3]float64
+		far := 0.0
+		for _, p := range points {
+			r := sub(p, c)
+			for _, b := range basis {
+				r = sub(r, scale(b, dot(r, b)))
+			}
+			if l := math.Sqrt(dot(r, r)); l > far {
+				best, far = r, l
+			}
+		}
+		if far <= flat {
+			break
+		}
+		basis = append(basis, scale(best, 1/far))
+	}
+	return len(basis)
+}
+
+// newTet returns a tetrahedron on the given vertices, reordered to have
+// positive orientation, with no neighbors.
+func (t *Triangulation) newTet(v [4]int32) tet {
+	p := func(i int) [3]float64 { return t.points[v[i]] }
+	if orient(p(0), p(1), p(2), p(3)) < 0 {
+		v[0], v[1] = v[1], v[0]
+	}
+	a, b, c, d := t.points[v[0]], t.points[v[1]], t.points[v[2]], t.points[v[3]]
+	center, r2 := circumsphere(a, b, c, d)
+	return tet{v: v, adj: [4]int32{-1, -1, -1, -1}, center: center, r2: r2}
+}
+
+// insertionOrder returns the distinct points in the order of a Z-order
+// curve, so that each point is located by a short walk from the last.
+func (t *Triangulation) insertionOrder() []int {
+	const bits = 10
+	keys := make([]uint32, t.n)
+	order := make([]int, t.n)
+	for i, p := range t.points[:t.n] {
+		var key uint32
+		var c [3]uint32
+		for k := range c {
+			c[k] = uint32(math.Max(0, math.Min(1<<bits-1, p[k]*(1<<bits))))
+		}
+		for b := bits - 1; b >= 0; b-- {
+			for k := range c {
+				key = key<<1 | c[k]>>b&1
+			}
+		}
+		keys[i], order[i] = key, i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return keys[order[i]] < keys[order[j]] })
+	return order
+}
+
+// insert adds vertex v to the triangulation.
+func (t *Triangulation) insert(v int32) {
+	p := t.points[v]
+	start := t.locate(p)
+
+	// Gather the cavity: the connected tetrahedra whose circumsphere
+	// contains p.
+	inCavity := map[int32]bool{start: true}
+	cavity := []int32{start}
+	for i := 0; i < len(cavity); i++ {
+		for _, a := range t.tets[cavity[i]].adj {
+			if a >= 0 && !inCavity[a] && dist2(p, t.tets[a].center) < t.tets[a].r2 {
+				inCavity[a] = true
+				cavity = append(cavity, a)
+			}
+		}
+	}
+	// Rounding may leave a boundary face that p does not see, which would
+	// give an inverted tetrahedron; grow the cavity across such faces.
+	for grown := true; grown; {
+		grown = false
+		for i := 0; i < len(cavity); i++ {
+			c := &t.tets[cavity[i]]
+			for k, a := range c.adj {
+				if a < 0 || inCavity[a] {
+					continue
+				}
+				if t.faceOrient(c.v, k, p) <= 0 {
+					inCavity[a] = true
+					cavity = append(cavity, a)
+					grown = true
+				}
+			}
+		}
+	}
+
+	// Join p to every boundary face, linking the new tetrahedra to those
+	// outside across the face and to each other across the faces through
+	// p, which are matched by their other two vertices.
+	type half struct {
+		tet  int32
+		face int
+	}
+	open := map[[2]int32]half{}
+	var created []int32
+	for _, ci := range cavity {
+		c := t.tets[ci]
+		for k, a := range c.adj {
+			if a >= 0 && inCavity[a] {
+				continue
+			}
+			nv := c.v
+			nv[k] = v
+			nt := tet{v: nv, adj: [4]int32{-1, -1, -1, -1}}
+			nt.center, nt.r2 = circumsphere(t.points[nv[0]], t.points[nv[1]], t.points[nv[2]], t.points[nv[3]])
+			nt.adj[k] = a
+			ni := t.alloc(nt)
+			created = append(created, ni)
+			if a >= 0 {
+				for m, b := range t.tets[a].adj {
+					if b == ci {
+						t.tets[a].adj[m] = ni
+					}
+				}
+			}
+			for j := 0; j < 4; j++ {
+				if j == k {
+					continue
+				}
+				var key [2]int32
+				n := 0
+				for m := 0; m < 4; m++ {
+					if m != j && m != k {
+						key[n] = nv[m]
+						n++
+					}
+				}
+				if key[0] > key[1] {
+					key[0], key[1] = key[1], key[0]
+				}
+				if other, ok := open[key]; ok {
+					t.tets[ni].adj[j] = other.tet
+					t.tets[other.tet].adj[other.face] = ni
+					delete(open, key)
+				} else {
+					open[key] = half{ni, j}
+				}
+			}
+		}
+	}
+	for _, ci := range cavity {
+		t.tets[ci].dead = true
+		t.free = append(t.free, ci)
+	}
+	t.last = created[0]
+}
+
+// alloc stores a new tetrahedron, reusing the slot of a dead one if there
+// is one. The slots of a cavity are freed only after it has been filled.
+func (t *Triangulation) alloc(nt tet) int32 {
+	if n := len(t.free); n > 0 {
+		i := t.free[n-1]
+		t.free = t.free[:n-1]
+		t.tets[i] = nt
+		return i
+	}
+	t.tets = append(t.tets, nt)
+	return int32(len(t.tets) - 1)
+}
+
+// faceOrient returns the orientation of the tetrahedron v with v[k]
+// replaced by p: positive if p is on the same side of face k as v[k].
+func (t *Triangulation) faceOrient(v [4]int32, k int, p [3]float64) float64 {
+	var q [4][3]float64
+	for m := range q {
+		q[m] = t.points[v[m]]
+	}
+	q[k] = p
+	return orient(q[0], q[1], q[2], q[3])
+}
+
+// locate returns a tetrahedron containing p, walking toward it from the
+// last one created. If rounding makes the walk cycle, it falls back to
+// checking every tetrahedron.
+func (t *Triangulation) locate(p [3]float64) int32 {
+	cur := t.last
+	for steps := 0; steps < len(t.tets); steps++ {
+		c := &t.tets[cur]
+		next := int32(-1)
+		for k := 0; k < 4; k++ {
+			if c.adj[k] >= 0 && t.faceOrient(c.v, k, p) < 0 {
+				next = c.adj[k]
+				break
+			}
+		}
+		if next < 0 {
+			return cur
+		}
+		cur = next
+	}
+	best, bestOrient := int32(0), math.Inf(-1)
+	for i := range t.tets {
+		if t.tets[i].dead {
+			continue
+		}
+		worst := math.Inf(1)
+		for k := 0; k < 4; k++ {
+			worst = math.Min(worst, t.faceOrient(t.tets[i].v, k, p))
+		}
+		if worst > bestOrient {
+			best, bestOrient = int32(i), worst
+		}
+	}
+	return best
+}
+
+// link records the tetrahedra around each vertex and which vertices
+// have unbounded Voronoi cells: those joined to the enclosing
+// tetrahedron, which lie on the convex hull of the points.
+func (t *Triangulation) link() {
+	t.incident = make([][]int32, t.n)
+	t.unbounded = make([]bool, t.n)
+	for i := range t.tets {
+		c := &t.tets[i]
+		if c.dead {
+			continue
+		}
+		outer := false
+		for _, v := range c.v {
+			outer = outer || int(v) >= t.n
+		}
+		for _, v := range c.v {
+			if int(v) < t.n {
+				t.incident[v] = append(t.incident[v], int32(i))
+				t.unbounded[v] = t.unbounded[v] || outer
+			}
+		}
+	}
+}
+
+// Edges returns the Delaunay edges as pairs of indices of the input
+// points. Coincident points are represented by the first of them.
+func (t *Triangulation) Edges() [][2]int {
+	var edges [][2]int
+	seen := map[[2]int32]bool{}
+	for i := range t.tets {
+		c := &t.tets[i]
+		if c.dead {
+			continue
+		}
+		for a := 0; a < 4; a++ {
+			for b := a + 1; b < 4; b++ {
+				u, w := c.v[a], c.v[b]
+				if int(u) >= t.n || int(w) >= t.n {
+					continue
+				}
+				if u > w {
+					u, w = w, u
+				}
+				if key := [2]int32{u, w}; !seen[key] {
+					seen[key] = true
+					edges = append(edges, [2]int{t.first[u], t.first[w]})
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// faces returns the faces of the Voronoi cell of vertex v in normalized
+// coordinates, keyed by the vertex across each face, each an ordered
+// convex polygon, or ok false if the cell is unbounded.
+func (t *Triangulation) faces(v int) (faces map[int32][][3]float64, ok bool) {
+	if t.unbounded[v] {
+		return nil, false
+	}
+	faces = map[int32][][3]float64{}
+	for _, ti := range t.incident[v] {
+		c := &t.tets[ti]
+		for _, w := range c.v {
+			if int(w) != v {
+				faces[w] = append(faces[w], c.center)
+			}
+		}
+	}
+	for w, poly := range faces {
+		faces[w] = order(poly, sub(t.points[w], t.points[v]))
+	}
+	return faces, true
+}
+
+// Cell returns the faces of the Voronoi cell of input point i, each an
+// ordered convex polygon in the coordinates of the points, or ok false if
+// the cell is unbounded because the point lies on the convex hull.
+func (t *Triangulation) Cell(i int) (faces [][][3]float64, ok bool) {
+	byNeighbor, ok := t.faces(t.index[i])
+	if !ok {
+		return nil, false
+	}
+	for _, poly := range byNeighbor {
+		face := make([][3]float64, len(poly))
+		for j, q := range poly {
+			for k := range q {
+				face[j][k] = t.offset[k] + q[k]*t.scale
+			}
+		}
+		faces = append(faces, face)
+	}
+	return faces, true
+}
+
+// Volumes returns the volume of the Voronoi cell of each input point,
+// shared equally by coincident points. It is NaN for unbounded cells and
+// for cells reaching outside the bounding box of the points: near the
+// convex hull, flat Delaunay tetrahedra put cell vertices far away, and the
+// volume says more about the boundary than about the density of points.
+// Each face contributes the pyramid over it from the point, whose height
+// is half the length of the Delaunay edge the face bisects.
+func (t *Triangulation) Volumes() []float64 {
+	cell := make([]float64, t.n)
+	for v := range cell {
+		faces, ok := t.faces(v)
+		if !ok || !t.inside(faces) {
+			cell[v] = math.NaN()
+			continue
+		}
+		for w, poly := range faces {
+			height := math.Sqrt(dist2(t.points[v], t.points[w])) / 2
+			cell[v] += area(poly) * height / 3
+		}
+		cell[v] *= t.scale * t.scale * t.scale
+	}
+	volumes := make([]float64, len(t.index))
+	for i, v := range t.index {
+		volumes[i] = cell[v] / float64(t.count[v])
+	}
+	return volumes
+}
+
+// inside reports whether every vertex of a cell lies in the bounding box
+// of the points.
+func (t *Triangulation) inside(faces map[int32][][3]float64) bool {
+	const slack = 1e-6 // beyond the jitter
+	for _, poly := range faces {
+		for _, q := range poly {
+			for k := range q {
+				if q[k] < -slack || q[k] > t.extent[k]+slack {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// order sorts the vertices of a convex polygon lying in a plane with
+// normal n by their angle about its centroid.
+func order(poly [][3]float64, n [3]float64) [][3]float64 {
+	var centroid [3]float64
+	for _, q := range poly {
+		for k := range q {
+			centroid[k] += q[k] / float64(len(poly))
+		}
+	}
+	// An orthonormal basis u, w of the plane.
+	u := cross(n, [3]float64{1, 0, 0})
+	if dot(u, u) < 1e-6*dot(n, n) {
+		u = cross(n, [3]float64{0, 1, 0})
+	}
+	u = scale(u, 1/math.Sqrt(dot(u, u)))
+	w := cross(n, u)
+	w = scale(w, 1/math.Sqrt(dot(w, w)))
+	angles := make([]float64, len(poly))
+	idx := make([]int, len(poly))
+	for i, q := range poly {
+		d := sub(q, centroid)
+		angles[i], idx[i] = math.Atan2(dot(d, w), dot(d, u)), i
+	}
+	sort.Slice(idx, func(a, b int) bool { return angles[idx[a]] < angles[idx[b]] })
+	out := make([][3]float64, len(poly))
+	for i, j := range idx {
+		out[i] = poly[j]
+	}
+	return out
+}
+
+// area returns the area of an ordered planar polygon.
+func area(poly [][3]float64) float64 {
+	var sum [3]float64
+	for i := 1; i+1 < len(poly); i++ {
+		c := cross(sub(poly[i], poly[0]), sub(poly[i+1], poly[0]))
+		for k := range sum {
+			sum[k] += c[k]
+		}
+	}
+	return math.Sqrt(dot(sum, sum)) / 2
+}
+
+// orient returns six times the signed volume of the tetrahedron abcd,
+// positive if d is on the side of the plane abc from which a, b and c
+// appear clockwise.
+func orient(a, b, c, d [3]float64) float64 {
+	return dot(sub(b, a), cross(sub(c, a), sub(d, a)))
+}
+
+// circumsphere returns the center and squared radius of the sphere through
+// a, b, c and d.
+func circumsphere(a, b, c, d [3]float64) ([3]float64, float64) {
+	b, c, d = sub(b, a), sub(c, a), sub(d, a)
+	cd, db, bc := cross(c, d), cross(d, b), cross(b, c)
+	den := 2 * dot(b, cd)
+	if den == 0 {
+		// A flat tetrahedron has no circumsphere; treating it as infinite
+		// puts every point inside, so the next insertion replaces it.
+		return a, math.Inf(1)
+	}
+	var r [3]float64
+	for k := range r {
+		r[k] = (dot(b, b)*cd[k] + dot(c, c)*db[k] + dot(d, d)*bc[k]) / den
+	}
+	return [3]float64{a[0] + r[0], a[1] + r[1], a[2] + r[2]}, dot(r, r)
+}
+
+func sub(a, b [3]float64) [3]float64 { return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+
+func dot(a, b [3]float64) float64 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func scale(a [3]float64, s float64) [3]float64 { return [3]float64{a[0] * s, a[1] * s, a[2] * s} }
+
+func dist2(a, b [3]float64) float64 {
+	d := sub(a, b)
+	return dot(d, d)
+}
@@ -0,0 +1,156 @@
+package delaunay
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func randomPoints(n int, rng *rand.Rand) [][3]float64 {
+	points := make([][3]float64, n)
+	for i := range points {
+		points[i] = [3]float64{rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+	return points
+}
+
+// TestEmptySphere checks the defining property of the triangulation: no
+// point lies inside the circumsphere of a tetrahedron.
+func TestEmptySphere(t *testing.T) {
+	tri, err := Triangulate(randomPoints(500, rand.New(rand.NewSource(1))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := 0
+	for _, c := range tri.tets {
+		if c.dead {
+			continue
+		}
+		live++
+		if orient(tri.points[c.v[0]], tri.points[c.v[1]], tri.points[c.v[2]], tri.points[c.v[3]]) <= 0 {
+			t.Fatalf("tetrahedron %v is not positively oriented", c.v)
+		}
+		for v, p := range tri.points[:tri.n] {
+			if d := dist2(p, c.center); d < c.r2*(1-1e-9) {
+				t.Fatalf("vertex %d lies inside the circumsphere of %v", v, c.v)
+			}
+		}
+	}
+	if live == 0 || len(tri.Edges()) < 3*500 {
+		t.Errorf("%d tetrahedra and %d edges for 500 points", live, len(tri.Edges()))
+	}
+}
+
+// TestLattice checks the Voronoi cells of a lattice, whose points are
+// cospherical, against the unit cubes around them.
+func TestLattice(t *testing.T) {
+	const m = 5
+	var points [][3]float64
+	for i := 0; i < m*m*m; i++ {
+		points = append(points, [3]float64{float64(i % m), float64(i / m % m), float64(i / (m * m))})
+	}
+	tri, err := Triangulate(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	volumes := tri.Volumes()
+	for i, p := range points {
+		interior := true
+		for _, x := range p {
+			interior = interior && x > 0 && x < m-1
+		}
+		if !interior {
+			if !math.IsNaN(volumes[i]) {
+				t.Errorf("boundary point %v has cell volume %v, want NaN", p, volumes[i])
+			}
+			continue
+		}
+		if math.Abs(volumes[i]-1) > 1e-6 {
+			t.Errorf("interior point %v has cell volume %v, want 1", p, volumes[i])
+		}
+		faces, ok := tri.Cell(i)
+		if !ok {
+			t.Errorf("interior point %v has an unbounded cell", p)
+			continue
+		}
+		// The cell is the cube of side 1 around the point; rounding may
+		// split its faces.
+		for _, face := range faces {
+			for _, q := range face {
+				for k := range q {
+					if math.Abs(q[k]-p[k]) > 0.5+1e-6 {
+						t.Fatalf("cell of %v has vertex %v outside its cube", p, q)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCoincidentPoints(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	points := randomPoints(200, rng)
+	points[0] = [3]float64{0.5, 0.5, 0.5}
+	points = append(points, points[0], points[0])
+	tri, err := Triangulate(points)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range tri.Edges() {
+		if e[0] >= 200 || e[1] >= 200 {
+			t.Fatalf("edge %v joins a repeated point", e)
+		}
+	}
+	volumes := tri.Volumes()
+	if v := volumes[200]; !(v > 0) || v != volumes[0] || v != volumes[201] {
+		t.Errorf("coincident points have volumes %v, %v and %v", volumes[0], volumes[200], volumes[201])
+	}
+	single, err := Triangulate(points[:200])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, w := 3*volumes[0], single.Volumes()[0]; math.Abs(v-w) > 1e-9*w {
+		t.Errorf("three coincident points share a volume of %v, want %v", v, w)
+	}
+}
+
+func TestDegenerate(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	collinear := make([][3]float64, 50)
+	for i := range collinear {
+		s := rng.Float64()
+		collinear[i] = [3]float64{1 + s, 2 + 2*s, 3 - s}
+	}
+	coplanar := make([][3]float64, 50)
+	for i := range coplanar {
+		u, v := rng.Float64(), rng.Float64()
+		coplanar[i] = [3]float64{u, v, 1 + 1000*u - 3*v}
+	}
+	// Points within rounding error of a tilted plane.
+	thin := randomPoints(50, rng)
+	for i := range thin {
+		thin[i][2] = thin[i][0] + thin[i][1] + 1e-12*rng.Float64()
+	}
+	tests := map[string][][3]float64{
+		"none":      nil,
+		"identical": {{1, 2, 3}, {1, 2, 3}, {1, 2, 3}, {1, 2, 3}, {1, 2, 3}},
+		"three":     {{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 1, 0}},
+		"collinear": collinear,
+		"coplanar":  coplanar,
+		"thin":      thin,
+		"infinite":  {{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {0, 0, math.Inf(1)}},
+	}
+	for name, points := range tests {
+		if _, err := Triangulate(points); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	// A slab thin in absolute terms has volume relative to its own scale.
+	tiny := randomPoints(50, rng)
+	for i := range tiny {
+		tiny[i] = [3]float64{1e-8 * tiny[i][0], 1e-8 * tiny[i][1], 1e-9 * tiny[i][2]}
+	}
+	if _, err := Triangulate(tiny); err != nil {
+		t.Errorf("tiny: %v", err)
+	}
+}
@@ -0,0 +1,464 @@
+// Package discrete holds joint probability mass functions of up to three
+// integer-valued or categorical variables on a lattice, generated from
+// standard families or read from tables. A joint PMF becomes a point cloud
+// with one point per lattice site of positive mass, which the client draws
+// as a lattice of bubbles.
+package discrete
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// Joint is a joint PMF on the lattice spanned by its axes. Distributions of
+// fewer than three variables have unnamed axes with a single level.
+type Joint struct {
+	Axes [3]pointcloud.Axis
+	// Mass is indexed by i + n0*(j + n1*k) for levels i, j and k, where nk
+	// is the number of levels of axis k.
+	Mass []float64
+}
+
+// MaxSites bounds the number of lattice sites.
+const MaxSites = 1 << 20
+
+// Tail is the mass generators may leave out when truncating variables with
+// unbounded support.
+const Tail = 1e-4
+
+// newJoint returns a joint PMF with no mass on the lattice of the given
+// axes, padding missing axes with a single level.
+func newJoint(axes ...pointcloud.Axis) (*Joint, error) {
+	j := &Joint{}
+	sites := 1
+	for k := range j.Axes {
+		j.Axes[k] = pointcloud.Axis{Levels: []string{""}}
+		if k < len(axes) {
+			j.Axes[k] = axes[k]
+		}
+		n := len(j.Axes[k].Levels)
+		if n > pointcloud.MaxLevels {
+			return nil, fmt.Errorf("discrete: %s has %d levels, more than %d", j.Axes[k].Name, n, pointcloud.MaxLevels)
+		}
+		if sites *= n; sites > MaxSites {
+			return nil, fmt.Errorf("discrete: lattice has more than %d sites", MaxSites)
+		}
+	}
+	j.Mass = make([]float64, sites)
+	return j, nil
+}
+
+// size returns the number of levels along each axis.
+func (j *Joint) size() (n0, n1, n2 int) {
+	return len(j.Axes[0].Levels), len(j.Axes[1].Levels), len(j.Axes[2].Levels)
+}
+
+// fill sets the mass of every site from f of its level indices.
+func (j *Joint) fill(f func(x [3]int) float64) {
+	n0, n1, n2 := j.size()
+	for k := 0; k < n2; k++ {
+		for i1 := 0; i1 < n1; i1++ {
+			for i0 := 0; i0 < n0; i0++ {
+				j.Mass[i0+n0*(i1+n1*k)] = f([3]int{i0, i1, k})
+			}
+		}
+	}
+}
+
+// Total returns the total mass, which is less than 1 for truncated
+// distributions.
+func (j *Joint) Total() float64 {
+	var sum float64
+	for _, m := range j.Mass {
+		sum += m
+	}
+	return sum
+}
+
+// Cloud returns the sites of positive mass as points at their level
+// indices, with the attribute "mass" followed by the value of each
+// variable (its level index if it is categorical).
+func (j *Joint) Cloud(name string) *pointcloud.Cloud {
+	n0, n1, _ := j.size()
+	var sites []int
+	for s, m := range j.Mass {
+		if m > 0 {
+			sites = append(sites, s)
+		}
+	}
+	c := pointcloud.New(name, len(sites))
+	c.Axes = j.Axes[:]
+	mass := make([]float32, len(sites))
+	var values [3][]float32
+	for k := range values {
+		values[k] = make([]float32, len(sites))
+	}
+	for i, s := range sites {
+		x := [3]int{s % n0, s / n0 % n1, s / (n0 * n1)}
+		c.SetPoint(i, float32(x[0]), float32(x[1]), float32(x[2]))
+		mass[i] = float32(j.Mass[s])
+		for k := range values {
+			values[k][i] = float32(x[k])
+			if v, err := strconv.ParseFloat(j.Axes[k].Levels[x[k]], 64); err == nil {
+				values[k][i] = float32(v)
+			}
+		}
+	}
+	c.SetAttribute("mass", mass)
+	for k, a := range j.Axes {
+		if len(a.Levels) > 1 {
+			c.SetAttribute(a.Name, values[k])
+		}
+	}
+	return c
+}
+
+// Marginals returns the marginal mass of each level of each axis of a
+// cloud made by Cloud, or ok false if the cloud is not a lattice.
+func Marginals(c *pointcloud.Cloud) (marginals [3][]float64, ok bool) {
+	mass := c.Attribute("mass")
+	if len(c.Axes) != 3 || mass == nil {
+		return marginals, false
+	}
+	for k, a := range c.Axes {
+		marginals[k] = make([]float64, len(a.Levels))
+	}
+	for i, m := range mass {
+		for k := range marginals {
+			if l := int(c.Positions[3*i+k]); l >= 0 && l < len(marginals[k]) {
+				marginals[k][l] += float64(m)
+			}
+		}
+	}
+	return marginals, true
+}
+
+// Options are the parameters of the generators. Zero values take the
+// defaults of each generator.
+type Options struct {
+	N      int       // multinomial trials
+	P      []float64 // category probabilities, one per variable
+	Lambda []float64 // Poisson means, one per variable
+	R      float64   // negative binomial stopping count
+}
+
+var generators = map[string]func(Options) (*Joint, error){
+	"multinomial": Multinomial,
+	"poisson":     PoissonProduct,
+	"negbinomial": NegativeBinomial,
+}
+
+// Kinds returns the names accepted by Generate, sorted.
+func Kinds() []string {
+	kinds := make([]string, 0, len(generators))
+	for k := range generators {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Generate returns the named distribution.
+func Generate(kind string, opts Options) (*Joint, error) {
+	gen, ok := generators[kind]
+	if !ok {
+		return nil, fmt.Errorf("discrete: unknown distribution %q", kind)
+	}
+	return gen(opts)
+}
+
+// variables returns the axes x1, x2, … for the given numbers of levels,
+// labeled 0, 1, ….
+func variables(levels ...int) []pointcloud.Axis {
+	axes := make([]pointcloud.Axis, len(levels))
+	for k, n := range levels {
+		axes[k].Name = "x" + strconv.Itoa(k+1)
+		for l := 0; l < n; l++ {
+			axes[k].Levels = append(axes[k].Levels, strconv.Itoa(l))
+		}
+	}
+	return axes
+}
+
+// checkProbabilities requires one to three probabilities that are
+// nonnegative and, with the rest of the mass, sum to 1. It returns that
+// rest.
+func checkProbabilities(p []float64) (rest float64, err error) {
+	if len(p) == 0 || len(p) > 3 {
+		return 0, fmt.Errorf("discrete: need 1 to 3 probabilities, got %d", len(p))
+	}
+	rest = 1
+	for _, q := range p {
+		if !(q >= 0 && q <= 1) {
+			return 0, fmt.Errorf("discrete: probability %v is not in [0, 1]", q)
+		}
+		rest -= q
+	}
+	if rest < -1e-9 {
+		return 0, errors.New("discrete: probabilities sum to more than 1")
+	}
+	return math.Max(rest, 0), nil
+}
+
+// xlogp returns x log p, taking 0 log 0 as 0.
+func xlogp(x, p float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x * math.Log(p)
+}
+
+func lgamma(x float64) float64 {
+	v, _ := math.Lgamma(x)
+	return v
+}
+
+// Multinomial returns the joint distribution of the counts of the first
+// categories in N trials (default 10) with category probabilities P
+// (default 0.2, 0.3, 0.1). Any probability left over belongs to a further
+// category that is not shown.
+func Multinomial(opts Options) (*Joint, error) {
+	n, p := opts.N, opts.P
+	if n == 0 {
+		n = 10
+	}
+	if p == nil {
+		p = []float64{0.2, 0.3, 0.1}
+	}
+	if n < 0 || n >= pointcloud.MaxLevels {
+		return nil, fmt.Errorf("discrete: trials must be between 0 and %d", pointcloud.MaxLevels-1)
+	}
+	rest, err := checkProbabilities(p)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]int, len(p))
+	for k := range levels {
+		levels[k] = n + 1
+	}
+	j, err := newJoint(variables(levels...)...)
+	if err != nil {
+		return nil, err
+	}
+	j.fill(func(x [3]int) float64 {
+		left := float64(n)
+		logm := lgamma(float64(n) + 1)
+		for k, q := range p {
+			left -= float64(x[k])
+			logm += xlogp(float64(x[k]), q) - lgamma(float64(x[k])+1)
+		}
+		if left < 0 {
+			return 0
+		}
+		return math.Exp(logm + xlogp(left, rest) - lgamma(left+1))
+	})
+	return j, nil
+}
+
+// PoissonProduct returns independent Poisson variables with means Lambda
+// (default 2, 4, 1.5), truncated to leave out at most Tail of the mass.
+func PoissonProduct(opts Options) (*Joint, error) {
+	lambda := opts.Lambda
+	if lambda == nil {
+		lambda = []float64{2, 4, 1.5}
+	}
+	if len(lambda) == 0 || len(lambda) > 3 {
+		return nil, fmt.Errorf("discrete: need 1 to 3 means, got %d", len(lambda))
+	}
+	pmfs := make([][]float64, len(lambda))
+	levels := make([]int, len(lambda))
+	for k, l := range lambda {
+		if !(l > 0) || math.IsInf(l, 1) {
+			return nil, fmt.Errorf("discrete: Poisson mean %v is not positive", l)
+		}
+		pmfs[k] = truncate(func(x float64) float64 {
+			return math.Exp(xlogp(x, l) - l - lgamma(x+1))
+		}, Tail/float64(len(lambda)))
+		levels[k] = len(pmfs[k])
+	}
+	return product(pmfs, levels)
+}
+
+// truncate returns pmf at 0, 1, … until the remaining mass is at most
+// tail, or at most MaxLevels values.
+func truncate(pmf func(x float64) float64, tail float64) []float64 {
+	var values []float64
+	cdf := 0.0
+	for x := 0; x < pointcloud.MaxLevels && cdf < 1-tail; x++ {
+		m := pmf(float64(x))
+		values = append(values, m)
+		cdf += m
+	}
+	return values
+}
+
+// product returns the joint distribution of independent variables.
+func product(pmfs [][]float64, levels []int) (*Joint, error) {
+	j, err := newJoint(variables(levels...)...)
+	if err != nil {
+		return nil, err
+	}
+	j.fill(func(x [3]int) float64 {
+		m := 1.0
+		for k, pmf := range pmfs {
+			m *= pmf[x[k]]
+		}
+		return m
+	})
+	return j, nil
+}
+
+// NegativeBinomial returns the negative multinomial distribution, the
+// joint negative binomial: the counts of the categories with probabilities
+// P (default 0.2, 0.15, 0.1) seen before the R-th (default 3) outcome of
+// the remaining probability. Each count alone is negative binomial. The
+// lattice is truncated to leave out at most Tail of each marginal.
+func NegativeBinomial(opts Options) (*Joint, error) {
+	r, p := opts.R, opts.P
+	if r == 0 {
+		r = 3
+	}
+	if p == nil {
+		p = []float64{0.2, 0.15, 0.1}
+	}
+	if !(r > 0) || math.IsInf(r, 1) {
+		return nil, fmt.Errorf("discrete: stopping count %v is not positive", r)
+	}
+	p0, err := checkProbabilities(p)
+	if err != nil {
+		return nil, err
+	}
+	if p0 <= 0 {
+		return nil, errors.New("discrete: probabilities must sum to less than 1")
+	}
+	levels := make([]int, len(p))
+	for k, q := range p {
+		// The count of category k alone is negative binomial with
+		// success probability p0/(p0+q).
+		s := p0 / (p0 + q)
+		levels[k] = len(truncate(func(x float64) float64 {
+			return math.Exp(lgamma(r+x) - lgamma(r) - lgamma(x+1) + r*math.Log(s) + xlogp(x, 1-s))
+		}, Tail/float64(len(p))))
+	}
+	j, err := newJoint(variables(levels...)...)
+	if err != nil {
+		return nil, err
+	}
+	j.fill(func(x [3]int) float64 {
+		total := 0.0
+		logm := r * math.Log(p0)
+		for k, q := range p {
+			total += float64(x[k])
+			logm += xlogp(float64(x[k]), q) - lgamma(float64(x[k])+1)
+		}
+		return math.Exp(logm + lgamma(r+total) - lgamma(r))
+	})
+	return j, nil
+}
+
+// ReadTable reads a PMF table: a header naming one to three variables and
+// a mass column, then one row per lattice site, comma- or tab-separated.
+// Lines starting with # are comments. Variables whose values are all
+// integers get every level from their smallest to their largest value;
+// other variables are categorical, with levels in order of appearance.
+// Repeated sites add up and the masses are normalized to sum to 1, so
+// counts work as well as probabilities.
+func ReadTable(r io.Reader) (*Joint, error) {
+	records, err := pointcloud.ReadRecords(r)
+	if err != nil {
+		return nil, fmt.Errorf("discrete: %v", err)
+	}
+	if len(records) < 2 {
+		return nil, errors.New("discrete: table has no rows")
+	}
+	header, rows := records[0], records[1:]
+	d := len(header) - 1
+	if d < 1 || d > 3 {
+		return nil, fmt.Errorf("discrete: table needs 1 to 3 variables and a mass column, got %d columns", len(header))
+	}
+	axes := make([]pointcloud.Axis, d)
+	index := make([]map[string]int, d)
+	for k := range axes {
+		axes[k], index[k], err = tableAxis(strings.TrimSpace(header[k]), rows, k)
+		if err != nil {
+			return nil, err
+		}
+	}
+	j, err := newJoint(axes...)
+	if err != nil {
+		return nil, err
+	}
+	n0, n1, _ := j.size()
+	var total float64
+	for i, row := range rows {
+		m, err := strconv.ParseFloat(strings.TrimSpace(row[d]), 64)
+		if err != nil || !(m >= 0) || math.IsInf(m, 1) {
+			return nil, fmt.Errorf("discrete: row %d: invalid mass %q", i+2, row[d])
+		}
+		var x [3]int
+		for k := range axes {
+			x[k] = index[k][strings.TrimSpace(row[k])]
+		}
+		j.Mass[x[0]+n0*(x[1]+n1*x[2])] += m
+		total += m
+	}
+	if total <= 0 {
+		return nil, errors.New("discrete: table has no mass")
+	}
+	for s := range j.Mass {
+		j.Mass[s] /= total
+	}
+	return j, nil
+}
+
+// tableAxis returns the axis of column k of a table and the level index of
+// each value in the column.
+func tableAxis(name string, rows [][]string, k int) (pointcloud.Axis, map[string]int, error) {
+	a := pointcloud.Axis{Name: name}
+	if a.Name == "" {
+		a.Name = "x" + strconv.Itoa(k+1)
+	}
+	index := map[string]int{}
+	integers := true
+	lo, hi := math.MaxInt, math.MinInt
+	for _, row := range rows {
+		v := strings.TrimSpace(row[k])
+		if _, ok := index[v]; ok {
+			continue
+		}
+		index[v] = len(a.Levels)
+		a.Levels = append(a.Levels, v)
+		if len(a.Levels) > pointcloud.MaxLevels {
+			return a, nil, fmt.Errorf("discrete: %s has more than %d levels", a.Name, pointcloud.MaxLevels)
+		}
+		if x, err := strconv.Atoi(v); err == nil {
+			lo, hi = min(lo, x), max(hi, x)
+		} else {
+			integers = false
+		}
+	}
+	if !integers {
+		return a, index, nil
+	}
+	// Unsigned subtraction gives the span even where hi-lo overflows.
+	span := uint64(hi) - uint64(lo)
+	if span >= pointcloud.MaxLevels {
+		return a, nil, fmt.Errorf("discrete: %s ranges over more than %d values", a.Name, pointcloud.MaxLevels)
+	}
+	a.Levels = a.Levels[:0]
+	for d := 0; d <= int(span); d++ {
+		a.Levels = append(a.Levels, strconv.Itoa(lo+d))
+	}
+	for v := range index {
+		x, _ := strconv.Atoi(v)
+		index[v] = x - lo
+	}
+	return a, index, nil
+}
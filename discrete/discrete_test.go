@@ -0,0 +1,156 @@
+package discrete
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// means returns the mean of each variable of j, taking level indices as
+// values.
+func means(j *Joint) [3]float64 {
+	var mu [3]float64
+	n0, n1, _ := j.size()
+	for s, m := range j.Mass {
+		x := [3]int{s % n0, s / n0 % n1, s / (n0 * n1)}
+		for k := range mu {
+			mu[k] += m * float64(x[k])
+		}
+	}
+	return mu
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		kind      string
+		opts      Options
+		minTotal  float64
+		wantMeans [3]float64
+	}{
+		{"multinomial", Options{}, 1, [3]float64{2, 3, 1}},
+		{"multinomial", Options{N: 7, P: []float64{0.5, 0.5}}, 1, [3]float64{3.5, 3.5, 0}},
+		{"multinomial", Options{N: 40, P: []float64{0.25}}, 1, [3]float64{10, 0, 0}},
+		{"poisson", Options{}, 1 - Tail, [3]float64{2, 4, 1.5}},
+		{"poisson", Options{Lambda: []float64{30}}, 1 - Tail, [3]float64{30, 0, 0}},
+		// Each count of the negative multinomial has mean R q/p0.
+		{"negbinomial", Options{}, 1 - Tail, [3]float64{3 * 0.2 / 0.55, 3 * 0.15 / 0.55, 3 * 0.1 / 0.55}},
+		{"negbinomial", Options{R: 1.5, P: []float64{0.4}}, 1 - Tail, [3]float64{1.5 * 0.4 / 0.6, 0, 0}},
+	}
+	for _, tt := range tests {
+		j, err := Generate(tt.kind, tt.opts)
+		if err != nil {
+			t.Errorf("%s %+v: %v", tt.kind, tt.opts, err)
+			continue
+		}
+		if total := j.Total(); total < tt.minTotal-1e-9 || total > 1+1e-9 {
+			t.Errorf("%s %+v: total mass %v, want at least %v", tt.kind, tt.opts, total, tt.minTotal)
+		}
+		// Truncation may drop Tail of the mass from the far tail, which
+		// moves the means by a little more than that.
+		for k, mu := range means(j) {
+			if math.Abs(mu-tt.wantMeans[k]) > 1e-6+0.01*tt.wantMeans[k] {
+				t.Errorf("%s %+v: mean of x%d = %v, want %v", tt.kind, tt.opts, k+1, mu, tt.wantMeans[k])
+			}
+		}
+	}
+}
+
+func TestClosedForm(t *testing.T) {
+	j, err := Multinomial(Options{N: 2, P: []float64{0.5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x, want := range []float64{0.25, 0.5, 0.25} {
+		if math.Abs(j.Mass[x]-want) > 1e-12 {
+			t.Errorf("Binomial(2, 0.5) mass at %d = %v, want %v", x, j.Mass[x], want)
+		}
+	}
+	j, err = PoissonProduct(Options{Lambda: []float64{2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := range j.Mass {
+		want := math.Exp(-2) * math.Pow(2, float64(x))
+		for i := 2; i <= x; i++ {
+			want /= float64(i)
+		}
+		if math.Abs(j.Mass[x]-want) > 1e-12 {
+			t.Errorf("Poisson(2) mass at %d = %v, want %v", x, j.Mass[x], want)
+		}
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []struct {
+		kind string
+		opts Options
+	}{
+		{"multinomial", Options{N: -1}},
+		{"multinomial", Options{N: 1 << 20}},
+		{"multinomial", Options{P: []float64{0.6, 0.6}}},
+		{"multinomial", Options{P: []float64{0.1, 0.1, 0.1, 0.1}}},
+		{"multinomial", Options{P: []float64{math.NaN()}}},
+		{"poisson", Options{Lambda: []float64{}}},
+		{"poisson", Options{Lambda: []float64{-1}}},
+		{"poisson", Options{Lambda: []float64{math.Inf(1)}}},
+		{"negbinomial", Options{R: -1}},
+		{"negbinomial", Options{P: []float64{0.5, 0.5}}},
+		{"binomial", Options{}},
+	}
+	for _, tt := range tests {
+		if _, err := Generate(tt.kind, tt.opts); err == nil {
+			t.Errorf("%s %+v: no error", tt.kind, tt.opts)
+		}
+	}
+}
+
+func TestReadTable(t *testing.T) {
+	j, err := ReadTable(strings.NewReader("# a comment\ncount,color,mass\n1,red,1\n3,blue,2\n1,red,1\n3,red,4\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Integer variables get every level from their smallest to their
+	// largest value; categorical variables keep their order.
+	if got := strings.Join(j.Axes[0].Levels, " "); j.Axes[0].Name != "count" || got != "1 2 3" {
+		t.Errorf("count axis %q has levels %q", j.Axes[0].Name, got)
+	}
+	if got := strings.Join(j.Axes[1].Levels, " "); got != "red blue" {
+		t.Errorf("color levels %q", got)
+	}
+	want := []float64{0.25, 0, 0.5, 0, 0, 0.25}
+	for s, m := range j.Mass {
+		if math.Abs(m-want[s]) > 1e-12 {
+			t.Errorf("mass = %v, want %v", j.Mass, want)
+			break
+		}
+	}
+
+	j, err = ReadTable(strings.NewReader("x\tp\n-2\t0.5\n2\t0.5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(j.Axes[0].Levels); n != 5 || j.Axes[0].Levels[0] != "-2" || j.Mass[0] != 0.5 || j.Mass[4] != 0.5 {
+		t.Errorf("tab-separated table: levels %v, mass %v", j.Axes[0].Levels, j.Mass)
+	}
+}
+
+func TestReadTableErrors(t *testing.T) {
+	minInt, maxInt := strconv.Itoa(math.MinInt), strconv.Itoa(math.MaxInt)
+	tests := map[string]string{
+		"no rows":        "x,mass\n",
+		"no variables":   "mass\n1\n",
+		"four variables": "a,b,c,d,mass\n1,1,1,1,1\n",
+		"negative mass":  "x,mass\n1,-1\n",
+		"NaN mass":       "x,mass\n1,NaN\n",
+		"no mass":        "x,mass\n1,0\n2,0\n",
+		"wide range":     "x,mass\n0,1\n1000000,1\n",
+		"overflow range": "x,mass\n" + minInt + ",1\n" + maxInt + ",1\n",
+		"too many sites": "x,y,z,mass\n0,0,0,1\n199,199,199,1\n",
+	}
+	for name, table := range tests {
+		if _, err := ReadTable(strings.NewReader(table)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/stats"
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+const (
+	// driftInterval is the least time between drift checks of a stream.
+	driftInterval = time.Second
+	// minDriftPoints is the smallest window compared against the reference.
+	minDriftPoints = 100
+	// driftCells is the number of grid cells per axis searched for the
+	// drifting region.
+	driftCells = 4
+)
+
+// driftConfig configures drift monitoring of a stream.
+type driftConfig struct {
+	// Method is "mmd" (squared maximum mean discrepancy with a Gaussian
+	// kernel, the default) or "energy" (the energy coefficient).
+	Method string `json:"method"`
+	// Threshold is the statistic above which the stream is drifting.
+	Threshold float64 `json:"threshold"`
+	// Baseline names a dataset, with optional ?parameters, to compare
+	// against. Without it the window at the time monitoring starts becomes
+	// the reference.
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// driftResult is the outcome of one drift check.
+type driftResult struct {
+	Seq       int           `json:"seq"`
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Statistic float64       `json:"statistic"`
+	Threshold float64       `json:"threshold"`
+	Drifting  bool          `json:"drifting"`
+	Reference int           `json:"reference"` // points compared on each side
+	Window    int           `json:"window"`
+	Region    *stats.Region `json:"region,omitempty"` // set while drifting
+}
+
+// driftMonitor compares a stream's sliding window against a reference
+// sample. It is guarded by the stream's mutex.
+type driftMonitor struct {
+	config    driftConfig
+	reference [][3]float64 // nil until the window is large enough
+	running   bool
+	last      time.Time
+	result    *driftResult
+	alerts    int64 // transitions into the drifting state
+
+	// skipped is set when a check is put off because one is running or
+	// the last is too recent, and followUp while a timer will retry it.
+	skipped, followUp bool
+}
+
+// startDrift begins monitoring s, replacing any earlier configuration. A
+// baseline dataset is loaded within the span in ctx.
+func (s *liveStream) startDrift(ctx context.Context, config driftConfig) error {
+	switch config.Method {
+	case "":
+		config.Method = "mmd"
+	case "mmd", "energy":
+	default:
+		return fmt.Errorf("unknown drift method %q", config.Method)
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 0.01
+	}
+	m := &driftMonitor{config: config}
+	if config.Baseline != "" {
+		u, err := url.Parse(config.Baseline)
+		if err != nil {
+			return fmt.Errorf("baseline: %v", err)
+		}
+		c, err := datasets.Get(ctx, u.Path, u.Query())
+		if err != nil {
+			return fmt.Errorf("baseline: %v", err)
+		}
+		points := make([][3]float64, c.Len())
+		for i := range points {
+			x, y, z := c.Point(i)
+			points[i] = [3]float64{float64(x), float64(y), float64(z)}
+		}
+		m.reference = stats.Thin(points, stats.MaxComparePoints)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m.reference == nil {
+		if window := s.summary.Window.Points(); len(window) >= minDriftPoints {
+			m.reference = stats.Thin(window, stats.MaxComparePoints)
+		}
+	}
+	s.drift = m
+	s.scheduleDrift()
+	return nil
+}
+
+func (s *liveStream) stopDrift() {
+	s.mu.Lock()
+	s.drift = nil
+	s.mu.Unlock()
+}
+
+// driftState returns the monitoring configuration and latest result, or
+// nils if the stream is not monitored.
+func (s *liveStream) driftState() (*driftConfig, *driftResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.drift == nil {
+		return nil, nil
+	}
+	config := s.drift.config
+	return &config, s.drift.result
+}
+
+// scheduleDrift starts a drift check in the background unless one is
+// running or the last one is too recent. A check put off is made once the
+// running one ends or the interval has passed, so the last points of a
+// burst of appends are compared even if no more arrive. s.mu must be held.
+func (s *liveStream) scheduleDrift() {
+	m := s.drift
+	if m == nil {
+		return
+	}
+	if m.running {
+		m.skipped = true
+		return
+	}
+	if since := time.Since(m.last); since < driftInterval {
+		m.skipped = true
+		if !m.followUp {
+			m.followUp = true
+			time.AfterFunc(driftInterval-since, func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				m.followUp = false
+				if s.drift == m && m.skipped {
+					s.scheduleDrift()
+				}
+			})
+		}
+		return
+	}
+	m.skipped = false
+	window := s.summary.Window.Points()
+	if len(window) < minDriftPoints {
+		return
+	}
+	window = stats.Thin(window, stats.MaxComparePoints)
+	if m.reference == nil {
+		m.reference = window
+		return
+	}
+	m.running = true
+	m.last = time.Now()
+	go s.checkDrift(m, window)
+}
+
+// checkDrift compares window against the monitor's reference and publishes
+// the result to subscribers. Each check is traced as a job of its own.
+func (s *liveStream) checkDrift(m *driftMonitor, window [][3]float64) {
+	_, span := trace.Start(context.Background(), "drift.check")
+	defer span.End()
+	r := &driftResult{
+		Time:      time.Now(),
+		Method:    m.config.Method,
+		Threshold: m.config.Threshold,
+		Reference: len(m.reference),
+		Window:    len(window),
+	}
+	if m.config.Method == "energy" {
+		_, r.Statistic = stats.EnergyDistance(m.reference, window)
+	} else {
+		r.Statistic = stats.MMD(m.reference, window, 0)
+	}
+	r.Drifting = r.Statistic > r.Threshold
+	if r.Drifting {
+		region := stats.DriftRegion(m.reference, window, driftCells)
+		r.Region = &region
+	}
+	span.Set("stream", s.name, "method", r.Method, "reference", r.Reference, "window", r.Window,
+		"statistic", r.Statistic, "threshold", r.Threshold, "drifting", r.Drifting)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.running = false
+	if s.drift != m {
+		return // reconfigured meanwhile
+	}
+	if m.skipped {
+		defer s.scheduleDrift()
+	}
+	if r.Drifting && (m.result == nil || !m.result.Drifting) {
+		m.alerts++
+	}
+	if m.result != nil {
+		r.Seq = m.result.Seq
+	}
+	r.Seq++
+	m.result = r
+	s.notify()
+}
+
+// handleDrift serves /api/streams/<name>/drift: GET returns the
+// configuration and latest result, POST starts monitoring with a JSON
+// driftConfig and DELETE stops it.
+func handleDrift(w http.ResponseWriter, r *http.Request, s *liveStream) {
+	switch r.Method {
+	case http.MethodPost:
+		var config driftConfig
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, fmt.Sprintf("drift config: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := s.startDrift(r.Context(), config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		s.stopDrift()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	config, result := s.driftState()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"config": config, "result": result})
+}
+
+func (h *streamHub) registerDriftMetrics() {
+	drift := func(fn func(m *driftMonitor) float64) func() []sample {
+		return func() []sample {
+			var samples []sample
+			for _, s := range h.list() {
+				s.mu.Lock()
+				if s.drift != nil {
+					samples = append(samples, sample{labels("stream", s.name), fn(s.drift)})
+				}
+				s.mu.Unlock()
+			}
+			return samples
+		}
+	}
+	registerMetric("threedistvis_stream_drift", "gauge", "Latest drift statistic of each monitored stream.",
+		drift(func(m *driftMonitor) float64 {
+			if m.result == nil {
+				return 0
+			}
+			return m.result.Statistic
+		}))
+	registerMetric("threedistvis_stream_drift_threshold", "gauge", "Drift threshold of each monitored stream.",
+		drift(func(m *driftMonitor) float64 { return m.config.Threshold }))
+	registerMetric("threedistvis_stream_drifting", "gauge", "Whether each monitored stream is drifting (1) or not (0).",
+		drift(func(m *driftMonitor) float64 {
+			if m.result != nil && m.result.Drifting {
+				return 1
+			}
+			return 0
+		}))
+	registerMetric("threedistvis_stream_drift_alerts_total", "counter", "Times each monitored stream started drifting.",
+		drift(func(m *driftMonitor) float64 { return float64(m.alerts) }))
+}
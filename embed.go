@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/manifold"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+const (
+	// defaultEmbedPoints is the sample of a dataset embedded unless the
+	// client asks for another size, and maxEmbedPoints the largest it may
+	// ask for.
+	defaultEmbedPoints = 5000
+	maxEmbedPoints     = 20000
+	// embedEventInterval limits how often progress and layouts are sent;
+	// the embedding runs on meanwhile and only its latest state is sent.
+	embedEventInterval = 200 * time.Millisecond
+)
+
+// embedMethods are the embeddings served, by name.
+var embedMethods = map[string]func(context.Context, [][]float64, manifold.Options, func(manifold.Progress)) ([][3]float64, error){
+	"umap":   manifold.UMAP,
+	"isomap": manifold.Isomap,
+}
+
+// handleEmbed serves GET /api/embed/<dataset>: a nonlinear embedding of a
+// sample of the dataset's points in three dimensions, computed while the
+// client watches, as server-sent events:
+//
+//	start     {"method", "points", "features", "indices"}; indices lists the
+//	          sampled points, or is absent if all points are embedded
+//	progress  {"phase", "step", "steps"}
+//	layout    the same with "positions", base64 little-endian float32 x, y, z
+//	done      {} after the final layout
+//	failed    {"error"}
+//
+// The query takes the dataset's loader parameters as one query string in
+// options, method (umap or isomap), the comma-separated features to embed
+// (x, y, z and attribute names; default x,y,z), the sample size in points,
+// and neighbors, epochs, mindist, landmarks and seed as in
+// manifold.Options. Since an EventSource cannot read the body of an error
+// response, errors are reported as failed events too. The embedding stops
+// when the client disconnects.
+func handleEmbed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	send := func(event string, v interface{}) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			trace.Println(r.Context(), "Embed event error:", err)
+			return false
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+		return err == nil
+	}
+	fail := func(err error) {
+		send("failed", map[string]string{"error": err.Error()})
+	}
+
+	ctx := r.Context()
+	name := strings.TrimPrefix(r.URL.Path, "/api/embed/")
+	query := r.URL.Query()
+	method := query.Get("method")
+	if method == "" {
+		method = "umap"
+	}
+	embed, ok := embedMethods[method]
+	if !ok {
+		fail(fmt.Errorf("unknown method %q; want umap or isomap", method))
+		return
+	}
+	opts, size, err := embedOptions(query)
+	if err != nil {
+		fail(err)
+		return
+	}
+	params, err := url.ParseQuery(query.Get("options"))
+	if err != nil {
+		fail(fmt.Errorf("options: %v", err))
+		return
+	}
+	c, err := datasets.Get(ctx, name, params)
+	if err != nil {
+		fail(err)
+		return
+	}
+	features := strings.Split(query.Get("features"), ",")
+	if query.Get("features") == "" {
+		features = []string{"x", "y", "z"}
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	data, indices, err := embedInput(c, features, size, rng)
+	if err != nil {
+		fail(err)
+		return
+	}
+	start := map[string]interface{}{"method": method, "points": len(indices), "features": features}
+	if len(indices) < c.Len() {
+		start["indices"] = indices
+	}
+	if !send("start", start) {
+		return
+	}
+
+	// The embedding leaves its latest progress in updates, replacing any
+	// that has not been sent yet.
+	updates := make(chan manifold.Progress, 1)
+	done := make(chan error, 1)
+	go func() {
+		_, err := embed(ctx, data, opts, func(p manifold.Progress) {
+			select {
+			case <-updates:
+			default:
+			}
+			updates <- p
+		})
+		done <- err
+	}()
+	sendProgress := func(p manifold.Progress) bool {
+		if p.Layout == nil {
+			return send("progress", p)
+		}
+		return send("layout", map[string]interface{}{"phase": p.Phase, "step": p.Step, "steps": p.Steps, "positions": encodeLayout(p.Layout)})
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-updates:
+			if !sendProgress(p) {
+				return
+			}
+		case err := <-done:
+			select {
+			case p := <-updates:
+				if !sendProgress(p) {
+					return
+				}
+			default:
+			}
+			if err != nil {
+				fail(err)
+			} else {
+				send("done", struct{}{})
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(embedEventInterval):
+		}
+	}
+}
+
+// embedOptions parses the embedding parameters of query.
+func embedOptions(query url.Values) (opts manifold.Options, size int, err error) {
+	size, err = intParam(query, "points", defaultEmbedPoints)
+	if err == nil && (size < 4 || size > maxEmbedPoints) {
+		err = fmt.Errorf("parameter points must be between 4 and %d", maxEmbedPoints)
+	}
+	if err == nil {
+		opts.Neighbors, err = intParam(query, "neighbors", 0)
+	}
+	if err == nil {
+		opts.Epochs, err = intParam(query, "epochs", 0)
+	}
+	if err == nil {
+		opts.MinDist, err = floatParam(query, "mindist", 0)
+	}
+	if err == nil {
+		opts.Landmarks, err = intParam(query, "landmarks", 0)
+	}
+	var seed int
+	if err == nil {
+		seed, err = intParam(query, "seed", 1)
+	}
+	opts.Seed = int64(seed)
+	return opts, size, err
+}
+
+// embedInput returns the named features of a random sample of at most
+// size points of c, skipping points where any is NaN, and the indices of
+// the sampled points in c, in increasing order. The features x, y and z
+// are the coordinates; others name attributes.
+func embedInput(c *pointcloud.Cloud, features []string, size int, rng *rand.Rand) (data [][]float64, indices []int, err error) {
+	columns := make([][]float32, len(features))
+	for f := range features {
+		features[f] = strings.TrimSpace(features[f])
+		switch name := features[f]; name {
+		case "x", "y", "z":
+			k := int(name[0] - 'x')
+			columns[f] = make([]float32, c.Len())
+			for i := range columns[f] {
+				columns[f][i] = c.Positions[3*i+k]
+			}
+		default:
+			if columns[f] = c.Attribute(name); columns[f] == nil {
+				return nil, nil, fmt.Errorf("dataset %s has no attribute %q", c.Name, name)
+			}
+		}
+	}
+	for i := 0; i < c.Len(); i++ {
+		finite := true
+		for _, col := range columns {
+			finite = finite && !math.IsNaN(float64(col[i])) && !math.IsInf(float64(col[i]), 0)
+		}
+		if finite {
+			indices = append(indices, i)
+		}
+	}
+	if len(indices) > size {
+		rng.Shuffle(len(indices), func(a, b int) { indices[a], indices[b] = indices[b], indices[a] })
+		indices = indices[:size]
+		sort.Ints(indices)
+	}
+	if len(indices) == 0 {
+		return nil, nil, errors.New("no points with finite features")
+	}
+	data = make([][]float64, len(indices))
+	for r, i := range indices {
+		data[r] = make([]float64, len(columns))
+		for f, col := range columns {
+			data[r][f] = float64(col[i])
+		}
+	}
+	return data, indices, nil
+}
+
+// encodeLayout returns a layout as base64 little-endian float32 x, y, z.
+func encodeLayout(layout [][3]float64) string {
+	b := make([]byte, 0, 12*len(layout))
+	for _, p := range layout {
+		for _, x := range p {
+			b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(x)))
+		}
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,278 @@
+// Package expr parses and evaluates arithmetic formulas such as
+// "sin(x) * cos(y)" over a fixed set of named variables, for surfaces and
+// other user-defined functions.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled formula.
+type Expr struct {
+	src  string
+	vars []string
+	eval func(args []float64) float64
+}
+
+// Parse compiles src, which may refer to the given variables, the constants
+// pi and e, the operators + - * / ^ (right-associative power) and the
+// functions sin, cos, tan, asin, acos, atan, sinh, cosh, tanh, exp, log,
+// sqrt, abs, floor, ceil, atan2, pow, min and max.
+func Parse(src string, vars ...string) (*Expr, error) {
+	p := &parser{src: src, vars: vars}
+	p.next()
+	eval, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "" {
+		return nil, p.errorf("unexpected %q", p.tok)
+	}
+	return &Expr{src: src, vars: vars, eval: eval}, nil
+}
+
+// Eval evaluates the formula with args bound to the variables, in the order
+// given to Parse.
+func (e *Expr) Eval(args ...float64) float64 {
+	return e.eval(args)
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Const evaluates a formula without variables, such as "2*pi".
+func Const(src string) (float64, error) {
+	e, err := Parse(src)
+	if err != nil {
+		return 0, err
+	}
+	return e.Eval(), nil
+}
+
+var constants = map[string]float64{"pi": math.Pi, "e": math.E}
+
+var unary = map[string]func(float64) float64{
+	"sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	"asin": math.Asin, "acos": math.Acos, "atan": math.Atan,
+	"sinh": math.Sinh, "cosh": math.Cosh, "tanh": math.Tanh,
+	"exp": math.Exp, "log": math.Log, "sqrt": math.Sqrt, "abs": math.Abs,
+	"floor": math.Floor, "ceil": math.Ceil,
+}
+
+var binary = map[string]func(float64, float64) float64{
+	"atan2": math.Atan2, "pow": math.Pow, "min": math.Min, "max": math.Max,
+}
+
+type parser struct {
+	src  string
+	vars []string
+	pos  int    // offset after tok
+	tok  string // current token, "" at the end
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expr %q: %s", p.src, fmt.Sprintf(format, args...))
+}
+
+// next advances to the next token: a number, a name or one operator
+// character.
+func (p *parser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = ""
+		return
+	}
+	c := rune(p.src[p.pos])
+	switch {
+	case unicode.IsDigit(c) || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		// Exponent, as in 1e-3.
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			q := p.pos + 1
+			if q < len(p.src) && (p.src[q] == '+' || p.src[q] == '-') {
+				q++
+			}
+			if q < len(p.src) && isDigit(p.src[q]) {
+				for q < len(p.src) && isDigit(p.src[q]) {
+					q++
+				}
+				p.pos = q
+			}
+		}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+type node = func(args []float64) float64
+
+// expr parses a sum: term {(+|-) term}.
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok
+		p.next()
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "+" {
+			left = func(a []float64) float64 { return l(a) + right(a) }
+		} else {
+			left = func(a []float64) float64 { return l(a) - right(a) }
+		}
+	}
+	return left, nil
+}
+
+// term parses a product: unary {(*|/) unary}.
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok
+		p.next()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if op == "*" {
+			left = func(a []float64) float64 { return l(a) * right(a) }
+		} else {
+			left = func(a []float64) float64 { return l(a) / right(a) }
+		}
+	}
+	return left, nil
+}
+
+// unary parses a signed power, so that -x^2 is -(x^2).
+func (p *parser) unary() (node, error) {
+	switch p.tok {
+	case "-":
+		p.next()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(a []float64) float64 { return -operand(a) }, nil
+	case "+":
+		p.next()
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power parses primary [^ unary].
+func (p *parser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != "^" {
+		return base, nil
+	}
+	p.next()
+	exp, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(a []float64) float64 { return math.Pow(base(a), exp(a)) }, nil
+}
+
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, p.errorf("unexpected end")
+	case tok == "(":
+		p.next()
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return n, nil
+	case isDigit(tok[0]) || tok[0] == '.':
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", tok)
+		}
+		p.next()
+		return func([]float64) float64 { return v }, nil
+	case unicode.IsLetter(rune(tok[0])) || tok[0] == '_':
+		p.next()
+		if p.tok == "(" {
+			return p.call(tok)
+		}
+		for i, v := range p.vars {
+			if v == tok {
+				return func(a []float64) float64 { return a[i] }, nil
+			}
+		}
+		if v, ok := constants[tok]; ok {
+			return func([]float64) float64 { return v }, nil
+		}
+		return nil, p.errorf("unknown name %q (variables: %s)", tok, strings.Join(p.vars, ", "))
+	}
+	return nil, p.errorf("unexpected %q", tok)
+}
+
+// call parses the arguments of function name; the current token is "(".
+func (p *parser) call(name string) (node, error) {
+	p.next()
+	var args []node
+	for p.tok != ")" {
+		if len(args) > 0 {
+			if p.tok != "," {
+				return nil, p.errorf("expected , or ) in call to %s", name)
+			}
+			p.next()
+		}
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+	if f, ok := unary[name]; ok {
+		if len(args) != 1 {
+			return nil, p.errorf("%s takes 1 argument", name)
+		}
+		x := args[0]
+		return func(a []float64) float64 { return f(x(a)) }, nil
+	}
+	if f, ok := binary[name]; ok {
+		if len(args) != 2 {
+			return nil, p.errorf("%s takes 2 arguments", name)
+		}
+		x, y := args[0], args[1]
+		return func(a []float64) float64 { return f(x(a), y(a)) }, nil
+	}
+	return nil, p.errorf("unknown function %q", name)
+}
@@ -0,0 +1,130 @@
+// Package geom provides the small amount of linear algebra the viewer and
+// renderers share: 3-vectors and 4x4 transforms.
+package geom
+
+import "math"
+
+// Vec3 is a point or direction in 3D.
+type Vec3 [3]float32
+
+func (a Vec3) Add(b Vec3) Vec3 { return Vec3{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a Vec3) Sub(b Vec3) Vec3 { return Vec3{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a Vec3) Scale(s float32) Vec3 {
+	return Vec3{a[0] * s, a[1] * s, a[2] * s}
+}
+func (a Vec3) Dot(b Vec3) float32 { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+func (a Vec3) Cross(b Vec3) Vec3 {
+	return Vec3{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+func (a Vec3) Len() float32 { return float32(math.Sqrt(float64(a.Dot(a)))) }
+
+// Normalize returns a scaled to unit length, or a itself if it is zero.
+func (a Vec3) Normalize() Vec3 {
+	if l := a.Len(); l > 0 {
+		return a.Scale(1 / l)
+	}
+	return a
+}
+
+// Mat4 is a 4x4 matrix stored in column-major order, as WebGL expects.
+type Mat4 [16]float32
+
+// Identity returns the identity matrix.
+func Identity() Mat4 {
+	return Mat4{1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+// Translate returns a translation by t.
+func Translate(t Vec3) Mat4 {
+	m := Identity()
+	m[12], m[13], m[14] = t[0], t[1], t[2]
+	return m
+}
+
+// Scale returns a scaling by s along each axis.
+func Scale(s Vec3) Mat4 {
+	m := Identity()
+	m[0], m[5], m[10] = s[0], s[1], s[2]
+	return m
+}
+
+// RotateX returns a right-handed rotation by angle radians about x.
+func RotateX(angle float32) Mat4 {
+	s, c := sincos(angle)
+	return Mat4{1, 0, 0, 0, 0, c, s, 0, 0, -s, c, 0, 0, 0, 0, 1}
+}
+
+// RotateY returns a right-handed rotation by angle radians about y.
+func RotateY(angle float32) Mat4 {
+	s, c := sincos(angle)
+	return Mat4{c, 0, -s, 0, 0, 1, 0, 0, s, 0, c, 0, 0, 0, 0, 1}
+}
+
+// RotateZ returns a right-handed rotation by angle radians about z.
+func RotateZ(angle float32) Mat4 {
+	s, c := sincos(angle)
+	return Mat4{c, s, 0, 0, -s, c, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1}
+}
+
+func sincos(angle float32) (s, c float32) {
+	sin, cos := math.Sincos(float64(angle))
+	return float32(sin), float32(cos)
+}
+
+// Mul returns m·n, the transform applying n first and then m.
+func (m Mat4) Mul(n Mat4) Mat4 {
+	var r Mat4
+	for col := 0; col < 4; col++ {
+		for row := 0; row < 4; row++ {
+			var sum float32
+			for k := 0; k < 4; k++ {
+				sum += m[k*4+row] * n[col*4+k]
+			}
+			r[col*4+row] = sum
+		}
+	}
+	return r
+}
+
+// Apply transforms the point p, dividing by w.
+func (m Mat4) Apply(p Vec3) Vec3 {
+	x, y, z, w := m.Apply4(p)
+	if w != 0 && w != 1 {
+		return Vec3{x / w, y / w, z / w}
+	}
+	return Vec3{x, y, z}
+}
+
+// Apply4 transforms the point p and returns homogeneous coordinates.
+func (m Mat4) Apply4(p Vec3) (x, y, z, w float32) {
+	x = m[0]*p[0] + m[4]*p[1] + m[8]*p[2] + m[12]
+	y = m[1]*p[0] + m[5]*p[1] + m[9]*p[2] + m[13]
+	z = m[2]*p[0] + m[6]*p[1] + m[10]*p[2] + m[14]
+	w = m[3]*p[0] + m[7]*p[1] + m[11]*p[2] + m[15]
+	return x, y, z, w
+}
+
+// Perspective returns a projection with vertical field of view fovy
+// radians, mapping view depths near..far to clip depths -1..1.
+func Perspective(fovy, aspect, near, far float32) Mat4 {
+	f := 1 / float32(math.Tan(float64(fovy)/2))
+	return Mat4{
+		f / aspect, 0, 0, 0,
+		0, f, 0, 0,
+		0, 0, (far + near) / (near - far), -1,
+		0, 0, 2 * far * near / (near - far), 0,
+	}
+}
+
+// LookAt returns a view transform for a camera at eye looking at target.
+func LookAt(eye, target, up Vec3) Mat4 {
+	f := target.Sub(eye).Normalize()
+	s := f.Cross(up).Normalize()
+	u := s.Cross(f)
+	return Mat4{
+		s[0], u[0], -f[0], 0,
+		s[1], u[1], -f[1], 0,
+		s[2], u[2], -f[2], 0,
+		-s.Dot(eye), -u.Dot(eye), f.Dot(eye), 1,
+	}
+}
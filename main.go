@@ -1,17 +1,74 @@
 package main
 
 import (
-    "fmt"
-    "net/http"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/trace"
 )
 
 func main() {
-    fs := http.FileServer(http.Dir("wasm"))
-    http.Handle("/", fs)
+	flag.StringVar(&dataDir, "data", dataDir, "directory holding volume files and PMF tables")
+	cacheMB := flag.Int64("cache-mb", 1024, "memory budget in MiB for cached datasets")
+	flag.StringVar(&clientMode, "client", clientMode, "client build to serve: auto, tinygo or go")
+	window := flag.Int("stream-window", 10000, "points in the sliding window of each live stream")
+	reservoir := flag.Int("stream-reservoir", 5000, "size of the uniform sample kept for each live stream")
+	commentsPath := flag.String("comments", "comments.json", "file to keep comment threads in (empty: memory only)")
+	otlpEndpoint := flag.String("otlp-endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector to export traces to, e.g. http://localhost:4318 (default: no export)")
+	flag.Parse()
+	if *window < 1 {
+		fmt.Println("Flag -stream-window must be at least 1")
+		os.Exit(1)
+	}
+
+	if *otlpEndpoint != "" {
+		exporter := trace.NewExporter(*otlpEndpoint, "threedistvis-go")
+		trace.SetExporter(exporter)
+		registerTraceMetrics(exporter)
+		// Send queued spans before exiting.
+		go func() {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			<-sig
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			exporter.Shutdown(ctx)
+			os.Exit(0)
+		}()
+		fmt.Println("Exporting traces to", *otlpEndpoint)
+	}
+
+	datasets = newDatasetCache(*cacheMB<<20, loadDataset)
+	streams = newStreamHub(*window, *reservoir)
+	registerRemoteMetrics()
+	var err error
+	if comments, err = openCommentStore(*commentsPath); err != nil {
+		fmt.Println("Comments error:", err)
+		os.Exit(1)
+	}
+
+	fs := http.FileServer(http.Dir(staticDir))
+	http.Handle("/", fs)
+	http.HandleFunc("/main.wasm", handleClientFile(false))
+	http.HandleFunc("/wasm_exec.js", handleClientFile(true))
+	http.HandleFunc("/api/datasets/", trace.Handler("/api/datasets/", handleDataset))
+	http.HandleFunc("/api/streams/", trace.Handler("/api/streams/", handleStream))
+	http.HandleFunc("/api/pattern/", trace.Handler("/api/pattern/", handlePattern))
+	http.HandleFunc("/api/embed/", trace.Handler("/api/embed/", handleEmbed))
+	http.HandleFunc("/api/render/", handleRender)
+	http.HandleFunc("/api/comments/", trace.Handler("/api/comments/", handleComments))
+	http.HandleFunc("/api/client/", trace.Handler("/api/client/", handleClient))
+	http.HandleFunc("/metrics", handleMetrics)
 
-    fmt.Println("Server running at http://localhost:8080")
-    err := http.ListenAndServe(":8080", nil)
-    if err != nil {
-        fmt.Println("Server error:", err)
-    }
+	fmt.Println("Server running at http://localhost:8080")
+	err = http.ListenAndServe(":8080", nil)
+	if err != nil {
+		fmt.Println("Server error:", err)
+	}
 }
@@ -0,0 +1,467 @@
+package manifold
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+)
+
+// maxPowerSteps bounds the subspace iterations of the landmark MDS, which
+// stop sooner once the eigenvectors settle to within powerTolerance.
+// Every layoutEvery iterations the layout is reported.
+const (
+	maxPowerSteps  = 300
+	powerTolerance = 1e-10
+	layoutEvery    = 5
+)
+
+// flatEigenvalue is the fraction of the largest eigenvalue of the landmark
+// scaling below which a coordinate is dropped: its spread is then under 3%
+// of the first coordinate's, and placing points along it mostly magnifies
+// the error of the geodesic distances.
+const flatEigenvalue = 1e-3
+
+// Isomap embeds data in three dimensions so that distances in the layout
+// match geodesic distances, measured along shortest paths through the
+// neighbor graph. It is landmark Isomap (de Silva and Tenenbaum, 2003):
+// shortest paths start from a random subset of landmark points only, the
+// landmarks are placed by classical multidimensional scaling of their
+// geodesic distances, and every point is then placed from its distances to
+// the landmarks. Components of the neighbor graph are joined by their
+// closest pairs of points. The scaling finds the top eigenvectors by
+// subspace iteration, reporting the layout they give as they converge.
+func Isomap(ctx context.Context, data [][]float64, opts Options, report func(Progress)) ([][3]float64, error) {
+	if opts.Neighbors == 0 {
+		opts.Neighbors = DefaultIsomapNeighbors
+	}
+	if opts.Landmarks == 0 {
+		opts.Landmarks = DefaultLandmarks
+	}
+	if err := check(data, opts); err != nil {
+		return nil, err
+	}
+	if opts.Landmarks < 4 || opts.Landmarks > MaxLandmarks {
+		return nil, fmt.Errorf("manifold: landmarks must be between 4 and %d", MaxLandmarks)
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	g, err := nearestNeighbors(ctx, data, opts.Neighbors, rng, report)
+	if err != nil {
+		return nil, err
+	}
+	adj := undirected(g)
+	if err := connect(ctx, data, adj, rng, report); err != nil {
+		return nil, err
+	}
+
+	n := len(data)
+	m := min(opts.Landmarks, n)
+	landmarks := rng.Perm(n)[:m]
+	// d2[l][i] is the squared geodesic distance from landmark l to point i.
+	d2 := make([][]float64, m)
+	for l, s := range landmarks {
+		report(Progress{Phase: "geodesics", Step: l, Steps: m})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d2[l] = shortestPaths(adj, s)
+		for i, d := range d2[l] {
+			d2[l][i] = d * d
+		}
+	}
+	report(Progress{Phase: "geodesics", Step: m, Steps: m})
+
+	// Double-center the squared distances between landmarks.
+	b := make([][]float64, m)
+	rowMean := make([]float64, m)
+	var mean float64
+	for l := range b {
+		b[l] = make([]float64, m)
+		for r, s := range landmarks {
+			b[l][r] = d2[l][s]
+			rowMean[l] += d2[l][s] / float64(m)
+		}
+		mean += rowMean[l] / float64(m)
+	}
+	for l := range b {
+		for r := range b[l] {
+			b[l][r] = -(b[l][r] - rowMean[l] - rowMean[r] + mean) / 2
+		}
+	}
+	// Shift the spectrum to make it positive, so the iteration finds the
+	// largest eigenvalues rather than the largest in magnitude.
+	var shift float64
+	for l := range b {
+		var s float64
+		for _, x := range b[l] {
+			s += math.Abs(x)
+		}
+		shift = math.Max(shift, s)
+	}
+
+	q := make([][3]float64, m)
+	for l := range q {
+		for k := range q[l] {
+			q[l][k] = rng.NormFloat64()
+		}
+	}
+	orthonormalize(q)
+	var y [][3]float64
+	for step := 1; step <= maxPowerSteps; step++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		z := make([][3]float64, m)
+		for l := range z {
+			for r, x := range b[l] {
+				for k := range z[l] {
+					z[l][k] += x * q[r][k]
+				}
+			}
+			for k := range z[l] {
+				z[l][k] += shift * q[l][k]
+			}
+		}
+		orthonormalize(z)
+		var change float64
+		for l := range z {
+			for k := range z[l] {
+				change = math.Max(change, math.Abs(math.Abs(z[l][k])-math.Abs(q[l][k])))
+			}
+		}
+		q = z
+		done := change < powerTolerance || step == maxPowerSteps
+		if done || step%layoutEvery == 0 {
+			y = place(b, q, d2, rowMean)
+			report(Progress{Phase: "scaling", Step: step, Steps: maxPowerSteps, Layout: copyLayout(y)})
+		}
+		if done {
+			break
+		}
+	}
+	return y, nil
+}
+
+// place returns the coordinates of every point given the landmark
+// eigenvectors q of b: each point goes where its squared distances d2 to
+// the landmarks differ least from those of the landmarks' mean, whose row
+// means are mean.
+//
+// Data of fewer intrinsic dimensions than three leaves eigenvalues that
+// are only rounding error or the error of the geodesics; dividing by their
+// roots would blow the layout up, so coordinates whose eigenvalue is below
+// flatEigenvalue of the largest stay 0.
+func place(b [][]float64, q [][3]float64, d2 [][]float64, mean []float64) [][3]float64 {
+	var lambda [3]float64
+	for k := range lambda {
+		// The Rayleigh quotient gives the eigenvalue.
+		for l := range b {
+			var bq float64
+			for r, x := range b[l] {
+				bq += x * q[r][k]
+			}
+			lambda[k] += q[l][k] * bq
+		}
+	}
+	largest := math.Max(lambda[0], math.Max(lambda[1], lambda[2]))
+	var scale [3]float64
+	for k, l := range lambda {
+		if l > flatEigenvalue*largest {
+			scale[k] = 1 / math.Sqrt(l)
+		}
+	}
+	y := make([][3]float64, len(d2[0]))
+	for i := range y {
+		for l := range d2 {
+			delta := d2[l][i] - mean[l]
+			for k := range y[i] {
+				y[i][k] -= delta * q[l][k] * scale[k] / 2
+			}
+		}
+	}
+	return y
+}
+
+// orthonormalize makes the columns of q orthonormal by Gram–Schmidt.
+func orthonormalize(q [][3]float64) {
+	for k := 0; k < 3; k++ {
+		for j := 0; j < k; j++ {
+			var dot float64
+			for l := range q {
+				dot += q[l][k] * q[l][j]
+			}
+			for l := range q {
+				q[l][k] -= dot * q[l][j]
+			}
+		}
+		var norm float64
+		for l := range q {
+			norm += q[l][k] * q[l][k]
+		}
+		norm = math.Sqrt(norm)
+		for l := range q {
+			q[l][k] /= norm
+		}
+	}
+}
+
+type edge struct {
+	to   int32
+	dist float64
+}
+
+// undirected returns the neighbor graph with every edge in both
+// directions.
+func undirected(g *neighborGraph) [][]edge {
+	adj := make([][]edge, len(g.index))
+	for i := range g.index {
+		for m, j := range g.index[i] {
+			d := g.dist[i][m]
+			adj[i] = append(adj[i], edge{j, d})
+			adj[j] = append(adj[j], edge{int32(i), d})
+		}
+	}
+	return adj
+}
+
+// connect joins the components of the graph by Borůvka's method: in each
+// round every component gains an edge to the closest point of another,
+// which at least halves their number. Candidates come from a grid over a
+// projection of the data, searched outward from each point until the
+// projected distance alone exceeds the best distance found, so far-apart
+// pairs are never compared. Each round is a step of the "connect" phase.
+func connect(ctx context.Context, data [][]float64, adj [][]edge, rng *rand.Rand, report func(Progress)) error {
+	comp, count := components(adj)
+	if count == 1 {
+		return nil
+	}
+	steps := bits.Len(uint(count - 1))
+	grid := newProjectionGrid(data, rng)
+	type link struct {
+		dist     float64
+		from, to int32
+	}
+	for round := 0; ; round++ {
+		report(Progress{Phase: "connect", Step: round, Steps: steps})
+		best := make([]link, count)
+		for c := range best {
+			best[c].dist = math.Inf(1)
+		}
+		for i := range data {
+			if i%1024 == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			c := comp[i]
+			grid.search(i, &best[c].dist, func(j int32) {
+				if comp[j] != c {
+					if d := dist(data[i], data[j]); d < best[c].dist {
+						best[c] = link{d, int32(i), j}
+					}
+				}
+			})
+		}
+		for _, l := range best {
+			adj[l.from] = append(adj[l.from], edge{l.to, l.dist})
+			adj[l.to] = append(adj[l.to], edge{l.from, l.dist})
+		}
+		if comp, count = components(adj); count == 1 {
+			report(Progress{Phase: "connect", Step: steps, Steps: steps})
+			return nil
+		}
+	}
+}
+
+// projectionGrid buckets points by their projection on up to three
+// orthonormal directions, which is never farther from another point's
+// projection than the points are from each other.
+type projectionGrid struct {
+	size  [3]int   // cells per axis
+	side  float64  // of a cell
+	cell  [][3]int // of each point
+	start []int32  // of each cell's points in points, by cell index
+	point []int32  // point indices, grouped by cell
+}
+
+func newProjectionGrid(data [][]float64, rng *rand.Rand) *projectionGrid {
+	n, d := len(data), len(data[0])
+	basis := make([][]float64, min(d, 3))
+	for b := range basis {
+		basis[b] = make([]float64, d)
+		for {
+			for k := range basis[b] {
+				basis[b][k] = rng.NormFloat64()
+			}
+			for _, prev := range basis[:b] {
+				var dot float64
+				for k := range prev {
+					dot += prev[k] * basis[b][k]
+				}
+				for k := range prev {
+					basis[b][k] -= dot * prev[k]
+				}
+			}
+			var norm float64
+			for _, x := range basis[b] {
+				norm += x * x
+			}
+			if norm > 1e-12 {
+				for k := range basis[b] {
+					basis[b][k] /= math.Sqrt(norm)
+				}
+				break
+			}
+		}
+	}
+	proj := make([][3]float64, n)
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for i, x := range data {
+		for b := range basis {
+			for k := range x {
+				proj[i][b] += x[k] * basis[b][k]
+			}
+		}
+		for b := range lo {
+			lo[b], hi[b] = math.Min(lo[b], proj[i][b]), math.Max(hi[b], proj[i][b])
+		}
+	}
+	// About two points per cell on average, over the longest side.
+	g := &projectionGrid{cell: make([][3]int, n), point: make([]int32, n)}
+	perAxis := math.Max(1, math.Cbrt(float64(n)/2))
+	g.side = math.Max(hi[0]-lo[0], math.Max(hi[1]-lo[1], hi[2]-lo[2])) / perAxis
+	if !(g.side > 0) {
+		g.side = 1
+	}
+	for b := range g.size {
+		g.size[b] = int((hi[b]-lo[b])/g.side) + 1
+	}
+	counts := make([]int32, g.size[0]*g.size[1]*g.size[2]+1)
+	for i, p := range proj {
+		for b := range p {
+			g.cell[i][b] = min(int((p[b]-lo[b])/g.side), g.size[b]-1)
+		}
+		counts[g.index(g.cell[i])+1]++
+	}
+	for c := 1; c < len(counts); c++ {
+		counts[c] += counts[c-1]
+	}
+	g.start = counts
+	next := append([]int32(nil), counts...)
+	for i := range proj {
+		c := g.index(g.cell[i])
+		g.point[next[c]] = int32(i)
+		next[c]++
+	}
+	return g
+}
+
+func (g *projectionGrid) index(c [3]int) int {
+	return c[0] + g.size[0]*(c[1]+g.size[1]*c[2])
+}
+
+// search calls visit with the points in cells ever farther from point i's
+// until the cells left are at least *bound away in projection. visit may
+// lower *bound.
+func (g *projectionGrid) search(i int, bound *float64, visit func(j int32)) {
+	center := g.cell[i]
+	reach := max(g.size[0], g.size[1], g.size[2])
+	for r := 0; r < reach; r++ {
+		// Points r cells away are more than r−1 cell sides away.
+		if float64(r-1)*g.side >= *bound {
+			return
+		}
+		for dx := -r; dx <= r; dx++ {
+			for dy := -r; dy <= r; dy++ {
+				// The shell at distance r: all of z on its faces, or
+				// else only its two ends.
+				dz, step := -r, 2*r
+				if r == 0 || dx == -r || dx == r || dy == -r || dy == r {
+					step = 1
+				}
+				for ; dz <= r; dz += step {
+					c := [3]int{center[0] + dx, center[1] + dy, center[2] + dz}
+					if c[0] < 0 || c[0] >= g.size[0] || c[1] < 0 || c[1] >= g.size[1] || c[2] < 0 || c[2] >= g.size[2] {
+						continue
+					}
+					k := g.index(c)
+					for _, j := range g.point[g.start[k]:g.start[k+1]] {
+						if j != int32(i) {
+							visit(j)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// components labels the connected components of the graph and returns
+// the label of each point and the number of components.
+func components(adj [][]edge) (comp []int, count int) {
+	comp = make([]int, len(adj))
+	for i := range comp {
+		comp[i] = -1
+	}
+	var stack []int32
+	for s := range adj {
+		if comp[s] >= 0 {
+			continue
+		}
+		comp[s] = count
+		stack = append(stack[:0], int32(s))
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range adj[i] {
+				if comp[e.to] < 0 {
+					comp[e.to] = count
+					stack = append(stack, e.to)
+				}
+			}
+		}
+		count++
+	}
+	return comp, count
+}
+
+// shortestPaths returns the length of the shortest path from s to every
+// point, by Dijkstra's algorithm.
+func shortestPaths(adj [][]edge, s int) []float64 {
+	d := make([]float64, len(adj))
+	for i := range d {
+		d[i] = math.Inf(1)
+	}
+	d[s] = 0
+	q := &pathQueue{{int32(s), 0}}
+	for q.Len() > 0 {
+		top := heap.Pop(q).(edge)
+		if top.dist > d[top.to] {
+			continue
+		}
+		for _, e := range adj[top.to] {
+			if nd := top.dist + e.dist; nd < d[e.to] {
+				d[e.to] = nd
+				heap.Push(q, edge{e.to, nd})
+			}
+		}
+	}
+	return d
+}
+
+// pathQueue is a min-heap of points by tentative distance.
+type pathQueue []edge
+
+func (q pathQueue) Len() int            { return len(q) }
+func (q pathQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(edge)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
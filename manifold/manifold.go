@@ -0,0 +1,83 @@
+// Package manifold embeds points given by many features in three
+// dimensions with two nonlinear methods, UMAP and Isomap, which unlike
+// principal components can unroll curved manifolds. Both start from the
+// graph joining each point to its nearest neighbors: UMAP lays out a fuzzy
+// version of that graph by stochastic gradient descent, and Isomap places
+// points by their shortest-path distances through it. Both report their
+// progress and intermediate layouts as they go, so callers can show the
+// embedding converge.
+package manifold
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Options set up an embedding. Zero values take the defaults.
+type Options struct {
+	Neighbors int     // in the neighbor graph, default 15 for UMAP and 10 for Isomap
+	Epochs    int     // UMAP: passes of gradient descent, default 200
+	MinDist   float64 // UMAP: closest spacing of points in the layout, default 0.1
+	Landmarks int     // Isomap: points the shortest paths start from, default 200
+	Seed      int64
+}
+
+const (
+	DefaultUMAPNeighbors   = 15
+	DefaultIsomapNeighbors = 10
+	MaxNeighbors           = 100
+	DefaultEpochs          = 200
+	MaxEpochs              = 2000
+	DefaultMinDist         = 0.1
+	DefaultLandmarks       = 200
+	MaxLandmarks           = 1000
+)
+
+// Progress reports how far an embedding has come. Phases run in order and
+// each counts its own steps; Layout is set once there is one to show and
+// belongs to the receiver.
+type Progress struct {
+	Phase  string       `json:"phase"`
+	Step   int          `json:"step"`
+	Steps  int          `json:"steps"`
+	Layout [][3]float64 `json:"-"`
+}
+
+// check validates data and the options common to both methods.
+func check(data [][]float64, opts Options) error {
+	if len(data) < 4 {
+		return errors.New("manifold: need at least 4 points")
+	}
+	if opts.Neighbors < 2 || opts.Neighbors > MaxNeighbors {
+		return fmt.Errorf("manifold: neighbors must be between 2 and %d", MaxNeighbors)
+	}
+	if opts.Neighbors >= len(data) {
+		return errors.New("manifold: need more points than neighbors")
+	}
+	d := len(data[0])
+	for _, row := range data {
+		if len(row) != d {
+			return errors.New("manifold: points have different numbers of features")
+		}
+		for _, x := range row {
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				return errors.New("manifold: features must be finite")
+			}
+		}
+	}
+	return nil
+}
+
+func dist(a, b []float64) float64 {
+	var s float64
+	for k := range a {
+		d := a[k] - b[k]
+		s += d * d
+	}
+	return math.Sqrt(s)
+}
+
+func copyLayout(y [][3]float64) [][3]float64 {
+	return append([][3]float64(nil), y...)
+}
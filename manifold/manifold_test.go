@@ -0,0 +1,268 @@
+package manifold
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func ignore(Progress) {}
+
+// clusters returns m tight clusters of size points each, with centers far
+// apart in d dimensions.
+func clusters(m, size, d int, rng *rand.Rand) (data [][]float64, label []int) {
+	for c := 0; c < m; c++ {
+		center := make([]float64, d)
+		for k := range center {
+			center[k] = 100 * rng.Float64()
+		}
+		for i := 0; i < size; i++ {
+			x := make([]float64, d)
+			for k := range x {
+				x[k] = center[k] + rng.NormFloat64()
+			}
+			data, label = append(data, x), append(label, c)
+		}
+	}
+	return data, label
+}
+
+func TestCheck(t *testing.T) {
+	ok := [][]float64{{0, 0}, {1, 0}, {0, 1}, {1, 1}, {2, 2}}
+	tests := []struct {
+		name string
+		data [][]float64
+		opts Options
+	}{
+		{"three points", ok[:3], Options{Neighbors: 2}},
+		{"one neighbor", ok, Options{Neighbors: 1}},
+		{"too many neighbors", ok, Options{Neighbors: MaxNeighbors + 1}},
+		{"neighbors for every point", ok, Options{Neighbors: 5}},
+		{"ragged", [][]float64{{0, 0}, {1, 0}, {0}, {1, 1}, {2, 2}}, Options{Neighbors: 2}},
+		{"NaN", [][]float64{{0, 0}, {1, 0}, {math.NaN(), 1}, {1, 1}, {2, 2}}, Options{Neighbors: 2}},
+		{"infinite", [][]float64{{0, 0}, {1, 0}, {0, math.Inf(-1)}, {1, 1}, {2, 2}}, Options{Neighbors: 2}},
+	}
+	for _, tt := range tests {
+		if err := check(tt.data, tt.opts); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+	if err := check(ok, Options{Neighbors: 4}); err != nil {
+		t.Errorf("valid data: %v", err)
+	}
+	for _, opts := range []Options{{Landmarks: 3}, {Landmarks: MaxLandmarks + 1}} {
+		if _, err := Isomap(context.Background(), ok, opts, ignore); err == nil {
+			t.Errorf("Isomap with %+v: no error", opts)
+		}
+	}
+	for _, opts := range []Options{{Neighbors: 3, Epochs: -1}, {Neighbors: 3, MinDist: 1}, {Neighbors: 3, MinDist: -0.1}} {
+		if _, err := UMAP(context.Background(), ok, opts, ignore); err == nil {
+			t.Errorf("UMAP with %+v: no error", opts)
+		}
+	}
+}
+
+// TestNearestNeighbors compares NN-descent with the exact neighbors.
+func TestNearestNeighbors(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	data := make([][]float64, 2*exactLimit)
+	for i := range data {
+		data[i] = []float64{rng.Float64(), rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+	const k = 10
+	g, err := nearestNeighbors(context.Background(), data, k, rng, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for i := range data {
+		heap := newNeighborHeap(k)
+		for j := range data {
+			if j != i {
+				heap.push(int32(j), dist(data[i], data[j]), false)
+			}
+		}
+		want := map[int32]bool{}
+		for _, j := range heap.index {
+			want[j] = true
+		}
+		for m, j := range g.index[i] {
+			if want[j] {
+				found++
+			}
+			if m > 0 && g.dist[i][m] < g.dist[i][m-1] {
+				t.Fatalf("neighbors of %d are not sorted: %v", i, g.dist[i])
+			}
+		}
+	}
+	if recall := float64(found) / float64(k*len(data)); recall < 0.9 {
+		t.Errorf("NN-descent recall %v, want at least 0.9", recall)
+	}
+}
+
+// TestConnect checks that joining the components of a neighbor graph
+// links each to its closest other component, as a brute-force search
+// finds it.
+func TestConnect(t *testing.T) {
+	data, label := clusters(6, 50, 5, rand.New(rand.NewSource(2)))
+	g, err := nearestNeighbors(context.Background(), data, 5, nil, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adj := undirected(g)
+	if _, count := components(adj); count != 6 {
+		t.Fatalf("the neighbor graph of 6 clusters has %d components", count)
+	}
+	before := make([]int, len(adj))
+	for i := range adj {
+		before[i] = len(adj[i])
+	}
+	if err := connect(context.Background(), data, adj, rand.New(rand.NewSource(3)), ignore); err != nil {
+		t.Fatal(err)
+	}
+	if _, count := components(adj); count != 1 {
+		t.Fatalf("connect left %d components", count)
+	}
+	for c := 0; c < 6; c++ {
+		closest := math.Inf(1)
+		for i := range data {
+			for j := range data {
+				if label[i] == c && label[j] != c {
+					closest = math.Min(closest, dist(data[i], data[j]))
+				}
+			}
+		}
+		linked := false
+		for i := range data {
+			for _, e := range adj[i][before[i]:] {
+				linked = linked || label[i] == c && e.dist == closest
+			}
+		}
+		if !linked {
+			t.Errorf("cluster %d is not linked to its closest neighbor at distance %v", c, closest)
+		}
+	}
+}
+
+// TestIsomapArc embeds a half circle, whose geodesic distances are arc
+// lengths: Isomap should straighten it into a segment of length π.
+func TestIsomapArc(t *testing.T) {
+	const n = 300
+	data := make([][]float64, n)
+	angle := make([]float64, n)
+	rng := rand.New(rand.NewSource(4))
+	for i := range data {
+		angle[i] = math.Pi * rng.Float64()
+		data[i] = []float64{math.Cos(angle[i]), math.Sin(angle[i]), 0, 0}
+	}
+	var phases []string
+	y, err := Isomap(context.Background(), data, Options{Landmarks: 50}, func(p Progress) {
+		if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+			phases = append(phases, p.Phase)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(phases, " "); got != "neighbors geodesics scaling" {
+		t.Errorf("phases %q", got)
+	}
+	var worst float64
+	for i := 0; i < n; i += 7 {
+		for j := i + 1; j < n; j += 11 {
+			d := math.Sqrt(dist2(y[i], y[j]))
+			worst = math.Max(worst, math.Abs(d-math.Abs(angle[i]-angle[j])))
+		}
+	}
+	// Paths through the neighbor graph cut the corners of the arc by less
+	// than a percent.
+	if worst > 0.03*math.Pi {
+		t.Errorf("layout distances differ from arc lengths by up to %v", worst)
+	}
+	for i := range y {
+		if y[i][1] != 0 || y[i][2] != 0 {
+			t.Fatalf("point %d of a curve is placed at %v, off the line", i, y[i])
+		}
+	}
+}
+
+// TestIsomapSwissRoll unrolls a Swiss roll: distances in the layout
+// should match those in the unrolled strip.
+func TestIsomapSwissRoll(t *testing.T) {
+	const n = 1500
+	rng := rand.New(rand.NewSource(8))
+	data := make([][]float64, n)
+	flat := make([][3]float64, n)
+	for i := range data {
+		a, h := math.Pi*(1.5+3*rng.Float64()), 20*rng.Float64()
+		data[i] = []float64{a * math.Cos(a), h, a * math.Sin(a)}
+		// The arc length of the spiral r = a from a = 0.
+		flat[i] = [3]float64{(a*math.Sqrt(1+a*a) + math.Asinh(a)) / 2, h}
+	}
+	y, err := Isomap(context.Background(), data, Options{Seed: 9}, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []float64
+	for i := 0; i < n; i += 13 {
+		for j := i + 1; j < n; j += 17 {
+			want := math.Sqrt(dist2(flat[i], flat[j]))
+			errs = append(errs, math.Abs(math.Sqrt(dist2(y[i], y[j]))-want)/want)
+		}
+	}
+	sort.Float64s(errs)
+	if median := errs[len(errs)/2]; median > 0.05 {
+		t.Errorf("median relative error of layout distances %v", median)
+	}
+}
+
+// TestUMAPClusters checks that UMAP keeps separate clusters apart.
+func TestUMAPClusters(t *testing.T) {
+	data, label := clusters(3, 60, 10, rand.New(rand.NewSource(5)))
+	y, err := UMAP(context.Background(), data, Options{Epochs: 100, Seed: 6}, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var within, between float64
+	var nWithin, nBetween int
+	for i := range y {
+		for j := i + 1; j < len(y); j++ {
+			d := math.Sqrt(dist2(y[i], y[j]))
+			if label[i] == label[j] {
+				within, nWithin = within+d, nWithin+1
+			} else {
+				between, nBetween = between+d, nBetween+1
+			}
+		}
+	}
+	if within /= float64(nWithin); !(between/float64(nBetween) > 3*within) {
+		t.Errorf("mean distance within clusters %v, between them %v", within, between/float64(nBetween))
+	}
+}
+
+func TestCancel(t *testing.T) {
+	data, _ := clusters(2, 100, 4, rand.New(rand.NewSource(7)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	epochs := 0
+	_, err := UMAP(ctx, data, Options{}, func(p Progress) {
+		if p.Phase == "layout" {
+			if epochs++; epochs == 3 {
+				cancel()
+			}
+		}
+	})
+	if !errors.Is(err, context.Canceled) || epochs != 3 {
+		t.Errorf("UMAP cancelled after 2 epochs = %v after %d reports", err, epochs)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := Isomap(ctx, data, Options{}, ignore); !errors.Is(err, context.Canceled) {
+		t.Errorf("Isomap with a cancelled context = %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package manifold
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// neighborGraph holds the k nearest neighbors of each point, nearest
+// first, with their distances.
+type neighborGraph struct {
+	index [][]int32
+	dist  [][]float64
+}
+
+// exactLimit is the number of points up to which neighbors are found by
+// comparing every pair, which is then cheaper than NN-descent.
+const exactLimit = 2000
+
+// NN-descent stops after maxDescents rounds or when a round improves fewer
+// than descentDelta of the neighbor lists' entries.
+const (
+	maxDescents  = 12
+	descentDelta = 0.001
+)
+
+// nearestNeighbors finds the k nearest neighbors of each point, exactly
+// for small inputs and approximately by NN-descent (Dong, Charikar and Li,
+// 2011) otherwise. NN-descent starts from random neighbors and repeatedly
+// tries the neighbors of neighbors, which are likely to be close too. It
+// reports each round as a step of the "neighbors" phase.
+func nearestNeighbors(ctx context.Context, data [][]float64, k int, rng *rand.Rand, report func(Progress)) (*neighborGraph, error) {
+	n := len(data)
+	heaps := make([]neighborHeap, n)
+	if n <= exactLimit {
+		report(Progress{Phase: "neighbors", Step: 0, Steps: 1})
+		for i := range data {
+			heaps[i] = newNeighborHeap(k)
+			for j := range data {
+				if j != i {
+					heaps[i].push(int32(j), dist(data[i], data[j]), false)
+				}
+			}
+		}
+		report(Progress{Phase: "neighbors", Step: 1, Steps: 1})
+		return sortedGraph(heaps), nil
+	}
+
+	for i := range heaps {
+		heaps[i] = newNeighborHeap(k)
+		for heaps[i].len() < k {
+			if j := rng.Intn(n); j != i {
+				heaps[i].push(int32(j), dist(data[i], data[j]), true)
+			}
+		}
+	}
+	newer, older := make([][]int32, n), make([][]int32, n)
+	newerRev, olderRev := make([][]int32, n), make([][]int32, n)
+	for round := 0; round < maxDescents; round++ {
+		report(Progress{Phase: "neighbors", Step: round, Steps: maxDescents})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Gather each point's new and old neighbors in both directions,
+		// sampling at most k reverse neighbors, and mark the new as old.
+		for i := range newer {
+			newer[i], older[i] = newer[i][:0], older[i][:0]
+			newerRev[i], olderRev[i] = newerRev[i][:0], olderRev[i][:0]
+		}
+		offeredNew := make([]int, n) // reverse neighbors offered to each point
+		offeredOld := make([]int, n)
+		sample := func(lists [][]int32, count []int, j, i int32) {
+			count[j]++
+			if len(lists[j]) < k {
+				lists[j] = append(lists[j], i)
+			} else if r := rng.Intn(count[j]); r < k {
+				lists[j][r] = i
+			}
+		}
+		for i := range heaps {
+			h := &heaps[i]
+			for m, j := range h.index {
+				if h.fresh[m] {
+					newer[i] = append(newer[i], j)
+					sample(newerRev, offeredNew, j, int32(i))
+					h.fresh[m] = false
+				} else {
+					older[i] = append(older[i], j)
+					sample(olderRev, offeredOld, j, int32(i))
+				}
+			}
+		}
+		for i := range newer {
+			newer[i] = append(newer[i], newerRev[i]...)
+			older[i] = append(older[i], olderRev[i]...)
+		}
+		// Compare new neighbors with each other and with old ones.
+		updates := 0
+		try := func(a, b int32) {
+			if a == b {
+				return
+			}
+			d := dist(data[a], data[b])
+			if heaps[a].push(b, d, true) {
+				updates++
+			}
+			if heaps[b].push(a, d, true) {
+				updates++
+			}
+		}
+		for i := range newer {
+			for x, a := range newer[i] {
+				for _, b := range newer[i][x+1:] {
+					try(a, b)
+				}
+				for _, b := range older[i] {
+					try(a, b)
+				}
+			}
+		}
+		if float64(updates) <= descentDelta*float64(n*k) {
+			break
+		}
+	}
+	report(Progress{Phase: "neighbors", Step: maxDescents, Steps: maxDescents})
+	return sortedGraph(heaps), nil
+}
+
+// sortedGraph returns the neighbors in heaps sorted nearest first.
+func sortedGraph(heaps []neighborHeap) *neighborGraph {
+	g := &neighborGraph{index: make([][]int32, len(heaps)), dist: make([][]float64, len(heaps))}
+	for i := range heaps {
+		h := &heaps[i]
+		order := make([]int, len(h.index))
+		for m := range order {
+			order[m] = m
+		}
+		sort.Slice(order, func(a, b int) bool { return h.dist[order[a]] < h.dist[order[b]] })
+		for _, m := range order {
+			g.index[i] = append(g.index[i], h.index[m])
+			g.dist[i] = append(g.dist[i], h.dist[m])
+		}
+	}
+	return g
+}
+
+// neighborHeap keeps the k nearest candidates seen in a max-heap on
+// distance, with whether each is new since the last round of NN-descent.
+type neighborHeap struct {
+	k     int
+	index []int32
+	dist  []float64
+	fresh []bool
+}
+
+func newNeighborHeap(k int) neighborHeap {
+	return neighborHeap{k: k, index: make([]int32, 0, k), dist: make([]float64, 0, k), fresh: make([]bool, 0, k)}
+}
+
+func (h *neighborHeap) len() int { return len(h.index) }
+
+// push adds j at distance d if it is nearer than the farthest candidate
+// and not already present, and reports whether it did.
+func (h *neighborHeap) push(j int32, d float64, fresh bool) bool {
+	if len(h.index) == h.k && d >= h.dist[0] {
+		return false
+	}
+	for _, i := range h.index {
+		if i == j {
+			return false
+		}
+	}
+	if len(h.index) < h.k {
+		h.index, h.dist, h.fresh = append(h.index, j), append(h.dist, d), append(h.fresh, fresh)
+		for c := len(h.index) - 1; c > 0; {
+			p := (c - 1) / 2
+			if h.dist[p] >= h.dist[c] {
+				break
+			}
+			h.swap(p, c)
+			c = p
+		}
+		return true
+	}
+	h.index[0], h.dist[0], h.fresh[0] = j, d, fresh
+	for p := 0; ; {
+		c := 2*p + 1
+		if c >= len(h.index) {
+			break
+		}
+		if c+1 < len(h.index) && h.dist[c+1] > h.dist[c] {
+			c++
+		}
+		if h.dist[p] >= h.dist[c] {
+			break
+		}
+		h.swap(p, c)
+		p = c
+	}
+	return true
+}
+
+func (h *neighborHeap) swap(a, b int) {
+	h.index[a], h.index[b] = h.index[b], h.index[a]
+	h.dist[a], h.dist[b] = h.dist[b], h.dist[a]
+	h.fresh[a], h.fresh[b] = h.fresh[b], h.fresh[a]
+}
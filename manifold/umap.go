@@ -0,0 +1,249 @@
+package manifold
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// UMAP parameters of McInnes, Healy and Melville (2018) that are not
+// options: the spread of the layout, the negative samples per positive
+// one, and the bound on each coordinate of a gradient step.
+const (
+	spread          = 1.0
+	negativeSamples = 5
+	gradientClip    = 4.0
+	initialExtent   = 10.0 // of the random initial layout
+)
+
+// UMAP embeds data in three dimensions by uniform manifold approximation
+// and projection. It finds the nearest neighbors of each point, weights
+// each neighbor by a membership strength that decays from the nearest
+// neighbor at a rate set so every point has the same total, symmetrizes
+// the weights as a fuzzy union and then lays the graph out from random
+// positions by stochastic gradient descent: sampled edges attract their
+// ends and random pairs repel. After each epoch it reports the layout.
+func UMAP(ctx context.Context, data [][]float64, opts Options, report func(Progress)) ([][3]float64, error) {
+	if opts.Neighbors == 0 {
+		opts.Neighbors = DefaultUMAPNeighbors
+	}
+	if opts.Epochs == 0 {
+		opts.Epochs = DefaultEpochs
+	}
+	if opts.MinDist == 0 {
+		opts.MinDist = DefaultMinDist
+	}
+	if err := check(data, opts); err != nil {
+		return nil, err
+	}
+	if opts.Epochs < 1 || opts.Epochs > MaxEpochs {
+		return nil, fmt.Errorf("manifold: epochs must be between 1 and %d", MaxEpochs)
+	}
+	if !(opts.MinDist > 0 && opts.MinDist < spread) {
+		return nil, errors.New("manifold: min distance must be between 0 and 1")
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	g, err := nearestNeighbors(ctx, data, opts.Neighbors, rng, report)
+	if err != nil {
+		return nil, err
+	}
+	heads, tails, weights := fuzzyGraph(g)
+	a, b := curve(opts.MinDist)
+
+	n := len(data)
+	y := make([][3]float64, n)
+	for i := range y {
+		for k := range y[i] {
+			y[i][k] = (rng.Float64()*2 - 1) * initialExtent
+		}
+	}
+	report(Progress{Phase: "layout", Step: 0, Steps: opts.Epochs, Layout: copyLayout(y)})
+
+	// Edges are sampled in proportion to their weight: the heaviest every
+	// epoch, lighter ones less often. Edges too light to be sampled once
+	// are dropped.
+	var maxWeight float64
+	for _, w := range weights {
+		maxWeight = math.Max(maxWeight, w)
+	}
+	var every, next, nextNegative []float64
+	var from, to []int32
+	for e, w := range weights {
+		if w < maxWeight/float64(opts.Epochs) {
+			continue
+		}
+		every = append(every, maxWeight/w)
+		from, to = append(from, heads[e]), append(to, tails[e])
+	}
+	next = append(next, every...)
+	for _, s := range every {
+		nextNegative = append(nextNegative, s/negativeSamples)
+	}
+
+	clip := func(x float64) float64 { return math.Max(-gradientClip, math.Min(gradientClip, x)) }
+	for epoch := 0; epoch < opts.Epochs; epoch++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		alpha := 1 - float64(epoch)/float64(opts.Epochs)
+		for e := range every {
+			if next[e] > float64(epoch) {
+				continue
+			}
+			i, j := from[e], to[e]
+			d2 := dist2(y[i], y[j])
+			if d2 > 0 {
+				pow := math.Pow(d2, b)
+				c := -2 * a * b * pow / d2 / (a*pow + 1)
+				for k := range y[i] {
+					step := clip(c*(y[i][k]-y[j][k])) * alpha
+					y[i][k] += step
+					y[j][k] -= step
+				}
+			}
+			next[e] += every[e]
+
+			negatives := int((float64(epoch) - nextNegative[e]) / (every[e] / negativeSamples))
+			for s := 0; s < negatives; s++ {
+				m := rng.Intn(n)
+				if int32(m) == i {
+					continue
+				}
+				d2 := dist2(y[i], y[m])
+				var c float64
+				if d2 > 0 {
+					c = 2 * b / ((0.001 + d2) * (a*math.Pow(d2, b) + 1))
+				}
+				for k := range y[i] {
+					step := gradientClip
+					if d2 > 0 {
+						step = clip(c * (y[i][k] - y[m][k]))
+					}
+					y[i][k] += step * alpha
+				}
+			}
+			nextNegative[e] += float64(negatives) * every[e] / negativeSamples
+		}
+		report(Progress{Phase: "layout", Step: epoch + 1, Steps: opts.Epochs, Layout: copyLayout(y)})
+	}
+	return y, nil
+}
+
+// fuzzyGraph returns the edges of the fuzzy simplicial set of the
+// neighbor graph as parallel lists of ends and weights. The weight of
+// neighbor j of point i is exp(−(d − ρ)/σ), where ρ is the distance to
+// the nearest neighbor of i and σ is set so the weights of its neighbors
+// sum to log2 k; edges found from both ends combine as a + b − ab.
+func fuzzyGraph(g *neighborGraph) (heads, tails []int32, weights []float64) {
+	n := len(g.index)
+	w := make([][]float64, n)
+	for i := range g.index {
+		w[i] = memberships(g.dist[i])
+	}
+	for i := range g.index {
+		for m, j := range g.index[i] {
+			a := w[i][m]
+			var b float64
+			for r, back := range g.index[j] {
+				if back == int32(i) {
+					b = w[j][r]
+				}
+			}
+			if b > 0 && j < int32(i) {
+				continue // added from j
+			}
+			heads, tails = append(heads, int32(i)), append(tails, j)
+			weights = append(weights, a+b-a*b)
+		}
+	}
+	return heads, tails, weights
+}
+
+// memberships returns the membership strengths of neighbors at distances
+// dist, nearest first, finding σ by bisection.
+func memberships(dist []float64) []float64 {
+	target := math.Log2(float64(len(dist)))
+	rho := dist[0]
+	sum := func(sigma float64) float64 {
+		var s float64
+		for _, d := range dist {
+			s += math.Exp(-math.Max(d-rho, 0) / sigma)
+		}
+		return s
+	}
+	lo, hi := 0.0, math.Inf(1)
+	sigma := 1.0
+	for iter := 0; iter < 64; iter++ {
+		if sum(sigma) > target {
+			hi = sigma
+			sigma = (lo + hi) / 2
+		} else {
+			lo = sigma
+			if math.IsInf(hi, 1) {
+				sigma *= 2
+			} else {
+				sigma = (lo + hi) / 2
+			}
+		}
+	}
+	w := make([]float64, len(dist))
+	for m, d := range dist {
+		w[m] = math.Exp(-math.Max(d-rho, 0) / sigma)
+	}
+	return w
+}
+
+// curve returns a and b such that 1/(1 + a d^2b) approximates the
+// membership strength at distance d in the layout: 1 up to minDist and
+// exp(−(d − minDist)/spread) beyond. It fits them by least squares,
+// searching a grid that narrows around the best point.
+func curve(minDist float64) (a, b float64) {
+	const samples = 300
+	var xs, ys [samples]float64
+	for s := range xs {
+		x := 3 * spread * float64(s+1) / samples
+		xs[s], ys[s] = x, 1
+		if x > minDist {
+			ys[s] = math.Exp(-(x - minDist) / spread)
+		}
+	}
+	loss := func(a, b float64) float64 {
+		var l float64
+		for s, x := range xs {
+			r := 1/(1+a*math.Pow(x, 2*b)) - ys[s]
+			l += r * r
+		}
+		return l
+	}
+	// Search log a and b.
+	la, b := 0.0, 1.0
+	width := [2]float64{4, 1}
+	for round := 0; round < 8; round++ {
+		best := math.Inf(1)
+		ca, cb := la, b
+		for i := -10; i <= 10; i++ {
+			for j := -10; j <= 10; j++ {
+				ta, tb := ca+width[0]*float64(i)/10, cb+width[1]*float64(j)/10
+				if tb <= 0 {
+					continue
+				}
+				if l := loss(math.Exp(ta), tb); l < best {
+					best, la, b = l, ta, tb
+				}
+			}
+		}
+		width[0], width[1] = width[0]/4, width[1]/4
+	}
+	return math.Exp(la), b
+}
+
+func dist2(a, b [3]float64) float64 {
+	var s float64
+	for k := range a {
+		d := a[k] - b[k]
+		s += d * d
+	}
+	return s
+}
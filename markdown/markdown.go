@@ -0,0 +1,186 @@
+// Package markdown renders the small subset of Markdown used for captions
+// and comments as HTML: paragraphs, "#" headings, "-" and "1." lists,
+// **bold**, *italic*, `code` and [links](url). Raw HTML is escaped, not
+// passed through, and links are limited to http, https, mailto and
+// relative URLs, so the output is safe to insert into a page.
+package markdown
+
+import (
+	"html"
+	"strings"
+)
+
+// ToHTML renders src as HTML.
+func ToHTML(src string) string {
+	var b strings.Builder
+	var para []string
+	list := "" // "ul" or "ol" while inside a list
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + inline(strings.Join(para, " ")) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			flush()
+			closeList()
+			continue
+		}
+		if level := headingLevel(line); level > 0 {
+			flush()
+			closeList()
+			tag := "h" + string(rune('0'+level))
+			b.WriteString("<" + tag + ">" + inline(strings.TrimSpace(line[level:])) + "</" + tag + ">\n")
+			continue
+		}
+		if kind, item, ok := listItem(line); ok {
+			flush()
+			if list != kind {
+				closeList()
+				b.WriteString("<" + kind + ">\n")
+				list = kind
+			}
+			b.WriteString("<li>" + inline(item) + "</li>\n")
+			continue
+		}
+		closeList()
+		para = append(para, line)
+	}
+	flush()
+	closeList()
+	return b.String()
+}
+
+// headingLevel returns n for a line starting with n (at most 3) '#'s and a
+// space, or 0.
+func headingLevel(line string) int {
+	n := 0
+	for n < len(line) && line[n] == '#' {
+		n++
+	}
+	if n == 0 || n > 3 || n == len(line) || line[n] != ' ' {
+		return 0
+	}
+	return n
+}
+
+// listItem recognizes "- item", "* item" and "1. item".
+func listItem(line string) (kind, item string, ok bool) {
+	if len(line) > 2 && (line[0] == '-' || line[0] == '*') && line[1] == ' ' {
+		return "ul", strings.TrimSpace(line[2:]), true
+	}
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i > 0 && i+1 < len(line) && line[i] == '.' && line[i+1] == ' ' {
+		return "ol", strings.TrimSpace(line[i+2:]), true
+	}
+	return "", "", false
+}
+
+// inline renders spans within a block: code first, so its contents are
+// left alone, then links and emphasis.
+func inline(text string) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(text, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		b.WriteString(links(text[:start]))
+		b.WriteString("<code>" + html.EscapeString(text[start+1:start+1+end]) + "</code>")
+		text = text[start+2+end:]
+	}
+	b.WriteString(links(text))
+	return b.String()
+}
+
+// links renders [text](url) links, and emphasis around and inside them.
+func links(text string) string {
+	var b strings.Builder
+	for {
+		open := strings.IndexByte(text, '[')
+		if open < 0 {
+			break
+		}
+		mid := strings.Index(text[open:], "](")
+		if mid < 0 {
+			break
+		}
+		mid += open
+		end := strings.IndexByte(text[mid:], ')')
+		if end < 0 {
+			break
+		}
+		end += mid
+		label, url := text[open+1:mid], strings.TrimSpace(text[mid+2:end])
+		b.WriteString(emphasis(text[:open]))
+		if safeURL(url) {
+			b.WriteString(`<a href="` + html.EscapeString(url) + `" target="_blank" rel="noopener">` + emphasis(label) + "</a>")
+		} else {
+			b.WriteString(emphasis(label))
+		}
+		text = text[end+1:]
+	}
+	b.WriteString(emphasis(text))
+	return b.String()
+}
+
+// safeURL allows absolute http, https and mailto URLs and relative ones.
+func safeURL(url string) bool {
+	lower := strings.ToLower(url)
+	for _, scheme := range []string{"http://", "https://", "mailto:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return url != "" && !strings.Contains(strings.SplitN(url, "/", 2)[0], ":")
+}
+
+// emphasis escapes text and renders **bold** and *italic*. Underscores
+// are left alone, as they are common in attribute names.
+func emphasis(text string) string {
+	text = html.EscapeString(text)
+	text = pairs(text, "**", "strong")
+	return pairs(text, "*", "em")
+}
+
+// pairs wraps text between matched delimiters in tag. An unmatched
+// delimiter is left as it is.
+func pairs(text, delim, tag string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(text, delim)
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+len(delim):], delim)
+		if end <= 0 {
+			break
+		}
+		inner := text[start+len(delim) : start+len(delim)+end]
+		if strings.TrimSpace(inner) != inner {
+			// "a * b * c" is not emphasis.
+			b.WriteString(text[:start+len(delim)])
+			text = text[start+len(delim):]
+			continue
+		}
+		b.WriteString(text[:start] + "<" + tag + ">" + inner + "</" + tag + ">")
+		text = text[start+2*len(delim)+end:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A metric is exported on /metrics in the Prometheus text format. Values are
+// gathered when the endpoint is scraped.
+type metric struct {
+	name    string
+	kind    string // "counter" or "gauge"
+	help    string
+	collect func() []sample
+}
+
+// sample is one value of a metric; labels is preformatted, e.g.
+// `{dataset="synth/torus"}`, or empty.
+type sample struct {
+	labels string
+	value  float64
+}
+
+var (
+	metricsMu sync.Mutex
+	metrics   []metric
+)
+
+// registerMetric adds a metric to the /metrics endpoint.
+func registerMetric(name, kind, help string, collect func() []sample) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics = append(metrics, metric{name, kind, help, collect})
+}
+
+// value wraps a single unlabeled value for registerMetric.
+func value(fn func() float64) func() []sample {
+	return func() []sample { return []sample{{value: fn()}} }
+}
+
+// labels formats label pairs given as alternating names and values.
+func labels(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, kv[i], v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsMu.Lock()
+	ms := append([]metric(nil), metrics...)
+	metricsMu.Unlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name < ms[j].name })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range ms {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, s := range m.collect() {
+			fmt.Fprintf(w, "%s%s %g\n", m.name, s.labels, s.value)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/pattern"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+const (
+	// defaultPatternPoints is the sample of a dataset tested for complete
+	// spatial randomness unless the client asks for another size, and
+	// maxPatternPoints the largest it may ask for. The cost grows with the
+	// square of the sample size in clustered patterns.
+	defaultPatternPoints = 2000
+	maxPatternPoints     = 20000
+	// maxPatternWork bounds the points times the simulations of one test.
+	maxPatternWork = 1000000
+)
+
+// handlePattern serves GET /api/pattern/<dataset>: the point-pattern
+// summary functions of a dataset with envelopes under complete spatial
+// randomness, as a JSON pattern.Result. The query takes the dataset's
+// loader parameters as one query string in options, the sample size in
+// points, and simulations and seed for the envelopes; the points times the
+// simulations may be at most maxPatternWork. Results are cached with the
+// dataset, and the test stops if the client disconnects.
+func handlePattern(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/pattern/")
+	query := r.URL.Query()
+	params, err := url.ParseQuery(query.Get("options"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("options: %v", err), http.StatusBadRequest)
+		return
+	}
+	size, err := intParam(query, "points", defaultPatternPoints)
+	if err == nil && (size < 2 || size > maxPatternPoints) {
+		err = fmt.Errorf("parameter points must be between 2 and %d", maxPatternPoints)
+	}
+	var opts pattern.Options
+	if err == nil {
+		opts.Simulations, err = intParam(query, "simulations", pattern.DefaultSimulations)
+	}
+	if err == nil && (opts.Simulations < 1 || opts.Simulations > pattern.MaxSimulations) {
+		err = fmt.Errorf("parameter simulations must be between 1 and %d", pattern.MaxSimulations)
+	}
+	if err == nil && size*opts.Simulations > maxPatternWork {
+		err = fmt.Errorf("points times simulations must be at most %d", maxPatternWork)
+	}
+	var seed int
+	if err == nil {
+		seed, err = intParam(query, "seed", 1)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Seed = int64(seed)
+
+	ctx := r.Context()
+	if _, err := datasets.Get(ctx, name, params); err != nil {
+		http.Error(w, err.Error(), datasetStatus(err))
+		return
+	}
+	kind := fmt.Sprintf("pattern?points=%d&simulations=%d&seed=%d", size, opts.Simulations, seed)
+	d, err := datasets.Derived(ctx, name, params, kind, func(c *pointcloud.Cloud) (derived, error) {
+		points := make([][3]float64, c.Len())
+		for i := range points {
+			x, y, z := c.Point(i)
+			points[i] = [3]float64{float64(x), float64(y), float64(z)}
+		}
+		rng := rand.New(rand.NewSource(opts.Seed))
+		return pattern.Analyze(ctx, pattern.Sample(points, size, rng), opts)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
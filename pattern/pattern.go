@@ -0,0 +1,445 @@
+// Package pattern computes summary functions of 3D point patterns for
+// testing complete spatial randomness (CSR): Ripley's K function and its
+// variance-stabilized form L, the pair correlation function g, the
+// nearest-neighbor distance distribution G and the empty-space function F.
+// The observation window is the bounding box of the points, and estimates
+// are corrected for its edges. Under CSR the pattern is a homogeneous
+// Poisson process, whose functions are known; envelopes from uniform
+// patterns of as many points in the same box show how far a pattern may
+// stray from them by chance.
+package pattern
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Box is the observation window.
+type Box struct {
+	Min [3]float64 `json:"min"`
+	Max [3]float64 `json:"max"`
+}
+
+// Bounds returns the bounding box of points.
+func Bounds(points [][3]float64) Box {
+	b := Box{Min: [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}, Max: [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}}
+	for _, p := range points {
+		for k := range p {
+			b.Min[k], b.Max[k] = math.Min(b.Min[k], p[k]), math.Max(b.Max[k], p[k])
+		}
+	}
+	return b
+}
+
+func (b Box) side(k int) float64 { return b.Max[k] - b.Min[k] }
+
+// Volume returns the volume of the box.
+func (b Box) Volume() float64 { return b.side(0) * b.side(1) * b.side(2) }
+
+// border returns the distance from p to the boundary of the box.
+func (b Box) border(p [3]float64) float64 {
+	d := math.Inf(1)
+	for k := range p {
+		d = math.Min(d, math.Min(p[k]-b.Min[k], b.Max[k]-p[k]))
+	}
+	return d
+}
+
+// overlap returns the volume the box shares with itself shifted by d.
+func (b Box) overlap(d [3]float64) float64 {
+	v := 1.0
+	for k := range d {
+		v *= math.Max(b.side(k)-math.Abs(d[k]), 0)
+	}
+	return v
+}
+
+// Function is a summary function at the distances R: its estimate for
+// the pattern, its value under CSR and the pointwise envelope of the
+// simulated uniform patterns.
+type Function struct {
+	Name        string    `json:"name"`
+	R           []float64 `json:"r"`
+	Observed    []float64 `json:"observed"`
+	Theoretical []float64 `json:"theoretical"`
+	Lo          []float64 `json:"lo"`
+	Hi          []float64 `json:"hi"`
+}
+
+// Result holds the summary functions K, L, g, G and F of a pattern, in
+// that order.
+type Result struct {
+	Points      int        `json:"points"`
+	Box         Box        `json:"box"`
+	Intensity   float64    `json:"intensity"` // points per unit volume
+	Bandwidth   float64    `json:"bandwidth"` // of the pair correlation kernel
+	Simulations int        `json:"simulations"`
+	Functions   []Function `json:"functions"`
+}
+
+// Bytes returns the approximate memory held by r.
+func (r *Result) Bytes() int64 {
+	var n int
+	for _, f := range r.Functions {
+		n += 5 * len(f.R)
+	}
+	return int64(8 * n)
+}
+
+// Options set up an analysis. Zero values take the defaults.
+type Options struct {
+	Simulations int   // uniform patterns for the envelopes, default 39
+	Steps       int   // distances evaluated, default 50
+	Seed        int64 // of the simulations
+}
+
+const (
+	// DefaultSimulations gives envelopes that a CSR pattern leaves at a
+	// given distance with probability 2/40 = 5%.
+	DefaultSimulations = 39
+	MaxSimulations     = 999
+	defaultSteps       = 50
+	maxSteps           = 1000
+	// refsPerAxis is the side of the grid of reference points from which
+	// F measures empty space.
+	refsPerAxis = 16
+	// maxCells bounds the neighbor search grid per axis.
+	maxCells = 64
+)
+
+// Analyze estimates the summary functions of points, with envelopes from
+// opts.Simulations uniform patterns. K, L and g are evaluated at distances
+// up to a quarter of the shortest side of the bounding box; G and F, which
+// approach 1 much sooner, up to the distance at which they reach 0.999
+// under CSR, if that is shorter. It stops with ctx's error if ctx is done
+// before the simulations are.
+func Analyze(ctx context.Context, points [][3]float64, opts Options) (*Result, error) {
+	if opts.Simulations == 0 {
+		opts.Simulations = DefaultSimulations
+	}
+	if opts.Steps == 0 {
+		opts.Steps = defaultSteps
+	}
+	if opts.Simulations < 1 || opts.Simulations > MaxSimulations {
+		return nil, fmt.Errorf("pattern: simulations must be between 1 and %d", MaxSimulations)
+	}
+	if opts.Steps < 1 || opts.Steps > maxSteps {
+		return nil, fmt.Errorf("pattern: steps must be between 1 and %d", maxSteps)
+	}
+	if len(points) < 2 {
+		return nil, errors.New("pattern: need at least 2 points")
+	}
+	box := Bounds(points)
+	shortest := math.Min(box.side(0), math.Min(box.side(1), box.side(2)))
+	if !(shortest > 0) || math.IsInf(box.Volume(), 1) {
+		return nil, errors.New("pattern: the points span no volume, so there is no 3D window to test them in")
+	}
+	res := &Result{
+		Points:      len(points),
+		Box:         box,
+		Intensity:   float64(len(points)) / box.Volume(),
+		Simulations: opts.Simulations,
+	}
+	// The 3D form of Stoyan's rule of thumb.
+	res.Bandwidth = 0.15 / math.Cbrt(res.Intensity)
+	ball := func(r float64) float64 { return 4 * math.Pi / 3 * r * r * r }
+	empty := func(r float64) float64 { return 1 - math.Exp(-res.Intensity*ball(r)) }
+	saturated := math.Cbrt(math.Log(1000) / res.Intensity / ball(1))
+	ranges := [5]float64{shortest / 4, shortest / 4, shortest / 4, math.Min(saturated, shortest/4), math.Min(saturated, shortest/4)}
+	theory := [5]func(r float64) float64{ball, func(r float64) float64 { return r }, func(float64) float64 { return 1 }, empty, empty}
+	for f, name := range [5]string{"K", "L", "g", "G", "F"} {
+		fn := Function{Name: name}
+		for i := 0; i < opts.Steps; i++ {
+			r := ranges[f] * float64(i+1) / float64(opts.Steps)
+			fn.R = append(fn.R, r)
+			fn.Theoretical = append(fn.Theoretical, theory[f](r))
+			fn.Lo = append(fn.Lo, math.Inf(1))
+			fn.Hi = append(fn.Hi, math.Inf(-1))
+		}
+		res.Functions = append(res.Functions, fn)
+	}
+
+	var refs [][3]float64
+	for i := 0; i < refsPerAxis*refsPerAxis*refsPerAxis; i++ {
+		var p [3]float64
+		for k, c := range [3]int{i % refsPerAxis, i / refsPerAxis % refsPerAxis, i / (refsPerAxis * refsPerAxis)} {
+			p[k] = box.Min[k] + (float64(c)+0.5)/refsPerAxis*box.side(k)
+		}
+		refs = append(refs, p)
+	}
+	a := &analysis{box: box, h: res.Bandwidth, refs: refs, k: res.Functions[0].R, nn: res.Functions[3].R}
+	for f, values := range a.summarize(points) {
+		res.Functions[f].Observed = values
+	}
+
+	// Simulate in parallel, each pattern from its own seed so the result
+	// does not depend on the scheduling.
+	rng := rand.New(rand.NewSource(opts.Seed))
+	seeds := make(chan int64, opts.Simulations)
+	for s := 0; s < opts.Simulations; s++ {
+		seeds <- rng.Int63()
+	}
+	close(seeds)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), opts.Simulations); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uniform := make([][3]float64, len(points))
+			for seed := range seeds {
+				if ctx.Err() != nil {
+					continue // drain the remaining seeds
+				}
+				rng := rand.New(rand.NewSource(seed))
+				for i := range uniform {
+					for k := range uniform[i] {
+						uniform[i][k] = box.Min[k] + rng.Float64()*box.side(k)
+					}
+				}
+				sim := a.summarize(uniform)
+				mu.Lock()
+				for f, values := range sim {
+					fn := &res.Functions[f]
+					for i, v := range values {
+						fn.Lo[i], fn.Hi[i] = math.Min(fn.Lo[i], v), math.Max(fn.Hi[i], v)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// analysis holds what the estimates of a pattern and its simulations
+// share: the window, the kernel half-width h, the reference points of F,
+// and the evenly spaced distances k of K, L and g and nn of G and F.
+type analysis struct {
+	box   Box
+	h     float64
+	refs  [][3]float64
+	k, nn []float64
+}
+
+// summarize returns the estimates of K, L, g, G and F of points. K and g
+// weight each pair by the translation correction, the inverse of the
+// fraction of the box in which the pair could be seen with its offset. G
+// and F use the border correction, counting only locations at least r
+// inside the box at distance r. g is a kernel estimate with the
+// Epanechnikov kernel.
+func (a *analysis) summarize(points [][3]float64) [5][]float64 {
+	box, h, r := a.box, a.h, a.k
+	n, steps := len(points), len(r)
+	dr, rmax := r[0], r[steps-1]
+	var out [5][]float64
+	for f := range out {
+		out[f] = make([]float64, len(a.k))
+	}
+	k, g := out[0], out[2]
+	grid := newGrid(points, box)
+	for i, p := range points {
+		grid.within(p, rmax+h, func(j int) {
+			if j <= i {
+				return
+			}
+			q := points[j]
+			off := [3]float64{p[0] - q[0], p[1] - q[1], p[2] - q[2]}
+			d := math.Sqrt(off[0]*off[0] + off[1]*off[1] + off[2]*off[2])
+			o := box.overlap(off)
+			if d > rmax+h || o <= 0 {
+				return
+			}
+			// Each pair counts for both of its ordered pairs.
+			w := 2 * box.Volume() / o
+			if d <= rmax {
+				k[max(int(math.Ceil(d/dr))-1, 0)] += w
+			}
+			for b := max(int((d-h)/dr)-1, 0); b < steps && r[b] < d+h; b++ {
+				if t := (r[b] - d) / h; t > -1 && t < 1 {
+					g[b] += w * 0.75 * (1 - t*t) / h
+				}
+			}
+		})
+	}
+	pairs := float64(n) * float64(n-1)
+	for b := range k {
+		if b > 0 {
+			k[b] += k[b-1]
+		}
+	}
+	for b, rb := range r {
+		k[b] *= box.Volume() / pairs
+		out[1][b] = math.Cbrt(3 * k[b] / (4 * math.Pi))
+		g[b] *= box.Volume() / pairs / (4 * math.Pi * rb * rb)
+	}
+
+	reach := a.nn[len(a.nn)-1]
+	nearest := make([]float64, n)
+	borders := make([]float64, n)
+	for i, p := range points {
+		nearest[i] = grid.nearest(p, i, reach)
+		borders[i] = box.border(p)
+	}
+	out[3] = reducedSample(a.nn, nearest, borders)
+	empty := make([]float64, len(a.refs))
+	borders = borders[:0]
+	for i, p := range a.refs {
+		empty[i] = grid.nearest(p, -1, reach)
+		borders = append(borders, box.border(p))
+	}
+	out[4] = reducedSample(a.nn, empty, borders)
+	return out
+}
+
+// reducedSample returns the border-corrected distribution of the distances
+// d of locations at the given distances from the boundary: at each r, the
+// fraction of locations at least r inside whose distance is at most r.
+// Where no location is that far inside, the previous value is kept.
+func reducedSample(r, d, borders []float64) []float64 {
+	cdf := make([]float64, len(r))
+	for b, rb := range r {
+		var inside, within int
+		for i, e := range borders {
+			if e >= rb {
+				inside++
+				if d[i] <= rb {
+					within++
+				}
+			}
+		}
+		switch {
+		case inside > 0:
+			cdf[b] = float64(within) / float64(inside)
+		case b > 0:
+			cdf[b] = cdf[b-1]
+		}
+	}
+	return cdf
+}
+
+// grid buckets points into cells holding a few points each on average.
+type grid struct {
+	box    Box
+	n      [3]int
+	size   [3]float64 // of a cell
+	points [][3]float64
+	cells  [][]int
+}
+
+func newGrid(points [][3]float64, box Box) *grid {
+	g := &grid{box: box, points: points}
+	// Cubic cells of about two points each.
+	side := math.Cbrt(2 * box.Volume() / float64(len(points)))
+	total := 1
+	for k := range g.n {
+		g.n[k] = min(max(int(box.side(k)/side), 1), maxCells)
+		g.size[k] = box.side(k) / float64(g.n[k])
+		total *= g.n[k]
+	}
+	g.cells = make([][]int, total)
+	for i, p := range points {
+		c := g.cell(p)
+		idx := c[0] + g.n[0]*(c[1]+g.n[1]*c[2])
+		g.cells[idx] = append(g.cells[idx], i)
+	}
+	return g
+}
+
+func (g *grid) cell(p [3]float64) [3]int {
+	var c [3]int
+	for k := range c {
+		c[k] = min(max(int((p[k]-g.box.Min[k])/g.size[k]), 0), g.n[k]-1)
+	}
+	return c
+}
+
+// within calls f with the index of every point in the cells that may hold
+// points within reach of p.
+func (g *grid) within(p [3]float64, reach float64, f func(j int)) {
+	c := g.cell(p)
+	var lo, hi [3]int
+	for k := range c {
+		m := int(math.Ceil(reach / g.size[k]))
+		lo[k], hi[k] = max(c[k]-m, 0), min(c[k]+m, g.n[k]-1)
+	}
+	for z := lo[2]; z <= hi[2]; z++ {
+		for y := lo[1]; y <= hi[1]; y++ {
+			for x := lo[0]; x <= hi[0]; x++ {
+				for _, j := range g.cells[x+g.n[0]*(y+g.n[1]*z)] {
+					f(j)
+				}
+			}
+		}
+	}
+}
+
+// nearest returns the distance from p to the nearest point other than the
+// one with index skip, searching outward shell by shell. Distances beyond
+// reach are not needed, so it returns +Inf if there is no point within
+// reach.
+func (g *grid) nearest(p [3]float64, skip int, reach float64) float64 {
+	c := g.cell(p)
+	best := math.Inf(1)
+	step := math.Min(g.size[0], math.Min(g.size[1], g.size[2]))
+	for s := 0; ; s++ {
+		// The points left, in shell s and beyond, are at least s-1 cells
+		// away.
+		if gap := float64(s-1) * step; gap > best || gap > reach {
+			break
+		}
+		var lo, hi [3]int
+		outside := true
+		for k := range c {
+			lo[k], hi[k] = c[k]-s, c[k]+s
+			outside = outside && lo[k] < 0 && hi[k] >= g.n[k]
+		}
+		if outside {
+			break
+		}
+		for z := max(lo[2], 0); z <= min(hi[2], g.n[2]-1); z++ {
+			for y := max(lo[1], 0); y <= min(hi[1], g.n[1]-1); y++ {
+				for x := max(lo[0], 0); x <= min(hi[0], g.n[0]-1); x++ {
+					if x != lo[0] && x != hi[0] && y != lo[1] && y != hi[1] && z != lo[2] && z != hi[2] {
+						continue // searched in an inner shell
+					}
+					for _, j := range g.cells[x+g.n[0]*(y+g.n[1]*z)] {
+						if j == skip {
+							continue
+						}
+						q := g.points[j]
+						d := math.Sqrt((p[0]-q[0])*(p[0]-q[0]) + (p[1]-q[1])*(p[1]-q[1]) + (p[2]-q[2])*(p[2]-q[2]))
+						best = math.Min(best, d)
+					}
+				}
+			}
+		}
+	}
+	if best > reach {
+		return math.Inf(1)
+	}
+	return best
+}
+
+// Sample returns at most max of points, chosen at random. Random thinning
+// keeps a CSR pattern CSR, where taking every few points could pick up
+// regularities of the order the points were generated in.
+func Sample(points [][3]float64, max int, rng *rand.Rand) [][3]float64 {
+	if len(points) <= max {
+		return points
+	}
+	out := make([][3]float64, max)
+	for i, j := range rng.Perm(len(points))[:max] {
+		out[i] = points[j]
+	}
+	return out
+}
@@ -0,0 +1,139 @@
+package pattern
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func uniform(n int, rng *rand.Rand) [][3]float64 {
+	points := make([][3]float64, n)
+	for i := range points {
+		points[i] = [3]float64{rng.Float64(), 2 * rng.Float64(), rng.Float64()}
+	}
+	return points
+}
+
+// TestUniform checks the estimates for a uniform pattern against their
+// values under CSR, such as K(r) = 4/3 πr³.
+func TestUniform(t *testing.T) {
+	points := uniform(3000, rand.New(rand.NewSource(1)))
+	res, err := Analyze(context.Background(), points, Options{Simulations: 19, Seed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Functions) != 5 || res.Points != len(points) || math.Abs(res.Intensity/1500-1) > 0.01 {
+		t.Fatalf("%d functions, %d points, intensity %v", len(res.Functions), res.Points, res.Intensity)
+	}
+	// Tolerances for K, L and g are relative to the theoretical value and
+	// for the distribution functions G and F absolute. Estimates at the
+	// smallest distances rest on few pairs and are skipped.
+	tolerance := map[string]func(want float64) float64{
+		"K": func(want float64) float64 { return 0.1 * want },
+		"L": func(want float64) float64 { return 0.04 * want },
+		"g": func(want float64) float64 { return 0.25 * want },
+		"G": func(float64) float64 { return 0.04 },
+		"F": func(float64) float64 { return 0.04 },
+	}
+	for _, fn := range res.Functions {
+		if fn.Name == "K" {
+			for i, r := range fn.R {
+				if want := 4 * math.Pi / 3 * r * r * r; math.Abs(fn.Theoretical[i]-want) > 1e-12 {
+					t.Errorf("theoretical K(%v) = %v, want %v", r, fn.Theoretical[i], want)
+				}
+			}
+		}
+		outside := 0
+		for i := len(fn.R) / 5; i < len(fn.R); i++ {
+			obs, want := fn.Observed[i], fn.Theoretical[i]
+			if math.Abs(obs-want) > tolerance[fn.Name](want) {
+				t.Errorf("%s(%.3f) = %v, want about %v", fn.Name, fn.R[i], obs, want)
+			}
+			if !(fn.Lo[i] <= fn.Hi[i]) {
+				t.Errorf("%s(%.3f): envelope [%v, %v]", fn.Name, fn.R[i], fn.Lo[i], fn.Hi[i])
+			}
+			if obs < fn.Lo[i] || obs > fn.Hi[i] {
+				outside++
+			}
+		}
+		if outside > len(fn.R)/2 {
+			t.Errorf("%s leaves its envelope at %d of %d distances", fn.Name, outside, len(fn.R))
+		}
+	}
+}
+
+// TestClustered checks that K of a clustered pattern rises above its
+// envelope.
+func TestClustered(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	var points [][3]float64
+	for _, c := range uniform(30, rng) {
+		for i := 0; i < 30; i++ {
+			points = append(points, [3]float64{c[0] + 0.03*rng.NormFloat64(), c[1] + 0.03*rng.NormFloat64(), c[2] + 0.03*rng.NormFloat64()})
+		}
+	}
+	res, err := Analyze(context.Background(), points, Options{Simulations: 19})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := res.Functions[0]
+	if i := len(k.R) / 4; !(k.Observed[i] > k.Hi[i]) {
+		t.Errorf("K(%v) of a clustered pattern = %v, inside the envelope [%v, %v]", k.R[i], k.Observed[i], k.Lo[i], k.Hi[i])
+	}
+}
+
+func TestAnalyzeErrors(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	planar := uniform(100, rng)
+	for i := range planar {
+		planar[i][2] = 1
+	}
+	huge := uniform(100, rng)
+	huge[0] = [3]float64{-math.MaxFloat64, -math.MaxFloat64, -math.MaxFloat64}
+	huge[1] = [3]float64{math.MaxFloat64, math.MaxFloat64, math.MaxFloat64}
+	points := uniform(100, rng)
+	tests := []struct {
+		name   string
+		points [][3]float64
+		opts   Options
+	}{
+		{"one point", points[:1], Options{}},
+		{"planar", planar, Options{}},
+		{"infinite volume", huge, Options{}},
+		{"too many simulations", points, Options{Simulations: MaxSimulations + 1}},
+		{"negative simulations", points, Options{Simulations: -1}},
+		{"too many steps", points, Options{Steps: maxSteps + 1}},
+	}
+	for _, tt := range tests {
+		if _, err := Analyze(context.Background(), tt.points, tt.opts); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
+
+func TestAnalyzeCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Analyze(ctx, uniform(500, rand.New(rand.NewSource(5))), Options{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Analyze with a cancelled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestSample(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	points := uniform(100, rng)
+	if s := Sample(points, 200, rng); len(s) != 100 {
+		t.Errorf("Sample of 100 points to 200 has %d", len(s))
+	}
+	s := Sample(points, 10, rng)
+	seen := map[[3]float64]bool{}
+	for _, p := range s {
+		seen[p] = true
+	}
+	if len(s) != 10 || len(seen) != 10 {
+		t.Errorf("Sample to 10 has %d points, %d distinct", len(s), len(seen))
+	}
+}
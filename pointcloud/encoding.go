@@ -0,0 +1,236 @@
+package pointcloud
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The wire format is little-endian:
+//
+//	"TDV2" | uint32 points | uint32 attributes | uint32 flags | string name
+//	float32 positions[3*points]
+//	uint32 ids[points], if flags&flagIDs
+//	repeated per axis, if flags&flagAxes: string name | uint32 levels | string labels[levels]
+//	uint32 parts | string names[parts], if flags&flagParts
+//	repeated per attribute: string name | float32 values[points]
+//
+// where a string is a uint16 byte length followed by UTF-8 bytes. Version 1
+// ("TDV1") lacks the flags field and IDs, and is still accepted by Decode.
+// The format avoids reflection so the client can decode it cheaply.
+const (
+	magic   = "TDV2"
+	magicV1 = "TDV1"
+)
+
+// Flags mark optional parts of an encoding: original point IDs, lattice
+// axes and composition parts.
+const (
+	flagIDs   = 1
+	flagAxes  = 2
+	flagParts = 4
+)
+
+// maxParts bounds the composition parts Decode accepts.
+const maxParts = 16
+
+// ErrFormat is returned by Decode for input that is not an encoded cloud.
+var ErrFormat = errors.New("pointcloud: invalid encoding")
+
+// Encode writes c to w in the binary wire format.
+func (c *Cloud) Encode(w io.Writer) error {
+	for _, a := range c.Attributes {
+		if len(a.Values) != c.Len() {
+			return fmt.Errorf("pointcloud: attribute %q has %d values for %d points", a.Name, len(a.Values), c.Len())
+		}
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(c.Len()))
+	bw.Write(buf[:])
+	binary.LittleEndian.PutUint32(buf[:], uint32(len(c.Attributes)))
+	bw.Write(buf[:])
+	var flags uint32
+	if len(c.Axes) != 0 && len(c.Axes) != 3 {
+		return fmt.Errorf("pointcloud: %d lattice axes", len(c.Axes))
+	}
+	if c.IDs != nil {
+		flags |= flagIDs
+	}
+	if c.Axes != nil {
+		flags |= flagAxes
+	}
+	if c.Parts != nil {
+		flags |= flagParts
+	}
+	binary.LittleEndian.PutUint32(buf[:], flags)
+	bw.Write(buf[:])
+	writeString(bw, c.Name)
+	writeFloats(bw, c.Positions)
+	for _, id := range c.IDs {
+		binary.LittleEndian.PutUint32(buf[:], id)
+		bw.Write(buf[:])
+	}
+	for _, a := range c.Axes {
+		writeString(bw, a.Name)
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(a.Levels)))
+		bw.Write(buf[:])
+		for _, l := range a.Levels {
+			writeString(bw, l)
+		}
+	}
+	if c.Parts != nil {
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(c.Parts)))
+		bw.Write(buf[:])
+		for _, p := range c.Parts {
+			writeString(bw, p)
+		}
+	}
+	for _, a := range c.Attributes {
+		writeString(bw, a.Name)
+		writeFloats(bw, a.Values)
+	}
+	return bw.Flush()
+}
+
+// Decode reads a cloud written by Encode.
+func Decode(r io.Reader) (*Cloud, error) {
+	br := bufio.NewReader(r)
+	var head [12]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		return nil, err
+	}
+	var flags uint32
+	switch string(head[:4]) {
+	case magic:
+		var buf [4]byte
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return nil, err
+		}
+		flags = binary.LittleEndian.Uint32(buf[:])
+	case magicV1:
+	default:
+		return nil, ErrFormat
+	}
+	n := int(binary.LittleEndian.Uint32(head[4:]))
+	nattr := int(binary.LittleEndian.Uint32(head[8:]))
+	name, err := readString(br)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cloud{Name: name}
+	if c.Positions, err = readFloats(br, 3*n); err != nil {
+		return nil, err
+	}
+	if flags&flagIDs != 0 {
+		if c.IDs, err = readWords(br, n, func(w uint32) uint32 { return w }); err != nil {
+			return nil, err
+		}
+	}
+	if flags&flagAxes != 0 {
+		c.Axes = make([]Axis, 3)
+		for k := range c.Axes {
+			a := &c.Axes[k]
+			if a.Name, err = readString(br); err != nil {
+				return nil, err
+			}
+			var buf [4]byte
+			if _, err := io.ReadFull(br, buf[:]); err != nil {
+				return nil, err
+			}
+			m := binary.LittleEndian.Uint32(buf[:])
+			if m > MaxLevels {
+				return nil, ErrFormat
+			}
+			a.Levels = make([]string, m)
+			for i := range a.Levels {
+				if a.Levels[i], err = readString(br); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if flags&flagParts != 0 {
+		var buf [4]byte
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return nil, err
+		}
+		m := binary.LittleEndian.Uint32(buf[:])
+		if m > maxParts {
+			return nil, ErrFormat
+		}
+		c.Parts = make([]string, m)
+		for i := range c.Parts {
+			if c.Parts[i], err = readString(br); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := 0; i < nattr; i++ {
+		var a Attribute
+		if a.Name, err = readString(br); err != nil {
+			return nil, err
+		}
+		if a.Values, err = readFloats(br, n); err != nil {
+			return nil, err
+		}
+		c.Attributes = append(c.Attributes, a)
+	}
+	return c, nil
+}
+
+func writeString(w *bufio.Writer, s string) {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], uint16(len(s)))
+	w.Write(buf[:])
+	w.WriteString(s)
+}
+
+func writeFloats(w *bufio.Writer, values []float32) {
+	var buf [4]byte
+	for _, v := range values {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(v))
+		w.Write(buf[:])
+	}
+}
+
+func readString(r io.Reader) (string, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return "", err
+	}
+	b := make([]byte, binary.LittleEndian.Uint16(buf[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readChunk is the most values read at once. The counts in a header are
+// not trusted: buffers grow with the data actually read, so a short input
+// claiming many points fails without allocating for them.
+const readChunk = 1 << 16
+
+// readWords reads n little-endian 32-bit words, converting each with conv.
+func readWords[T any](r io.Reader, n int, conv func(uint32) T) ([]T, error) {
+	values := make([]T, 0, min(n, readChunk))
+	b := make([]byte, 4*min(n, readChunk))
+	for len(values) < n {
+		m := min(n-len(values), readChunk)
+		if _, err := io.ReadFull(r, b[:4*m]); err != nil {
+			return nil, err
+		}
+		for i := 0; i < m; i++ {
+			values = append(values, conv(binary.LittleEndian.Uint32(b[4*i:])))
+		}
+	}
+	return values, nil
+}
+
+func readFloats(r io.Reader, n int) ([]float32, error) {
+	return readWords(r, n, math.Float32frombits)
+}
@@ -0,0 +1,53 @@
+package pointcloud
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+	c := New("cloud", 3)
+	for i := 0; i < 3; i++ {
+		c.SetPoint(i, float32(i), float32(2*i), float32(-i))
+	}
+	c.SetAttribute("value", []float32{0.5, 1.5, 2.5})
+	c.IDs = []uint32{2, 0, 1}
+	var buf bytes.Buffer
+	if err := c.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("Decode(Encode(c)) = %+v, want %+v", got, c)
+	}
+}
+
+// A header claiming far more points than the input holds must fail on the
+// short read without allocating for the claimed points.
+func TestDecodeHugeCount(t *testing.T) {
+	for _, flags := range []uint32{0, flagIDs} {
+		var b []byte
+		b = append(b, magic...)
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF) // points
+		b = binary.LittleEndian.AppendUint32(b, 1)          // attributes
+		b = binary.LittleEndian.AppendUint32(b, flags)
+		b = append(b, 0, 0) // empty name
+		b = append(b, make([]byte, 64)...)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		if _, err := Decode(bytes.NewReader(b)); err == nil {
+			t.Fatalf("flags %d: Decode of a truncated cloud succeeded", flags)
+		}
+		runtime.ReadMemStats(&after)
+		if grown := after.TotalAlloc - before.TotalAlloc; grown > 16<<20 {
+			t.Errorf("flags %d: Decode allocated %d bytes for a %d-byte input", flags, grown, len(b))
+		}
+	}
+}
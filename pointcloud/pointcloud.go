@@ -0,0 +1,169 @@
+// Package pointcloud holds the in-memory representation of a point
+// distribution, shared by the server and the WASM client.
+package pointcloud
+
+import "math"
+
+// Cloud is a set of 3D points stored as interleaved x, y, z coordinates,
+// plus optional per-point scalar attributes used for coloring.
+type Cloud struct {
+	Name       string
+	Positions  []float32
+	Attributes []Attribute
+	// IDs maps each point to its index in the cloud as originally loaded,
+	// after the points have been reordered. Nil means points are in their
+	// original order.
+	IDs []uint32
+	// Axes, if set, mark the cloud as the lattice of a discrete
+	// distribution: coordinate k of each point is a level index along
+	// Axes[k]. There are three axes or none.
+	Axes []Axis
+	// Parts, if set, name the three or four parts of compositions shown in
+	// the simplex: each point is the mixture of the simplex vertices
+	// (package compositional) weighted by its parts.
+	Parts []string
+}
+
+// Axis names a variable of a discrete distribution and labels its levels.
+type Axis struct {
+	Name   string
+	Levels []string
+}
+
+// MaxLevels bounds the number of levels of a lattice axis.
+const MaxLevels = 1000
+
+// Attribute is a named scalar value per point. NaN marks points for which
+// the attribute is undefined (for example outliers of a synthetic manifold).
+type Attribute struct {
+	Name   string
+	Values []float32
+}
+
+// New returns a cloud with room for n points and no attributes.
+func New(name string, n int) *Cloud {
+	return &Cloud{Name: name, Positions: make([]float32, 3*n)}
+}
+
+// Len returns the number of points.
+func (c *Cloud) Len() int {
+	return len(c.Positions) / 3
+}
+
+// Point returns the coordinates of point i.
+func (c *Cloud) Point(i int) (x, y, z float32) {
+	p := c.Positions[3*i : 3*i+3]
+	return p[0], p[1], p[2]
+}
+
+// SetPoint sets the coordinates of point i.
+func (c *Cloud) SetPoint(i int, x, y, z float32) {
+	p := c.Positions[3*i : 3*i+3]
+	p[0], p[1], p[2] = x, y, z
+}
+
+// ID returns the original index of point i.
+func (c *Cloud) ID(i int) uint32 {
+	if c.IDs == nil {
+		return uint32(i)
+	}
+	return c.IDs[i]
+}
+
+// Permute reorders the points so that new point i is old point perm[i],
+// carrying attributes along and recording original IDs.
+func (c *Cloud) Permute(perm []int) {
+	positions := make([]float32, len(c.Positions))
+	ids := make([]uint32, len(perm))
+	for i, j := range perm {
+		copy(positions[3*i:3*i+3], c.Positions[3*j:3*j+3])
+		ids[i] = c.ID(j)
+	}
+	c.Positions, c.IDs = positions, ids
+	for k, a := range c.Attributes {
+		values := make([]float32, len(a.Values))
+		for i, j := range perm {
+			values[i] = a.Values[j]
+		}
+		c.Attributes[k].Values = values
+	}
+}
+
+// Attribute returns the values of the named attribute, or nil if the cloud
+// has no such attribute.
+func (c *Cloud) Attribute(name string) []float32 {
+	for _, a := range c.Attributes {
+		if a.Name == name {
+			return a.Values
+		}
+	}
+	return nil
+}
+
+// SetAttribute adds the named attribute, replacing any existing attribute
+// with the same name. values must have one entry per point.
+func (c *Cloud) SetAttribute(name string, values []float32) {
+	for i, a := range c.Attributes {
+		if a.Name == name {
+			c.Attributes[i].Values = values
+			return
+		}
+	}
+	c.Attributes = append(c.Attributes, Attribute{Name: name, Values: values})
+}
+
+// Bounds returns the axis-aligned bounding box of the points. An empty
+// cloud has an empty (inverted) box.
+func (c *Cloud) Bounds() (min, max [3]float32) {
+	for k := 0; k < 3; k++ {
+		min[k] = float32(math.Inf(1))
+		max[k] = float32(math.Inf(-1))
+	}
+	for i := 0; i < len(c.Positions); i += 3 {
+		for k := 0; k < 3; k++ {
+			v := c.Positions[i+k]
+			if v < min[k] {
+				min[k] = v
+			}
+			if v > max[k] {
+				max[k] = v
+			}
+		}
+	}
+	return min, max
+}
+
+// Range returns the smallest and largest non-NaN value of an attribute.
+func Range(values []float32) (lo, hi float32) {
+	lo, hi = float32(math.Inf(1)), float32(math.Inf(-1))
+	for _, v := range values {
+		if v != v {
+			continue
+		}
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	return lo, hi
+}
+
+// Bytes returns the approximate memory held by the cloud's slices.
+func (c *Cloud) Bytes() int64 {
+	n := int64(4*len(c.Positions) + 4*len(c.IDs) + len(c.Name))
+	for _, p := range c.Parts {
+		n += int64(len(p))
+	}
+	for _, a := range c.Axes {
+		n += int64(len(a.Name))
+		for _, l := range a.Levels {
+			n += int64(len(l))
+		}
+	}
+	for _, a := range c.Attributes {
+		n += int64(4*len(a.Values) + len(a.Name))
+	}
+	return n
+}
@@ -0,0 +1,31 @@
+package pointcloud
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// ReadRecords reads the records of a comma- or tab-separated table, which
+// is tab-separated if its first line that is not a comment holds a tab.
+// Lines starting with # are comments and leading spaces in fields are
+// dropped.
+func ReadRecords(r io.Reader) ([][]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			if strings.Contains(line, "\t") {
+				cr.Comma = '\t'
+			}
+			break
+		}
+	}
+	return cr.ReadAll()
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/jpeg"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/render"
+	"github.com/sbecker11/threedistvis-go/trace"
+	"github.com/sbecker11/threedistvis-go/websocket"
+)
+
+// Remote rendering serves clients that cannot render the view themselves.
+// The server keeps the camera and coloring of each connection, renders
+// frames on the CPU with the same camera and color mapping as the WebGL
+// client, and streams them as JPEG images over a WebSocket. The client
+// sends its input as JSON messages:
+//
+//	{"type": "load", "dataset": "synth/torus", "options": "n=5000"}
+//	{"type": "resize", "width": 800, "height": 600}
+//	{"type": "drag", "dx": 12}              turn the camera
+//	{"type": "rotate"}                      toggle rotation
+//	{"type": "reset"}                       reset the camera
+//	{"type": "color", "by": "t", "colormap": "viridis"}
+//
+// and the server answers with binary frames and JSON text messages:
+//
+//	{"type": "loaded", "dataset": ..., "points": n, "attributes": [...], "colorBy": ..., "colormaps": [...]}
+//	{"type": "error", "message": ...}
+const (
+	// remoteFrameInterval paces frames while the view changes.
+	remoteFrameInterval = time.Second / 15
+	// remoteRotation is the rotation speed in radians per second, matching
+	// the client's 0.01 per frame at 60 frames per second.
+	remoteRotation = 0.6
+	// remoteMaxPixels bounds the frame size clients may ask for.
+	remoteMaxPixels = 1920 * 1200
+	// remoteMaxPoints bounds the points rendered per frame; larger clouds
+	// are drawn from an evenly spaced subset.
+	remoteMaxPoints   = 500000
+	remoteJPEGQuality = 75
+)
+
+var remoteSessions atomic.Int64
+
+type remoteSession struct {
+	ctx  context.Context
+	conn *websocket.Conn
+
+	cloud     *pointcloud.Cloud
+	positions []float32 // possibly thinned
+	colors    []float32
+	center    [3]float32
+	scale     float32
+	colorBy   string
+	cmap      *colormap.Colormap
+	palette   *colormap.Palette
+
+	angle         float32
+	rotating      bool
+	width, height int
+	dirty         bool
+}
+
+// remoteEvent is an input message from the client.
+type remoteEvent struct {
+	Type     string  `json:"type"`
+	Dataset  string  `json:"dataset"`
+	Options  string  `json:"options"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	DX       float64 `json:"dx"`
+	By       string  `json:"by"`
+	Colormap string  `json:"colormap"`
+}
+
+// handleRender serves remote rendering sessions on GET /api/render/ws.
+func handleRender(w http.ResponseWriter, r *http.Request) {
+	if strings.TrimPrefix(r.URL.Path, "/api/render/") != "ws" {
+		http.NotFound(w, r)
+		return
+	}
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	remoteSessions.Add(1)
+	defer remoteSessions.Add(-1)
+
+	ctx, span := trace.Start(context.Background(), "render.session")
+	defer span.End()
+	s := &remoteSession{ctx: ctx, conn: conn, rotating: true, width: 800, height: 600, dirty: true}
+	s.cmap, _ = colormap.Get("viridis")
+	s.palette, _ = colormap.GetPalette("tab10")
+
+	events := make(chan remoteEvent, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(events)
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var e remoteEvent
+			if kind != websocket.Text || json.Unmarshal(data, &e) != nil {
+				continue
+			}
+			select {
+			case events <- e:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	frames, bytesSent := 0, 0
+	defer func() { span.Set("render.frames", frames, "render.bytes", bytesSent) }()
+	ticker := time.NewTicker(remoteFrameInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			s.handle(e)
+			continue
+		case now := <-ticker.C:
+			if s.rotating {
+				s.angle += float32(remoteRotation * now.Sub(last).Seconds())
+				s.dirty = true
+			}
+			last = now
+		}
+		if !s.dirty || s.cloud == nil {
+			continue
+		}
+		frame, err := s.frame()
+		if err != nil {
+			trace.Println(ctx, "Remote render error:", err)
+			return
+		}
+		// Writing blocks until the client takes the frame, so slow
+		// connections get fewer frames rather than a backlog.
+		if err := conn.WriteMessage(websocket.Binary, frame); err != nil {
+			return
+		}
+		s.dirty = false
+		frames++
+		bytesSent += len(frame)
+	}
+}
+
+func (s *remoteSession) handle(e remoteEvent) {
+	s.dirty = true
+	switch e.Type {
+	case "load":
+		if err := s.load(e.Dataset, e.Options); err != nil {
+			s.send(map[string]interface{}{"type": "error", "message": err.Error()})
+		}
+	case "resize":
+		if e.Width > 0 && e.Height > 0 && e.Width <= remoteMaxPixels && e.Height <= remoteMaxPixels/e.Width {
+			s.width, s.height = e.Width, e.Height
+		}
+	case "drag":
+		s.angle += float32(e.DX * 0.01)
+	case "rotate":
+		s.rotating = !s.rotating
+	case "reset":
+		s.angle = 0
+	case "color":
+		if m, ok := colormap.Get(e.Colormap); ok {
+			s.cmap = m
+		}
+		if e.By == "" || s.cloud != nil && s.cloud.Attribute(e.By) != nil {
+			s.colorBy = e.By
+		}
+		s.recolor()
+	}
+}
+
+// load fetches a dataset through the cache and fits the view to it.
+func (s *remoteSession) load(name, options string) error {
+	params, err := url.ParseQuery(strings.TrimPrefix(options, "?"))
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(name, "stream/") {
+		return errors.New("live streams cannot be viewed remotely")
+	}
+	ctx, span := trace.Start(s.ctx, "render.load")
+	defer span.End()
+	span.Set("dataset", name)
+	c, err := datasets.Get(ctx, name, params)
+	if err != nil {
+		span.Fail(err)
+		return err
+	}
+	s.cloud = c
+	s.center, s.scale = render.Fit(c)
+	s.colorBy = render.DefaultAttribute(c)
+	s.positions = c.Positions
+	if n := c.Len(); n > remoteMaxPoints {
+		s.positions = thin(c.Positions, 3, n, remoteMaxPoints)
+	}
+	s.recolor()
+	var attrs []string
+	for _, a := range c.Attributes {
+		attrs = append(attrs, a.Name)
+	}
+	s.send(map[string]interface{}{
+		"type":       "loaded",
+		"dataset":    name,
+		"points":     c.Len(),
+		"attributes": attrs,
+		"colorBy":    s.colorBy,
+		"colormaps":  colormap.Names(),
+	})
+	return nil
+}
+
+func (s *remoteSession) recolor() {
+	if s.cloud == nil {
+		return
+	}
+	n := s.cloud.Len()
+	values := s.cloud.Attribute(s.colorBy)
+	cats := render.Categories(values)
+	if values != nil && n > remoteMaxPoints {
+		values = thin(values, 1, n, remoteMaxPoints)
+	}
+	s.colors = render.Colors(len(s.positions)/3, values, cats, s.cmap, s.palette)
+}
+
+// thin keeps max of the n items of stride values each, evenly spaced.
+func thin(values []float32, stride, n, max int) []float32 {
+	out := make([]float32, 0, stride*max)
+	for k := 0; k < max; k++ {
+		i := k * n / max
+		out = append(out, values[stride*i:stride*i+stride]...)
+	}
+	return out
+}
+
+// frame renders the view and encodes it as JPEG.
+func (s *remoteSession) frame() ([]byte, error) {
+	mvp := render.Projection(s.width, s.height).Mul(render.View(s.angle)).Mul(render.DataTransform(s.center, s.scale))
+	img := render.Points(s.positions, s.colors, mvp, s.width, s.height)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: remoteJPEGQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *remoteSession) send(msg map[string]interface{}) {
+	if b, err := json.Marshal(msg); err == nil {
+		s.conn.WriteMessage(websocket.Text, b)
+	}
+}
+
+func registerRemoteMetrics() {
+	registerMetric("threedistvis_remote_sessions", "gauge", "Open remote rendering sessions.",
+		value(func() float64 { return float64(remoteSessions.Load()) }))
+}
@@ -0,0 +1,165 @@
+// Package render holds the camera and color mapping shared by the WebGL
+// client and the server, and a CPU renderer that draws point clouds into
+// images with them, for clients that cannot render themselves.
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/geom"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// DefaultAttribute is the attribute a cloud is colored by when it is
+// loaded: its first, unless that only flags outliers.
+func DefaultAttribute(c *pointcloud.Cloud) string {
+	for _, a := range c.Attributes {
+		if a.Name != "outlier" {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+// Fit returns the center and scale that fit a cloud's points into the
+// view: the center of their bounding box is shown at the origin and the
+// farthest point at radius 0.9.
+func Fit(c *pointcloud.Cloud) (center [3]float32, scale float32) {
+	lo, hi := c.Bounds()
+	for k := range center {
+		center[k] = (lo[k] + hi[k]) / 2
+	}
+	var radius float32
+	for i := 0; i < c.Len(); i++ {
+		x, y, z := c.Point(i)
+		x, y, z = x-center[0], y-center[1], z-center[2]
+		if r := float32(math.Sqrt(float64(x*x + y*y + z*z))); r > radius {
+			radius = r
+		}
+	}
+	scale = 1
+	if radius > 0 {
+		scale = 0.9 / radius
+	}
+	return center, scale
+}
+
+// DataTransform maps data coordinates to view coordinates for a cloud
+// fitted with Fit.
+func DataTransform(center [3]float32, scale float32) geom.Mat4 {
+	return geom.Scale(geom.Vec3{scale, scale, scale}).Mul(geom.Translate(geom.Vec3(center).Scale(-1)))
+}
+
+// View rotates the scene about the vertical axis.
+func View(angle float32) geom.Mat4 {
+	return geom.RotateY(angle)
+}
+
+// Projection is orthographic, keeping the unit sphere in view whatever the
+// aspect ratio. The camera looks down -z.
+func Projection(width, height int) geom.Mat4 {
+	sx, sy := float32(1), float32(1)
+	if width > height {
+		sx = float32(height) / float32(width)
+	} else if height > width {
+		sy = float32(width) / float32(height)
+	}
+	return geom.Scale(geom.Vec3{sx, sy, -1})
+}
+
+// MaxCategories is the most distinct values an integer-valued attribute
+// may take to be colored with a categorical palette.
+const MaxCategories = 12
+
+// Categories returns the sorted distinct values of an attribute if it is
+// categorical, or nil.
+func Categories(values []float32) []float32 {
+	seen := map[float32]bool{}
+	for _, t := range values {
+		if t != t || seen[t] {
+			continue
+		}
+		if t != float32(math.Trunc(float64(t))) || len(seen) == MaxCategories {
+			return nil
+		}
+		seen[t] = true
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	cats := make([]float32, 0, len(seen))
+	for t := range seen {
+		cats = append(cats, t)
+	}
+	sort.Slice(cats, func(i, j int) bool { return cats[i] < cats[j] })
+	return cats
+}
+
+// Colors returns rgb-interleaved colors for n points with the given
+// attribute values: palette colors for categorical attributes (cats from
+// Categories), the colormap over the value range otherwise, gray where a
+// value is NaN and white for all points if values is nil.
+func Colors(n int, values, cats []float32, cmap *colormap.Colormap, palette *colormap.Palette) []float32 {
+	colors := make([]float32, 3*n)
+	lo, hi := pointcloud.Range(values)
+	for i := 0; i < n; i++ {
+		rgb := colormap.RGB{R: 1, G: 1, B: 1}
+		if values != nil {
+			switch t := values[i]; {
+			case t != t:
+				rgb = colormap.RGB{R: 0.5, G: 0.5, B: 0.5}
+			case cats != nil:
+				rgb = palette.At(sort.Search(len(cats), func(k int) bool { return cats[k] >= t }))
+			default:
+				rgb = cmap.At(cmap.Normalize(float64(t), float64(lo), float64(hi)))
+			}
+		}
+		colors[3*i], colors[3*i+1], colors[3*i+2] = float32(rgb.R), float32(rgb.G), float32(rgb.B)
+	}
+	return colors
+}
+
+// PointSize is the side of the square drawn for each point, in pixels, as
+// in the WebGL client.
+const PointSize = 3
+
+// Points draws xyz-interleaved positions with rgb-interleaved colors into
+// a width by height image on black, transformed by mvp into clip space.
+// Nearer points hide farther ones.
+func Points(positions, colors []float32, mvp geom.Mat4, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	depth := make([]float32, width*height)
+	for i := range depth {
+		depth[i] = 2 // beyond the far plane
+	}
+	for i := 0; i+2 < len(positions); i += 3 {
+		p := mvp.Apply(geom.Vec3{positions[i], positions[i+1], positions[i+2]})
+		if p[2] < -1 || p[2] > 1 {
+			continue
+		}
+		c := color.RGBA{to8(colors[i]), to8(colors[i+1]), to8(colors[i+2]), 255}
+		cx := int((p[0] + 1) / 2 * float32(width))
+		cy := int((1 - p[1]) / 2 * float32(height))
+		for y := cy - PointSize/2; y <= cy+PointSize/2; y++ {
+			for x := cx - PointSize/2; x <= cx+PointSize/2; x++ {
+				if x < 0 || y < 0 || x >= width || y >= height || p[2] >= depth[y*width+x] {
+					continue
+				}
+				depth[y*width+x] = p[2]
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+func to8(v float32) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(float64(v)*255))))
+}
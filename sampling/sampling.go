@@ -0,0 +1,281 @@
+// Package sampling provides 3D source distributions with known moments and
+// the large-sample limits of estimators computed from them, for
+// demonstrating sampling distributions such as the central limit theorem.
+package sampling
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Distribution is a 3D source distribution. The mean and covariance are
+// exact where they exist; the median is componentwise.
+type Distribution struct {
+	Name        string
+	Description string
+	draw        func(rng *rand.Rand) [3]float64
+
+	heavy bool // no mean or covariance
+	mean  [3]float64
+	cov   [3][3]float64
+	// median and medianCov give the limit of the componentwise median:
+	// sqrt(n)(median - m) tends to a Gaussian with covariance
+	// (P(X_i < m_i, X_j < m_j) - 1/4) / (f_i(m_i) f_j(m_j)), where f_i is
+	// the marginal density.
+	median    [3]float64
+	medianCov [3][3]float64
+}
+
+// Draw returns one point.
+func (d *Distribution) Draw(rng *rand.Rand) [3]float64 {
+	return d.draw(rng)
+}
+
+// Sample returns n independent points.
+func (d *Distribution) Sample(n int, rng *rand.Rand) [][3]float64 {
+	s := make([][3]float64, n)
+	for i := range s {
+		s[i] = d.draw(rng)
+	}
+	return s
+}
+
+// Moments returns the mean and covariance, or ok false if they do not
+// exist.
+func (d *Distribution) Moments() (mean [3]float64, cov [3][3]float64, ok bool) {
+	return d.mean, d.cov, !d.heavy
+}
+
+// Limit returns the center and covariance of the Gaussian that the
+// estimator computed from samples of size n approaches, or ok false if it
+// does not approach one.
+func (d *Distribution) Limit(estimator string, n int) (center [3]float64, cov [3][3]float64, ok bool) {
+	switch estimator {
+	case "mean":
+		if d.heavy {
+			return center, cov, false
+		}
+		center, cov = d.mean, d.cov
+	case "median":
+		center, cov = d.median, d.medianCov
+	default:
+		return center, cov, false
+	}
+	for i := range cov {
+		for j := range cov[i] {
+			cov[i][j] /= float64(n)
+		}
+	}
+	return center, cov, true
+}
+
+// Estimators lists the estimators accepted by Estimate and Limit.
+var Estimators = []string{"mean", "median"}
+
+// Estimate computes the named estimator from a sample.
+func Estimate(estimator string, sample [][3]float64) ([3]float64, error) {
+	var e [3]float64
+	if len(sample) == 0 {
+		return e, fmt.Errorf("sampling: empty sample")
+	}
+	switch estimator {
+	case "mean":
+		for _, p := range sample {
+			for k := range e {
+				e[k] += p[k]
+			}
+		}
+		for k := range e {
+			e[k] /= float64(len(sample))
+		}
+	case "median":
+		values := make([]float64, len(sample))
+		for k := range e {
+			for i, p := range sample {
+				values[i] = p[k]
+			}
+			sort.Float64s(values)
+			m := len(values) / 2
+			if len(values)%2 == 1 {
+				e[k] = values[m]
+			} else {
+				e[k] = (values[m-1] + values[m]) / 2
+			}
+		}
+	default:
+		return e, fmt.Errorf("sampling: unknown estimator %q", estimator)
+	}
+	return e, nil
+}
+
+var distributions = map[string]*Distribution{}
+
+// Get returns the named distribution.
+func Get(name string) (*Distribution, bool) {
+	d, ok := distributions[name]
+	return d, ok
+}
+
+// Names returns the names accepted by Get, sorted.
+func Names() []string {
+	names := make([]string, 0, len(distributions))
+	for n := range distributions {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func register(d *Distribution) {
+	distributions[d.Name] = d
+}
+
+// independent returns a diagonal matrix.
+func independent(a, b, c float64) [3][3]float64 {
+	return [3][3]float64{{a, 0, 0}, {0, b, 0}, {0, 0, c}}
+}
+
+func init() {
+	gaussCov := [3][3]float64{{1, 0.6, 0.3}, {0.6, 1, 0.2}, {0.3, 0.2, 0.5}}
+	gaussL, _ := Cholesky(gaussCov)
+	var gaussMedianCov [3][3]float64
+	for i := range gaussCov {
+		for j := range gaussCov {
+			si, sj := math.Sqrt(gaussCov[i][i]), math.Sqrt(gaussCov[j][j])
+			gaussMedianCov[i][j] = si * sj * math.Asin(gaussCov[i][j]/(si*sj))
+		}
+	}
+	register(&Distribution{
+		Name:        "gaussian",
+		Description: "correlated Gaussian",
+		draw: func(rng *rand.Rand) [3]float64 {
+			z := [3]float64{rng.NormFloat64(), rng.NormFloat64(), rng.NormFloat64()}
+			return mulLower(gaussL, z)
+		},
+		cov:       gaussCov,
+		medianCov: gaussMedianCov,
+	})
+
+	register(&Distribution{
+		Name:        "uniform",
+		Description: "uniform on the cube [-1, 1]³",
+		draw: func(rng *rand.Rand) [3]float64 {
+			return [3]float64{2*rng.Float64() - 1, 2*rng.Float64() - 1, 2*rng.Float64() - 1}
+		},
+		cov:       independent(1.0/3, 1.0/3, 1.0/3),
+		medianCov: independent(1, 1, 1),
+	})
+
+	register(&Distribution{
+		Name:        "exponential",
+		Description: "independent Exp(1) coordinates, skewed",
+		draw: func(rng *rand.Rand) [3]float64 {
+			return [3]float64{rng.ExpFloat64(), rng.ExpFloat64(), rng.ExpFloat64()}
+		},
+		mean:      [3]float64{1, 1, 1},
+		cov:       independent(1, 1, 1),
+		median:    [3]float64{math.Ln2, math.Ln2, math.Ln2},
+		medianCov: independent(1, 1, 1),
+	})
+
+	const s = 0.75 // log-scale standard deviation
+	lnMean, lnVar := math.Exp(s*s/2), (math.Exp(s*s)-1)*math.Exp(s*s)
+	lnMedianVar := math.Pi * s * s / 2
+	register(&Distribution{
+		Name:        "lognormal",
+		Description: "independent lognormal coordinates, strongly skewed",
+		draw: func(rng *rand.Rand) [3]float64 {
+			return [3]float64{math.Exp(s * rng.NormFloat64()), math.Exp(s * rng.NormFloat64()), math.Exp(s * rng.NormFloat64())}
+		},
+		mean:      [3]float64{lnMean, lnMean, lnMean},
+		cov:       independent(lnVar, lnVar, lnVar),
+		median:    [3]float64{1, 1, 1},
+		medianCov: independent(lnMedianVar, lnMedianVar, lnMedianVar),
+	})
+
+	const a = 2 // distance of the modes from the origin
+	density := math.Exp(-a*a/2) / math.Sqrt(2*math.Pi)
+	register(&Distribution{
+		Name:        "bimodal",
+		Description: "two Gaussian modes at x = ±2",
+		draw: func(rng *rand.Rand) [3]float64 {
+			x := rng.NormFloat64() + a
+			if rng.Intn(2) == 0 {
+				x -= 2 * a
+			}
+			return [3]float64{x, rng.NormFloat64(), rng.NormFloat64()}
+		},
+		cov:       independent(1+a*a, 1, 1),
+		medianCov: independent(1/(4*density*density), math.Pi/2, math.Pi/2),
+	})
+
+	register(&Distribution{
+		Name:        "cauchy",
+		Description: "independent Cauchy coordinates, no mean",
+		draw: func(rng *rand.Rand) [3]float64 {
+			var p [3]float64
+			for k := range p {
+				p[k] = math.Tan(math.Pi * (rng.Float64() - 0.5))
+			}
+			return p
+		},
+		heavy:     true,
+		medianCov: independent(math.Pi*math.Pi/4, math.Pi*math.Pi/4, math.Pi*math.Pi/4),
+	})
+}
+
+// Chi2Level95 is the 95% quantile of the chi-squared distribution with
+// three degrees of freedom: 95% of a 3D Gaussian lies within this squared
+// Mahalanobis distance of its center.
+const Chi2Level95 = 7.814727903251178
+
+// Cholesky returns the lower-triangular l with l lᵀ = a, or ok false if a
+// is not positive definite.
+func Cholesky(a [3][3]float64) (l [3][3]float64, ok bool) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j <= i; j++ {
+			sum := a[i][j]
+			for k := 0; k < j; k++ {
+				sum -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if sum <= 0 {
+					return l, false
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, true
+}
+
+// Mahalanobis2 returns the squared Mahalanobis length of d under the
+// covariance with Cholesky factor l.
+func Mahalanobis2(l [3][3]float64, d [3]float64) float64 {
+	// Solve l y = d; the answer is |y|².
+	var y [3]float64
+	var sum float64
+	for i := 0; i < 3; i++ {
+		y[i] = d[i]
+		for k := 0; k < i; k++ {
+			y[i] -= l[i][k] * y[k]
+		}
+		y[i] /= l[i][i]
+		sum += y[i] * y[i]
+	}
+	return sum
+}
+
+func mulLower(l [3][3]float64, z [3]float64) [3]float64 {
+	var p [3]float64
+	for i := 0; i < 3; i++ {
+		for k := 0; k <= i; k++ {
+			p[i] += l[i][k] * z[k]
+		}
+	}
+	return p
+}
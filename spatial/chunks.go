@@ -0,0 +1,66 @@
+package spatial
+
+import "github.com/sbecker11/threedistvis-go/pointcloud"
+
+// Chunk is a run of consecutive points and their bounding box.
+type Chunk struct {
+	Start, End int // point index range [Start, End)
+	Min, Max   [3]float32
+}
+
+// ChunkIndex splits a cloud's buffers into fixed-size runs of points with
+// bounding boxes. Queries skip chunks whose boxes miss the query region, so
+// the index pays off when the cloud is spatially ordered (see Reorder) and
+// each chunk covers a compact region.
+type ChunkIndex struct {
+	Chunks []Chunk
+	cloud  *pointcloud.Cloud
+}
+
+// NewChunkIndex indexes c in chunks of size points.
+func NewChunkIndex(c *pointcloud.Cloud, size int) *ChunkIndex {
+	idx := &ChunkIndex{cloud: c}
+	for start := 0; start < c.Len(); start += size {
+		end := start + size
+		if end > c.Len() {
+			end = c.Len()
+		}
+		sub := pointcloud.Cloud{Positions: c.Positions[3*start : 3*end]}
+		min, max := sub.Bounds()
+		idx.Chunks = append(idx.Chunks, Chunk{start, end, min, max})
+	}
+	return idx
+}
+
+// Bytes reports the memory held by the index.
+func (idx *ChunkIndex) Bytes() int64 {
+	return int64(len(idx.Chunks)) * 40
+}
+
+// Box returns the indices of the points inside the axis-aligned box
+// [min, max], and the number of points examined.
+func (idx *ChunkIndex) Box(min, max [3]float32) (hits []int, scanned int) {
+	pos := idx.cloud.Positions
+	for _, ch := range idx.Chunks {
+		if !overlaps(ch.Min, ch.Max, min, max) {
+			continue
+		}
+		scanned += ch.End - ch.Start
+		for i := ch.Start; i < ch.End; i++ {
+			x, y, z := pos[3*i], pos[3*i+1], pos[3*i+2]
+			if x >= min[0] && x <= max[0] && y >= min[1] && y <= max[1] && z >= min[2] && z <= max[2] {
+				hits = append(hits, i)
+			}
+		}
+	}
+	return hits, scanned
+}
+
+func overlaps(amin, amax, bmin, bmax [3]float32) bool {
+	for k := 0; k < 3; k++ {
+		if amax[k] < bmin[k] || amin[k] > bmax[k] {
+			return false
+		}
+	}
+	return true
+}
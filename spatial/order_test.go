@@ -0,0 +1,77 @@
+package spatial
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/synth"
+)
+
+// The benchmarks compare the original order of a synthetic swiss roll with
+// Morton and Hilbert order; cmd/orderbench reports the same comparison with
+// compression and locality measures for one large run.
+
+const benchPoints = 200000
+
+var benchOrders = []struct {
+	name  string
+	order Order
+}{{"original", ""}, {"morton", Morton}, {"hilbert", Hilbert}}
+
+func benchCloud(b *testing.B) *pointcloud.Cloud {
+	c, err := synth.Generate("swissroll", synth.Options{N: benchPoints, Seed: 1})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+func BenchmarkReorder(b *testing.B) {
+	for _, o := range benchOrders[1:] {
+		b.Run(o.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				c := benchCloud(b)
+				b.StartTimer()
+				if err := Reorder(c, o.order); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBoxQuery times box queries covering 5% of the bounding box on
+// each axis against a chunk index of 4096-point chunks.
+func BenchmarkBoxQuery(b *testing.B) {
+	for _, o := range benchOrders {
+		b.Run(o.name, func(b *testing.B) {
+			c := benchCloud(b)
+			if o.order != "" {
+				if err := Reorder(c, o.order); err != nil {
+					b.Fatal(err)
+				}
+			}
+			idx := NewChunkIndex(c, 4096)
+			lo, hi := c.Bounds()
+			rng := rand.New(rand.NewSource(2))
+			boxes := make([][2][3]float32, 1000)
+			for q := range boxes {
+				for k := 0; k < 3; k++ {
+					size := 0.05 * (hi[k] - lo[k])
+					min := lo[k] + rng.Float32()*(hi[k]-lo[k]-size)
+					boxes[q][0][k], boxes[q][1][k] = min, min+size
+				}
+			}
+			scanned := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				box := boxes[i%len(boxes)]
+				_, s := idx.Box(box[0], box[1])
+				scanned += s
+			}
+			b.ReportMetric(float64(scanned)/float64(b.N), "scanned/op")
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// MaxComparePoints bounds the sample size used by MMD and EnergyDistance,
+// whose cost is quadratic. Larger inputs are thinned evenly.
+const MaxComparePoints = 500
+
+// Thin returns at most max points of p, taken at even strides so that the
+// result spans the whole input.
+func Thin(p [][3]float64, max int) [][3]float64 {
+	if len(p) <= max {
+		return p
+	}
+	out := make([][3]float64, max)
+	for i := range out {
+		out[i] = p[i*len(p)/max]
+	}
+	return out
+}
+
+func dist(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// MedianDistance returns the median pairwise distance within the pooled
+// samples, the usual choice of RBF bandwidth (the median heuristic).
+func MedianDistance(a, b [][3]float64) float64 {
+	pooled := append(Thin(a, 300), Thin(b, 300)...)
+	var d []float64
+	for i := range pooled {
+		for j := i + 1; j < len(pooled); j++ {
+			d = append(d, dist(pooled[i], pooled[j]))
+		}
+	}
+	if len(d) == 0 {
+		return 0
+	}
+	sort.Float64s(d)
+	return d[len(d)/2]
+}
+
+// MMD returns the unbiased estimate of the squared maximum mean discrepancy
+// between the distributions of a and b under the Gaussian kernel
+// exp(-|x-y|²/(2 bandwidth²)). It is near zero when both samples come from
+// the same distribution and at most 2 otherwise. A bandwidth of zero selects
+// it by the median heuristic.
+func MMD(a, b [][3]float64, bandwidth float64) float64 {
+	a, b = Thin(a, MaxComparePoints), Thin(b, MaxComparePoints)
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+	if bandwidth <= 0 {
+		bandwidth = MedianDistance(a, b)
+	}
+	if bandwidth <= 0 {
+		return 0
+	}
+	gamma := 1 / (2 * bandwidth * bandwidth)
+	k := func(x, y [3]float64) float64 {
+		d := dist(x, y)
+		return math.Exp(-gamma * d * d)
+	}
+	within := func(s [][3]float64) float64 {
+		var sum float64
+		for i := range s {
+			for j := i + 1; j < len(s); j++ {
+				sum += k(s[i], s[j])
+			}
+		}
+		n := float64(len(s))
+		return 2 * sum / (n * (n - 1))
+	}
+	var cross float64
+	for _, x := range a {
+		for _, y := range b {
+			cross += k(x, y)
+		}
+	}
+	return within(a) + within(b) - 2*cross/float64(len(a)*len(b))
+}
+
+// EnergyDistance returns the energy distance 2E|X-Y| - E|X-X'| - E|Y-Y'|
+// between the samples, in data units, together with the scale-free energy
+// coefficient, the distance divided by 2E|X-Y|, which lies in [0, 1].
+func EnergyDistance(a, b [][3]float64) (distance, coefficient float64) {
+	a, b = Thin(a, MaxComparePoints), Thin(b, MaxComparePoints)
+	if len(a) < 2 || len(b) < 2 {
+		return 0, 0
+	}
+	mean := func(s [][3]float64) float64 {
+		var sum float64
+		for i := range s {
+			for j := i + 1; j < len(s); j++ {
+				sum += dist(s[i], s[j])
+			}
+		}
+		n := float64(len(s))
+		return 2 * sum / (n * (n - 1))
+	}
+	var cross float64
+	for _, x := range a {
+		for _, y := range b {
+			cross += dist(x, y)
+		}
+	}
+	cross /= float64(len(a) * len(b))
+	distance = 2*cross - mean(a) - mean(b)
+	if cross > 0 {
+		coefficient = distance / (2 * cross)
+	}
+	return distance, coefficient
+}
+
+// Region is a box of space where two samples differ.
+type Region struct {
+	Min [3]float64 `json:"min"`
+	Max [3]float64 `json:"max"`
+	// Shift is the fraction of the current sample in the box minus the
+	// fraction of the reference sample: positive where mass has moved in.
+	Shift float64 `json:"shift"`
+}
+
+// DriftRegion divides the common bounding box of both samples into a grid
+// of cells per axis and returns the cell whose share of points changed the
+// most from reference to current.
+func DriftRegion(reference, current [][3]float64, cells int) Region {
+	lo := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	hi := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, s := range [][][3]float64{reference, current} {
+		for _, p := range s {
+			for k := range p {
+				lo[k], hi[k] = math.Min(lo[k], p[k]), math.Max(hi[k], p[k])
+			}
+		}
+	}
+	if len(reference) == 0 || len(current) == 0 || cells < 1 {
+		return Region{}
+	}
+	cell := func(p [3]float64) int {
+		idx := 0
+		for k := 2; k >= 0; k-- {
+			c := 0
+			if hi[k] > lo[k] {
+				c = int(float64(cells) * (p[k] - lo[k]) / (hi[k] - lo[k]))
+			}
+			if c >= cells {
+				c = cells - 1
+			}
+			idx = idx*cells + c
+		}
+		return idx
+	}
+	shift := make([]float64, cells*cells*cells)
+	for _, p := range current {
+		shift[cell(p)] += 1 / float64(len(current))
+	}
+	for _, p := range reference {
+		shift[cell(p)] -= 1 / float64(len(reference))
+	}
+	best := 0
+	for i, s := range shift {
+		if math.Abs(s) > math.Abs(shift[best]) {
+			best = i
+		}
+	}
+	r := Region{Shift: shift[best]}
+	for k, c := 0, best; k < 3; k, c = k+1, c/cells {
+		size := (hi[k] - lo[k]) / float64(cells)
+		r.Min[k] = lo[k] + float64(c%cells)*size
+		r.Max[k] = r.Min[k] + size
+	}
+	return r
+}
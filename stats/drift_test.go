@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func gaussian(rng *rand.Rand, n int, shift [3]float64) [][3]float64 {
+	points := make([][3]float64, n)
+	for i := range points {
+		for k := range points[i] {
+			points[i][k] = rng.NormFloat64() + shift[k]
+		}
+	}
+	return points
+}
+
+func TestDriftStatistics(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ref := gaussian(rng, 400, [3]float64{})
+	tests := []struct {
+		name     string
+		current  [][3]float64
+		drifting bool
+	}{
+		{"same distribution", gaussian(rng, 400, [3]float64{}), false},
+		{"shifted mean", gaussian(rng, 400, [3]float64{1.5, 0, 0}), true},
+	}
+	for _, tt := range tests {
+		mmd := MMD(ref, tt.current, 0)
+		_, coef := EnergyDistance(ref, tt.current)
+		if tt.drifting != (mmd > 0.01) {
+			t.Errorf("%s: MMD = %g", tt.name, mmd)
+		}
+		if tt.drifting != (coef > 0.02) {
+			t.Errorf("%s: energy coefficient = %g", tt.name, coef)
+		}
+		if coef < -0.01 || coef > 1 {
+			t.Errorf("%s: energy coefficient %g outside [0, 1]", tt.name, coef)
+		}
+	}
+}
+
+func TestEnergyDistanceClosedForm(t *testing.T) {
+	// For single points at distance d each side has no pairs, so use two
+	// copies of each: E|X-Y| = d and E|X-X'| = 0.
+	a := [][3]float64{{0, 0, 0}, {0, 0, 0}}
+	b := [][3]float64{{3, 4, 0}, {3, 4, 0}}
+	d, coef := EnergyDistance(a, b)
+	if math.Abs(d-10) > 1e-12 || math.Abs(coef-1) > 1e-12 {
+		t.Errorf("EnergyDistance = %g, %g; want 10, 1", d, coef)
+	}
+	if got := MMD(a, a, 1); math.Abs(got) > 1e-12 {
+		t.Errorf("MMD of a sample with itself = %g, want 0", got)
+	}
+}
+
+func TestDriftRegion(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	ref := make([][3]float64, 2000)
+	cur := make([][3]float64, 2000)
+	for i := range ref {
+		for k := 0; k < 3; k++ {
+			ref[i][k], cur[i][k] = rng.Float64(), rng.Float64()
+		}
+	}
+	// Move a fifth of the current sample into the corner cell near 1.
+	for i := 0; i < len(cur)/5; i++ {
+		for k := 0; k < 3; k++ {
+			cur[i][k] = 0.8 + 0.15*rng.Float64()
+		}
+	}
+	r := DriftRegion(ref, cur, 4)
+	for k := 0; k < 3; k++ {
+		if r.Min[k] > 0.8 || r.Max[k] < 0.95 {
+			t.Fatalf("DriftRegion = %+v, want the cell covering [0.8, 0.95]³", r)
+		}
+	}
+	if r.Shift < 0.15 {
+		t.Errorf("Shift = %g, want about 0.2", r.Shift)
+	}
+}
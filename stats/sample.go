@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Reservoir keeps a uniform random sample of fixed size from a stream
+// (Vitter's algorithm R).
+type Reservoir struct {
+	Points [][3]float64
+	size   int
+	seen   int64
+	rng    *rand.Rand
+}
+
+// NewReservoir returns a reservoir holding up to size points.
+func NewReservoir(size int, seed int64) *Reservoir {
+	return &Reservoir{size: size, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Add offers p to the sample.
+func (r *Reservoir) Add(p [3]float64) {
+	r.seen++
+	if len(r.Points) < r.size {
+		r.Points = append(r.Points, p)
+		return
+	}
+	if j := r.rng.Int63n(r.seen); j < int64(r.size) {
+		r.Points[j] = p
+	}
+}
+
+// Window holds the most recent points of a stream in a ring buffer with
+// their running mean and covariance.
+type Window struct {
+	Stats Welford
+	ring  [][3]float64
+	next  int
+	full  bool
+	// removed counts removals since Stats was last recomputed; see Add.
+	removed int
+}
+
+// NewWindow returns a window over the last size points; sizes below 1
+// are taken as 1.
+func NewWindow(size int) *Window {
+	size = max(size, 1)
+	return &Window{ring: make([][3]float64, size)}
+}
+
+// Add appends p, evicting the oldest point once the window is full.
+func (w *Window) Add(p [3]float64) {
+	if w.full {
+		w.Stats.Remove(w.ring[w.next])
+		w.removed++
+	}
+	w.ring[w.next] = p
+	w.Stats.Add(p)
+	w.next++
+	if w.next == len(w.ring) {
+		w.next, w.full = 0, true
+	}
+	// Removal accumulates rounding error; rebuild from the buffer once
+	// every window length to keep it bounded.
+	if w.removed >= len(w.ring) {
+		w.Stats = Welford{}
+		for _, q := range w.Points() {
+			w.Stats.Add(q)
+		}
+		w.removed = 0
+	}
+}
+
+// Points returns the points in the window, oldest first.
+func (w *Window) Points() [][3]float64 {
+	if !w.full {
+		return append([][3]float64(nil), w.ring[:w.next]...)
+	}
+	return append(append([][3]float64(nil), w.ring[w.next:]...), w.ring[:w.next]...)
+}
+
+// Quantiles returns the exact quantiles of each axis over the window.
+func (w *Window) Quantiles(probs []float64) [3][]float64 {
+	pts := w.Points()
+	var out [3][]float64
+	values := make([]float64, len(pts))
+	for k := 0; k < 3; k++ {
+		for i, p := range pts {
+			values[i] = p[k]
+		}
+		sort.Float64s(values)
+		for _, q := range probs {
+			out[k] = append(out[k], quantileSorted(values, q))
+		}
+	}
+	return out
+}
+
+// quantileSorted interpolates the q-quantile of sorted values.
+func quantileSorted(values []float64, q float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	pos := q * float64(len(values)-1)
+	i := int(pos)
+	if i >= len(values)-1 {
+		return values[len(values)-1]
+	}
+	return values[i] + (pos-float64(i))*(values[i+1]-values[i])
+}
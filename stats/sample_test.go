@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestReservoirUniform(t *testing.T) {
+	// Each of 100 values should be kept with probability 10/100; count
+	// how often each is kept over many reservoirs.
+	const size, n, trials = 10, 100, 5000
+	kept := make([]int, n)
+	for s := 0; s < trials; s++ {
+		r := NewReservoir(size, int64(s))
+		for i := 0; i < n; i++ {
+			r.Add([3]float64{float64(i)})
+		}
+		if len(r.Points) != size {
+			t.Fatalf("reservoir holds %d points, want %d", len(r.Points), size)
+		}
+		for _, p := range r.Points {
+			kept[int(p[0])]++
+		}
+	}
+	want := float64(trials * size / n)
+	for i, k := range kept {
+		// Five standard deviations of a binomial count.
+		if math.Abs(float64(k)-want) > 5*math.Sqrt(want*(1-float64(size)/n)) {
+			t.Errorf("value %d kept %d times, want about %g", i, k, want)
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w := NewWindow(3)
+	for i := 1; i <= 5; i++ {
+		w.Add([3]float64{float64(i), float64(-i), 0})
+	}
+	want := [][3]float64{{3, -3, 0}, {4, -4, 0}, {5, -5, 0}}
+	if got := w.Points(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Points = %v, want %v", got, want)
+	}
+	if w.Stats.N != 3 || math.Abs(w.Stats.Mean[0]-4) > 1e-12 || math.Abs(w.Stats.Cov()[0][1]+1) > 1e-12 {
+		t.Errorf("Stats = %+v, want 3 points with mean 4 and covariance -1", w.Stats)
+	}
+	q := w.Quantiles([]float64{0, 0.5, 1})
+	if !reflect.DeepEqual(q[0], []float64{3, 4, 5}) {
+		t.Errorf("Quantiles of x = %v, want [3 4 5]", q[0])
+	}
+}
+
+func TestWindowMinimumSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		w := NewWindow(size)
+		w.Add([3]float64{1, 2, 3})
+		w.Add([3]float64{4, 5, 6})
+		if got := w.Points(); !reflect.DeepEqual(got, [][3]float64{{4, 5, 6}}) {
+			t.Errorf("NewWindow(%d): Points = %v, want the last point", size, got)
+		}
+	}
+}
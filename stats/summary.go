@@ -0,0 +1,85 @@
+package stats
+
+import "math"
+
+// Probs are the quantile levels reported in snapshots.
+var Probs = []float64{0.05, 0.25, 0.5, 0.75, 0.95}
+
+// Summary maintains all streaming statistics of a point stream: running
+// moments and per-axis quantile digests over the whole history, a uniform
+// reservoir sample and a sliding window of recent points.
+type Summary struct {
+	Total     Welford
+	Digests   [3]*TDigest
+	Reservoir *Reservoir
+	Window    *Window
+	Min, Max  [3]float64
+}
+
+// NewSummary returns an empty summary with the given window and reservoir
+// sizes.
+func NewSummary(window, reservoir int, seed int64) *Summary {
+	s := &Summary{Reservoir: NewReservoir(reservoir, seed), Window: NewWindow(window)}
+	for k := range s.Digests {
+		s.Digests[k] = NewTDigest(100)
+		s.Min[k], s.Max[k] = math.Inf(1), math.Inf(-1)
+	}
+	return s
+}
+
+// Add includes p in every statistic.
+func (s *Summary) Add(p [3]float64) {
+	s.Total.Add(p)
+	for k := range p {
+		s.Digests[k].Add(p[k])
+		s.Min[k], s.Max[k] = math.Min(s.Min[k], p[k]), math.Max(s.Max[k], p[k])
+	}
+	s.Reservoir.Add(p)
+	s.Window.Add(p)
+}
+
+// Snapshot is the JSON form of a summary.
+type Snapshot struct {
+	Count     int64          `json:"count"`
+	Mean      [3]float64     `json:"mean"`
+	Cov       [3][3]float64  `json:"cov"`
+	Min       [3]float64     `json:"min"`
+	Max       [3]float64     `json:"max"`
+	Probs     []float64      `json:"probs"`
+	Quantiles [3][]float64   `json:"quantiles"`
+	Window    WindowSnapshot `json:"window"`
+}
+
+// WindowSnapshot describes the sliding window.
+type WindowSnapshot struct {
+	Count     int64         `json:"count"`
+	Mean      [3]float64    `json:"mean"`
+	Cov       [3][3]float64 `json:"cov"`
+	Quantiles [3][]float64  `json:"quantiles"`
+}
+
+// Snapshot returns the current statistics. Empty streams report zeros
+// rather than infinities so the result is valid JSON.
+func (s *Summary) Snapshot() Snapshot {
+	snap := Snapshot{
+		Count: s.Total.N,
+		Mean:  s.Total.Mean,
+		Cov:   s.Total.Cov(),
+		Probs: Probs,
+		Window: WindowSnapshot{
+			Count:     s.Window.Stats.N,
+			Mean:      s.Window.Stats.Mean,
+			Cov:       s.Window.Stats.Cov(),
+			Quantiles: s.Window.Quantiles(Probs),
+		},
+	}
+	if s.Total.N > 0 {
+		snap.Min, snap.Max = s.Min, s.Max
+		for k := range snap.Quantiles {
+			for _, q := range Probs {
+				snap.Quantiles[k] = append(snap.Quantiles[k], s.Digests[k].Quantile(q))
+			}
+		}
+	}
+	return snap
+}
@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// TDigest is a merging t-digest (Dunning and Ertl), a compact sketch that
+// estimates quantiles of a stream with high accuracy near the tails.
+type TDigest struct {
+	compression float64
+	centroids   []centroid // sorted by mean
+	buffer      []float64  // values not yet merged
+	count       float64
+	min, max    float64
+}
+
+type centroid struct {
+	mean, weight float64
+}
+
+// NewTDigest returns an empty digest. Larger compression keeps more
+// centroids and gives more accurate quantiles; 100 is a common choice.
+func NewTDigest(compression float64) *TDigest {
+	return &TDigest{compression: compression, min: math.Inf(1), max: math.Inf(-1)}
+}
+
+// Add includes x. NaN values are ignored.
+func (t *TDigest) Add(x float64) {
+	if x != x {
+		return
+	}
+	t.buffer = append(t.buffer, x)
+	t.min, t.max = math.Min(t.min, x), math.Max(t.max, x)
+	if len(t.buffer) >= int(5*t.compression) {
+		t.flush()
+	}
+}
+
+// Count returns the number of values added.
+func (t *TDigest) Count() int64 {
+	return int64(t.count) + int64(len(t.buffer))
+}
+
+// scale is the k1 scale function: it limits centroid sizes near the tails.
+func (t *TDigest) scale(q float64) float64 {
+	return t.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+func (t *TDigest) scaleInverse(k float64) float64 {
+	if k >= t.compression/4 {
+		return 1
+	}
+	return (math.Sin(k*2*math.Pi/t.compression) + 1) / 2
+}
+
+// flush merges buffered values into the centroids.
+func (t *TDigest) flush() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := make([]centroid, 0, len(t.centroids)+len(t.buffer))
+	all = append(all, t.centroids...)
+	for _, x := range t.buffer {
+		all = append(all, centroid{x, 1})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].mean < all[j].mean })
+	total := t.count + float64(len(t.buffer))
+
+	merged := t.centroids[:0:0]
+	cur := all[0]
+	before := 0.0
+	limit := t.scaleInverse(t.scale(0)+1) * total
+	for _, c := range all[1:] {
+		if before+cur.weight+c.weight <= limit {
+			cur.mean += (c.mean - cur.mean) * c.weight / (cur.weight + c.weight)
+			cur.weight += c.weight
+			continue
+		}
+		merged = append(merged, cur)
+		before += cur.weight
+		limit = t.scaleInverse(t.scale(before/total)+1) * total
+		cur = c
+	}
+	t.centroids = append(merged, cur)
+	t.count = total
+	t.buffer = t.buffer[:0]
+}
+
+// Quantile estimates the q-quantile, or NaN if no values were added.
+func (t *TDigest) Quantile(q float64) float64 {
+	t.flush()
+	cs := t.centroids
+	if len(cs) == 0 {
+		return math.NaN()
+	}
+	if len(cs) == 1 || q <= 0 {
+		if q <= 0 {
+			return t.min
+		}
+		return cs[0].mean
+	}
+	if q >= 1 {
+		return t.max
+	}
+	target := q * t.count
+	// Interpolate between centroid centers, and between the extreme
+	// centroids and the observed min and max.
+	center := cs[0].weight / 2
+	if target < center {
+		return t.min + (cs[0].mean-t.min)*target/center
+	}
+	cum := 0.0
+	for i := 0; i+1 < len(cs); i++ {
+		left := cum + cs[i].weight/2
+		right := cum + cs[i].weight + cs[i+1].weight/2
+		if target <= right {
+			f := (target - left) / (right - left)
+			return cs[i].mean + f*(cs[i+1].mean-cs[i].mean)
+		}
+		cum += cs[i].weight
+	}
+	last := cs[len(cs)-1]
+	lastCenter := t.count - last.weight/2
+	return last.mean + (t.max-last.mean)*(target-lastCenter)/(t.count-lastCenter)
+}
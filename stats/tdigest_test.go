@@ -0,0 +1,33 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestTDigestQuantiles(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	d := NewTDigest(100)
+	values := make([]float64, 100000)
+	for i := range values {
+		values[i] = rng.NormFloat64()
+		d.Add(values[i])
+	}
+	d.Add(math.NaN())
+	if d.Count() != int64(len(values)) {
+		t.Errorf("Count = %d, want %d", d.Count(), len(values))
+	}
+	sort.Float64s(values)
+	for _, q := range []float64{0, 0.001, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 0.999, 1} {
+		want := quantileSorted(values, q)
+		got := d.Quantile(q)
+		// Compare by rank: the digest's error is bounded in quantile,
+		// tighter near the tails.
+		rank := float64(sort.SearchFloat64s(values, got)) / float64(len(values)-1)
+		if tol := 0.002 + 0.02*q*(1-q); math.Abs(rank-q) > tol {
+			t.Errorf("Quantile(%g) = %g at rank %.4f, want %g (rank tolerance %g)", q, got, rank, want, tol)
+		}
+	}
+}
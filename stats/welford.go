@@ -0,0 +1,63 @@
+// Package stats provides incrementally updated statistics for point
+// streams: running mean and covariance, quantile sketches, reservoir
+// samples and sliding windows, plus distribution comparisons.
+package stats
+
+// Welford maintains the running mean and covariance of 3D points using
+// Welford's algorithm, which stays numerically stable over long streams.
+// Points can also be removed, which sliding windows rely on.
+type Welford struct {
+	N    int64
+	Mean [3]float64
+	// co holds the sum of outer products of deviations from the mean.
+	co [3][3]float64
+}
+
+// Add includes p.
+func (w *Welford) Add(p [3]float64) {
+	w.N++
+	var d [3]float64
+	for i := range p {
+		d[i] = p[i] - w.Mean[i]
+		w.Mean[i] += d[i] / float64(w.N)
+	}
+	for i := range p {
+		for j := range p {
+			w.co[i][j] += d[i] * (p[j] - w.Mean[j])
+		}
+	}
+}
+
+// Remove excludes a previously added p.
+func (w *Welford) Remove(p [3]float64) {
+	if w.N <= 1 {
+		*w = Welford{}
+		return
+	}
+	var prev [3]float64
+	for i := range p {
+		prev[i] = (float64(w.N)*w.Mean[i] - p[i]) / float64(w.N-1)
+	}
+	for i := range p {
+		for j := range p {
+			w.co[i][j] -= (p[i] - prev[i]) * (p[j] - w.Mean[j])
+		}
+	}
+	w.N--
+	w.Mean = prev
+}
+
+// Cov returns the sample covariance matrix (zero for fewer than two
+// points).
+func (w *Welford) Cov() [3][3]float64 {
+	var c [3][3]float64
+	if w.N < 2 {
+		return c
+	}
+	for i := range c {
+		for j := range c[i] {
+			c[i][j] = w.co[i][j] / float64(w.N-1)
+		}
+	}
+	return c
+}
@@ -0,0 +1,80 @@
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// twoPass returns the mean and sample covariance of points the direct way.
+func twoPass(points [][3]float64) (mean [3]float64, cov [3][3]float64) {
+	n := float64(len(points))
+	for _, p := range points {
+		for i := range p {
+			mean[i] += p[i] / n
+		}
+	}
+	for _, p := range points {
+		for i := range p {
+			for j := range p {
+				cov[i][j] += (p[i] - mean[i]) * (p[j] - mean[j]) / (n - 1)
+			}
+		}
+	}
+	return mean, cov
+}
+
+func randomPoints(rng *rand.Rand, n int) [][3]float64 {
+	points := make([][3]float64, n)
+	for i := range points {
+		x := rng.NormFloat64()
+		points[i] = [3]float64{1e6 + x, 2*x + rng.NormFloat64(), rng.ExpFloat64()}
+	}
+	return points
+}
+
+func checkMoments(t *testing.T, w *Welford, points [][3]float64, tol float64) {
+	t.Helper()
+	mean, cov := twoPass(points)
+	if w.N != int64(len(points)) {
+		t.Fatalf("N = %d, want %d", w.N, len(points))
+	}
+	got := w.Cov()
+	for i := range mean {
+		if math.Abs(w.Mean[i]-mean[i]) > tol*(1+math.Abs(mean[i])) {
+			t.Errorf("Mean[%d] = %g, want %g", i, w.Mean[i], mean[i])
+		}
+		for j := range mean {
+			if math.Abs(got[i][j]-cov[i][j]) > tol*(1+math.Abs(cov[i][j])) {
+				t.Errorf("Cov[%d][%d] = %g, want %g", i, j, got[i][j], cov[i][j])
+			}
+		}
+	}
+}
+
+func TestWelfordAdd(t *testing.T) {
+	points := randomPoints(rand.New(rand.NewSource(1)), 10000)
+	var w Welford
+	for _, p := range points {
+		w.Add(p)
+	}
+	checkMoments(t, &w, points, 1e-9)
+}
+
+func TestWelfordRemove(t *testing.T) {
+	points := randomPoints(rand.New(rand.NewSource(2)), 2000)
+	var w Welford
+	for _, p := range points {
+		w.Add(p)
+	}
+	for _, p := range points[:1500] {
+		w.Remove(p)
+	}
+	checkMoments(t, &w, points[1500:], 1e-6)
+	for _, p := range points[1500:] {
+		w.Remove(p)
+	}
+	if w.N != 0 || w.Cov() != ([3][3]float64{}) {
+		t.Errorf("after removing every point: %+v", w)
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/stats"
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+// streamEventInterval limits how often statistics are pushed to each
+// subscriber; appends in between are coalesced into one event.
+const streamEventInterval = 250 * time.Millisecond
+
+// A liveStream is a dataset that grows as producers append points. Its
+// statistics are updated incrementally on every append.
+type liveStream struct {
+	name string
+
+	mu      sync.Mutex
+	summary *stats.Summary
+	subs    map[chan struct{}]struct{}
+	drift   *driftMonitor // nil unless drift is monitored
+}
+
+// streamHub holds the live streams by name. Streams are created by their
+// first append.
+type streamHub struct {
+	window, reservoir int
+
+	mu      sync.Mutex
+	streams map[string]*liveStream
+}
+
+// streams is the server's stream hub; it is set up in main.
+var streams *streamHub
+
+func newStreamHub(window, reservoir int) *streamHub {
+	h := &streamHub{window: window, reservoir: reservoir, streams: map[string]*liveStream{}}
+	h.registerMetrics()
+	h.registerDriftMetrics()
+	return h
+}
+
+// get returns the named stream, creating it if create is set.
+func (h *streamHub) get(name string, create bool) *liveStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.streams[name]
+	if !ok && create {
+		s = &liveStream{
+			name:    name,
+			summary: stats.NewSummary(h.window, h.reservoir, 1),
+			subs:    map[chan struct{}]struct{}{},
+		}
+		h.streams[name] = s
+	}
+	return s
+}
+
+func (h *streamHub) names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.streams))
+	for name := range h.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// list returns the streams sorted by name.
+func (h *streamHub) list() []*liveStream {
+	var list []*liveStream
+	for _, name := range h.names() {
+		list = append(list, h.get(name, false))
+	}
+	return list
+}
+
+func (h *streamHub) registerMetrics() {
+	registerMetric("threedistvis_stream_points_total", "counter", "Points appended to each live stream.",
+		func() []sample {
+			var samples []sample
+			for _, s := range h.list() {
+				s.mu.Lock()
+				samples = append(samples, sample{labels("stream", s.name), float64(s.summary.Total.N)})
+				s.mu.Unlock()
+			}
+			return samples
+		})
+	registerMetric("threedistvis_stream_subscribers", "gauge", "Clients watching each live stream.",
+		func() []sample {
+			var samples []sample
+			for _, s := range h.list() {
+				s.mu.Lock()
+				samples = append(samples, sample{labels("stream", s.name), float64(len(s.subs))})
+				s.mu.Unlock()
+			}
+			return samples
+		})
+}
+
+// append adds points to the stream and notifies subscribers. Points with
+// non-finite coordinates are dropped.
+func (s *liveStream) append(points [][3]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range points {
+		if finite(p) {
+			s.summary.Add(p)
+		}
+	}
+	s.scheduleDrift()
+	s.notify()
+}
+
+// notify wakes the subscribers. s.mu must be held.
+func (s *liveStream) notify() {
+	for ch := range s.subs {
+		select {
+		case ch <- struct{}{}:
+		default: // already pending
+		}
+	}
+}
+
+// subscribe returns a channel that receives a value after appends and drift
+// checks, and a function that cancels the subscription.
+func (s *liveStream) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.subs[ch] = struct{}{}
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *liveStream) snapshot() stats.Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary.Snapshot()
+}
+
+// cloud returns the points of the sliding window, with their arrival order
+// as the "sequence" attribute, or with from "reservoir" the uniform sample
+// of the whole history.
+func (s *liveStream) cloud(from string) (*pointcloud.Cloud, error) {
+	s.mu.Lock()
+	var points [][3]float64
+	switch from {
+	case "", "window":
+		points = s.summary.Window.Points()
+	case "reservoir":
+		points = append(points, s.summary.Reservoir.Points...)
+	default:
+		s.mu.Unlock()
+		return nil, fmt.Errorf("parameter from: unknown value %q", from)
+	}
+	s.mu.Unlock()
+
+	c := pointcloud.New("stream/"+s.name, len(points))
+	for i, p := range points {
+		c.SetPoint(i, float32(p[0]), float32(p[1]), float32(p[2]))
+	}
+	if from != "reservoir" {
+		seq := make([]float32, len(points))
+		for i := range seq {
+			seq[i] = float32(i)
+		}
+		c.SetAttribute("sequence", seq)
+	}
+	return c, nil
+}
+
+func finite(p [3]float64) bool {
+	for _, x := range p {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// readPoints parses an append request body: an encoded point cloud when the
+// content type is application/octet-stream, otherwise a JSON array of
+// [x, y, z] triples.
+func readPoints(w http.ResponseWriter, r *http.Request) (points [][3]float64, err error) {
+	_, span := trace.Start(r.Context(), "stream.parse")
+	span.Set("content_type", r.Header.Get("Content-Type"))
+	defer func() {
+		span.Set("points", len(points))
+		span.Fail(err)
+		span.End()
+	}()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	span.Set("bytes", len(body))
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		c, err := pointcloud.Decode(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		points := make([][3]float64, c.Len())
+		for i := range points {
+			x, y, z := c.Point(i)
+			points[i] = [3]float64{float64(x), float64(y), float64(z)}
+		}
+		return points, nil
+	}
+	if err := json.Unmarshal(body, &points); err != nil {
+		return nil, fmt.Errorf("points: %v", err)
+	}
+	return points, nil
+}
+
+// handleStream serves the live stream API:
+//
+//	GET  /api/streams/                  JSON list of stream names
+//	POST /api/streams/<name>/points     append points, creating the stream
+//	GET  /api/streams/<name>/points     encoded window (or ?from=reservoir)
+//	GET  /api/streams/<name>/stats      JSON statistics snapshot
+//	GET  /api/streams/<name>/events     statistics as server-sent events
+//	*    /api/streams/<name>/drift      drift monitoring; see handleDrift
+func handleStream(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/streams/")
+	if path == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(streams.names())
+		return
+	}
+	name, op, _ := strings.Cut(path, "/")
+	if name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method == http.MethodPost && op == "points" {
+		points, err := readPoints(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		streams.get(name, true).append(points)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	s := streams.get(name, false)
+	if s == nil {
+		http.Error(w, fmt.Sprintf("unknown stream %q", name), http.StatusNotFound)
+		return
+	}
+	switch op {
+	case "points":
+		c, err := s.cloud(r.URL.Query().Get("from"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := c.Encode(w); err != nil {
+			trace.Println(r.Context(), "Encode error:", err)
+		}
+	case "stats":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.snapshot())
+	case "events":
+		serveStreamEvents(w, r, s)
+	case "drift":
+		handleDrift(w, r, s)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveStreamEvents pushes a "stats" event with the current snapshot on
+// connect and after appends, at most once per streamEventInterval, and a
+// "drift" event with each new drift check result.
+func serveStreamEvents(w http.ResponseWriter, r *http.Request, s *liveStream) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	updates, cancel := s.subscribe()
+	defer cancel()
+
+	send := func(event string, v interface{}) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			trace.Println(r.Context(), "Stream event error:", err)
+			return false
+		}
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		return err == nil
+	}
+	lastDrift := 0
+	for {
+		if !send("stats", s.snapshot()) {
+			return
+		}
+		if _, result := s.driftState(); result != nil && result.Seq != lastDrift {
+			if !send("drift", result) {
+				return
+			}
+			lastDrift = result.Seq
+		}
+		flusher.Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(streamEventInterval):
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-updates:
+		}
+	}
+}
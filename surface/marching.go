@@ -0,0 +1,182 @@
+package surface
+
+// Cube corners are numbered by their coordinate bits: corner i lies at
+// (i&1, i>>1&1, i>>2&1) in the cell. An edge joins two corners that differ
+// in one bit.
+var cubeEdges [12][2]int
+
+// cases lists, for each of the 256 inside/outside patterns of the corners,
+// the triangles of the surface within the cell as triples of edge indices.
+// It plays the role of the classic marching cubes triangle table, but is
+// derived at startup: intersected edges are joined across each face of the
+// cell, and the resulting closed loops are fanned into triangles. On faces
+// with two diagonally opposite inside corners the loops separate the inside
+// corners, as in the classic table, so neighboring cells always agree and
+// the surface is watertight.
+var cases [256][][3]int
+
+func init() {
+	e := 0
+	for i := 0; i < 8; i++ {
+		for k := 0; k < 3; k++ {
+			if i&(1<<k) == 0 {
+				cubeEdges[e] = [2]int{i, i | 1<<k}
+				e++
+			}
+		}
+	}
+	for c := range cases {
+		cases[c] = triangulateCase(c)
+	}
+}
+
+func triangulateCase(c int) [][3]int {
+	inside := func(corner int) bool { return c>>corner&1 == 1 }
+	cut := func(e int) bool { return inside(cubeEdges[e][0]) != inside(cubeEdges[e][1]) }
+	links := map[int][]int{}
+	link := func(a, b int) {
+		links[a] = append(links[a], b)
+		links[b] = append(links[b], a)
+	}
+	for k := 0; k < 3; k++ {
+		for side := 0; side < 2; side++ {
+			// The face's edges join two corners both on the face.
+			onFace := func(corner int) bool { return corner>>k&1 == side }
+			var edges []int
+			for e, ends := range cubeEdges {
+				if onFace(ends[0]) && onFace(ends[1]) && cut(e) {
+					edges = append(edges, e)
+				}
+			}
+			switch len(edges) {
+			case 2:
+				link(edges[0], edges[1])
+			case 4:
+				// Ambiguous face: cut off each inside corner on its own.
+				for corner := 0; corner < 8; corner++ {
+					if !onFace(corner) || !inside(corner) {
+						continue
+					}
+					var pair []int
+					for _, e := range edges {
+						if cubeEdges[e][0] == corner || cubeEdges[e][1] == corner {
+							pair = append(pair, e)
+						}
+					}
+					link(pair[0], pair[1])
+				}
+			}
+		}
+	}
+	// Every cut edge lies on two faces and has one link on each, so the
+	// links form closed loops.
+	var tris [][3]int
+	visited := map[int]bool{}
+	for start := 0; start < 12; start++ {
+		if !cut(start) || visited[start] {
+			continue
+		}
+		loop := []int{start}
+		visited[start] = true
+		for prev, cur := -1, start; ; {
+			next := links[cur][0]
+			if next == prev {
+				next = links[cur][1]
+			}
+			if next == start {
+				break
+			}
+			loop = append(loop, next)
+			visited[next] = true
+			prev, cur = cur, next
+		}
+		for i := 1; i+1 < len(loop); i++ {
+			tris = append(tris, [3]int{loop[0], loop[i], loop[i+1]})
+		}
+	}
+	return tris
+}
+
+// Implicit extracts the surface f(x, y, z) = 0 within the box from min to
+// max with marching cubes on an n × n × n grid of cells. Vertex normals are
+// the normalized gradient of f, and triangles face the direction in which
+// f increases.
+func Implicit(f func(x, y, z float64) float64, min, max [3]float64, n int) *Mesh {
+	if n < 1 {
+		n = 1
+	}
+	var step [3]float64
+	for k := range step {
+		step[k] = (max[k] - min[k]) / float64(n)
+	}
+	point := func(i, j, l int) [3]float64 {
+		return [3]float64{min[0] + float64(i)*step[0], min[1] + float64(j)*step[1], min[2] + float64(l)*step[2]}
+	}
+	// Sample the field once per grid point.
+	stride := n + 1
+	field := make([]float64, stride*stride*stride)
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			for l := 0; l <= n; l++ {
+				p := point(i, j, l)
+				field[(i*stride+j)*stride+l] = f(p[0], p[1], p[2])
+			}
+		}
+	}
+	h := [3]float64{step[0] * 1e-3, step[1] * 1e-3, step[2] * 1e-3}
+	gradient := func(p [3]float64) [3]float64 {
+		var g [3]float64
+		for k := range g {
+			a, b := p, p
+			a[k] += h[k]
+			b[k] -= h[k]
+			g[k] = (f(a[0], a[1], a[2]) - f(b[0], b[1], b[2])) / (2 * h[k])
+		}
+		return g
+	}
+
+	m := &Mesh{}
+	var corners [8][3]float64
+	var values [8]float64
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			for l := 0; l < n; l++ {
+				c := 0
+				for corner := 0; corner < 8; corner++ {
+					ci, cj, cl := i+corner&1, j+corner>>1&1, l+corner>>2&1
+					corners[corner] = point(ci, cj, cl)
+					values[corner] = field[(ci*stride+cj)*stride+cl]
+					if values[corner] < 0 {
+						c |= 1 << corner
+					}
+				}
+				if c == 0 || c == 255 {
+					continue
+				}
+				for _, tri := range cases[c] {
+					var p, nor [3][3]float64
+					for v, e := range tri {
+						a, b := cubeEdges[e][0], cubeEdges[e][1]
+						t := 0.5
+						if d := values[a] - values[b]; d != 0 {
+							t = values[a] / d
+						}
+						for k := 0; k < 3; k++ {
+							p[v][k] = corners[a][k] + t*(corners[b][k]-corners[a][k])
+						}
+						nor[v] = normalize(gradient(p[v]))
+					}
+					// Orient the triangle along the gradient.
+					face := cross(sub(p[1], p[0]), sub(p[2], p[0]))
+					g := [3]float64{nor[0][0] + nor[1][0] + nor[2][0], nor[0][1] + nor[1][1] + nor[2][1], nor[0][2] + nor[1][2] + nor[2][2]}
+					if face[0]*g[0]+face[1]*g[1]+face[2]*g[2] < 0 {
+						p[1], p[2] = p[2], p[1]
+						nor[1], nor[2] = nor[2], nor[1]
+					}
+					m.addTriangle(p, nor)
+				}
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,104 @@
+// Package surface triangulates surfaces given by formulas: explicit height
+// fields z = f(x, y), parametric surfaces (u, v) -> (x, y, z) and implicit
+// surfaces f(x, y, z) = 0.
+package surface
+
+import "math"
+
+// Mesh is a triangle soup: every three vertices form a triangle.
+type Mesh struct {
+	Positions []float32 // xyz interleaved
+	Normals   []float32 // unit vertex normals, xyz interleaved
+	Values    []float32 // height (z) of each vertex, for coloring
+}
+
+// Triangles returns the number of triangles.
+func (m *Mesh) Triangles() int {
+	return len(m.Positions) / 9
+}
+
+// addTriangle appends a triangle unless any of its coordinates or normals
+// is not finite.
+func (m *Mesh) addTriangle(p [3][3]float64, n [3][3]float64) {
+	for i := range p {
+		for k := 0; k < 3; k++ {
+			if !finite(p[i][k]) || !finite(n[i][k]) {
+				return
+			}
+		}
+	}
+	for i := range p {
+		for k := 0; k < 3; k++ {
+			m.Positions = append(m.Positions, float32(p[i][k]))
+			m.Normals = append(m.Normals, float32(n[i][k]))
+		}
+		m.Values = append(m.Values, float32(p[i][2]))
+	}
+}
+
+func finite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func normalize(a [3]float64) [3]float64 {
+	l := math.Sqrt(a[0]*a[0] + a[1]*a[1] + a[2]*a[2])
+	if l == 0 {
+		return a
+	}
+	return [3]float64{a[0] / l, a[1] / l, a[2] / l}
+}
+
+// Explicit triangulates the height field z = f(x, y) over [x0, x1] × [y0, y1]
+// on an n × n grid of cells. Cells touching points where f is not finite are
+// left out.
+func Explicit(f func(x, y float64) float64, x0, x1, y0, y1 float64, n int) *Mesh {
+	return Parametric(func(x, y float64) (float64, float64, float64) {
+		return x, y, f(x, y)
+	}, x0, x1, y0, y1, n)
+}
+
+// Parametric triangulates the surface (u, v) -> (x, y, z) over
+// [u0, u1] × [v0, v1] on an n × n grid of cells. Normals come from the
+// cross product of the partial derivatives, estimated by finite
+// differences.
+func Parametric(f func(u, v float64) (x, y, z float64), u0, u1, v0, v1 float64, n int) *Mesh {
+	if n < 1 {
+		n = 1
+	}
+	du, dv := (u1-u0)/float64(n), (v1-v0)/float64(n)
+	hu, hv := du*1e-3, dv*1e-3
+	at := func(u, v float64) [3]float64 {
+		x, y, z := f(u, v)
+		return [3]float64{x, y, z}
+	}
+	pos := make([][3]float64, (n+1)*(n+1))
+	nor := make([][3]float64, (n+1)*(n+1))
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= n; j++ {
+			u, v := u0+float64(i)*du, v0+float64(j)*dv
+			k := i*(n+1) + j
+			pos[k] = at(u, v)
+			pu := sub(at(u+hu, v), at(u-hu, v))
+			pv := sub(at(u, v+hv), at(u, v-hv))
+			nor[k] = normalize(cross(pu, pv))
+		}
+	}
+	m := &Mesh{}
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			a, b := i*(n+1)+j, (i+1)*(n+1)+j
+			c, d := b+1, a+1
+			m.addTriangle([3][3]float64{pos[a], pos[b], pos[c]}, [3][3]float64{nor[a], nor[b], nor[c]})
+			m.addTriangle([3][3]float64{pos[a], pos[c], pos[d]}, [3][3]float64{nor[a], nor[c], nor[d]})
+		}
+	}
+	return m
+}
@@ -0,0 +1,233 @@
+// Package synth generates standard manifold benchmarks for exercising
+// dimensionality-reduction and clustering features. Every generator records
+// the intrinsic coordinates of each sample as attributes so the embedding
+// can be colored by ground truth.
+package synth
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// Options control the sample size and the corruption applied on top of a
+// clean manifold sample.
+type Options struct {
+	N        int     // number of points on the manifold
+	Noise    float64 // standard deviation of isotropic Gaussian noise
+	Outliers float64 // extra points, as a fraction of N, drawn uniformly from the bounding box
+	Seed     int64
+}
+
+// A Generator draws n clean samples from a manifold.
+type Generator func(n int, rng *rand.Rand) *pointcloud.Cloud
+
+var generators = map[string]Generator{
+	"swissroll": SwissRoll,
+	"scurve":    SCurve,
+	"torus":     Torus,
+	"helix":     Helix,
+	"mobius":    Mobius,
+	"spirals":   Spirals,
+	"spheres":   Spheres,
+}
+
+// Kinds returns the names accepted by Generate, sorted.
+func Kinds() []string {
+	kinds := make([]string, 0, len(generators))
+	for k := range generators {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Generate draws a sample from the named manifold and applies the noise and
+// outliers requested in opts. The result always carries an "outlier"
+// attribute (1 for outliers, 0 otherwise); intrinsic attributes are NaN for
+// outliers.
+func Generate(kind string, opts Options) (*pointcloud.Cloud, error) {
+	gen, ok := generators[kind]
+	if !ok {
+		return nil, fmt.Errorf("synth: unknown manifold %q", kind)
+	}
+	if opts.N <= 0 {
+		return nil, fmt.Errorf("synth: sample size must be positive, got %d", opts.N)
+	}
+	if !(opts.Noise >= 0) || math.IsInf(opts.Noise, 0) {
+		return nil, fmt.Errorf("synth: noise must be a finite non-negative number, got %g", opts.Noise)
+	}
+	if !(opts.Outliers >= 0) || math.IsInf(opts.Outliers, 0) {
+		return nil, fmt.Errorf("synth: outlier fraction must be a finite non-negative number, got %g", opts.Outliers)
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+	c := gen(opts.N, rng)
+	c.Name = kind
+	if opts.Noise > 0 {
+		for i := range c.Positions {
+			c.Positions[i] += float32(rng.NormFloat64() * opts.Noise)
+		}
+	}
+	addOutliers(c, int(math.Round(opts.Outliers*float64(opts.N))), rng)
+	return c, nil
+}
+
+// addOutliers appends m points drawn uniformly from the bounding box of c,
+// grown by 10% on each side.
+func addOutliers(c *pointcloud.Cloud, m int, rng *rand.Rand) {
+	n := c.Len()
+	flag := make([]float32, n, n+m)
+	if m > 0 {
+		lo, hi := c.Bounds()
+		for k := 0; k < 3; k++ {
+			pad := 0.1 * (hi[k] - lo[k])
+			lo[k], hi[k] = lo[k]-pad, hi[k]+pad
+		}
+		for i := 0; i < m; i++ {
+			for k := 0; k < 3; k++ {
+				c.Positions = append(c.Positions, lo[k]+rng.Float32()*(hi[k]-lo[k]))
+			}
+			flag = append(flag, 1)
+		}
+		nan := float32(math.NaN())
+		for i := range c.Attributes {
+			for j := 0; j < m; j++ {
+				c.Attributes[i].Values = append(c.Attributes[i].Values, nan)
+			}
+		}
+	}
+	c.SetAttribute("outlier", flag)
+}
+
+// SwissRoll samples the classic rolled-up rectangle. Attributes: "t" (the
+// position along the roll) and "height".
+func SwissRoll(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("swissroll", n)
+	t, h := make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		ti := 1.5 * math.Pi * (1 + 2*rng.Float64())
+		hi := 21 * rng.Float64()
+		c.SetPoint(i, float32(ti*math.Cos(ti)), float32(hi), float32(ti*math.Sin(ti)))
+		t[i], h[i] = float32(ti), float32(hi)
+	}
+	c.SetAttribute("t", t)
+	c.SetAttribute("height", h)
+	return c
+}
+
+// SCurve samples an S-shaped sheet. Attributes: "t" and "height".
+func SCurve(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("scurve", n)
+	t, h := make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		ti := 3 * math.Pi * (rng.Float64() - 0.5)
+		hi := 2 * rng.Float64()
+		sign := 1.0
+		if ti < 0 {
+			sign = -1
+		}
+		c.SetPoint(i, float32(math.Sin(ti)), float32(hi), float32(sign*(math.Cos(ti)-1)))
+		t[i], h[i] = float32(ti), float32(hi)
+	}
+	c.SetAttribute("t", t)
+	c.SetAttribute("height", h)
+	return c
+}
+
+// Torus samples a ring torus (major radius 2, minor radius 0.75) uniformly
+// by area. Attributes: "theta" (around the ring) and "phi" (around the tube).
+func Torus(n int, rng *rand.Rand) *pointcloud.Cloud {
+	const R, r = 2.0, 0.75
+	c := pointcloud.New("torus", n)
+	theta, phi := make([]float32, n), make([]float32, n)
+	for i := 0; i < n; {
+		th := 2 * math.Pi * rng.Float64()
+		ph := 2 * math.Pi * rng.Float64()
+		// The area element grows with the distance from the axis.
+		if rng.Float64()*(R+r) > R+r*math.Cos(ph) {
+			continue
+		}
+		d := R + r*math.Cos(ph)
+		c.SetPoint(i, float32(d*math.Cos(th)), float32(d*math.Sin(th)), float32(r*math.Sin(ph)))
+		theta[i], phi[i] = float32(th), float32(ph)
+		i++
+	}
+	c.SetAttribute("theta", theta)
+	c.SetAttribute("phi", phi)
+	return c
+}
+
+// Helix samples a three-turn circular helix. Attribute: "t", the angle
+// along the curve.
+func Helix(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("helix", n)
+	t := make([]float32, n)
+	for i := 0; i < n; i++ {
+		ti := 6 * math.Pi * rng.Float64()
+		c.SetPoint(i, float32(math.Cos(ti)), float32(math.Sin(ti)), float32(ti/(4*math.Pi)))
+		t[i] = float32(ti)
+	}
+	c.SetAttribute("t", t)
+	return c
+}
+
+// Mobius samples a Möbius strip of unit radius and unit width. Attributes:
+// "u" (around the strip) and "v" (across it).
+func Mobius(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("mobius", n)
+	u, v := make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		ui := 2 * math.Pi * rng.Float64()
+		vi := rng.Float64() - 0.5
+		d := 1 + vi*math.Cos(ui/2)
+		c.SetPoint(i, float32(d*math.Cos(ui)), float32(d*math.Sin(ui)), float32(vi*math.Sin(ui/2)))
+		u[i], v[i] = float32(ui), float32(vi)
+	}
+	c.SetAttribute("u", u)
+	c.SetAttribute("v", v)
+	return c
+}
+
+// Spirals samples two intertwined conical spirals, offset by half a turn.
+// Attributes: "t" (distance along the arm, 0 to 1) and "arm" (0 or 1).
+func Spirals(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("spirals", n)
+	t, arm := make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		ti := rng.Float64()
+		a := i % 2
+		angle := 3*math.Pi*ti + float64(a)*math.Pi
+		r := 0.2 + 1.8*ti
+		c.SetPoint(i, float32(r*math.Cos(angle)), float32(r*math.Sin(angle)), float32(2*ti-1))
+		t[i], arm[i] = float32(ti), float32(a)
+	}
+	c.SetAttribute("t", t)
+	c.SetAttribute("arm", arm)
+	return c
+}
+
+// Spheres samples three concentric spheres of radius 1, 2 and 3, uniformly
+// by area. Attributes: "shell" (0, 1 or 2), "theta" (azimuth) and "phi"
+// (polar angle).
+func Spheres(n int, rng *rand.Rand) *pointcloud.Cloud {
+	c := pointcloud.New("spheres", n)
+	shell, theta, phi := make([]float32, n), make([]float32, n), make([]float32, n)
+	for i := 0; i < n; i++ {
+		s := i % 3
+		th := 2 * math.Pi * rng.Float64()
+		ph := math.Acos(2*rng.Float64() - 1)
+		r := float64(s + 1)
+		c.SetPoint(i,
+			float32(r*math.Sin(ph)*math.Cos(th)),
+			float32(r*math.Sin(ph)*math.Sin(th)),
+			float32(r*math.Cos(ph)))
+		shell[i], theta[i], phi[i] = float32(s), float32(th), float32(ph)
+	}
+	c.SetAttribute("shell", shell)
+	c.SetAttribute("theta", theta)
+	c.SetAttribute("phi", phi)
+	return c
+}
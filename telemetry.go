@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/trace"
+)
+
+// clientError is an error report from the browser client. TraceID and
+// SpanID name the client span of the failed operation, if it had one.
+type clientError struct {
+	Message string `json:"message"`
+	Context string `json:"context"` // what the client was doing
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+	URL     string `json:"url"`
+}
+
+// clientSpan is a span timed in the browser, such as rendering a dataset.
+// Times are milliseconds since the Unix epoch.
+type clientSpan struct {
+	TraceID    string                 `json:"traceId"`
+	SpanID     string                 `json:"spanId"`
+	ParentID   string                 `json:"parentSpanId"`
+	Name       string                 `json:"name"`
+	Start      float64                `json:"start"`
+	End        float64                `json:"end"`
+	Attributes map[string]interface{} `json:"attributes"`
+	Error      string                 `json:"error"`
+}
+
+// maxClientSpans bounds the spans accepted in one report.
+const maxClientSpans = 100
+
+// handleClient serves the client telemetry API:
+//
+//	POST /api/client/errors    a JSON clientError, logged with its trace ID
+//	POST /api/client/spans     a JSON array of clientSpans, exported as-is
+func handleClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, 1<<20)
+	switch strings.TrimPrefix(r.URL.Path, "/api/client/") {
+	case "errors":
+		var report clientError
+		if err := json.NewDecoder(body).Decode(&report); err != nil {
+			http.Error(w, fmt.Sprintf("error report: %v", err), http.StatusBadRequest)
+			return
+		}
+		recordClientError(r.Context(), report, r.UserAgent())
+	case "spans":
+		var spans []clientSpan
+		if err := json.NewDecoder(body).Decode(&spans); err != nil {
+			http.Error(w, fmt.Sprintf("spans: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(spans) > maxClientSpans {
+			http.Error(w, fmt.Sprintf("at most %d spans per report", maxClientSpans), http.StatusRequestEntityTooLarge)
+			return
+		}
+		// Check the whole report before recording any of it, so a rejected
+		// report can be retried without duplicating spans.
+		converted := make([]*trace.Span, len(spans))
+		for i, s := range spans {
+			var err error
+			if converted[i], err = clientSpanToTrace(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		for _, s := range converted {
+			trace.Record(s)
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordClientError logs a client error and records it as a failed span.
+// If the report names a trace, the span joins it, so the error shows up
+// next to the server side of the failed operation.
+func recordClientError(ctx context.Context, report clientError, userAgent string) {
+	traceID, ok1 := trace.ParseTraceID(report.TraceID)
+	spanID, ok2 := trace.ParseSpanID(report.SpanID)
+	if ok1 && ok2 {
+		ctx = trace.WithRemoteParent(context.Background(), trace.SpanContext{TraceID: traceID, SpanID: spanID, Sampled: true})
+	}
+	ctx, span := trace.Start(ctx, "client.error")
+	defer span.End()
+	span.Set("client.context", report.Context, "client.url", report.URL, "user_agent", userAgent)
+	span.Fail(fmt.Errorf("%s", report.Message))
+	trace.Println(ctx, "Client error:", report.Context+":", report.Message)
+}
+
+// clientSpanToTrace validates a span reported by the client and returns it
+// ready to record.
+func clientSpanToTrace(s clientSpan) (*trace.Span, error) {
+	traceID, ok := trace.ParseTraceID(s.TraceID)
+	if !ok {
+		return nil, fmt.Errorf("span %q: bad trace ID %q", s.Name, s.TraceID)
+	}
+	spanID, ok := trace.ParseSpanID(s.SpanID)
+	if !ok {
+		return nil, fmt.Errorf("span %q: bad span ID %q", s.Name, s.SpanID)
+	}
+	parent, _ := trace.ParseSpanID(s.ParentID)
+	span := &trace.Span{
+		Name:       s.Name,
+		Kind:       trace.Client,
+		Context:    trace.SpanContext{TraceID: traceID, SpanID: spanID, Sampled: true},
+		Parent:     parent,
+		StartTime:  time.UnixMilli(int64(s.Start)),
+		EndTime:    time.UnixMilli(int64(s.End)),
+		Attributes: s.Attributes,
+	}
+	if span.Attributes == nil {
+		span.Attributes = map[string]interface{}{}
+	}
+	if s.Error != "" {
+		span.StatusCode, span.StatusMessage = trace.StatusError, s.Error
+	}
+	return span, nil
+}
+
+func registerTraceMetrics(e *trace.Exporter) {
+	stat := func(pick func(exported, dropped, failures int64) int64) func() []sample {
+		return value(func() float64 {
+			return float64(pick(e.Stats()))
+		})
+	}
+	registerMetric("threedistvis_trace_spans_exported_total", "counter", "Spans sent to the OTLP collector.",
+		stat(func(exported, _, _ int64) int64 { return exported }))
+	registerMetric("threedistvis_trace_spans_dropped_total", "counter", "Spans dropped because the export queue was full or the export failed.",
+		stat(func(_, dropped, _ int64) int64 { return dropped }))
+	registerMetric("threedistvis_trace_export_failures_total", "counter", "Failed requests to the OTLP collector.",
+		stat(func(_, _, failures int64) int64 { return failures }))
+}
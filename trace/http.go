@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"net/http"
+)
+
+// Handler wraps h in a server span named after the method and route. A
+// W3C traceparent header on the request makes the span a child of the
+// caller's; the response carries the span's context in a traceresponse
+// header so clients can quote the trace ID in error reports.
+func Handler(route string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := ParseTraceparent(r.Header.Get("Traceparent")); ok {
+			ctx = WithRemoteParent(ctx, sc)
+		}
+		ctx, span := start(ctx, r.Method+" "+route, Server)
+		defer span.End()
+		span.Set("http.method", r.Method, "http.route", route, "http.target", r.URL.RequestURI())
+		w.Header().Set("Traceresponse", span.Context.Traceparent())
+
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(rw, r.WithContext(ctx))
+		span.Set("http.status_code", rw.status)
+		if rw.status >= 500 {
+			span.mu.Lock()
+			span.StatusCode, span.StatusMessage = StatusError, http.StatusText(rw.status)
+			span.mu.Unlock()
+		}
+	}
+}
+
+// statusWriter records the response status. It passes Flush through for
+// server-sent events.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wrote {
+		w.status, w.wrote = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
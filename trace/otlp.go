@@ -0,0 +1,294 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter batches finished spans and posts them to an OTLP/HTTP collector
+// as JSON. Spans that arrive while the queue is full are dropped rather
+// than slowing down requests.
+type Exporter struct {
+	url     string
+	service string
+	client  *http.Client
+
+	mu       sync.Mutex
+	queue    []*Span
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  bool
+	exported int64
+	dropped  int64
+	failures int64
+}
+
+// Export batching: a batch is sent when it reaches exportBatch spans or
+// exportInterval after the first span in it, whichever comes first.
+const (
+	exportBatch    = 512
+	exportInterval = 2 * time.Second
+	maxQueue       = 8192
+)
+
+var (
+	exporterMu sync.RWMutex
+	exporter   *Exporter
+)
+
+// NewExporter returns an exporter posting to the collector at endpoint,
+// either its base URL (such as http://localhost:4318) or the full
+// /v1/traces URL. Spans carry service as their service.name.
+func NewExporter(endpoint, service string) *Exporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	e := &Exporter{
+		url:     url,
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// SetExporter makes e receive every span ended from now on. With no
+// exporter, spans are still created, so trace IDs appear in logs, but are
+// discarded when they end.
+func SetExporter(e *Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+// Record hands a finished span to the exporter. Unsampled spans are
+// discarded.
+func Record(s *Span) {
+	exporterMu.RLock()
+	e := exporter
+	exporterMu.RUnlock()
+	if e == nil || !s.Context.Sampled {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopped || len(e.queue) >= maxQueue {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, s)
+	if len(e.queue) >= exportBatch {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stats returns the numbers of spans exported and dropped and of failed
+// export requests.
+func (e *Exporter) Stats() (exported, dropped, failures int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.exported, e.dropped, e.failures
+}
+
+// Shutdown stops the exporter after sending the queued spans, waiting at
+// most until ctx is done.
+func (e *Exporter) Shutdown(ctx context.Context) {
+	e.mu.Lock()
+	if e.stopped {
+		e.mu.Unlock()
+		return
+	}
+	e.stopped = true
+	e.mu.Unlock()
+	close(e.wake)
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		open := true
+		select {
+		case _, open = <-e.wake:
+		case <-ticker.C:
+		}
+		for {
+			e.mu.Lock()
+			batch := e.queue
+			if len(batch) > exportBatch {
+				batch = batch[:exportBatch]
+			}
+			e.queue = e.queue[len(batch):]
+			e.mu.Unlock()
+			if len(batch) == 0 {
+				break
+			}
+			e.send(batch)
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+func (e *Exporter) send(batch []*Span) {
+	body, err := json.Marshal(e.encode(batch))
+	if err == nil {
+		var resp *http.Response
+		resp, err = e.client.Post(e.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("%s: %s", e.url, resp.Status)
+			}
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.failures++
+		e.dropped += int64(len(batch))
+		fmt.Println("Trace export error:", err)
+		return
+	}
+	e.exported += int64(len(batch))
+}
+
+// The OTLP/JSON request body. IDs are hex strings and 64-bit integers are
+// decimal strings, as the OTLP JSON mapping requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              Kind           `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+func (e *Exporter) encode(batch []*Span) otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/sbecker11/threedistvis-go/trace"}}
+	for _, s := range batch {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: unixNano(s.StartTime),
+			EndTimeUnixNano:   unixNano(s.EndTime),
+			Attributes:        attributes(s.Attributes),
+			Status:            otlpStatus{Code: s.StatusCode, Message: s.StatusMessage},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, ev := range s.Events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: unixNano(ev.Time),
+				Name:         ev.Name,
+				Attributes:   attributes(ev.Attributes),
+			})
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": e.service})},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// attributes converts attributes to OTLP key-values, sorted by key.
+func attributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: anyValue(attrs[k])})
+	}
+	return kvs
+}
+
+func anyValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		return map[string]interface{}{"doubleValue": v}
+	case float32:
+		return anyValue(float64(v))
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
@@ -0,0 +1,259 @@
+// Package trace records OpenTelemetry-style spans and exports them with
+// OTLP over HTTP. It implements the small part of the OpenTelemetry model
+// the server needs (spans with attributes, events and status, W3C trace
+// context propagation and batched export) without external dependencies.
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID and SpanID identify traces and spans; the zero values are
+// invalid.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether t is not all zero.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid reports whether s is not all zero.
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that propagates across process
+// boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are valid.
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// Traceparent formats sc as a W3C traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent header value.
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil {
+		return sc, false
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// ParseTraceID parses a trace ID in hex.
+func ParseTraceID(s string) (TraceID, bool) {
+	var t TraceID
+	return t, decodeHex(t[:], s) == nil && t.IsValid()
+}
+
+// ParseSpanID parses a span ID in hex.
+func ParseSpanID(s string) (SpanID, bool) {
+	var id SpanID
+	return id, decodeHex(id[:], s) == nil && id.IsValid()
+}
+
+func decodeHex(dst []byte, s string) error {
+	if hex.DecodedLen(len(s)) != len(dst) {
+		return fmt.Errorf("trace: want %d hex digits, got %q", 2*len(dst), s)
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+var (
+	idMu  sync.Mutex
+	idRNG = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+func newIDs(trace *TraceID, span *SpanID) {
+	idMu.Lock()
+	defer idMu.Unlock()
+	for trace != nil && !trace.IsValid() {
+		idRNG.Read(trace[:])
+	}
+	for !span.IsValid() {
+		idRNG.Read(span[:])
+	}
+}
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+// Status codes, as in OTLP.
+const (
+	StatusUnset = 0
+	StatusOK    = 1
+	StatusError = 2
+)
+
+// Event is a timestamped annotation of a span, such as a log line.
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// Span is a timed operation. Live spans are created by Start and finished
+// with End; finished spans from elsewhere, such as the browser client, can
+// be built directly and passed to Record.
+type Span struct {
+	Name          string
+	Kind          Kind
+	Context       SpanContext
+	Parent        SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]interface{}
+	Events        []Event
+	StatusCode    int
+	StatusMessage string
+
+	mu    sync.Mutex
+	ended bool
+}
+
+type contextKey struct{}
+
+// Start begins a span named name as a child of the span in ctx, or of a
+// remote parent set with WithRemoteParent, or as the root of a new trace.
+// The returned context carries the new span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	return start(ctx, name, Internal)
+}
+
+func start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	s := &Span{Name: name, Kind: kind, StartTime: time.Now(), Attributes: map[string]interface{}{}}
+	parent := SpanContextFrom(ctx)
+	if parent.IsValid() {
+		s.Context.TraceID, s.Parent, s.Context.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+		newIDs(nil, &s.Context.SpanID)
+	} else {
+		s.Context.Sampled = true
+		newIDs(&s.Context.TraceID, &s.Context.SpanID)
+	}
+	return context.WithValue(ctx, contextKey{}, s), s
+}
+
+// remoteParent carries a span context received from another process.
+type remoteParent struct{}
+
+// WithRemoteParent returns a context whose spans become children of sc.
+func WithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteParent{}, sc)
+}
+
+// FromContext returns the span in ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// SpanContextFrom returns the context of the span in ctx, or of the remote
+// parent if there is no span, or the zero SpanContext.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	if s := FromContext(ctx); s != nil {
+		return s.Context
+	}
+	sc, _ := ctx.Value(remoteParent{}).(SpanContext)
+	return sc
+}
+
+// Set records attributes given as alternating keys and values. Values
+// should be strings, bools, integers or floats.
+func (s *Span) Set(kv ...interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i+1 < len(kv); i += 2 {
+		s.Attributes[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+}
+
+// AddEvent records a named event with attributes given as alternating keys
+// and values.
+func (s *Span) AddEvent(name string, kv ...interface{}) {
+	e := Event{Name: name, Time: time.Now(), Attributes: map[string]interface{}{}}
+	for i := 0; i+1 < len(kv); i += 2 {
+		e.Attributes[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, e)
+}
+
+// Fail marks the span as failed with err, recording it as an exception
+// event. A nil err is ignored, so Fail can wrap any error return.
+func (s *Span) Fail(err error) {
+	if err == nil {
+		return
+	}
+	s.AddEvent("exception", "exception.message", err.Error())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.StatusCode, s.StatusMessage = StatusError, err.Error()
+}
+
+// End finishes the span and hands it to the exporter. Later calls do
+// nothing.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	Record(s)
+}
+
+// Println logs args like fmt.Println, prefixed with the trace and span IDs
+// from ctx so log lines can be joined with traces. The line is also added
+// to the span as a "log" event.
+func Println(ctx context.Context, args ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+	if sc := SpanContextFrom(ctx); sc.IsValid() {
+		fmt.Printf("trace_id=%s span_id=%s %s\n", sc.TraceID, sc.SpanID, msg)
+	} else {
+		fmt.Println(msg)
+	}
+	if s := FromContext(ctx); s != nil {
+		s.AddEvent("log", "message", msg)
+	}
+}
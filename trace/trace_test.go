@@ -0,0 +1,140 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		sc := SpanContext{Sampled: sampled}
+		newIDs(&sc.TraceID, &sc.SpanID)
+		got, ok := ParseTraceparent(sc.Traceparent())
+		if !ok || got != sc {
+			t.Errorf("ParseTraceparent(%q) = %+v, %v; want %+v", sc.Traceparent(), got, ok, sc)
+		}
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		in      string
+		ok      bool
+		sampled bool
+	}{
+		{"00-" + traceID + "-" + spanID + "-01", true, true},
+		{" 00-" + traceID + "-" + spanID + "-00 ", true, false},
+		{"01-" + traceID + "-" + spanID + "-01-future", true, true}, // later versions may add fields
+		{"ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"00-" + strings.Repeat("0", 32) + "-" + spanID + "-01", false, false},
+		{"00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"00-" + traceID[:30] + "-" + spanID + "-01", false, false},
+		{"00-" + traceID + "-" + spanID + "-zz", false, false},
+		{"00-" + traceID + "-" + spanID, false, false},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		sc, ok := ParseTraceparent(tt.in)
+		if ok != tt.ok || ok && (sc.Sampled != tt.sampled || sc.TraceID.String() != traceID || sc.SpanID.String() != spanID) {
+			t.Errorf("ParseTraceparent(%q) = %+v, %v; want ok %v, sampled %v", tt.in, sc, ok, tt.ok, tt.sampled)
+		}
+	}
+}
+
+func TestStartParents(t *testing.T) {
+	remote := SpanContext{Sampled: true}
+	newIDs(&remote.TraceID, &remote.SpanID)
+	ctx, parent := Start(WithRemoteParent(context.Background(), remote), "parent")
+	_, child := Start(ctx, "child")
+	if parent.Context.TraceID != remote.TraceID || parent.Parent != remote.SpanID {
+		t.Errorf("parent span %+v does not continue the remote trace %+v", parent.Context, remote)
+	}
+	if child.Context.TraceID != remote.TraceID || child.Parent != parent.Context.SpanID || child.Context.SpanID == parent.Context.SpanID {
+		t.Errorf("child span %+v is not a child of %+v", child.Context, parent.Context)
+	}
+	_, root := Start(context.Background(), "root")
+	if !root.Context.IsValid() || root.Parent.IsValid() || root.Context.TraceID == remote.TraceID {
+		t.Errorf("root span %+v, parent %v", root.Context, root.Parent)
+	}
+}
+
+func TestOTLPEncoding(t *testing.T) {
+	start := time.Unix(1700000000, 5)
+	s := &Span{
+		Name:       "dataset.load",
+		Kind:       Server,
+		StartTime:  start,
+		EndTime:    start.Add(time.Millisecond),
+		Attributes: map[string]interface{}{"b": 2, "a": "x", "nan": math.NaN(), "ok": true},
+		StatusCode: StatusError,
+	}
+	newIDs(&s.Context.TraceID, &s.Context.SpanID)
+	e := &Exporter{service: "test"}
+	b, err := json.Marshal(e.encode([]*Span{s}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]interface{}
+				}
+			}
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID, SpanID, ParentSpanID      string
+					Name                               string
+					Kind                               int
+					StartTimeUnixNano, EndTimeUnixNano string
+					Attributes                         []struct {
+						Key   string
+						Value map[string]interface{}
+					}
+					Status struct{ Code int }
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	rs := got.ResourceSpans[0]
+	if a := rs.Resource.Attributes[0]; a.Key != "service.name" || a.Value["stringValue"] != "test" {
+		t.Errorf("resource attributes = %+v", rs.Resource.Attributes)
+	}
+	span := rs.ScopeSpans[0].Spans[0]
+	if span.TraceID != s.Context.TraceID.String() || span.SpanID != s.Context.SpanID.String() || span.ParentSpanID != "" {
+		t.Errorf("span IDs = %s %s %q", span.TraceID, span.SpanID, span.ParentSpanID)
+	}
+	if span.StartTimeUnixNano != "1700000000000000005" || span.EndTimeUnixNano != "1700000000001000005" {
+		t.Errorf("times = %s, %s", span.StartTimeUnixNano, span.EndTimeUnixNano)
+	}
+	if span.Kind != int(Server) || span.Status.Code != StatusError {
+		t.Errorf("kind %d, status %d", span.Kind, span.Status.Code)
+	}
+	var keys []string
+	for _, a := range span.Attributes {
+		keys = append(keys, a.Key)
+	}
+	if strings.Join(keys, ",") != "a,b,nan,ok" {
+		t.Errorf("attribute keys = %v, want sorted", keys)
+	}
+	want := []map[string]interface{}{{"stringValue": "x"}, {"intValue": "2"}, {"stringValue": "NaN"}, {"boolValue": true}}
+	for i, a := range span.Attributes {
+		for k, v := range want[i] {
+			if a.Value[k] != v {
+				t.Errorf("attribute %s = %v, want %v", a.Key, a.Value, want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package volume
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var metaTypes = map[string]sampleType{
+	"MET_CHAR":       typeInt8,
+	"MET_UCHAR":      typeUint8,
+	"MET_SHORT":      typeInt16,
+	"MET_USHORT":     typeUint16,
+	"MET_INT":        typeInt32,
+	"MET_UINT":       typeUint32,
+	"MET_LONG_LONG":  typeInt64,
+	"MET_ULONG_LONG": typeUint64,
+	"MET_FLOAT":      typeFloat32,
+	"MET_DOUBLE":     typeFloat64,
+}
+
+// ReadMetaImage reads a three-dimensional MetaImage volume: a text header
+// (.mhd) naming a raw data file below dir, or a single file
+// (.mha) with ElementDataFile = LOCAL. Zlib-compressed data is supported.
+func ReadMetaImage(r io.Reader, dir string) (*Volume, error) {
+	br := bufio.NewReader(r)
+	fields := map[string]string{}
+	for {
+		line, err := br.ReadString('\n')
+		if key, value, ok := strings.Cut(line, "="); ok {
+			key = strings.TrimSpace(key)
+			fields[key] = strings.TrimSpace(value)
+			// ElementDataFile is always the last header field.
+			if key == "ElementDataFile" {
+				break
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("volume: MetaImage header has no ElementDataFile")
+		}
+	}
+
+	typ, ok := metaTypes[fields["ElementType"]]
+	if !ok {
+		return nil, fmt.Errorf("volume: unsupported MetaImage element type %q", fields["ElementType"])
+	}
+	if fields["NDims"] != "3" {
+		return nil, fmt.Errorf("volume: MetaImage NDims is %q, want 3", fields["NDims"])
+	}
+	if n := fields["ElementNumberOfChannels"]; n != "" && n != "1" {
+		return nil, fmt.Errorf("volume: MetaImage with %s channels is not supported", n)
+	}
+	v := &Volume{Spacing: [3]float64{1, 1, 1}}
+	if err := parseInts(fields["DimSize"], v.Dims[:]); err != nil {
+		return nil, fmt.Errorf("volume: MetaImage DimSize: %w", err)
+	}
+	if err := checkDims(v.Dims); err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"ElementSpacing", "ElementSize"} {
+		if s, ok := fields[key]; ok {
+			if err := parseFloats(s, v.Spacing[:]); err != nil {
+				return nil, fmt.Errorf("volume: MetaImage %s: %w", key, err)
+			}
+			break
+		}
+	}
+	for _, key := range []string{"Offset", "Origin", "Position"} {
+		if s, ok := fields[key]; ok {
+			if err := parseFloats(s, v.Origin[:]); err != nil {
+				return nil, fmt.Errorf("volume: MetaImage %s: %w", key, err)
+			}
+			break
+		}
+	}
+
+	var data io.Reader = br
+	if file := fields["ElementDataFile"]; file != "LOCAL" && file != "Local" {
+		if strings.Contains(file, "%") || file == "LIST" {
+			return nil, fmt.Errorf("volume: multi-file MetaImage data is not supported")
+		}
+		path, err := dataFile(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data = f
+	}
+	if strings.EqualFold(fields["CompressedData"], "True") {
+		zr, err := zlib.NewReader(data)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data = zr
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if strings.EqualFold(fields["BinaryDataByteOrderMSB"], "True") || strings.EqualFold(fields["ElementByteOrderMSB"], "True") {
+		order = binary.BigEndian
+	}
+	var err error
+	if v.Data, err = readBinary(data, typ, order, v.Len()); err != nil {
+		return nil, fmt.Errorf("volume: MetaImage data: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,210 @@
+package volume
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var nrrdTypes = map[string]sampleType{
+	"signed char": typeInt8, "int8": typeInt8, "int8_t": typeInt8,
+	"uchar": typeUint8, "unsigned char": typeUint8, "uint8": typeUint8, "uint8_t": typeUint8,
+	"short": typeInt16, "short int": typeInt16, "signed short": typeInt16, "signed short int": typeInt16, "int16": typeInt16, "int16_t": typeInt16,
+	"ushort": typeUint16, "unsigned short": typeUint16, "unsigned short int": typeUint16, "uint16": typeUint16, "uint16_t": typeUint16,
+	"int": typeInt32, "signed int": typeInt32, "int32": typeInt32, "int32_t": typeInt32,
+	"uint": typeUint32, "unsigned int": typeUint32, "uint32": typeUint32, "uint32_t": typeUint32,
+	"longlong": typeInt64, "long long": typeInt64, "long long int": typeInt64, "signed long long": typeInt64, "signed long long int": typeInt64, "int64": typeInt64, "int64_t": typeInt64,
+	"ulonglong": typeUint64, "unsigned long long": typeUint64, "unsigned long long int": typeUint64, "uint64": typeUint64, "uint64_t": typeUint64,
+	"float":  typeFloat32,
+	"double": typeFloat64,
+}
+
+// ReadNRRD reads a three-dimensional NRRD volume. Detached data files
+// (.nhdr) are resolved relative to dir and must lie below it. Raw, ASCII, gzip and bzip2
+// encodings are supported.
+func ReadNRRD(r io.Reader, dir string) (*Volume, error) {
+	br := bufio.NewReader(r)
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "NRRD000") {
+		return nil, errors.New("volume: not a NRRD file")
+	}
+	fields := map[string]string{}
+	for {
+		line, err := br.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// A blank line (or the end of a detached header) ends the header.
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "#") || strings.Contains(line, ":=") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("volume: malformed NRRD header line %q", line)
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		if err == io.EOF {
+			break
+		}
+	}
+
+	typ, ok := nrrdTypes[fields["type"]]
+	if !ok {
+		return nil, fmt.Errorf("volume: unsupported NRRD type %q", fields["type"])
+	}
+	if fields["dimension"] != "3" {
+		return nil, fmt.Errorf("volume: NRRD dimension is %q, want 3", fields["dimension"])
+	}
+	v := &Volume{Spacing: [3]float64{1, 1, 1}}
+	if err := parseInts(fields["sizes"], v.Dims[:]); err != nil {
+		return nil, fmt.Errorf("volume: NRRD sizes: %w", err)
+	}
+	if err := checkDims(v.Dims); err != nil {
+		return nil, err
+	}
+	if s, ok := fields["spacings"]; ok {
+		if err := parseFloats(s, v.Spacing[:]); err != nil {
+			return nil, fmt.Errorf("volume: NRRD spacings: %w", err)
+		}
+	}
+	if s, ok := fields["space directions"]; ok {
+		// Only the length of each axis vector is kept; oblique volumes are
+		// treated as axis aligned.
+		for i, vec := range strings.Fields(s) {
+			var d [3]float64
+			if i >= 3 || parseFloats(strings.Trim(vec, "()"), d[:]) != nil {
+				continue
+			}
+			v.Spacing[i] = math.Sqrt(d[0]*d[0] + d[1]*d[1] + d[2]*d[2])
+		}
+	}
+	if s, ok := fields["space origin"]; ok {
+		if err := parseFloats(strings.Trim(s, "()"), v.Origin[:]); err != nil {
+			return nil, fmt.Errorf("volume: NRRD space origin: %w", err)
+		}
+	}
+
+	var data io.Reader = br
+	file := fields["data file"]
+	if file == "" {
+		file = fields["datafile"]
+	}
+	if file != "" {
+		if file == "LIST" || strings.Contains(file, " ") {
+			return nil, fmt.Errorf("volume: multi-file NRRD data is not supported")
+		}
+		path, err := dataFile(dir, file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data = f
+	}
+	if s := fields["line skip"]; s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("volume: NRRD line skip: %w", err)
+		}
+		lr := bufio.NewReader(data)
+		for i := 0; i < n; i++ {
+			if _, err := lr.ReadString('\n'); err != nil {
+				return nil, err
+			}
+		}
+		data = lr
+	}
+
+	enc := fields["encoding"]
+	switch enc {
+	case "gzip", "gz":
+		zr, err := gzip.NewReader(data)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		data = zr
+	case "bzip2", "bz2":
+		data = bzip2.NewReader(data)
+	}
+	if err := skipBytes(data, fields["byte skip"]); err != nil {
+		return nil, err
+	}
+
+	switch enc {
+	case "ascii", "text", "txt":
+		v.Data, err = readASCII(data, v.Len())
+	case "raw", "gzip", "gz", "bzip2", "bz2":
+		var order binary.ByteOrder = binary.LittleEndian
+		if fields["endian"] == "big" {
+			order = binary.BigEndian
+		}
+		v.Data, err = readBinary(data, typ, order, v.Len())
+	default:
+		return nil, fmt.Errorf("volume: unsupported NRRD encoding %q", enc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("volume: NRRD data: %w", err)
+	}
+	return v, nil
+}
+
+func skipBytes(r io.Reader, s string) error {
+	if s == "" || s == "0" {
+		return nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("volume: unsupported byte skip %q", s)
+	}
+	_, err = io.CopyN(io.Discard, r, n)
+	return err
+}
+
+func parseInts(s string, dst []int) error {
+	f := strings.Fields(s)
+	if len(f) != len(dst) {
+		return fmt.Errorf("want %d values, got %q", len(dst), s)
+	}
+	for i := range dst {
+		v, err := strconv.Atoi(f[i])
+		if err != nil {
+			return err
+		}
+		if v <= 0 {
+			return fmt.Errorf("non-positive size %d", v)
+		}
+		dst[i] = v
+	}
+	return nil
+}
+
+func parseFloats(s string, dst []float64) error {
+	f := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+	if len(f) != len(dst) {
+		return fmt.Errorf("want %d values, got %q", len(dst), s)
+	}
+	for i := range dst {
+		v, err := strconv.ParseFloat(f[i], 64)
+		if err != nil {
+			return err
+		}
+		dst[i] = v
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package volume
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// sampleType is the on-disk element type of a volume.
+type sampleType int
+
+const (
+	typeInt8 sampleType = iota
+	typeUint8
+	typeInt16
+	typeUint16
+	typeInt32
+	typeUint32
+	typeInt64
+	typeUint64
+	typeFloat32
+	typeFloat64
+)
+
+var sampleSizes = [...]int{1, 1, 2, 2, 4, 4, 8, 8, 4, 8}
+
+func (t sampleType) size() int {
+	return sampleSizes[t]
+}
+
+// readBinary decodes n samples of type t from r.
+func readBinary(r io.Reader, t sampleType, order binary.ByteOrder, n int) ([]float32, error) {
+	size := t.size()
+	br := bufio.NewReader(r)
+	buf := make([]byte, size)
+	data := make([]float32, n)
+	for i := range data {
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("reading sample %d of %d: %w", i, n, err)
+		}
+		switch t {
+		case typeInt8:
+			data[i] = float32(int8(buf[0]))
+		case typeUint8:
+			data[i] = float32(buf[0])
+		case typeInt16:
+			data[i] = float32(int16(order.Uint16(buf)))
+		case typeUint16:
+			data[i] = float32(order.Uint16(buf))
+		case typeInt32:
+			data[i] = float32(int32(order.Uint32(buf)))
+		case typeUint32:
+			data[i] = float32(order.Uint32(buf))
+		case typeInt64:
+			data[i] = float32(int64(order.Uint64(buf)))
+		case typeUint64:
+			data[i] = float32(order.Uint64(buf))
+		case typeFloat32:
+			data[i] = math.Float32frombits(order.Uint32(buf))
+		case typeFloat64:
+			data[i] = float32(math.Float64frombits(order.Uint64(buf)))
+		}
+	}
+	return data, nil
+}
+
+// readASCII decodes n whitespace-separated samples from r.
+func readASCII(r io.Reader, n int) ([]float32, error) {
+	sc := bufio.NewScanner(r)
+	sc.Split(bufio.ScanWords)
+	data := make([]float32, 0, n)
+	for len(data) < n && sc.Scan() {
+		v, err := strconv.ParseFloat(sc.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("reading sample %d: %w", len(data), err)
+		}
+		data = append(data, float32(v))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(data) < n {
+		return nil, fmt.Errorf("got %d of %d samples", len(data), n)
+	}
+	return data, nil
+}
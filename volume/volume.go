@@ -0,0 +1,174 @@
+// Package volume loads 3D scalar volumes (NRRD and MetaImage raw+header)
+// and converts them to point clouds by thresholding or importance sampling.
+package volume
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// Volume is a regular grid of scalar samples. Data is stored with x varying
+// fastest, then y, then z.
+type Volume struct {
+	Dims    [3]int
+	Spacing [3]float64
+	Origin  [3]float64
+	Data    []float32
+}
+
+// Open reads a volume, choosing the format from the file extension: .nrrd
+// and .nhdr for NRRD, .mhd and .mha for MetaImage.
+func Open(path string) (*Volume, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nrrd", ".nhdr":
+		return readFile(path, ReadNRRD)
+	case ".mhd", ".mha":
+		return readFile(path, ReadMetaImage)
+	}
+	return nil, fmt.Errorf("volume: unsupported file type %q", filepath.Ext(path))
+}
+
+func readFile(path string, read func(r io.Reader, dir string) (*Volume, error)) (*Volume, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	v, err := read(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return v, nil
+}
+
+// MaxVoxels bounds the voxels of a volume, so that a header cannot ask for
+// more memory than any volume this viewer can show needs.
+const MaxVoxels = 1 << 28
+
+// checkDims returns an error unless every size in dims is positive and
+// their product is at most MaxVoxels, checking each step for overflow.
+func checkDims(dims [3]int) error {
+	n := 1
+	for _, d := range dims {
+		if d <= 0 {
+			return fmt.Errorf("volume: non-positive size %d", d)
+		}
+		if n > MaxVoxels/d {
+			return fmt.Errorf("volume: %d×%d×%d voxels are more than %d", dims[0], dims[1], dims[2], MaxVoxels)
+		}
+		n *= d
+	}
+	return nil
+}
+
+// dataFile returns the path of a detached data file named in a header read
+// from dir. Names must stay within dir.
+func dataFile(dir, file string) (string, error) {
+	if !filepath.IsLocal(file) {
+		return "", fmt.Errorf("volume: data file %q is outside the header's directory", file)
+	}
+	return filepath.Join(dir, file), nil
+}
+
+// Len returns the number of voxels.
+func (v *Volume) Len() int {
+	return v.Dims[0] * v.Dims[1] * v.Dims[2]
+}
+
+// Position returns the world coordinates of the center of voxel (i, j, k).
+func (v *Volume) Position(i, j, k int) (x, y, z float64) {
+	return v.Origin[0] + float64(i)*v.Spacing[0],
+		v.Origin[1] + float64(j)*v.Spacing[1],
+		v.Origin[2] + float64(k)*v.Spacing[2]
+}
+
+// Range returns the smallest and largest voxel value.
+func (v *Volume) Range() (lo, hi float32) {
+	return pointcloud.Range(v.Data)
+}
+
+// Threshold returns one point per voxel whose value lies in [lo, hi], with
+// the voxel value kept as the "value" attribute. NaN voxels are skipped.
+func (v *Volume) Threshold(name string, lo, hi float32) *pointcloud.Cloud {
+	c := pointcloud.New(name, 0)
+	var values []float32
+	v.each(func(i, j, k int, val float32) {
+		if !(val >= lo && val <= hi) {
+			return
+		}
+		x, y, z := v.Position(i, j, k)
+		c.Positions = append(c.Positions, float32(x), float32(y), float32(z))
+		values = append(values, val)
+	})
+	c.SetAttribute("value", values)
+	return c
+}
+
+// Sample draws n points with probability proportional to voxel intensity
+// above the volume minimum, jittered uniformly within the chosen voxel. The
+// voxel value is kept as the "value" attribute.
+func (v *Volume) Sample(name string, n int, rng *rand.Rand) (*pointcloud.Cloud, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("volume: sample size must be positive, got %d", n)
+	}
+	min, _ := v.Range()
+	cdf := make([]float64, len(v.Data))
+	total := 0.0
+	for i, val := range v.Data {
+		if w := float64(val - min); w > 0 && !math.IsInf(w, 0) {
+			total += w
+		}
+		cdf[i] = total
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("volume: cannot sample a constant volume")
+	}
+	c := pointcloud.New(name, n)
+	values := make([]float32, n)
+	nx, nxy := v.Dims[0], v.Dims[0]*v.Dims[1]
+	for s := 0; s < n; s++ {
+		idx := search(cdf, rng.Float64()*total)
+		i, j, k := idx%nx, idx%nxy/nx, idx/nxy
+		x, y, z := v.Position(i, j, k)
+		c.SetPoint(s,
+			float32(x+(rng.Float64()-0.5)*v.Spacing[0]),
+			float32(y+(rng.Float64()-0.5)*v.Spacing[1]),
+			float32(z+(rng.Float64()-0.5)*v.Spacing[2]))
+		values[s] = v.Data[idx]
+	}
+	c.SetAttribute("value", values)
+	return c, nil
+}
+
+// search returns the first index whose cumulative weight exceeds u.
+func search(cdf []float64, u float64) int {
+	lo, hi := 0, len(cdf)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if cdf[mid] > u {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	return lo
+}
+
+func (v *Volume) each(fn func(i, j, k int, val float32)) {
+	n := 0
+	for k := 0; k < v.Dims[2]; k++ {
+		for j := 0; j < v.Dims[1]; j++ {
+			for i := 0; i < v.Dims[0]; i++ {
+				fn(i, j, k, v.Data[n])
+				n++
+			}
+		}
+	}
+}
@@ -0,0 +1,567 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/compositional"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/sampling"
+)
+
+// An action is a user-facing command. The command palette, keyboard
+// shortcuts and menus all dispatch through the registry, so every command
+// is reachable from each of them.
+type action struct {
+	id       string // stable identifier, e.g. "dataset.load"
+	title    string
+	menu     string // menu listing the action, or "" for palette only
+	shortcut string // e.g. "Ctrl+K" or "R"; see keyName
+	params   []param
+	run      func(args map[string]string)
+}
+
+// A param is an argument prompted for before an action runs.
+type param struct {
+	name    string
+	prompt  string
+	def     func() string   // initial input, may be nil
+	choices func() []string // suggested values, may be nil; must not block
+	free    bool            // whether values outside choices are accepted
+}
+
+var actions []*action
+
+// register adds a to the registry. Menus list actions in registration order.
+func register(a *action) {
+	actions = append(actions, a)
+}
+
+// invoke runs a, prompting for its parameters in the palette first.
+func invoke(a *action) {
+	if len(a.params) > 0 {
+		thePalette.prompt(a)
+		return
+	}
+	go a.run(nil)
+}
+
+// datasetNames caches the server's dataset list for the load prompt.
+var datasetNames []string
+
+func fetchDatasetNames() {
+	b, err := fetchBytes("api/datasets/")
+	if err != nil {
+		return
+	}
+	decodeJSON(b, &datasetNames)
+}
+
+func registerActions(v *viewer) {
+	register(&action{
+		id:       "palette.open",
+		title:    "Show command palette",
+		menu:     "View",
+		shortcut: "Ctrl+K",
+		run:      func(map[string]string) { thePalette.show() },
+	})
+	register(&action{
+		id:    "dataset.load",
+		title: "Load dataset",
+		menu:  "File",
+		params: []param{
+			{name: "name", prompt: "Dataset", choices: func() []string { return datasetNames }, free: true},
+			{name: "options", prompt: "Options, e.g. n=5000&noise=0.1 (Enter for defaults)", free: true},
+		},
+		run: func(args map[string]string) {
+			if err := loadDataset(v, args["name"], args["options"]); err != nil {
+				reportError("Load failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "stream.watch",
+		title: "Watch live stream",
+		menu:  "File",
+		params: []param{{name: "name", prompt: "Stream", choices: func() []string {
+			go fetchStreamNames()
+			return streamNames
+		}, free: true}},
+		run: func(args map[string]string) { theStats.watch(args["name"]) },
+	})
+	register(&action{
+		id:    "stream.stop",
+		title: "Stop watching stream",
+		menu:  "File",
+		run:   func(map[string]string) { theStats.stop() },
+	})
+	register(&action{
+		id:    "stream.drift",
+		title: "Monitor stream drift",
+		menu:  "File",
+		params: []param{
+			{name: "method", prompt: "Drift statistic", choices: func() []string { return []string{"mmd", "energy"} }},
+			{name: "threshold", prompt: "Threshold (Enter for 0.01)", free: true},
+			{name: "baseline", prompt: "Baseline dataset (Enter to use the current window)", choices: func() []string { return datasetNames }, free: true},
+		},
+		run: func(args map[string]string) {
+			if err := theStats.monitorDrift(args["method"], args["threshold"], args["baseline"]); err != nil {
+				reportError("Drift monitoring failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "scene.open",
+		title: "Open scene",
+		menu:  "File",
+		run:   func(map[string]string) { openScene(v) },
+	})
+	register(&action{
+		id:    "scene.save",
+		title: "Save scene",
+		menu:  "File",
+		run:   func(map[string]string) { saveScene(v) },
+	})
+	register(&action{
+		id:       "export.png",
+		title:    "Export image (PNG)",
+		menu:     "File",
+		shortcut: "Ctrl+S",
+		run: func(map[string]string) {
+			a := element("a", "", "")
+			a.Set("href", v.canvas.Call("toDataURL", "image/png"))
+			a.Set("download", strings.ReplaceAll(v.cloud.Name, "/", "-")+".png")
+			a.Call("click")
+		},
+	})
+	register(&action{
+		id:    "export.html",
+		title: "Export snapshot (HTML)",
+		menu:  "File",
+		run: func(map[string]string) {
+			if err := exportSnapshot(v); err != nil {
+				reportError("Snapshot failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "color.attribute",
+		title: "Color by attribute",
+		menu:  "View",
+		params: []param{{
+			name:   "attribute",
+			prompt: "Attribute",
+			choices: func() []string {
+				names := []string{"none"}
+				for _, a := range v.cloud.Attributes {
+					names = append(names, a.Name)
+				}
+				return names
+			},
+		}},
+		run: func(args map[string]string) {
+			v.colorBy = args["attribute"]
+			if v.colorBy == "none" {
+				v.colorBy = ""
+			}
+			v.recolor()
+		},
+	})
+	register(&action{
+		id:     "color.map",
+		title:  "Change colormap",
+		menu:   "View",
+		params: []param{{name: "colormap", prompt: "Colormap", choices: v.colormapNames}},
+		run: func(args map[string]string) {
+			if m, ok := v.lookupColormap(args["colormap"]); ok {
+				v.cmap = m
+				v.recolor()
+				savePrefs(v)
+			}
+		},
+	})
+	register(&action{
+		id:    "color.edit",
+		title: "Edit colormap",
+		menu:  "View",
+		run:   func(map[string]string) { theEditor.edit(v.cmap) },
+	})
+	register(&action{
+		id:    "color.import",
+		title: "Import colormap",
+		menu:  "File",
+		run: func(map[string]string) {
+			importColormap(v, func(m *colormap.Colormap) {
+				if err := v.addColormap(m); err != nil {
+					setStatus("%v", err)
+					return
+				}
+				v.cmap = m
+				v.recolor()
+				savePrefs(v)
+			})
+		},
+	})
+	register(&action{
+		id:    "color.export",
+		title: "Export colormap",
+		menu:  "File",
+		run:   func(map[string]string) { exportColormap(v.cmap) },
+	})
+	register(&action{
+		id:     "color.palette",
+		title:  "Change categorical palette",
+		menu:   "View",
+		params: []param{{name: "palette", prompt: "Palette", choices: colormap.PaletteNames}},
+		run: func(args map[string]string) {
+			if p, ok := colormap.GetPalette(args["palette"]); ok {
+				v.palette = p
+				v.recolor()
+			}
+		},
+	})
+	for _, k := range surfaceKinds {
+		k := k
+		register(&action{
+			id:    "surface." + k.name,
+			title: k.title,
+			menu:  "Layers",
+			params: []param{
+				{name: "formula", prompt: k.formula, free: true},
+				{name: "domain", prompt: k.domain, free: true},
+				{name: "resolution", prompt: "Grid resolution", def: func() string { return k.resolution }, free: true},
+			},
+			run: func(args map[string]string) {
+				n, err := strconv.Atoi(args["resolution"])
+				if err == nil {
+					err = v.addSurface(k.name, args["formula"], args["domain"], n)
+				}
+				if err != nil {
+					reportError("Surface failed", err)
+				}
+			},
+		})
+	}
+	register(&action{
+		id:    "surface.clear",
+		title: "Remove surfaces",
+		menu:  "Layers",
+		run:   func(map[string]string) { v.clearSurfaces() },
+	})
+	register(&action{
+		id:    "note.add",
+		title: "Add annotation",
+		menu:  "Layers",
+		params: []param{
+			{name: "text", prompt: "Text", free: true},
+			{name: "at", prompt: "Position x, y, z", free: true, def: func() string {
+				return formatPoint([3]float64{float64(v.center[0]), float64(v.center[1]), float64(v.center[2])})
+			}},
+		},
+		run: func(args map[string]string) {
+			at, err := parsePoint(args["at"])
+			if err == nil {
+				err = v.addNote(args["text"], at)
+			}
+			if err != nil {
+				setStatus("Annotation: %v", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "note.clear",
+		title: "Remove annotations",
+		menu:  "Layers",
+		run:   func(map[string]string) { v.clearNotes() },
+	})
+	register(&action{
+		id:    "pattern.test",
+		title: "Test spatial randomness",
+		menu:  "Analyze",
+		params: []param{
+			{name: "points", prompt: "Points to test (Enter for 2000)", free: true},
+			{name: "simulations", prompt: "Uniform simulations for the envelopes (Enter for 39)", free: true},
+		},
+		run: func(args map[string]string) {
+			if err := thePattern.test(args["points"], args["simulations"]); err != nil {
+				reportError("Spatial randomness test failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "voronoi.compute",
+		title: "Voronoi tessellation",
+		menu:  "Analyze",
+		params: []param{{
+			name:   "region",
+			prompt: "Region: all, or min x, y, z; max x, y, z",
+			def:    v.defaultRegion,
+			free:   true,
+		}},
+		run: func(args map[string]string) {
+			if err := v.tessellate(args["region"]); err != nil {
+				reportError("Tessellation failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "voronoi.edges",
+		title: "Toggle Delaunay edges",
+		menu:  "Analyze",
+		run:   func(map[string]string) { v.toggleDelaunay() },
+	})
+	register(&action{
+		id:    "voronoi.clear",
+		title: "Remove tessellation",
+		menu:  "Analyze",
+		run:   func(map[string]string) { v.clearVoronoi() },
+	})
+	register(&action{
+		id:    "embed.start",
+		title: "Embed with UMAP or Isomap",
+		menu:  "Analyze",
+		params: []param{
+			{name: "method", prompt: "Method", choices: func() []string { return []string{"umap", "isomap"} }},
+			{name: "features", prompt: "Features: x, y, z and attributes (Enter for x,y,z)", free: true},
+			{name: "points", prompt: "Points to embed (Enter for 5000)", free: true},
+			{name: "neighbors", prompt: "Neighbors (Enter for 15 with UMAP, 10 with Isomap)", free: true},
+		},
+		run: func(args map[string]string) {
+			if err := theEmbedding.start(args["method"], args["features"], args["points"], args["neighbors"]); err != nil {
+				reportError("Embedding failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "embed.stop",
+		title: "Stop embedding",
+		menu:  "Analyze",
+		run:   func(map[string]string) { theEmbedding.stop() },
+	})
+	register(&action{
+		id:    "sampling.start",
+		title: "Sampling distribution demo",
+		menu:  "Teach",
+		params: []param{
+			{name: "distribution", prompt: "Source distribution", choices: sampling.Names},
+			{name: "estimator", prompt: "Estimator", choices: func() []string { return sampling.Estimators }},
+			{name: "mode", prompt: "clt: many samples of size n; lln: one growing sample", choices: func() []string { return []string{"clt", "lln"} }},
+			{name: "n", prompt: "Sample size n", def: func() string { return "30" }, free: true},
+		},
+		run: func(args map[string]string) {
+			theSampling.start(args["distribution"], args["estimator"], args["mode"], args["n"])
+		},
+	})
+	register(&action{
+		id:    "sampling.stop",
+		title: "Close sampling demo",
+		menu:  "Teach",
+		run:   func(map[string]string) { theSampling.stop() },
+	})
+	register(&action{
+		id:     "simplex.transform",
+		title:  "Change composition coordinates",
+		menu:   "View",
+		params: []param{{name: "transform", prompt: "Coordinates", choices: func() []string { return compositional.Transforms }}},
+		run: func(args map[string]string) {
+			if err := v.setTransform(args["transform"]); err != nil {
+				reportError("Transform failed", err)
+			}
+		},
+	})
+	register(&action{
+		id:    "comments.open",
+		title: "Show comments",
+		menu:  "View",
+		run:   func(map[string]string) { theComments.open() },
+	})
+	register(&action{
+		id:    "story.edit",
+		title: "Edit story",
+		menu:  "Story",
+		run:   func(map[string]string) { theStory.open() },
+	})
+	register(&action{
+		id:    "story.play",
+		title: "Play story",
+		menu:  "Story",
+		run:   func(map[string]string) { theStory.play(0) },
+	})
+	register(&action{
+		id:    "view.cvd",
+		title: "Simulate color vision deficiency",
+		menu:  "View",
+		params: []param{{
+			name:   "deficiency",
+			prompt: "Deficiency",
+			choices: func() []string {
+				names := []string{colormap.NormalVision.String()}
+				for _, d := range colormap.Deficiencies {
+					names = append(names, d.String())
+				}
+				return names
+			},
+		}},
+		run: func(args map[string]string) {
+			d, err := colormap.ParseDeficiency(args["deficiency"])
+			if err != nil {
+				setStatus("%v", err)
+				return
+			}
+			v.cvd = d
+			v.updateLegend()
+		},
+	})
+	register(&action{
+		id:       "view.axes",
+		title:    "Toggle axes",
+		menu:     "View",
+		shortcut: "A",
+		run: func(map[string]string) {
+			axes := v.scene.find("axes")
+			axes.hidden = !axes.hidden
+		},
+	})
+	register(&action{
+		id:       "view.rotate",
+		title:    "Toggle rotation",
+		menu:     "View",
+		shortcut: "R",
+		run:      func(map[string]string) { v.rotating = !v.rotating },
+	})
+	register(&action{
+		id:       "view.reset",
+		title:    "Reset view",
+		menu:     "View",
+		shortcut: "0",
+		run:      func(map[string]string) { v.angle = 0 },
+	})
+}
+
+// loadDataset fetches a dataset from the server and displays it. options
+// is a query string of loader parameters. The load is traced from the
+// request through decoding to uploading the points for rendering.
+func loadDataset(v *viewer, name, options string) (err error) {
+	options = strings.TrimPrefix(options, "?")
+	url := "api/datasets/" + name
+	if options != "" {
+		url += "?" + options
+	}
+	setStatus("Loading %s…", name)
+	s := startSpan("client.load", nil)
+	s.attrs["dataset"] = name
+	defer func() {
+		s.end(err)
+		err = traced(err, s)
+	}()
+	b, err := requestWithin(s, url, map[string]interface{}{})
+	if err != nil {
+		return err
+	}
+	decode := startSpan("client.decode", s)
+	c, err := pointcloud.Decode(bytes.NewReader(b))
+	decode.attrs["bytes"] = len(b)
+	decode.end(err)
+	if err != nil {
+		return err
+	}
+	theStats.stop()
+	theSampling.stop()
+	thePattern.hide()
+	theEmbedding.stop()
+	render := startSpan("client.render", s)
+	render.attrs["points"] = c.Len()
+	v.setCloud(c)
+	render.end(nil)
+	v.source = datasetSource{name, options}
+	setStatus("")
+	theComments.refresh()
+	return nil
+}
+
+// keyName formats a keyboard event the way shortcuts are written: modifiers
+// first ("Ctrl+" also covers the Mac command key), then the key, upper-cased
+// if it is a single character. Shift is only named for non-character keys,
+// since it is already reflected in the character itself.
+func keyName(event js.Value) string {
+	key := event.Get("key").String()
+	var b strings.Builder
+	if event.Get("ctrlKey").Bool() || event.Get("metaKey").Bool() {
+		b.WriteString("Ctrl+")
+	}
+	if event.Get("altKey").Bool() {
+		b.WriteString("Alt+")
+	}
+	if len([]rune(key)) == 1 {
+		b.WriteString(strings.ToUpper(key))
+	} else {
+		if event.Get("shiftKey").Bool() {
+			b.WriteString("Shift+")
+		}
+		b.WriteString(key)
+	}
+	return b.String()
+}
+
+// initShortcuts dispatches key presses to the action with a matching
+// shortcut. Keys typed into text fields are left alone.
+func initShortcuts() {
+	document.Call("addEventListener", "keydown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		event := args[0]
+		switch event.Get("target").Get("tagName").String() {
+		case "INPUT", "TEXTAREA", "SELECT":
+			return nil
+		}
+		name := keyName(event)
+		for _, a := range actions {
+			if a.shortcut == name {
+				event.Call("preventDefault")
+				invoke(a)
+				return nil
+			}
+		}
+		return nil
+	}))
+}
+
+// initMenus builds the menu bar from the registry.
+func initMenus() {
+	bar := document.Call("getElementById", "menubar")
+	menus := map[string]js.Value{}
+	for _, a := range actions {
+		if a.menu == "" {
+			continue
+		}
+		items, ok := menus[a.menu]
+		if !ok {
+			menu := element("div", "menu", "")
+			menu.Call("appendChild", element("button", "menu-title", a.menu))
+			items = element("div", "menu-items", "")
+			menu.Call("appendChild", items)
+			bar.Call("appendChild", menu)
+			menus[a.menu] = items
+		}
+		item := element("button", "menu-item", "")
+		item.Call("appendChild", element("span", "", a.title+ellipsis(a)))
+		item.Call("appendChild", element("span", "shortcut", a.shortcut))
+		a := a
+		item.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			invoke(a)
+			return nil
+		}))
+		items.Call("appendChild", item)
+	}
+}
+
+// ellipsis marks actions that prompt for input before running.
+func ellipsis(a *action) string {
+	if len(a.params) > 0 {
+		return "…"
+	}
+	return ""
+}
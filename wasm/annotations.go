@@ -0,0 +1,101 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// note is a text annotation pinned to a point in data coordinates. Notes
+// are drawn as labels under the data node's "notes" child and are saved in
+// scene files and story slides.
+type note struct {
+	text string
+	at   [3]float64
+}
+
+// noteColor is the color of annotation labels.
+const noteColor = "#ffd54f"
+
+func (v *viewer) addNote(text string, at [3]float64) error {
+	label, err := newTextLabel(v.renderer, text, noteColor, vec3(at))
+	if err != nil {
+		return err
+	}
+	v.notes.add(newNode("note", label))
+	v.noteList = append(v.noteList, note{text, at})
+	return nil
+}
+
+func (v *viewer) clearNotes() {
+	for len(v.notes.children) > 0 {
+		v.notes.remove(v.notes.children[0])
+	}
+	v.noteList = nil
+}
+
+// parsePoint parses "x, y, z" in data coordinates.
+func parsePoint(s string) ([3]float64, error) {
+	var p [3]float64
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) != 3 {
+		return p, fmt.Errorf("point %q: want x, y, z", s)
+	}
+	for k, f := range fields {
+		x, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return p, fmt.Errorf("point %q: %v", s, err)
+		}
+		p[k] = x
+	}
+	return p, nil
+}
+
+// formatPoint is the inverse of parsePoint.
+func formatPoint(p [3]float64) string {
+	return strconv.FormatFloat(p[0], 'g', 4, 64) + ", " + strconv.FormatFloat(p[1], 'g', 4, 64) + ", " + strconv.FormatFloat(p[2], 'g', 4, 64)
+}
+
+func (v *viewer) noteState() []interface{} {
+	var list []interface{}
+	for _, n := range v.noteList {
+		list = append(list, map[string]interface{}{
+			"text": n.text,
+			"at":   []interface{}{n.at[0], n.at[1], n.at[2]},
+		})
+	}
+	return list
+}
+
+func (v *viewer) applyNotes(list []interface{}) error {
+	v.clearNotes()
+	for _, item := range list {
+		n, _ := item.(map[string]interface{})
+		text, _ := n["text"].(string)
+		at, ok := floats(n["at"], 3)
+		if !ok {
+			return fmt.Errorf("note %q: bad position", text)
+		}
+		if err := v.addNote(text, [3]float64{at[0], at[1], at[2]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// floats converts a decoded JSON array of n numbers.
+func floats(value interface{}, n int) ([]float64, bool) {
+	list, ok := value.([]interface{})
+	if !ok || len(list) != n {
+		return nil, false
+	}
+	out := make([]float64, n)
+	for i, x := range list {
+		if out[i], ok = x.(float64); !ok {
+			return nil, false
+		}
+	}
+	return out, true
+}
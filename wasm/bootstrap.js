@@ -0,0 +1,198 @@
+// Starts the WASM client: checks for WebAssembly support,
+// downloads main.wasm with a progress bar, instantiates it (falling back to
+// arrayBuffer instantiation when streaming compilation is rejected, usually
+// because the server sent the wrong MIME type) and reports startup timing.
+// The Go side calls bootstrap.ready() once the viewer is running. Startup
+// failures and uncaught errors are reported to the server. In a snapshot
+// page the client is embedded as base64 and there is no server to report to.
+// Without WebGL the client draws with the Canvas 2D API instead. Browsers
+// without WebAssembly, and pages opened with ?remote, get the
+// server-rendered remote view (remote.js).
+(() => {
+	"use strict";
+
+	const start = performance.now();
+	const timing = {};
+	const mark = (name) => {
+		timing[name] = Math.round(performance.now() - start);
+		performance.mark("threedistvis:" + name);
+	};
+
+	const loading = document.getElementById("loading");
+	const message = loading.querySelector(".message");
+	const progress = loading.querySelector("progress");
+
+	const setMessage = (text) => {
+		message.textContent = text;
+	};
+
+	const embedded = document.getElementById("snapshot-wasm");
+
+	// report sends an error report to the server, which logs it. Reports
+	// are best effort and never raise errors of their own.
+	const report = (context, message) => {
+		if (embedded) {
+			return;
+		}
+		try {
+			fetch("api/client/errors", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ message: String(message), context, url: location.href }),
+				keepalive: true,
+			}).catch(() => {});
+		} catch (e) {
+			// Reporting must not fail the page.
+		}
+	};
+	window.addEventListener("error", (e) => report("uncaught error", e.message));
+	window.addEventListener("unhandledrejection", (e) => report("unhandled rejection", e.reason));
+
+	const fail = (text) => {
+		console.error("startup failed:", text);
+		loading.classList.add("failed");
+		setMessage(text);
+		report("startup", text);
+	};
+
+	const ready = () => {
+		mark("ready");
+		loading.style.display = "none";
+		console.info("startup timing (ms since page script start):", timing);
+	};
+
+	window.bootstrap = { ready, fail, timing };
+
+	const supportsWasm = () => {
+		try {
+			// The smallest valid module: magic number and version.
+			return typeof WebAssembly === "object" &&
+				WebAssembly.validate(new Uint8Array([0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00]));
+		} catch (e) {
+			return false;
+		}
+	};
+
+	const supportsWebGL = () => {
+		try {
+			const canvas = document.createElement("canvas");
+			return !!(window.WebGLRenderingContext && canvas.getContext("webgl"));
+		} catch (e) {
+			return false;
+		}
+	};
+
+	// fetchWithProgress returns a Response whose body updates the progress
+	// bar as it is consumed, so streaming compilation still works.
+	const fetchWithProgress = async (url) => {
+		const resp = await fetch(url);
+		if (!resp.ok) {
+			throw new Error(`${url}: HTTP ${resp.status}`);
+		}
+		const total = Number(resp.headers.get("Content-Length"));
+		if (!resp.body || !total) {
+			progress.removeAttribute("value");
+			return resp;
+		}
+		let loaded = 0;
+		const reader = resp.body.getReader();
+		const body = new ReadableStream({
+			async pull(controller) {
+				const { done, value } = await reader.read();
+				if (done) {
+					mark("downloaded");
+					controller.close();
+					return;
+				}
+				loaded += value.byteLength;
+				progress.value = loaded / total;
+				setMessage(`Downloading viewer… ${(loaded / 1048576).toFixed(1)} of ${(total / 1048576).toFixed(1)} MB`);
+				controller.enqueue(value);
+			},
+		});
+		return new Response(body, { headers: resp.headers });
+	};
+
+	const instantiate = async (url, importObject) => {
+		if (WebAssembly.instantiateStreaming) {
+			try {
+				return await WebAssembly.instantiateStreaming(fetchWithProgress(url), importObject);
+			} catch (e) {
+				if (!(e instanceof TypeError)) {
+					throw e;
+				}
+				console.warn("streaming compilation failed, retrying with arrayBuffer:", e.message);
+			}
+		}
+		const resp = await fetchWithProgress(url);
+		const bytes = await resp.arrayBuffer();
+		setMessage("Compiling viewer…");
+		return WebAssembly.instantiate(bytes, importObject);
+	};
+
+	// instantiateEmbedded decodes and instantiates the client embedded in a
+	// snapshot page.
+	const instantiateEmbedded = (importObject) => {
+		setMessage("Unpacking viewer…");
+		const text = atob(embedded.textContent.trim());
+		const bytes = new Uint8Array(text.length);
+		for (let i = 0; i < text.length; i++) {
+			bytes[i] = text.charCodeAt(i);
+		}
+		mark("downloaded");
+		setMessage("Compiling viewer…");
+		return WebAssembly.instantiate(bytes, importObject);
+	};
+
+	// startRemote switches to the remote view, or fails with reason where
+	// there is no server to render for us.
+	const startRemote = (reason) => {
+		if (embedded) {
+			fail(reason);
+			return;
+		}
+		console.warn("using the remote view:", reason);
+		setMessage("Connecting to the remote view…");
+		const script = document.createElement("script");
+		script.src = "remote.js";
+		script.onload = () => window.remoteView.start({ setMessage, ready, fail });
+		script.onerror = () => fail(reason);
+		document.body.appendChild(script);
+	};
+
+	const run = async () => {
+		if (new URLSearchParams(location.search).has("remote")) {
+			startRemote("The remote view was requested.");
+			return;
+		}
+		if (!supportsWasm()) {
+			startRemote("This browser does not support WebAssembly. Please use a recent version of Chrome, Firefox or Safari.");
+			return;
+		}
+		if (!supportsWebGL()) {
+			console.warn("WebGL is not available; the viewer draws with Canvas 2D, which is slower.");
+		}
+		if (typeof Go !== "function") {
+			fail("The Go runtime (wasm_exec.js) failed to load.");
+			return;
+		}
+		const go = new Go();
+		let result;
+		try {
+			if (embedded) {
+				result = await instantiateEmbedded(go.importObject);
+			} else {
+				setMessage("Downloading viewer…");
+				result = await instantiate("main.wasm", go.importObject);
+			}
+		} catch (e) {
+			fail("Could not load the viewer: " + e.message);
+			return;
+		}
+		mark("instantiated");
+		setMessage("Starting…");
+		go.run(result.instance).catch((e) => fail("The viewer crashed: " + e.message));
+	};
+
+	run();
+})();
@@ -0,0 +1,274 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/geom"
+)
+
+// canvasMaxPoints bounds the points drawn per point set without WebGL;
+// larger sets are drawn from an evenly spaced subset.
+const canvasMaxPoints = 50000
+
+// canvas2D draws the scene with the Canvas 2D API when WebGL is not
+// available. Primitives keep their data on the CPU and, instead of drawing,
+// add projected shapes to the frame. The shapes are sorted by depth and
+// painted back to front, so nearer geometry covers farther geometry as it
+// would with a depth buffer. Colors go through the color vision deficiency
+// simulation one at a time, since there is no post-processing pass.
+type canvas2D struct {
+	ctx           js.Value
+	cvd           colormap.Deficiency
+	width, height float32
+	shapes        []shape
+	styles        map[uint32]js.Value // CSS colors by packed rgb
+}
+
+type shapeKind uint8
+
+const (
+	dotShape shapeKind = iota
+	segmentShape
+	triangleShape
+	discShape
+	labelShape
+)
+
+// shape is a projected primitive: up to three vertices in pixels, with the
+// depth of its center in normalized device coordinates (smaller is nearer).
+type shape struct {
+	kind  shapeKind
+	depth float32
+	x, y  [3]float32
+	size  float32 // dot side or disc radius in pixels
+	color uint32  // packed 8-bit rgb
+	label *textLabel
+}
+
+func newCanvas2D(ctx js.Value) *canvas2D {
+	return &canvas2D{ctx: ctx, styles: map[uint32]js.Value{}}
+}
+
+// begin clears the canvas for a frame of the given size.
+func (c *canvas2D) begin(width, height int) {
+	c.width, c.height = float32(width), float32(height)
+	c.shapes = c.shapes[:0]
+	c.ctx.Set("fillStyle", "#000")
+	c.ctx.Call("fillRect", 0, 0, width, height)
+}
+
+// project maps p through mvp to pixels. It reports false for points
+// outside the depth range, which WebGL would clip.
+func (c *canvas2D) project(mvp geom.Mat4, p geom.Vec3) (x, y, z float32, ok bool) {
+	q := mvp.Apply(p)
+	if q[2] < -1 || q[2] > 1 {
+		return 0, 0, 0, false
+	}
+	return (q[0] + 1) / 2 * c.width, (1 - q[1]) / 2 * c.height, q[2], true
+}
+
+// pack returns the 8-bit rgb of a color as seen with the current
+// deficiency.
+func (c *canvas2D) pack(r, g, b float32) uint32 {
+	rgb := colormap.RGB{R: float64(r), G: float64(g), B: float64(b)}
+	if c.cvd != colormap.NormalVision {
+		rgb = colormap.Simulate(rgb, c.cvd)
+	}
+	return uint32(to8(rgb.R))<<16 | uint32(to8(rgb.G))<<8 | uint32(to8(rgb.B))
+}
+
+func to8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v*255))))
+}
+
+// style returns the CSS color of packed rgb, caching the JS strings since
+// most frames reuse the same colors.
+func (c *canvas2D) style(rgb uint32) js.Value {
+	s, ok := c.styles[rgb]
+	if !ok {
+		if len(c.styles) >= 1<<16 {
+			c.styles = map[uint32]js.Value{}
+		}
+		s = js.ValueOf(fmt.Sprintf("#%06x", rgb))
+		c.styles[rgb] = s
+	}
+	return s
+}
+
+// points adds xyz-interleaved positions with rgb-interleaved colors as
+// squares of the given side.
+func (c *canvas2D) points(mvp geom.Mat4, positions, colors []float32, size float32) {
+	n := len(positions) / 3
+	step := (n + canvasMaxPoints - 1) / canvasMaxPoints
+	for i := 0; i < n && 3*i+2 < len(colors); i += step {
+		x, y, z, ok := c.project(mvp, geom.Vec3{positions[3*i], positions[3*i+1], positions[3*i+2]})
+		if !ok {
+			continue
+		}
+		c.shapes = append(c.shapes, shape{
+			kind:  dotShape,
+			depth: z,
+			x:     [3]float32{x},
+			y:     [3]float32{y},
+			size:  size,
+			color: c.pack(colors[3*i], colors[3*i+1], colors[3*i+2]),
+		})
+	}
+}
+
+// lines adds segments, two vertices each, colored by their first vertex.
+func (c *canvas2D) lines(mvp geom.Mat4, positions, colors []float32) {
+	for i := 0; i+5 < len(positions) && i+2 < len(colors); i += 6 {
+		x0, y0, z0, ok0 := c.project(mvp, geom.Vec3{positions[i], positions[i+1], positions[i+2]})
+		x1, y1, z1, ok1 := c.project(mvp, geom.Vec3{positions[i+3], positions[i+4], positions[i+5]})
+		if !ok0 || !ok1 {
+			continue
+		}
+		c.shapes = append(c.shapes, shape{
+			kind:  segmentShape,
+			depth: (z0 + z1) / 2,
+			x:     [3]float32{x0, x1},
+			y:     [3]float32{y0, y1},
+			color: c.pack(colors[i], colors[i+1], colors[i+2]),
+		})
+	}
+}
+
+// triangles adds shaded triangles, lit by a headlight from both sides as
+// in the WebGL mesh shader and filled with the mean of their vertex
+// colors.
+func (c *canvas2D) triangles(mvp, modelView geom.Mat4, positions, normals, colors []float32) {
+	for i := 0; i+8 < len(positions) && i+8 < len(colors) && i+8 < len(normals); i += 9 {
+		var s shape
+		var rgb [3]float32
+		ok := true
+		for k := 0; k < 3; k++ {
+			j := i + 3*k
+			x, y, z, in := c.project(mvp, geom.Vec3{positions[j], positions[j+1], positions[j+2]})
+			ok = ok && in
+			s.x[k], s.y[k] = x, y
+			s.depth += z / 3
+			n := direction(modelView, geom.Vec3{normals[j], normals[j+1], normals[j+2]}).Normalize()
+			light := 0.3 + 0.7*float32(math.Abs(float64(n[2])))
+			for ch := range rgb {
+				rgb[ch] += colors[j+ch] * light / 3
+			}
+		}
+		if !ok {
+			continue
+		}
+		s.kind = triangleShape
+		s.color = c.pack(rgb[0], rgb[1], rgb[2])
+		c.shapes = append(c.shapes, s)
+	}
+}
+
+// direction transforms the vector v by the linear part of m.
+func direction(m geom.Mat4, v geom.Vec3) geom.Vec3 {
+	return geom.Vec3{
+		m[0]*v[0] + m[4]*v[1] + m[8]*v[2],
+		m[1]*v[0] + m[5]*v[1] + m[9]*v[2],
+		m[2]*v[0] + m[6]*v[1] + m[10]*v[2],
+	}
+}
+
+// discs adds glyph instances as discs of their projected size, which is
+// exact for sphere glyphs.
+func (c *canvas2D) discs(mvp geom.Mat4, offsets, scales, colors []float32) {
+	for i, scale := range scales {
+		o := geom.Vec3{offsets[3*i], offsets[3*i+1], offsets[3*i+2]}
+		x, y, z, ok := c.project(mvp, o)
+		if !ok {
+			continue
+		}
+		// The view turns about the vertical axis, so a vertical offset
+		// keeps its length on screen.
+		_, top, _, _ := c.project(mvp, o.Add(geom.Vec3{0, scale, 0}))
+		c.shapes = append(c.shapes, shape{
+			kind:  discShape,
+			depth: z,
+			x:     [3]float32{x},
+			y:     [3]float32{y},
+			size:  float32(math.Abs(float64(y - top))),
+			color: c.pack(colors[3*i], colors[3*i+1], colors[3*i+2]),
+		})
+	}
+}
+
+// label adds a text label at its anchor.
+func (c *canvas2D) label(mvp geom.Mat4, l *textLabel) {
+	x, y, z, ok := c.project(mvp, l.anchor)
+	if !ok {
+		return
+	}
+	c.shapes = append(c.shapes, shape{kind: labelShape, depth: z, x: [3]float32{x}, y: [3]float32{y}, label: l})
+}
+
+// end paints the frame's shapes back to front.
+func (c *canvas2D) end() {
+	sort.SliceStable(c.shapes, func(i, j int) bool { return c.shapes[i].depth > c.shapes[j].depth })
+	ctx := c.ctx
+	ctx.Set("lineWidth", 1)
+	ctx.Set("font", labelFont)
+	ctx.Set("textBaseline", "middle")
+	// Setting a style is a call into JavaScript; skip it while the color
+	// stays the same.
+	fill, stroke := uint32(1<<24), uint32(1<<24)
+	setFill := func(rgb uint32) {
+		if rgb != fill {
+			ctx.Set("fillStyle", c.style(rgb))
+			fill = rgb
+		}
+	}
+	setStroke := func(rgb uint32) {
+		if rgb != stroke {
+			ctx.Set("strokeStyle", c.style(rgb))
+			stroke = rgb
+		}
+	}
+	for i := range c.shapes {
+		s := &c.shapes[i]
+		switch s.kind {
+		case dotShape:
+			setFill(s.color)
+			ctx.Call("fillRect", s.x[0]-s.size/2, s.y[0]-s.size/2, s.size, s.size)
+		case segmentShape:
+			setStroke(s.color)
+			ctx.Call("beginPath")
+			ctx.Call("moveTo", s.x[0], s.y[0])
+			ctx.Call("lineTo", s.x[1], s.y[1])
+			ctx.Call("stroke")
+		case triangleShape:
+			// Stroking the edges too hides the seams antialiasing
+			// leaves between neighbouring triangles.
+			setFill(s.color)
+			setStroke(s.color)
+			ctx.Call("beginPath")
+			ctx.Call("moveTo", s.x[0], s.y[0])
+			ctx.Call("lineTo", s.x[1], s.y[1])
+			ctx.Call("lineTo", s.x[2], s.y[2])
+			ctx.Call("closePath")
+			ctx.Call("fill")
+			ctx.Call("stroke")
+		case discShape:
+			setFill(s.color)
+			ctx.Call("beginPath")
+			ctx.Call("arc", s.x[0], s.y[0], s.size, 0, 2*math.Pi)
+			ctx.Call("fill")
+		case labelShape:
+			if rgb, err := colormap.ParseHex(s.label.color); err == nil {
+				ctx.Set("fillStyle", c.style(c.pack(float32(rgb.R), float32(rgb.G), float32(rgb.B))))
+			} else {
+				ctx.Set("fillStyle", s.label.color)
+			}
+			fill = 1 << 24
+			ctx.Call("fillText", s.label.text, s.x[0]+2, s.y[0])
+		}
+	}
+}
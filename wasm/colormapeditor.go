@@ -0,0 +1,238 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+)
+
+// colormapEditor is a panel for building colormaps from control points,
+// choosing the interpolation space, discrete bins and a diverging center.
+// Applied colormaps become user colormaps, saved in the preferences.
+type colormapEditor struct {
+	v     *viewer
+	root  js.Value
+	draft *colormap.Colormap
+
+	name, space, bins, diverging, center js.Value
+	preview, stops, errLine              js.Value
+}
+
+var theEditor *colormapEditor
+
+func initColormapEditor(v *viewer) {
+	e := &colormapEditor{v: v, root: document.Call("getElementById", "colormap-editor")}
+	theEditor = e
+	e.root.Call("appendChild", element("div", "panel-title", "Colormap editor"))
+
+	field := func(label string, input js.Value) js.Value {
+		row := element("label", "panel-row", label)
+		row.Call("appendChild", input)
+		e.root.Call("appendChild", row)
+		input.Call("addEventListener", "input", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			e.readForm()
+			return nil
+		}))
+		return input
+	}
+	e.name = field("Name", input("text", ""))
+	e.space = element("select", "", "")
+	for _, s := range []colormap.Space{colormap.SpaceOKLab, colormap.SpaceLab, colormap.SpaceRGB} {
+		opt := element("option", "", string(s))
+		opt.Set("value", string(s))
+		e.space.Call("appendChild", opt)
+	}
+	field("Interpolation", e.space)
+	e.bins = field("Bins (0 = continuous)", input("number", "0"))
+	e.bins.Set("min", 0)
+	e.diverging = field("Diverging", input("checkbox", ""))
+	e.center = field("Center value", input("number", "0"))
+	e.center.Set("step", "any")
+
+	e.preview = element("div", "legend-gradient", "")
+	e.root.Call("appendChild", e.preview)
+	e.stops = element("div", "", "")
+	e.root.Call("appendChild", e.stops)
+	e.errLine = element("div", "legend-warning", "")
+	e.root.Call("appendChild", e.errLine)
+
+	buttons := element("div", "panel-buttons", "")
+	e.root.Call("appendChild", buttons)
+	button := func(label string, fn func()) {
+		b := element("button", "", label)
+		b.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			fn()
+			return nil
+		}))
+		buttons.Call("appendChild", b)
+	}
+	button("Add stop", e.addStop)
+	button("Import…", func() { importColormap(v, e.edit) })
+	button("Export", func() { exportColormap(e.draft) })
+	button("Apply", e.apply)
+	button("Close", e.hide)
+}
+
+func input(kind, value string) js.Value {
+	in := element("input", "", "")
+	in.Set("type", kind)
+	in.Set("value", value)
+	return in
+}
+
+// edit opens the editor on a copy of m.
+func (e *colormapEditor) edit(m *colormap.Colormap) {
+	draft := *m
+	draft.Stops = append([]colormap.Stop(nil), m.Stops...)
+	if draft.Space == "" {
+		draft.Space = colormap.SpaceRGB
+	}
+	if _, builtin := colormap.Get(draft.Name); builtin {
+		draft.Name += "-custom"
+	}
+	e.draft = &draft
+	e.name.Set("value", draft.Name)
+	e.space.Set("value", string(draft.Space))
+	e.bins.Set("value", draft.Bins)
+	e.diverging.Set("checked", draft.Diverging)
+	e.center.Set("value", draft.Center)
+	e.renderStops()
+	e.update()
+	e.root.Get("style").Set("display", "block")
+}
+
+func (e *colormapEditor) hide() {
+	e.root.Get("style").Set("display", "none")
+}
+
+// renderStops rebuilds the control point rows from the draft.
+func (e *colormapEditor) renderStops() {
+	e.stops.Set("innerHTML", "")
+	for i := range e.draft.Stops {
+		i := i
+		s := e.draft.Stops[i]
+		row := element("div", "panel-row", "")
+		pos := input("number", strconv.FormatFloat(s.Pos, 'f', -1, 64))
+		pos.Set("min", 0)
+		pos.Set("max", 1)
+		pos.Set("step", 0.01)
+		color := input("color", s.Color.Hex())
+		remove := element("button", "", "×")
+		row.Call("appendChild", pos)
+		row.Call("appendChild", color)
+		row.Call("appendChild", remove)
+		onInput := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			p, err := strconv.ParseFloat(pos.Get("value").String(), 64)
+			if err == nil {
+				e.draft.Stops[i].Pos = p
+			}
+			if c, err := colormap.ParseHex(color.Get("value").String()); err == nil {
+				e.draft.Stops[i].Color = c
+			}
+			e.update()
+			return nil
+		})
+		pos.Call("addEventListener", "input", onInput)
+		color.Call("addEventListener", "input", onInput)
+		remove.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			e.draft.Stops = append(e.draft.Stops[:i], e.draft.Stops[i+1:]...)
+			e.renderStops()
+			e.update()
+			return nil
+		}))
+		e.stops.Call("appendChild", row)
+	}
+}
+
+// addStop inserts a stop in the middle of the widest gap.
+func (e *colormapEditor) addStop() {
+	stops := e.draft.Stops
+	at, pos := len(stops), 1.0
+	if len(stops) >= 2 {
+		best := -1.0
+		for i := 1; i < len(stops); i++ {
+			if gap := stops[i].Pos - stops[i-1].Pos; gap > best {
+				best, at, pos = gap, i, (stops[i].Pos+stops[i-1].Pos)/2
+			}
+		}
+	}
+	s := colormap.Stop{Pos: pos, Color: e.draft.At(pos)}
+	e.draft.Stops = append(stops[:at], append([]colormap.Stop{s}, stops[at:]...)...)
+	e.renderStops()
+	e.update()
+}
+
+// readForm copies the scalar fields into the draft.
+func (e *colormapEditor) readForm() {
+	e.draft.Name = strings.TrimSpace(e.name.Get("value").String())
+	e.draft.Space = colormap.Space(e.space.Get("value").String())
+	e.draft.Bins, _ = strconv.Atoi(e.bins.Get("value").String())
+	e.draft.Diverging = e.diverging.Get("checked").Bool()
+	e.draft.Center, _ = strconv.ParseFloat(e.center.Get("value").String(), 64)
+	e.update()
+}
+
+// update refreshes the preview and validation message.
+func (e *colormapEditor) update() {
+	if err := e.draft.Validate(); err != nil {
+		e.errLine.Set("textContent", err.Error())
+		return
+	}
+	e.errLine.Set("textContent", "")
+	var stops []string
+	for i := 0; i <= 64; i++ {
+		t := float64(i) / 64
+		stops = append(stops, fmt.Sprintf("%s %.1f%%", e.draft.At(t).Hex(), t*100))
+	}
+	e.preview.Get("style").Set("background", "linear-gradient(to right, "+strings.Join(stops, ", ")+")")
+}
+
+// apply makes the draft the current colormap and saves it.
+func (e *colormapEditor) apply() {
+	e.readForm()
+	if err := e.draft.Validate(); err != nil {
+		return
+	}
+	m := *e.draft
+	m.Stops = append([]colormap.Stop(nil), e.draft.Stops...)
+	if err := e.v.addColormap(&m); err != nil {
+		e.errLine.Set("textContent", err.Error())
+		return
+	}
+	e.v.cmap = &m
+	e.v.recolor()
+	savePrefs(e.v)
+}
+
+// importColormap reads a colormap definition from a JSON file and passes it
+// to use.
+func importColormap(v *viewer, use func(*colormap.Colormap)) {
+	pickFile(".json,application/json", func(name, text string) {
+		var def interface{}
+		if err := decodeJSON([]byte(text), &def); err != nil {
+			setStatus("%s: %v", name, err)
+			return
+		}
+		m, err := colormap.FromJSON(def)
+		if err != nil {
+			setStatus("%s: %v", name, err)
+			return
+		}
+		use(m)
+	})
+}
+
+// exportColormap downloads m as a JSON definition.
+func exportColormap(m *colormap.Colormap) {
+	b, err := encodeJSON(m.ToJSON())
+	if err != nil {
+		setStatus("Export failed: %v", err)
+		return
+	}
+	downloadBytes(m.Name+".json", "application/json", b)
+}
@@ -0,0 +1,416 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/markdown"
+)
+
+// commentsPanel lists the review threads on the current dataset and lets
+// users start threads, reply and resolve them. Threads are kept on the
+// server; threads anchored to a point or location are also marked in the
+// scene with their number:
+//
+//	data
+//	└── comments             one label per open thread
+type commentsPanel struct {
+	v    *viewer
+	root js.Value
+	list js.Value
+
+	author, kind, target, text js.Value // new thread form
+	showResolved               js.Value
+
+	node    *node
+	dataset string                   // key of the loaded threads
+	threads []map[string]interface{} // as returned by the server
+}
+
+// commentColor is the color of comment markers.
+const commentColor = "#4fc3f7"
+
+// commentAuthor is the name comments are posted under, saved with the
+// preferences.
+var commentAuthor string
+
+var theComments *commentsPanel
+
+func initComments(v *viewer) {
+	p := &commentsPanel{v: v, root: document.Call("getElementById", "comments-panel")}
+	theComments = p
+	p.node = v.data.add(newNode("comments", nil))
+
+	p.root.Call("appendChild", element("div", "panel-title", "Comments"))
+	row := func(label string, control js.Value) js.Value {
+		r := element("label", "panel-row", label)
+		r.Call("appendChild", control)
+		p.root.Call("appendChild", r)
+		return r
+	}
+	p.author = input("text", commentAuthor)
+	p.author.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		commentAuthor = strings.TrimSpace(p.author.Get("value").String())
+		savePrefs(v)
+		return nil
+	}))
+	row("Your name", p.author)
+	p.kind = element("select", "", "")
+	for _, kind := range []string{"point", "location", "view"} {
+		opt := element("option", "", kind)
+		opt.Set("value", kind)
+		p.kind.Call("appendChild", opt)
+	}
+	row("Anchor", p.kind)
+	p.target = input("text", "")
+	p.target.Set("placeholder", "point ID or x, y, z")
+	targetRow := row("At", p.target)
+	p.kind.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		display := "flex"
+		if p.kind.Get("value").String() == "view" {
+			display = "none"
+		}
+		targetRow.Get("style").Set("display", display)
+		return nil
+	}))
+	p.text = element("textarea", "comment-text", "")
+	p.text.Set("placeholder", "Comment (Markdown)")
+	p.text.Set("rows", 3)
+	p.root.Call("appendChild", p.text)
+
+	buttons := element("div", "panel-buttons", "")
+	p.root.Call("appendChild", buttons)
+	button := func(label string, fn func()) {
+		b := element("button", "", label)
+		b.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			go fn()
+			return nil
+		}))
+		buttons.Call("appendChild", b)
+	}
+	button("Post", p.post)
+	button("Refresh", p.refresh)
+	button("Close", p.close)
+
+	p.showResolved = input("checkbox", "")
+	p.showResolved.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.render()
+		return nil
+	}))
+	row("Show resolved", p.showResolved)
+
+	// Thread buttons are handled here rather than with a listener each,
+	// since the list is rebuilt on every change.
+	p.list = element("div", "comment-list", "")
+	p.list.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		b := args[0].Get("target").Call("closest", "button")
+		if b.IsNull() {
+			return nil
+		}
+		thread := b.Call("closest", ".comment")
+		id := thread.Get("dataset").Get("id").String()
+		switch b.Get("dataset").Get("action").String() {
+		case "goto":
+			p.goTo(id)
+		case "resolve":
+			go p.resolve(id, true)
+		case "reopen":
+			go p.resolve(id, false)
+		case "reply":
+			text := thread.Call("querySelector", "textarea").Get("value").String()
+			go p.reply(id, text)
+		}
+		return nil
+	}))
+	p.root.Call("appendChild", p.list)
+}
+
+func (p *commentsPanel) open() {
+	p.root.Get("style").Set("display", "block")
+	p.refresh()
+}
+
+func (p *commentsPanel) close() {
+	p.root.Get("style").Set("display", "none")
+}
+
+// datasetKey identifies the current dataset to the server.
+func (p *commentsPanel) datasetKey() string {
+	key := p.v.source.name
+	if p.v.source.options != "" {
+		key += "?" + p.v.source.options
+	}
+	return key
+}
+
+// refresh fetches the threads on the current dataset. It blocks.
+func (p *commentsPanel) refresh() {
+	key := p.datasetKey()
+	if offline || p.v.source.name == "" {
+		p.dataset, p.threads = key, nil
+		p.render()
+		return
+	}
+	b, err := fetchBytes("api/comments/?dataset=" + url.QueryEscape(key))
+	if err != nil {
+		reportError("Comments", err)
+		return
+	}
+	var threads []interface{}
+	if err := decodeJSON(b, &threads); err != nil {
+		reportError("Comments", err)
+		return
+	}
+	p.dataset, p.threads = key, nil
+	for _, t := range threads {
+		if m, ok := t.(map[string]interface{}); ok {
+			p.threads = append(p.threads, m)
+		}
+	}
+	p.render()
+}
+
+// post starts a thread from the form. It blocks.
+func (p *commentsPanel) post() {
+	if commentAuthor == "" {
+		setStatus("Enter your name to comment")
+		return
+	}
+	a := map[string]interface{}{"kind": p.kind.Get("value").String()}
+	target := strings.TrimSpace(p.target.Get("value").String())
+	switch a["kind"] {
+	case "point":
+		id, err := strconv.ParseUint(target, 10, 32)
+		if err != nil {
+			setStatus("Point ID %q: not a number", target)
+			return
+		}
+		a["point"] = float64(id)
+	case "location":
+		at, err := parsePoint(target)
+		if err != nil {
+			setStatus("%v", err)
+			return
+		}
+		a["at"] = []interface{}{at[0], at[1], at[2]}
+	case "view":
+		a["view"] = p.v.captureView()
+	}
+	t, err := p.send("POST", "", map[string]interface{}{
+		"dataset": p.datasetKey(),
+		"anchor":  a,
+		"author":  commentAuthor,
+		"text":    p.text.Get("value").String(),
+	})
+	if err != nil {
+		reportError("Comment failed", err)
+		return
+	}
+	p.text.Set("value", "")
+	p.threads = append(p.threads, t)
+	p.render()
+}
+
+func (p *commentsPanel) reply(id, text string) {
+	if commentAuthor == "" {
+		setStatus("Enter your name to comment")
+		return
+	}
+	t, err := p.send("POST", id+"/replies", map[string]interface{}{"author": commentAuthor, "text": text})
+	if err != nil {
+		reportError("Reply failed", err)
+		return
+	}
+	p.replace(t)
+}
+
+func (p *commentsPanel) resolve(id string, resolved bool) {
+	t, err := p.send("PATCH", id, map[string]interface{}{"resolved": resolved})
+	if err != nil {
+		reportError("Comments", err)
+		return
+	}
+	p.replace(t)
+}
+
+// send makes a comments API request and returns the changed thread.
+func (p *commentsPanel) send(method, path string, body map[string]interface{}) (map[string]interface{}, error) {
+	if offline {
+		return nil, fmt.Errorf("comments are not available offline")
+	}
+	b, err := encodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	if b, err = sendJSON(method, "api/comments/"+path, b); err != nil {
+		return nil, err
+	}
+	var t map[string]interface{}
+	if err := decodeJSON(b, &t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (p *commentsPanel) replace(t map[string]interface{}) {
+	for i, old := range p.threads {
+		if old["id"] == t["id"] {
+			p.threads[i] = t
+		}
+	}
+	p.render()
+}
+
+func (p *commentsPanel) find(id string) map[string]interface{} {
+	for _, t := range p.threads {
+		if t["id"] == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// position returns where a thread is anchored in data coordinates, if it
+// is anchored to a point of the current cloud or to a location.
+func (p *commentsPanel) position(t map[string]interface{}) ([3]float64, bool) {
+	a, _ := t["anchor"].(map[string]interface{})
+	switch a["kind"] {
+	case "point":
+		id, _ := a["point"].(float64)
+		c := p.v.cloud
+		for i := 0; i < c.Len(); i++ {
+			if c.ID(i) == uint32(id) {
+				x, y, z := c.Point(i)
+				return [3]float64{float64(x), float64(y), float64(z)}, true
+			}
+		}
+	case "location":
+		if at, ok := floats(a["at"], 3); ok {
+			return [3]float64{at[0], at[1], at[2]}, true
+		}
+	}
+	return [3]float64{}, false
+}
+
+func anchorLabel(t map[string]interface{}) string {
+	a, _ := t["anchor"].(map[string]interface{})
+	switch a["kind"] {
+	case "point":
+		id, _ := a["point"].(float64)
+		return fmt.Sprintf("point %d", int64(id))
+	case "location":
+		if at, ok := floats(a["at"], 3); ok {
+			return "at " + formatPoint([3]float64{at[0], at[1], at[2]})
+		}
+	case "view":
+		return "view"
+	}
+	return ""
+}
+
+// render rebuilds the thread list and the scene markers. Threads are
+// numbered in creation order, resolved ones included, so numbers stay put
+// when threads are resolved.
+func (p *commentsPanel) render() {
+	for len(p.node.children) > 0 {
+		p.node.remove(p.node.children[0])
+	}
+	p.list.Set("innerHTML", "")
+	showResolved := p.showResolved.Get("checked").Bool()
+	for i, t := range p.threads {
+		resolved, _ := t["resolved"].(bool)
+		if resolved && !showResolved {
+			continue
+		}
+		number := "#" + strconv.Itoa(i+1)
+		if at, ok := p.position(t); ok && !resolved {
+			if label, err := newTextLabel(p.v.renderer, number, commentColor, vec3(at)); err == nil {
+				p.node.add(newNode(number, label))
+			}
+		}
+		p.list.Call("appendChild", p.threadElement(t, number, resolved))
+	}
+	if p.list.Get("childElementCount").Int() == 0 {
+		p.list.Call("appendChild", element("div", "comment-meta", "No comments on this dataset."))
+	}
+}
+
+func (p *commentsPanel) threadElement(t map[string]interface{}, number string, resolved bool) js.Value {
+	id, _ := t["id"].(string)
+	el := element("div", "comment", "")
+	if resolved {
+		el.Set("className", "comment resolved")
+	}
+	el.Get("dataset").Set("id", id)
+	post := func(m map[string]interface{}, prefix string) {
+		author, _ := m["author"].(string)
+		created, _ := m["created"].(string)
+		if len(created) >= 16 {
+			created = strings.Replace(created[:16], "T", " ", 1)
+		}
+		el.Call("appendChild", element("div", "comment-meta", prefix+author+" · "+created))
+		body := element("div", "comment-body", "")
+		text, _ := m["text"].(string)
+		body.Set("innerHTML", markdown.ToHTML(text))
+		el.Call("appendChild", body)
+	}
+	post(t, number+" · "+anchorLabel(t)+" · ")
+	replies, _ := t["replies"].([]interface{})
+	for _, r := range replies {
+		if m, ok := r.(map[string]interface{}); ok {
+			post(m, "↳ ")
+		}
+	}
+	buttons := element("div", "panel-buttons", "")
+	button := func(label, action string) {
+		b := element("button", "", label)
+		b.Get("dataset").Set("action", action)
+		buttons.Call("appendChild", b)
+	}
+	if a, _ := t["anchor"].(map[string]interface{}); a["kind"] == "view" {
+		button("Show view", "goto")
+	} else if _, ok := p.position(t); ok {
+		button("Show", "goto")
+	}
+	if resolved {
+		button("Reopen", "reopen")
+	} else {
+		reply := element("textarea", "comment-text", "")
+		reply.Set("placeholder", "Reply")
+		reply.Set("rows", 2)
+		el.Call("appendChild", reply)
+		button("Reply", "reply")
+		button("Resolve", "resolve")
+	}
+	el.Call("appendChild", buttons)
+	return el
+}
+
+// goTo shows what a thread is about: its view, or a box around its point
+// or location.
+func (p *commentsPanel) goTo(id string) {
+	t := p.find(id)
+	if t == nil {
+		return
+	}
+	if a, _ := t["anchor"].(map[string]interface{}); a["kind"] == "view" {
+		if view, ok := a["view"].(map[string]interface{}); ok {
+			angle, rotating := p.v.applyView(view)
+			p.v.angle, p.v.rotating = angle, rotating
+		}
+		return
+	}
+	at, ok := p.position(t)
+	if !ok {
+		return
+	}
+	// A box 6% of the view across.
+	r := 0.03 / float64(p.v.scale)
+	p.v.setHighlight([3]float64{at[0] - r, at[1] - r, at[2] - r}, [3]float64{at[0] + r, at[1] + r, at[2] + r})
+	p.v.rotating = false
+}
@@ -0,0 +1,260 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// embeddingPanel shows a UMAP or Isomap embedding of the current dataset
+// converging. The server computes it and pushes intermediate layouts as
+// server-sent events; each replaces the positions of the displayed points,
+// which keep the attributes of the points they came from.
+type embeddingPanel struct {
+	v          *viewer
+	root, body js.Value
+	events     js.Value // EventSource while embedding
+	handlers   map[string]js.Func
+
+	base     *pointcloud.Cloud // the dataset being embedded
+	embedded *pointcloud.Cloud // displayed embedding, or nil
+	pending  *pointcloud.Cloud // embedding awaiting its first layout
+	method   string
+	progress map[string]interface{}
+	finished bool
+}
+
+var theEmbedding *embeddingPanel
+
+// embeddingMethods are the methods offered, with their titles.
+var embeddingMethods = map[string]string{"umap": "UMAP", "isomap": "Isomap"}
+
+// embeddingPhases describe the phases the server reports.
+var embeddingPhases = map[string]string{
+	"neighbors": "Finding nearest neighbors",
+	"connect":   "Joining components",
+	"geodesics": "Measuring geodesic distances",
+	"scaling":   "Scaling",
+	"layout":    "Laying out",
+}
+
+func initEmbeddingPanel(v *viewer) {
+	p := &embeddingPanel{v: v, root: document.Call("getElementById", "embedding-panel")}
+	theEmbedding = p
+	p.root.Call("appendChild", element("div", "panel-title", "Embedding"))
+	p.body = element("div", "", "")
+	p.root.Call("appendChild", p.body)
+	buttons := element("div", "panel-buttons", "")
+	stop := element("button", "", "Close")
+	stop.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.stop()
+		return nil
+	}))
+	buttons.Call("appendChild", stop)
+	p.root.Call("appendChild", buttons)
+
+	event := func(handle func(map[string]interface{})) js.Func {
+		return js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			var data map[string]interface{}
+			if err := decodeJSON([]byte(args[0].Get("data").String()), &data); err != nil {
+				return nil
+			}
+			handle(data)
+			return nil
+		})
+	}
+	p.handlers = map[string]js.Func{
+		"start":    event(p.onStart),
+		"progress": event(p.onProgress),
+		"layout":   event(p.onLayout),
+		"done":     event(func(map[string]interface{}) { p.finish("") }),
+		"failed":   event(func(data map[string]interface{}) { p.finish(fmt.Sprint(data["error"])) }),
+		// The connection failed or dropped. EventSource would reconnect
+		// and start the embedding over, so close it instead.
+		"error": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if p.events.Truthy() && !p.finished {
+				p.finish("the connection to the server was lost")
+			}
+			return nil
+		}),
+	}
+}
+
+// start asks the server to embed the current dataset with method, using
+// the given features, sample size and neighbors, any of which may be
+// empty for the server's default, and shows the layouts as they come.
+// Embedding an embedding embeds its dataset again.
+func (p *embeddingPanel) start(method, features, points, neighbors string) error {
+	src := p.v.source
+	if src.name == "" {
+		return errors.New("load a dataset first")
+	}
+	if _, ok := embeddingMethods[method]; !ok {
+		return fmt.Errorf("unknown method %q", method)
+	}
+	base := p.base
+	if p.embedded == nil || p.v.cloud != p.embedded {
+		base = p.v.cloud
+	}
+	query := url.Values{"method": {method}}
+	for key, value := range map[string]string{"options": src.options, "features": features, "points": points, "neighbors": neighbors} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	p.stop()
+	theStats.stop()
+	theSampling.stop()
+	thePattern.hide()
+	p.base, p.method = base, method
+	p.finished = false
+	p.progress = map[string]interface{}{"phase": "starting"}
+	p.events = js.Global().Get("EventSource").New("api/embed/" + src.name + "?" + query.Encode())
+	for name, h := range p.handlers {
+		p.events.Call("addEventListener", name, h)
+	}
+	p.render()
+	p.root.Get("style").Set("display", "block")
+	return nil
+}
+
+// stop stops the embedding, if one is running, and closes the panel. The
+// points stay where the last layout put them.
+func (p *embeddingPanel) stop() {
+	if p.events.Truthy() {
+		p.events.Call("close")
+		p.events = js.Undefined()
+	}
+	p.pending = nil
+	p.root.Get("style").Set("display", "none")
+}
+
+// finish closes the connection after the server is done or has failed
+// with msg.
+func (p *embeddingPanel) finish(msg string) {
+	if p.events.Truthy() {
+		p.events.Call("close")
+		p.events = js.Undefined()
+	}
+	p.finished = true
+	if msg != "" {
+		p.progress = map[string]interface{}{"phase": "failed", "error": msg}
+		reportError(embeddingMethods[p.method]+" failed", errors.New(msg))
+	} else {
+		p.progress["phase"] = "done"
+	}
+	p.render()
+}
+
+// onStart prepares the cloud of the embedded points: the sampled points of
+// the dataset with its attributes, and its coordinates as further
+// attributes.
+func (p *embeddingPanel) onStart(data map[string]interface{}) {
+	base := p.base
+	var indices []int
+	if list, ok := data["indices"]; ok {
+		for _, i := range numbers(list) {
+			indices = append(indices, int(i))
+		}
+	} else {
+		for i := 0; i < base.Len(); i++ {
+			indices = append(indices, i)
+		}
+	}
+	for _, i := range indices {
+		if i < 0 || i >= base.Len() {
+			p.finish("the server sampled points the dataset does not have")
+			return
+		}
+	}
+	c := pointcloud.New(embeddingMethods[p.method]+" of "+base.Name, len(indices))
+	for _, a := range base.Attributes {
+		values := make([]float32, len(indices))
+		for j, i := range indices {
+			values[j] = a.Values[i]
+		}
+		c.SetAttribute(a.Name, values)
+	}
+	for k, axis := range []string{"x", "y", "z"} {
+		values := make([]float32, len(indices))
+		for j, i := range indices {
+			values[j] = base.Positions[3*i+k]
+		}
+		c.SetAttribute("data "+axis, values)
+	}
+	p.pending = c
+}
+
+func (p *embeddingPanel) onProgress(data map[string]interface{}) {
+	p.progress = data
+	p.render()
+}
+
+// onLayout moves the embedded points to a new layout. The first layout
+// replaces the dataset with the embedding, keeping the coloring.
+func (p *embeddingPanel) onLayout(data map[string]interface{}) {
+	p.progress = data
+	p.render()
+	c := p.embedded
+	if p.pending != nil {
+		c = p.pending
+	}
+	s, _ := data["positions"].(string)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || c == nil || len(b) != 4*len(c.Positions) {
+		return
+	}
+	for i := range c.Positions {
+		c.Positions[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	if c != p.pending {
+		p.v.refit()
+		return
+	}
+	keep := p.v.colorBy
+	p.v.setCloud(c)
+	if keep != "" && c.Attribute(keep) != nil && keep != p.v.colorBy {
+		p.v.colorBy = keep
+		p.v.recolor()
+	}
+	p.embedded, p.pending = c, nil
+}
+
+func (p *embeddingPanel) render() {
+	p.body.Set("innerHTML", "")
+	row := func(label, value string) {
+		r := element("div", "panel-row", "")
+		r.Call("appendChild", element("span", "", label))
+		r.Call("appendChild", element("span", "stats-value", value))
+		p.body.Call("appendChild", r)
+	}
+	row("Method", embeddingMethods[p.method])
+	if c := p.pending; c != nil {
+		row("Points", fmt.Sprint(c.Len()))
+	} else if c := p.embedded; c != nil {
+		row("Points", fmt.Sprint(c.Len()))
+	}
+	phase, _ := p.progress["phase"].(string)
+	switch phase {
+	case "done":
+		p.body.Call("appendChild", element("div", "", "Converged."))
+	case "failed":
+		p.body.Call("appendChild", element("div", "legend-warning", fmt.Sprint(p.progress["error"])))
+	case "starting":
+		p.body.Call("appendChild", element("div", "", "Starting…"))
+	default:
+		title := embeddingPhases[phase]
+		if title == "" {
+			title = phase
+		}
+		row(title, fmt.Sprintf("%.0f of %.0f", number(p.progress["step"]), number(p.progress["steps"])))
+	}
+}
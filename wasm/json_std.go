@@ -0,0 +1,17 @@
+//go:build js && wasm && !tinygo
+
+package main
+
+import "encoding/json"
+
+// decodeJSON and encodeJSON wrap encoding/json. TinyGo builds use the
+// browser's JSON object instead (see json_tinygo.go), so client code must
+// stick to the targets supported there: *[]string, *[]interface{},
+// *map[string]interface{} and *interface{}.
+func decodeJSON(b []byte, v interface{}) error {
+	return json.Unmarshal(b, v)
+}
+
+func encodeJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
@@ -0,0 +1,91 @@
+//go:build js && wasm && tinygo
+
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// decodeJSON parses b with the browser's JSON.parse. encoding/json relies on
+// reflection that bloats TinyGo builds, so only dynamic targets are
+// supported: *[]string, *[]interface{}, *map[string]interface{} and
+// *interface{}.
+func decodeJSON(b []byte, v interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("json: %v", r)
+		}
+	}()
+	parsed := fromJS(js.Global().Get("JSON").Call("parse", string(b)))
+	switch v := v.(type) {
+	case *interface{}:
+		*v = parsed
+	case *map[string]interface{}:
+		m, ok := parsed.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("json: not an object")
+		}
+		*v = m
+	case *[]interface{}:
+		a, ok := parsed.([]interface{})
+		if !ok {
+			return fmt.Errorf("json: not an array")
+		}
+		*v = a
+	case *[]string:
+		a, ok := parsed.([]interface{})
+		if !ok {
+			return fmt.Errorf("json: not an array")
+		}
+		*v = make([]string, len(a))
+		for i, s := range a {
+			if (*v)[i], ok = s.(string); !ok {
+				return fmt.Errorf("json: element %d is not a string", i)
+			}
+		}
+	default:
+		return fmt.Errorf("json: unsupported target %T", v)
+	}
+	return nil
+}
+
+// encodeJSON serializes maps, slices and scalars with JSON.stringify.
+func encodeJSON(v interface{}) ([]byte, error) {
+	if a, ok := v.([]string); ok {
+		s := make([]interface{}, len(a))
+		for i := range a {
+			s[i] = a[i]
+		}
+		v = s
+	}
+	return []byte(js.Global().Get("JSON").Call("stringify", js.ValueOf(v)).String()), nil
+}
+
+// fromJS converts a parsed JSON value to the types encoding/json produces.
+func fromJS(v js.Value) interface{} {
+	switch v.Type() {
+	case js.TypeNull, js.TypeUndefined:
+		return nil
+	case js.TypeBoolean:
+		return v.Bool()
+	case js.TypeNumber:
+		return v.Float()
+	case js.TypeString:
+		return v.String()
+	}
+	if js.Global().Get("Array").Call("isArray", v).Bool() {
+		a := make([]interface{}, v.Length())
+		for i := range a {
+			a[i] = fromJS(v.Index(i))
+		}
+		return a
+	}
+	keys := js.Global().Get("Object").Call("keys", v)
+	m := make(map[string]interface{}, keys.Length())
+	for i := 0; i < keys.Length(); i++ {
+		k := keys.Index(i).String()
+		m[k] = fromJS(v.Get(k))
+	}
+	return m
+}
@@ -0,0 +1,165 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"syscall/js"
+)
+
+var document = js.Global().Get("document")
+
+// float32Array copies data into a new JS Float32Array.
+func float32Array(data []float32) js.Value {
+	b := make([]byte, 4*len(data))
+	for i, v := range data {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	u8 := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(u8, b)
+	return js.Global().Get("Float32Array").New(u8.Get("buffer"))
+}
+
+// await blocks the calling goroutine until promise settles. It must not be
+// called from a JS callback, which would deadlock the event loop.
+func await(promise js.Value) (js.Value, error) {
+	done := make(chan struct{})
+	var result js.Value
+	var err error
+	onResolve := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		result = args[0]
+		close(done)
+		return nil
+	})
+	defer onResolve.Release()
+	onReject := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err = errors.New(args[0].Call("toString").String())
+		close(done)
+		return nil
+	})
+	defer onReject.Release()
+	promise.Call("then", onResolve, onReject)
+	<-done
+	return result, err
+}
+
+// fetchBytes GETs url and returns the response body.
+func fetchBytes(url string) ([]byte, error) {
+	return request(url, map[string]interface{}{})
+}
+
+// sendJSON sends body to url with the given method and returns the
+// response body.
+func sendJSON(method, url string, body []byte) ([]byte, error) {
+	return request(url, map[string]interface{}{
+		"method":  method,
+		"headers": map[string]interface{}{"Content-Type": "application/json"},
+		"body":    string(body),
+	})
+}
+
+// request fetches url with the given fetch options and returns the body of
+// a successful response.
+func request(url string, init map[string]interface{}) ([]byte, error) {
+	return requestWithin(nil, url, init)
+}
+
+// requestWithin is request as part of the span s. The request carries a
+// traceparent header naming s, or a new trace if s is nil, and failures
+// are returned as tracedErrors.
+func requestWithin(s *span, url string, init map[string]interface{}) ([]byte, error) {
+	if s == nil {
+		s = startSpan("", nil) // never ended; it only names the trace
+	}
+	headers, _ := init["headers"].(map[string]interface{})
+	if headers == nil {
+		headers = map[string]interface{}{}
+		init["headers"] = headers
+	}
+	headers["traceparent"] = s.traceparent()
+	resp, err := await(js.Global().Call("fetch", url, init))
+	if err != nil {
+		return nil, traced(err, s)
+	}
+	if !resp.Get("ok").Bool() {
+		text, _ := await(resp.Call("text"))
+		return nil, traced(fmt.Errorf("%d: %s", resp.Get("status").Int(), strings.TrimSpace(text.String())), s)
+	}
+	buf, err := await(resp.Call("arrayBuffer"))
+	if err != nil {
+		return nil, traced(err, s)
+	}
+	u8 := js.Global().Get("Uint8Array").New(buf)
+	b := make([]byte, u8.Get("length").Int())
+	js.CopyBytesToGo(b, u8)
+	return b, nil
+}
+
+// element creates a DOM element with the given class and text content.
+func element(tag, class, text string) js.Value {
+	el := document.Call("createElement", tag)
+	if class != "" {
+		el.Set("className", class)
+	}
+	if text != "" {
+		el.Set("textContent", text)
+	}
+	return el
+}
+
+// setStatus shows a message in the status bar; an empty message hides it.
+func setStatus(format string, args ...interface{}) {
+	status := document.Call("getElementById", "status")
+	msg := fmt.Sprintf(format, args...)
+	status.Set("textContent", msg)
+	if msg == "" {
+		status.Get("style").Set("display", "none")
+	} else {
+		status.Get("style").Set("display", "block")
+	}
+}
+
+// downloadBytes offers data to the user as a file download.
+func downloadBytes(filename, mime string, data []byte) {
+	u8 := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(u8, data)
+	blob := js.Global().Get("Blob").New([]interface{}{u8}, map[string]interface{}{"type": mime})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+	a := element("a", "", "")
+	a.Set("href", url)
+	a.Set("download", filename)
+	a.Call("click")
+	js.Global().Get("URL").Call("revokeObjectURL", url)
+}
+
+// pickFile asks the user for a file and calls fn with its text content on
+// a new goroutine.
+func pickFile(accept string, fn func(name, text string)) {
+	input := element("input", "", "")
+	input.Set("type", "file")
+	input.Set("accept", accept)
+	var onChange js.Func
+	onChange = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		onChange.Release()
+		files := input.Get("files")
+		if files.Length() == 0 {
+			return nil
+		}
+		file := files.Index(0)
+		go func() {
+			text, err := await(file.Call("text"))
+			if err != nil {
+				setStatus("Could not read %s: %v", file.Get("name").String(), err)
+				return
+			}
+			fn(file.Get("name").String(), text.String())
+		}()
+		return nil
+	})
+	input.Call("addEventListener", "change", onChange)
+	input.Call("click")
+}
@@ -0,0 +1,171 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+
+	"github.com/sbecker11/threedistvis-go/discrete"
+	"github.com/sbecker11/threedistvis-go/geom"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/render"
+)
+
+// Clouds with lattice axes are discrete distributions. They are drawn as a
+// lattice of spheres whose volume is proportional to the probability mass
+// at each site, colored like points, with the marginal distribution of
+// each variable as bars along its axis. Lengths are in lattice units, one
+// per level.
+const (
+	bubbleRadius = 0.45 // of the sphere with the largest mass
+	barWidth     = 0.6
+	barGap       = 0.6 // between the lattice and the bars
+	// maxLevelLabels bounds the level labels per axis; longer axes label
+	// every few levels.
+	maxLevelLabels = 12
+)
+
+// barAxes gives, for the bars of each variable, the axis along which they
+// grow and the axis they are offset along: bars of x and z hang below the
+// lattice and bars of y extend to its left.
+var barAxes = [3][2]int{{1, 2}, {0, 2}, {1, 0}}
+
+// setLattice replaces the bubble lattice with one for the current cloud,
+// or removes it if the cloud is not a discrete distribution. For lattices
+// it also refits the view so the bars and labels stay in it.
+func (v *viewer) setLattice() {
+	if v.lattice != nil {
+		v.lattice.parent.remove(v.lattice)
+		v.lattice, v.bubbles = nil, nil
+	}
+	marginals, ok := discrete.Marginals(v.cloud)
+	if !ok {
+		return
+	}
+	if err := v.buildLattice(marginals); err != nil {
+		reportError("Lattice failed", err)
+	}
+}
+
+func (v *viewer) buildLattice(marginals [3][]float64) error {
+	c := v.cloud
+	mass := c.Attribute("mass")
+	_, top := pointcloud.Range(mass)
+	scales := make([]float32, len(mass))
+	for i, m := range mass {
+		if m > 0 {
+			scales[i] = bubbleRadius * float32(math.Cbrt(float64(m/top)))
+		}
+	}
+	shape, normals := sphereGlyph(8, 16)
+	bubbles, err := newGlyphInstances(v.renderer, shape, normals, c.Positions, scales, make([]float32, len(c.Positions)))
+	if err != nil {
+		return err
+	}
+	lattice := newNode("lattice", bubbles)
+
+	var n [3]int
+	longest := 0
+	for k, a := range c.Axes {
+		n[k] = len(a.Levels)
+		longest = max(longest, n[k])
+	}
+	length := 0.3*float32(longest-1) + 1 // of the bar of the largest marginal
+	labelAt := -barGap - length - 0.5
+	var positions, colors []float32
+	for k, marginal := range marginals {
+		if n[k] < 2 {
+			continue
+		}
+		g, o := barAxes[k][0], barAxes[k][1]
+		var most float64
+		for _, m := range marginal {
+			most = math.Max(most, m)
+		}
+		step := (n[k] + maxLevelLabels - 1) / maxLevelLabels
+		color := axisColors[k]
+		for l, m := range marginal {
+			if m > 0 {
+				var lo, hi geom.Vec3
+				lo[k], hi[k] = float32(l)-barWidth/2, float32(l)+barWidth/2
+				lo[o], hi[o] = -1-barWidth/2, -1+barWidth/2
+				lo[g], hi[g] = -barGap-length*float32(m/most), -barGap
+				positions = appendBox(positions, lo, hi)
+				for i := 0; i < 36; i++ {
+					colors = append(colors, float32(color.R), float32(color.G), float32(color.B))
+				}
+			}
+			if l%step == 0 && c.Axes[k].Levels[l] != "" {
+				var at geom.Vec3
+				at[k], at[o], at[g] = float32(l), -1, labelAt
+				if err := addLabel(v.renderer, lattice, c.Axes[k].Levels[l], color.Hex(), at); err != nil {
+					return err
+				}
+			}
+		}
+		var at geom.Vec3
+		at[k], at[o], at[g] = float32(n[k]), -1, labelAt
+		if err := addLabel(v.renderer, lattice, c.Axes[k].Name, color.Hex(), at); err != nil {
+			return err
+		}
+	}
+	if positions != nil {
+		bars, err := newTriangleMesh(v.renderer, positions, nil, colors)
+		if err != nil {
+			return err
+		}
+		lattice.add(newNode("marginals", bars))
+	}
+
+	// Fit the view to the lattice together with its bars and labels.
+	box := pointcloud.New("", 8)
+	for i := 0; i < 8; i++ {
+		var p [3]float32
+		for k := range p {
+			p[k] = labelAt
+			if i>>k&1 == 1 {
+				p[k] = float32(n[k])
+			}
+		}
+		box.SetPoint(i, p[0], p[1], p[2])
+	}
+	v.center, v.scale = render.Fit(box)
+	v.lattice = v.data.find("points").add(lattice)
+	v.bubbles = bubbles
+	return nil
+}
+
+func addLabel(r *renderer, parent *node, text, color string, at geom.Vec3) error {
+	label, err := newTextLabel(r, text, color, at)
+	if err != nil {
+		return err
+	}
+	parent.add(newNode("label", label))
+	return nil
+}
+
+// appendBox appends the 12 triangles of the box from lo to hi.
+func appendBox(positions []float32, lo, hi geom.Vec3) []float32 {
+	corner := func(i int) geom.Vec3 {
+		var p geom.Vec3
+		for k := range p {
+			p[k] = lo[k]
+			if i>>k&1 == 1 {
+				p[k] = hi[k]
+			}
+		}
+		return p
+	}
+	// Each face is the corners with one coordinate fixed, split into two
+	// triangles.
+	for k := 0; k < 3; k++ {
+		a, b := 1<<((k+1)%3), 1<<((k+2)%3)
+		for _, side := range []int{0, 1 << k} {
+			for _, i := range []int{0, a, a | b, 0, a | b, b} {
+				p := corner(side | i)
+				positions = append(positions, p[:]...)
+			}
+		}
+	}
+	return positions
+}
@@ -0,0 +1,67 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// updateLegend describes the current coloring: swatches for categorical
+// attributes, with warnings for colors that are hard to tell apart, or a
+// gradient for continuous ones. Colors are shown as simulated when a color
+// vision deficiency simulation is active, to match the canvas.
+func (v *viewer) updateLegend() {
+	legend := document.Call("getElementById", "legend")
+	legend.Set("innerHTML", "")
+	values := v.cloud.Attribute(v.colorBy)
+	if values == nil {
+		legend.Get("style").Set("display", "none")
+		return
+	}
+	legend.Get("style").Set("display", "block")
+	legend.Call("appendChild", element("div", "legend-title", v.colorBy))
+	show := func(c colormap.RGB) string {
+		return colormap.Simulate(c, v.cvd).Hex()
+	}
+
+	if v.categories != nil {
+		var used []colormap.RGB
+		for i, cat := range v.categories {
+			c := v.palette.At(i)
+			used = append(used, c)
+			row := element("div", "legend-row", "")
+			swatch := element("span", "swatch", "")
+			swatch.Get("style").Set("background", show(c))
+			row.Call("appendChild", swatch)
+			row.Call("appendChild", element("span", "", fmt.Sprint(cat)))
+			legend.Call("appendChild", row)
+		}
+		for _, conflict := range colormap.CheckPalette(used) {
+			legend.Call("appendChild", element("div", "legend-warning", "⚠ "+conflict.String()))
+		}
+		return
+	}
+
+	lo, hi := pointcloud.Range(values)
+	var stops []string
+	const samples = 32
+	for i := 0; i <= samples; i++ {
+		f := float64(i) / samples
+		t := v.cmap.Normalize(float64(lo)+f*float64(hi-lo), float64(lo), float64(hi))
+		stops = append(stops, fmt.Sprintf("%s %.1f%%", show(v.cmap.At(t)), f*100))
+	}
+	bar := element("div", "legend-gradient", "")
+	bar.Get("style").Set("background", "linear-gradient(to right, "+strings.Join(stops, ", ")+")")
+	legend.Call("appendChild", bar)
+	labels := element("div", "legend-range", "")
+	labels.Call("appendChild", element("span", "", fmt.Sprintf("%.3g", lo)))
+	if v.cmap.Diverging {
+		labels.Call("appendChild", element("span", "", fmt.Sprintf("center %.3g", v.cmap.Center)))
+	}
+	labels.Call("appendChild", element("span", "", fmt.Sprintf("%.3g", hi)))
+	legend.Call("appendChild", labels)
+}
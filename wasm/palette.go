@@ -0,0 +1,235 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"syscall/js"
+	"unicode"
+)
+
+// palette is the Ctrl+K command palette. It lists registered actions
+// filtered by a fuzzy query and, once an action is chosen, prompts for each
+// of its parameters in turn.
+type palette struct {
+	root  js.Value
+	input js.Value
+	list  js.Value
+
+	// Parameter prompting state: the action being invoked, the arguments
+	// collected so far and the index of the parameter being asked for.
+	pending *action
+	args    map[string]string
+	param   int
+
+	items    []paletteItem
+	selected int
+}
+
+type paletteItem struct {
+	label  string
+	hint   string
+	action *action // set when choosing a command
+	value  string  // set when choosing a parameter value
+}
+
+var thePalette = &palette{}
+
+func initPalette() {
+	p := thePalette
+	p.root = document.Call("getElementById", "palette")
+	p.input = p.root.Call("querySelector", "input")
+	p.list = p.root.Call("querySelector", "ul")
+	p.input.Call("addEventListener", "input", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.selected = 0
+		p.refresh()
+		return nil
+	}))
+	p.input.Call("addEventListener", "keydown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		event := args[0]
+		switch event.Get("key").String() {
+		case "ArrowDown":
+			p.move(1)
+		case "ArrowUp":
+			p.move(-1)
+		case "Enter":
+			p.accept()
+		case "Escape":
+			p.hide()
+		default:
+			return nil
+		}
+		event.Call("preventDefault")
+		return nil
+	}))
+	p.input.Call("addEventListener", "blur", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.hide()
+		return nil
+	}))
+}
+
+// show opens the palette in command mode.
+func (p *palette) show() {
+	p.pending = nil
+	p.open("Type a command…", "")
+}
+
+// prompt opens the palette to collect the parameters of a.
+func (p *palette) prompt(a *action) {
+	p.pending = a
+	p.args = map[string]string{}
+	p.param = 0
+	p.askParam()
+}
+
+func (p *palette) askParam() {
+	pr := p.pending.params[p.param]
+	def := ""
+	if pr.def != nil {
+		def = pr.def()
+	}
+	p.open(p.pending.title+": "+pr.prompt, def)
+}
+
+func (p *palette) open(placeholder, value string) {
+	p.input.Set("placeholder", placeholder)
+	p.input.Set("value", value)
+	p.selected = 0
+	p.root.Get("style").Set("display", "block")
+	p.input.Call("focus")
+	p.refresh()
+}
+
+func (p *palette) hide() {
+	p.pending = nil
+	p.root.Get("style").Set("display", "none")
+}
+
+// refresh rebuilds the list for the current query.
+func (p *palette) refresh() {
+	query := p.input.Get("value").String()
+	p.items = p.items[:0]
+	if p.pending == nil {
+		for _, a := range actions {
+			p.items = append(p.items, paletteItem{label: a.title + ellipsis(a), hint: a.shortcut, action: a})
+		}
+		p.items = filterItems(p.items, query, func(it paletteItem) string { return it.label + " " + it.action.id })
+	} else {
+		pr := p.pending.params[p.param]
+		var choices []string
+		if pr.choices != nil {
+			choices = pr.choices()
+		}
+		for _, c := range choices {
+			p.items = append(p.items, paletteItem{label: c, value: c})
+		}
+		p.items = filterItems(p.items, query, func(it paletteItem) string { return it.label })
+		if pr.free && (len(p.items) == 0 || p.items[0].value != query) {
+			label := query
+			if label == "" {
+				label = "(default)"
+			}
+			p.items = append([]paletteItem{{label: label, hint: "Enter", value: query}}, p.items...)
+		}
+	}
+	if p.selected >= len(p.items) {
+		p.selected = len(p.items) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+
+	p.list.Set("innerHTML", "")
+	for i, it := range p.items {
+		li := element("li", "", "")
+		if i == p.selected {
+			li.Set("className", "selected")
+		}
+		li.Call("appendChild", element("span", "", it.label))
+		li.Call("appendChild", element("span", "shortcut", it.hint))
+		i := i
+		li.Call("addEventListener", "mousedown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			args[0].Call("preventDefault")
+			p.selected = i
+			p.accept()
+			return nil
+		}))
+		p.list.Call("appendChild", li)
+	}
+}
+
+func (p *palette) move(delta int) {
+	if len(p.items) == 0 {
+		return
+	}
+	p.selected = (p.selected + delta + len(p.items)) % len(p.items)
+	p.refresh()
+}
+
+// accept chooses the selected item: a command starts prompting for its
+// parameters (or runs), a value advances to the next parameter.
+func (p *palette) accept() {
+	if p.selected >= len(p.items) {
+		return
+	}
+	it := p.items[p.selected]
+	if p.pending == nil {
+		p.hide()
+		invoke(it.action)
+		return
+	}
+	a := p.pending
+	p.args[a.params[p.param].name] = it.value
+	p.param++
+	if p.param < len(a.params) {
+		p.askParam()
+		return
+	}
+	args := p.args
+	p.hide()
+	go a.run(args)
+}
+
+// filterItems keeps the items whose text fuzzily matches query, best
+// matches first. Ties keep their original order.
+func filterItems(items []paletteItem, query string, text func(paletteItem) string) []paletteItem {
+	type scored struct {
+		item  paletteItem
+		score int
+	}
+	var matches []scored
+	for _, it := range items {
+		if s, ok := fuzzyScore(query, text(it)); ok {
+			matches = append(matches, scored{it, s})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	out := items[:0]
+	for _, m := range matches {
+		out = append(out, m.item)
+	}
+	return out
+}
+
+// fuzzyScore reports whether the runes of query appear in text in order,
+// ignoring case, and scores the match. Consecutive runs and matches at the
+// start of a word score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	score, qi, run := 0, 0, 0
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			run = 0
+			continue
+		}
+		run++
+		score += run
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) {
+			score += 3
+		}
+		qi++
+	}
+	return score, qi == len(q)
+}
@@ -0,0 +1,229 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"syscall/js"
+)
+
+// patternPanel charts the point-pattern summary functions of the current
+// dataset, as computed by the server, against their values under complete
+// spatial randomness and the envelope of simulated uniform patterns.
+type patternPanel struct {
+	v          *viewer
+	root, body js.Value
+	function   js.Value // select
+	result     map[string]interface{}
+}
+
+var thePattern *patternPanel
+
+// patternFunctions describes the summary functions in the order the
+// server returns them. Above the envelope, the first four indicate
+// clustering and F regularity.
+var patternFunctions = []struct{ name, title string }{
+	{"K", "K(r): pairs within r, per intensity"},
+	{"L", "L(r) − r: K on a linear scale"},
+	{"g", "g(r): pair correlation"},
+	{"G", "G(r): nearest-neighbor distances"},
+	{"F", "F(r): empty space"},
+}
+
+// Chart layout in pixels.
+const (
+	chartWidth, chartHeight = 280, 180
+	chartLeft, chartBottom  = 44, 20
+)
+
+func initPatternPanel(v *viewer) {
+	p := &patternPanel{v: v, root: document.Call("getElementById", "pattern-panel")}
+	thePattern = p
+	p.root.Call("appendChild", element("div", "panel-title", "Spatial randomness"))
+	p.function = element("select", "", "")
+	for _, f := range patternFunctions {
+		opt := element("option", "", f.title)
+		opt.Set("value", f.name)
+		p.function.Call("appendChild", opt)
+	}
+	p.function.Set("value", "L")
+	p.function.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.render()
+		return nil
+	}))
+	row := element("label", "panel-row", "Function")
+	row.Call("appendChild", p.function)
+	p.root.Call("appendChild", row)
+	p.body = element("div", "", "")
+	p.root.Call("appendChild", p.body)
+	buttons := element("div", "panel-buttons", "")
+	hide := element("button", "", "Close")
+	hide.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.hide()
+		return nil
+	}))
+	buttons.Call("appendChild", hide)
+	p.root.Call("appendChild", buttons)
+}
+
+// test asks the server to test the current dataset for complete spatial
+// randomness with a sample of the given size and number of simulations,
+// either of which may be empty for the server's default, and shows the
+// result.
+func (p *patternPanel) test(points, simulations string) error {
+	src := p.v.source
+	if src.name == "" {
+		return errors.New("load a dataset first")
+	}
+	query := url.Values{}
+	if src.options != "" {
+		query.Set("options", src.options)
+	}
+	if points != "" {
+		query.Set("points", points)
+	}
+	if simulations != "" {
+		query.Set("simulations", simulations)
+	}
+	setStatus("Testing %s for spatial randomness…", src.name)
+	defer setStatus("")
+	b, err := fetchBytes("api/pattern/" + src.name + "?" + query.Encode())
+	if err != nil {
+		return err
+	}
+	var result map[string]interface{}
+	if err := decodeJSON(b, &result); err != nil {
+		return err
+	}
+	theSampling.stop()
+	p.result = result
+	p.render()
+	p.root.Get("style").Set("display", "block")
+	return nil
+}
+
+// hide closes the panel and drops its result, which no longer applies once
+// another dataset is loaded.
+func (p *patternPanel) hide() {
+	p.result = nil
+	p.root.Get("style").Set("display", "none")
+}
+
+// render draws the chosen function of the latest result.
+func (p *patternPanel) render() {
+	res := p.result
+	if res == nil {
+		return
+	}
+	p.body.Set("innerHTML", "")
+	row := func(label, value string) {
+		r := element("div", "panel-row", "")
+		r.Call("appendChild", element("span", "", label))
+		r.Call("appendChild", element("span", "stats-value", value))
+		p.body.Call("appendChild", r)
+	}
+	row("Points tested", fmt.Sprintf("%.0f", number(res["points"])))
+	row("Intensity", fmt.Sprintf("%.4g per unit³", number(res["intensity"])))
+	row("Simulations", fmt.Sprintf("%.0f", number(res["simulations"])))
+
+	name := p.function.Get("value").String()
+	functions, _ := res["functions"].([]interface{})
+	var fn map[string]interface{}
+	for _, f := range functions {
+		if m, ok := f.(map[string]interface{}); ok && m["name"] == name {
+			fn = m
+		}
+	}
+	if fn == nil {
+		return
+	}
+	r := numbers(fn["r"])
+	curves := [4][]float64{numbers(fn["observed"]), numbers(fn["theoretical"]), numbers(fn["lo"]), numbers(fn["hi"])}
+	for _, c := range curves {
+		if len(c) != len(r) || len(r) == 0 {
+			return
+		}
+		if name == "L" {
+			for i := range c {
+				c[i] -= r[i]
+			}
+		}
+	}
+	chart := element("div", "pattern-chart", "")
+	chart.Set("innerHTML", patternChart(r, curves[0], curves[1], curves[2], curves[3]))
+	p.body.Call("appendChild", chart)
+
+	var above, below int
+	for i, v := range curves[0] {
+		if v > curves[3][i] {
+			above++
+		} else if v < curves[2][i] {
+			below++
+		}
+	}
+	clustered, regular := "clustering", "regularity"
+	if name == "F" {
+		clustered, regular = regular, clustered
+	}
+	switch {
+	case above == 0 && below == 0:
+		p.body.Call("appendChild", element("div", "", "Within the envelope at every distance: consistent with complete spatial randomness."))
+	default:
+		var parts []string
+		if above > 0 {
+			parts = append(parts, fmt.Sprintf("above the envelope at %d of %d distances (%s)", above, len(r), clustered))
+		}
+		if below > 0 {
+			parts = append(parts, fmt.Sprintf("below it at %d (%s)", below, regular))
+		}
+		p.body.Call("appendChild", element("div", "legend-warning", "Observed "+strings.Join(parts, ", ")+"."))
+	}
+	p.body.Call("appendChild", element("div", "legend-range", "Envelopes are pointwise: a random pattern may leave them at a few distances."))
+}
+
+// patternChart returns an SVG line chart of a summary function against r:
+// the envelope as a band, the CSR value dashed and the estimate solid.
+func patternChart(r, observed, theoretical, lo, hi []float64) string {
+	ymin, ymax := math.Inf(1), math.Inf(-1)
+	for _, c := range [][]float64{observed, theoretical, lo, hi} {
+		for _, v := range c {
+			ymin, ymax = math.Min(ymin, v), math.Max(ymax, v)
+		}
+	}
+	if ymax <= ymin {
+		ymin, ymax = ymin-1, ymax+1
+	}
+	xmax := r[len(r)-1]
+	plotW, plotH := float64(chartWidth-chartLeft-4), float64(chartHeight-chartBottom-6)
+	x := func(v float64) float64 { return chartLeft + v/xmax*plotW }
+	y := func(v float64) float64 { return 6 + (ymax-v)/(ymax-ymin)*plotH }
+	path := func(values []float64) string {
+		var b strings.Builder
+		for i, v := range values {
+			fmt.Fprintf(&b, "%.1f,%.1f ", x(r[i]), y(v))
+		}
+		return b.String()
+	}
+	var band strings.Builder
+	band.WriteString(path(hi))
+	for i := len(lo) - 1; i >= 0; i-- {
+		fmt.Fprintf(&band, "%.1f,%.1f ", x(r[i]), y(lo[i]))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg width="%d" height="%d" font-size="10" fill="#aaa">`, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<polygon points="%s" fill="#555"/>`, band.String())
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#ddd" stroke-dasharray="4 3"/>`, path(theoretical))
+	fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#fdd663" stroke-width="1.5"/>`, path(observed))
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#777"/>`, chartLeft, 6+plotH, chartWidth-4, 6+plotH)
+	fmt.Fprintf(&b, `<line x1="%d" y1="6" x2="%d" y2="%.1f" stroke="#777"/>`, chartLeft, chartLeft, 6+plotH)
+	fmt.Fprintf(&b, `<text x="%d" y="10" text-anchor="end">%.3g</text>`, chartLeft-3, ymax)
+	fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%.3g</text>`, chartLeft-3, 6+plotH, ymin)
+	fmt.Fprintf(&b, `<text x="%d" y="%d">0</text>`, chartLeft, chartHeight-6)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">r = %.3g</text>`, chartWidth-4, chartHeight-6, xmax)
+	b.WriteString(`</svg>`)
+	return b.String()
+}
@@ -0,0 +1,121 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+)
+
+const cvdVertexShaderSource = `
+	attribute vec2 position;
+	varying vec2 uv;
+	void main() {
+		uv = position * 0.5 + 0.5;
+		gl_Position = vec4(position, 0.0, 1.0);
+	}
+`
+
+// The simulation matrices operate on linear RGB, so the frame is decoded
+// from sRGB first and re-encoded afterwards.
+const cvdFragmentShaderSource = `
+	precision mediump float;
+	uniform sampler2D frame;
+	uniform mat3 cvd;
+	varying vec2 uv;
+	vec3 toLinear(vec3 c) {
+		return mix(c / 12.92, pow((c + 0.055) / 1.055, vec3(2.4)), step(0.04045, c));
+	}
+	vec3 toSRGB(vec3 c) {
+		return mix(c * 12.92, 1.055 * pow(c, vec3(1.0 / 2.4)) - 0.055, step(0.0031308, c));
+	}
+	void main() {
+		vec3 c = texture2D(frame, uv).rgb;
+		gl_FragColor = vec4(toSRGB(clamp(cvd * toLinear(c), 0.0, 1.0)), 1.0);
+	}
+`
+
+// cvdPass renders the frame to an offscreen texture and then draws it to
+// the screen through a color vision deficiency simulation.
+type cvdPass struct {
+	gl        js.Value
+	program   js.Value
+	fbo       js.Value
+	texture   js.Value
+	depth     js.Value
+	quad      js.Value
+	posLoc    int
+	matrixLoc js.Value
+	width     int
+	height    int
+}
+
+func newCVDPass(gl js.Value) (*cvdPass, error) {
+	program, err := linkProgram(gl, cvdVertexShaderSource, cvdFragmentShaderSource)
+	if err != nil {
+		return nil, err
+	}
+	p := &cvdPass{
+		gl:        gl,
+		program:   program,
+		fbo:       gl.Call("createFramebuffer"),
+		texture:   gl.Call("createTexture"),
+		depth:     gl.Call("createRenderbuffer"),
+		quad:      gl.Call("createBuffer"),
+		posLoc:    gl.Call("getAttribLocation", program, "position").Int(),
+		matrixLoc: gl.Call("getUniformLocation", program, "cvd"),
+	}
+	gl.Call("bindBuffer", gl.Get("ARRAY_BUFFER"), p.quad)
+	gl.Call("bufferData", gl.Get("ARRAY_BUFFER"), float32Array([]float32{-1, -1, 1, -1, -1, 1, -1, 1, 1, -1, 1, 1}), gl.Get("STATIC_DRAW"))
+	return p, nil
+}
+
+// resize (re)allocates the offscreen targets to match the canvas.
+func (p *cvdPass) resize(width, height int) {
+	gl := p.gl
+	p.width, p.height = width, height
+	tex2D := gl.Get("TEXTURE_2D")
+	gl.Call("bindTexture", tex2D, p.texture)
+	gl.Call("texImage2D", tex2D, 0, gl.Get("RGBA"), width, height, 0, gl.Get("RGBA"), gl.Get("UNSIGNED_BYTE"), nil)
+	gl.Call("texParameteri", tex2D, gl.Get("TEXTURE_MIN_FILTER"), gl.Get("NEAREST"))
+	gl.Call("texParameteri", tex2D, gl.Get("TEXTURE_MAG_FILTER"), gl.Get("NEAREST"))
+	gl.Call("texParameteri", tex2D, gl.Get("TEXTURE_WRAP_S"), gl.Get("CLAMP_TO_EDGE"))
+	gl.Call("texParameteri", tex2D, gl.Get("TEXTURE_WRAP_T"), gl.Get("CLAMP_TO_EDGE"))
+	gl.Call("bindRenderbuffer", gl.Get("RENDERBUFFER"), p.depth)
+	gl.Call("renderbufferStorage", gl.Get("RENDERBUFFER"), gl.Get("DEPTH_COMPONENT16"), width, height)
+	gl.Call("bindFramebuffer", gl.Get("FRAMEBUFFER"), p.fbo)
+	gl.Call("framebufferTexture2D", gl.Get("FRAMEBUFFER"), gl.Get("COLOR_ATTACHMENT0"), tex2D, p.texture, 0)
+	gl.Call("framebufferRenderbuffer", gl.Get("FRAMEBUFFER"), gl.Get("DEPTH_ATTACHMENT"), gl.Get("RENDERBUFFER"), p.depth)
+}
+
+// begin redirects drawing to the offscreen frame.
+func (p *cvdPass) begin(width, height int) {
+	if width != p.width || height != p.height {
+		p.resize(width, height)
+	}
+	p.gl.Call("bindFramebuffer", p.gl.Get("FRAMEBUFFER"), p.fbo)
+}
+
+// end draws the offscreen frame to the canvas as seen with deficiency d.
+func (p *cvdPass) end(d colormap.Deficiency) {
+	gl := p.gl
+	gl.Call("bindFramebuffer", gl.Get("FRAMEBUFFER"), js.Null())
+	gl.Call("disable", gl.Get("DEPTH_TEST"))
+	gl.Call("useProgram", p.program)
+	// GLSL matrices are column-major.
+	m := d.Matrix()
+	gl.Call("uniformMatrix3fv", p.matrixLoc, false, float32Array([]float32{
+		float32(m[0]), float32(m[3]), float32(m[6]),
+		float32(m[1]), float32(m[4]), float32(m[7]),
+		float32(m[2]), float32(m[5]), float32(m[8]),
+	}))
+	gl.Call("activeTexture", gl.Get("TEXTURE0"))
+	gl.Call("bindTexture", gl.Get("TEXTURE_2D"), p.texture)
+	gl.Call("bindBuffer", gl.Get("ARRAY_BUFFER"), p.quad)
+	gl.Call("enableVertexAttribArray", p.posLoc)
+	gl.Call("vertexAttribPointer", p.posLoc, 2, gl.Get("FLOAT"), false, 0, 0)
+	gl.Call("drawArrays", gl.Get("TRIANGLES"), 0, 6)
+	gl.Call("disableVertexAttribArray", p.posLoc)
+	gl.Call("enable", gl.Get("DEPTH_TEST"))
+}
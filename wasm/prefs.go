@@ -0,0 +1,53 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+)
+
+// prefsKey is the localStorage key holding the user's preferences: their
+// own colormaps, the colormap in use and the name they comment under.
+const prefsKey = "threedistvis.preferences"
+
+// loadPrefs restores preferences saved by savePrefs. Invalid entries are
+// skipped.
+func loadPrefs(v *viewer) {
+	stored := js.Global().Get("localStorage").Call("getItem", prefsKey)
+	if stored.IsNull() {
+		return
+	}
+	var prefs map[string]interface{}
+	if decodeJSON([]byte(stored.String()), &prefs) != nil {
+		return
+	}
+	maps, _ := prefs["colormaps"].([]interface{})
+	for _, def := range maps {
+		if m, err := colormap.FromJSON(def); err == nil {
+			v.addColormap(m)
+		}
+	}
+	if name, ok := prefs["colormap"].(string); ok {
+		if m, ok := v.lookupColormap(name); ok {
+			v.cmap = m
+			v.recolor()
+		}
+	}
+	commentAuthor, _ = prefs["author"].(string)
+}
+
+// savePrefs stores the user colormaps, the current colormap name and the
+// comment author.
+func savePrefs(v *viewer) {
+	var maps []interface{}
+	for _, m := range v.userMaps {
+		maps = append(maps, m.ToJSON())
+	}
+	b, err := encodeJSON(map[string]interface{}{"colormaps": maps, "colormap": v.cmap.Name, "author": commentAuthor})
+	if err != nil {
+		return
+	}
+	js.Global().Get("localStorage").Call("setItem", prefsKey, string(b))
+}
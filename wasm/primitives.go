@@ -0,0 +1,537 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/geom"
+)
+
+// mvp returns the model-view-projection matrix for model in the current
+// frame.
+func (r *renderer) mvp(model geom.Mat4) geom.Mat4 {
+	return r.proj.Mul(r.view).Mul(model)
+}
+
+const colorFragmentShader = `
+	precision mediump float;
+	varying vec3 vColor;
+	void main() {
+		gl_FragColor = vec4(vColor, 1.0);
+	}
+`
+
+// pointSet draws points with per-point colors.
+type pointSet struct {
+	shader            *shader
+	positions, colors js.Value
+	count             int
+	size              float32 // in pixels
+
+	// Without WebGL the data stays on the CPU.
+	cpuPositions, cpuColors []float32
+}
+
+const pointVertexShader = `
+	attribute vec3 position;
+	attribute vec3 color;
+	uniform mat4 modelViewProjection;
+	uniform float pointSize;
+	varying vec3 vColor;
+	void main() {
+		gl_Position = modelViewProjection * vec4(position, 1.0);
+		gl_PointSize = pointSize;
+		vColor = color;
+	}
+`
+
+func newPointSet(r *renderer) (*pointSet, error) {
+	if r.canvas != nil {
+		return &pointSet{size: 3}, nil
+	}
+	s, err := r.shader("points", pointVertexShader, colorFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	return &pointSet{shader: s, size: 3}, nil
+}
+
+// setPositions uploads xyz-interleaved positions.
+func (p *pointSet) setPositions(positions []float32) {
+	p.count = len(positions) / 3
+	if p.shader == nil {
+		p.cpuPositions = positions
+		return
+	}
+	p.positions = upload(p.shader.gl, p.positions, positions)
+}
+
+// setColors uploads rgb-interleaved colors, one per point.
+func (p *pointSet) setColors(colors []float32) {
+	if p.shader == nil {
+		p.cpuColors = colors
+		return
+	}
+	p.colors = upload(p.shader.gl, p.colors, colors)
+}
+
+func (p *pointSet) draw(r *renderer, model geom.Mat4) {
+	if c := r.canvas; c != nil {
+		c.points(r.mvp(model), p.cpuPositions, p.cpuColors, p.size)
+		return
+	}
+	if p.count == 0 || !p.colors.Truthy() {
+		return
+	}
+	s := p.shader
+	s.use()
+	s.setMatrix("modelViewProjection", r.mvp(model))
+	r.gl.Call("uniform1f", s.uniform("pointSize"), p.size)
+	pos := s.bind("position", p.positions, 3)
+	col := s.bind("color", p.colors, 3)
+	r.gl.Call("drawArrays", r.gl.Get("POINTS"), 0, p.count)
+	s.unbind(pos, col)
+}
+
+func (p *pointSet) release() {
+	deleteBuffers(p.shader, p.positions, p.colors)
+}
+
+// deleteBuffers frees the buffers of a primitive drawn with s, if any.
+func deleteBuffers(s *shader, bufs ...js.Value) {
+	if s == nil {
+		return
+	}
+	for _, b := range bufs {
+		if b.Truthy() {
+			s.gl.Call("deleteBuffer", b)
+		}
+	}
+}
+
+// lineSet draws line segments, two vertices each, with per-vertex colors.
+type lineSet struct {
+	shader            *shader
+	positions, colors js.Value
+	count             int
+
+	cpuPositions, cpuColors []float32
+}
+
+const lineVertexShader = `
+	attribute vec3 position;
+	attribute vec3 color;
+	uniform mat4 modelViewProjection;
+	varying vec3 vColor;
+	void main() {
+		gl_Position = modelViewProjection * vec4(position, 1.0);
+		vColor = color;
+	}
+`
+
+// newLineSet returns a line set of the given segment endpoints and colors.
+func newLineSet(r *renderer, positions, colors []float32) (*lineSet, error) {
+	l := &lineSet{}
+	if r.canvas == nil {
+		s, err := r.shader("lines", lineVertexShader, colorFragmentShader)
+		if err != nil {
+			return nil, err
+		}
+		l.shader = s
+	}
+	l.set(positions, colors)
+	return l, nil
+}
+
+func (l *lineSet) set(positions, colors []float32) {
+	if l.shader == nil {
+		l.cpuPositions, l.cpuColors = positions, colors
+		l.count = len(positions) / 3
+		return
+	}
+	l.positions = upload(l.shader.gl, l.positions, positions)
+	l.colors = upload(l.shader.gl, l.colors, colors)
+	l.count = len(positions) / 3
+}
+
+func (l *lineSet) draw(r *renderer, model geom.Mat4) {
+	if l.count == 0 {
+		return
+	}
+	if c := r.canvas; c != nil {
+		c.lines(r.mvp(model), l.cpuPositions, l.cpuColors)
+		return
+	}
+	s := l.shader
+	s.use()
+	s.setMatrix("modelViewProjection", r.mvp(model))
+	pos := s.bind("position", l.positions, 3)
+	col := s.bind("color", l.colors, 3)
+	r.gl.Call("drawArrays", r.gl.Get("LINES"), 0, l.count)
+	s.unbind(pos, col)
+}
+
+func (l *lineSet) release() {
+	deleteBuffers(l.shader, l.positions, l.colors)
+}
+
+// Meshes and glyphs are lit by a headlight, from both sides so open
+// surfaces read correctly from behind.
+const litFragmentShader = `
+	precision mediump float;
+	varying vec3 vColor;
+	varying vec3 vNormal;
+	void main() {
+		float light = abs(normalize(vNormal).z);
+		gl_FragColor = vec4(vColor * (0.3 + 0.7 * light), 1.0);
+	}
+`
+
+// triangleMesh draws shaded triangles, three vertices each, with
+// per-vertex normals and colors.
+type triangleMesh struct {
+	shader                     *shader
+	positions, normals, colors js.Value
+	count                      int
+
+	cpuPositions, cpuNormals, cpuColors []float32
+}
+
+const meshVertexShader = `
+	attribute vec3 position;
+	attribute vec3 normal;
+	attribute vec3 color;
+	uniform mat4 modelViewProjection;
+	uniform mat4 modelView;
+	varying vec3 vColor;
+	varying vec3 vNormal;
+	void main() {
+		gl_Position = modelViewProjection * vec4(position, 1.0);
+		vNormal = mat3(modelView) * normal;
+		vColor = color;
+	}
+`
+
+// newTriangleMesh returns a mesh of the given triangles. If normals is nil,
+// each triangle is shaded flat.
+func newTriangleMesh(r *renderer, positions, normals, colors []float32) (*triangleMesh, error) {
+	if normals == nil {
+		normals = flatNormals(positions)
+	}
+	if r.canvas != nil {
+		return &triangleMesh{
+			cpuPositions: positions,
+			cpuNormals:   normals,
+			cpuColors:    colors,
+			count:        len(positions) / 3,
+		}, nil
+	}
+	s, err := r.shader("mesh", meshVertexShader, litFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	gl := r.gl
+	return &triangleMesh{
+		shader:    s,
+		positions: upload(gl, js.Undefined(), positions),
+		normals:   upload(gl, js.Undefined(), normals),
+		colors:    upload(gl, js.Undefined(), colors),
+		count:     len(positions) / 3,
+	}, nil
+}
+
+// flatNormals returns each triangle's face normal for its three vertices.
+func flatNormals(positions []float32) []float32 {
+	normals := make([]float32, len(positions))
+	for i := 0; i+9 <= len(positions); i += 9 {
+		a := geom.Vec3{positions[i], positions[i+1], positions[i+2]}
+		b := geom.Vec3{positions[i+3], positions[i+4], positions[i+5]}
+		c := geom.Vec3{positions[i+6], positions[i+7], positions[i+8]}
+		n := b.Sub(a).Cross(c.Sub(a)).Normalize()
+		for k := 0; k < 9; k++ {
+			normals[i+k] = n[k%3]
+		}
+	}
+	return normals
+}
+
+// setColors replaces the vertex colors.
+func (m *triangleMesh) setColors(colors []float32) {
+	if m.shader == nil {
+		m.cpuColors = colors
+		return
+	}
+	m.colors = upload(m.shader.gl, m.colors, colors)
+}
+
+func (m *triangleMesh) draw(r *renderer, model geom.Mat4) {
+	if m.count == 0 {
+		return
+	}
+	if c := r.canvas; c != nil {
+		c.triangles(r.mvp(model), r.view.Mul(model), m.cpuPositions, m.cpuNormals, m.cpuColors)
+		return
+	}
+	s := m.shader
+	s.use()
+	s.setMatrix("modelViewProjection", r.mvp(model))
+	s.setMatrix("modelView", r.view.Mul(model))
+	pos := s.bind("position", m.positions, 3)
+	nor := s.bind("normal", m.normals, 3)
+	col := s.bind("color", m.colors, 3)
+	r.gl.Call("drawArrays", r.gl.Get("TRIANGLES"), 0, m.count)
+	s.unbind(pos, nor, col)
+}
+
+func (m *triangleMesh) release() {
+	deleteBuffers(m.shader, m.positions, m.normals, m.colors)
+}
+
+// textLabel draws a line of text facing the camera, with its left edge at
+// an anchor point. The text is rendered once into a texture.
+type textLabel struct {
+	shader        *shader
+	texture, quad js.Value
+	anchor        geom.Vec3
+	width, height int // in pixels
+
+	// Without WebGL the text is drawn directly.
+	text, color string
+}
+
+const labelVertexShader = `
+	attribute vec2 position;
+	uniform mat4 modelViewProjection;
+	uniform vec3 anchor;
+	uniform vec2 size;
+	varying vec2 uv;
+	void main() {
+		gl_Position = modelViewProjection * vec4(anchor, 1.0);
+		gl_Position.xy += (position - vec2(0.0, 0.5)) * size * gl_Position.w;
+		uv = vec2(position.x, 1.0 - position.y);
+	}
+`
+
+const labelFragmentShader = `
+	precision mediump float;
+	uniform sampler2D text;
+	varying vec2 uv;
+	void main() {
+		vec4 c = texture2D(text, uv);
+		if (c.a < 0.5) discard;
+		gl_FragColor = c;
+	}
+`
+
+// labelFont is the CSS font of text labels; labelHeight is their height
+// in pixels.
+const (
+	labelFont   = "14px sans-serif"
+	labelHeight = 18
+)
+
+// newTextLabel returns a label showing text in the given CSS color.
+func newTextLabel(r *renderer, text, color string, anchor geom.Vec3) (*textLabel, error) {
+	if r.canvas != nil {
+		return &textLabel{anchor: anchor, text: text, color: color}, nil
+	}
+	s, err := r.shader("label", labelVertexShader, labelFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	canvas := document.Call("createElement", "canvas")
+	ctx := canvas.Call("getContext", "2d")
+	ctx.Set("font", labelFont)
+	width := int(math.Ceil(ctx.Call("measureText", text).Get("width").Float())) + 4
+	canvas.Set("width", width)
+	canvas.Set("height", labelHeight)
+	ctx.Set("font", labelFont) // resizing resets the context
+	ctx.Set("fillStyle", color)
+	ctx.Set("textBaseline", "middle")
+	ctx.Call("fillText", text, 2, labelHeight/2)
+
+	gl := r.gl
+	texture := gl.Call("createTexture")
+	gl.Call("bindTexture", gl.Get("TEXTURE_2D"), texture)
+	gl.Call("texImage2D", gl.Get("TEXTURE_2D"), 0, gl.Get("RGBA"), gl.Get("RGBA"), gl.Get("UNSIGNED_BYTE"), canvas)
+	for _, p := range []string{"TEXTURE_WRAP_S", "TEXTURE_WRAP_T"} {
+		gl.Call("texParameteri", gl.Get("TEXTURE_2D"), gl.Get(p), gl.Get("CLAMP_TO_EDGE"))
+	}
+	for _, p := range []string{"TEXTURE_MIN_FILTER", "TEXTURE_MAG_FILTER"} {
+		gl.Call("texParameteri", gl.Get("TEXTURE_2D"), gl.Get(p), gl.Get("LINEAR"))
+	}
+	return &textLabel{
+		shader:  s,
+		texture: texture,
+		quad:    upload(gl, js.Undefined(), []float32{0, 0, 1, 0, 0, 1, 1, 1}),
+		anchor:  anchor,
+		width:   width,
+		height:  labelHeight,
+	}, nil
+}
+
+func (l *textLabel) draw(r *renderer, model geom.Mat4) {
+	if c := r.canvas; c != nil {
+		c.label(r.mvp(model), l)
+		return
+	}
+	s, gl := l.shader, r.gl
+	s.use()
+	s.setMatrix("modelViewProjection", r.mvp(model))
+	gl.Call("uniform3f", s.uniform("anchor"), l.anchor[0], l.anchor[1], l.anchor[2])
+	gl.Call("uniform2f", s.uniform("size"), 2*float32(l.width)/float32(r.width), 2*float32(l.height)/float32(r.height))
+	gl.Call("activeTexture", gl.Get("TEXTURE0"))
+	gl.Call("bindTexture", gl.Get("TEXTURE_2D"), l.texture)
+	gl.Call("uniform1i", s.uniform("text"), 0)
+	pos := s.bind("position", l.quad, 2)
+	gl.Call("drawArrays", gl.Get("TRIANGLE_STRIP"), 0, 4)
+	s.unbind(pos)
+}
+
+func (l *textLabel) release() {
+	if l.shader == nil {
+		return
+	}
+	l.shader.gl.Call("deleteTexture", l.texture)
+	deleteBuffers(l.shader, l.quad)
+}
+
+// glyphInstances draws copies of one shaded shape (a glyph) at many
+// offsets, each with its own scale and color. It uses instanced drawing
+// where available and one draw call per instance otherwise. Without WebGL
+// each instance is drawn as a disc.
+type glyphInstances struct {
+	shader                 *shader
+	shape, shapeNormals    js.Value
+	shapeCount             int
+	offsets, scales, color []float32
+	offsetBuf, scaleBuf    js.Value
+	colorBuf               js.Value
+}
+
+const glyphVertexShader = `
+	attribute vec3 position;
+	attribute vec3 normal;
+	attribute vec3 offset;
+	attribute float scale;
+	attribute vec3 color;
+	uniform mat4 modelViewProjection;
+	uniform mat4 modelView;
+	varying vec3 vColor;
+	varying vec3 vNormal;
+	void main() {
+		gl_Position = modelViewProjection * vec4(offset + position * scale, 1.0);
+		vNormal = mat3(modelView) * normal;
+		vColor = color;
+	}
+`
+
+// newGlyphInstances returns instances of the triangle shape with the given
+// vertex normals; offsets and colors are xyz and rgb interleaved, with one
+// scale per instance.
+func newGlyphInstances(r *renderer, shape, normals, offsets, scales, colors []float32) (*glyphInstances, error) {
+	if r.canvas != nil {
+		return &glyphInstances{offsets: offsets, scales: scales, color: colors}, nil
+	}
+	s, err := r.shader("glyphs", glyphVertexShader, litFragmentShader)
+	if err != nil {
+		return nil, err
+	}
+	gl := r.gl
+	g := &glyphInstances{
+		shader:       s,
+		shape:        upload(gl, js.Undefined(), shape),
+		shapeNormals: upload(gl, js.Undefined(), normals),
+		shapeCount:   len(shape) / 3,
+		offsets:      offsets,
+		scales:       scales,
+		color:        colors,
+	}
+	if r.instancing.Truthy() {
+		g.offsetBuf = upload(gl, js.Undefined(), offsets)
+		g.scaleBuf = upload(gl, js.Undefined(), scales)
+		g.colorBuf = upload(gl, js.Undefined(), colors)
+	}
+	return g, nil
+}
+
+// setColors replaces the instance colors.
+func (g *glyphInstances) setColors(colors []float32) {
+	g.color = colors
+	if g.colorBuf.Truthy() {
+		g.colorBuf = upload(g.shader.gl, g.colorBuf, colors)
+	}
+}
+
+func (g *glyphInstances) draw(r *renderer, model geom.Mat4) {
+	n := len(g.scales)
+	if n == 0 {
+		return
+	}
+	if c := r.canvas; c != nil {
+		c.discs(r.mvp(model), g.offsets, g.scales, g.color)
+		return
+	}
+	s, gl := g.shader, r.gl
+	s.use()
+	s.setMatrix("modelViewProjection", r.mvp(model))
+	s.setMatrix("modelView", r.view.Mul(model))
+	pos := s.bind("position", g.shape, 3)
+	nor := s.bind("normal", g.shapeNormals, 3)
+	defer s.unbind(pos, nor)
+	offset, scale, color := s.attrib("offset"), s.attrib("scale"), s.attrib("color")
+
+	if ext := r.instancing; ext.Truthy() {
+		s.bind("offset", g.offsetBuf, 3)
+		s.bind("scale", g.scaleBuf, 1)
+		s.bind("color", g.colorBuf, 3)
+		for _, loc := range []int{offset, scale, color} {
+			ext.Call("vertexAttribDivisorANGLE", loc, 1)
+		}
+		ext.Call("drawArraysInstancedANGLE", gl.Get("TRIANGLES"), 0, g.shapeCount, n)
+		// Divisors are global state; reset them for other primitives.
+		for _, loc := range []int{offset, scale, color} {
+			ext.Call("vertexAttribDivisorANGLE", loc, 0)
+		}
+		s.unbind(offset, scale, color)
+		return
+	}
+	// Without instancing, per-instance attributes are constant values.
+	for i := 0; i < n; i++ {
+		gl.Call("vertexAttrib3f", offset, g.offsets[3*i], g.offsets[3*i+1], g.offsets[3*i+2])
+		gl.Call("vertexAttrib1f", scale, g.scales[i])
+		gl.Call("vertexAttrib3f", color, g.color[3*i], g.color[3*i+1], g.color[3*i+2])
+		gl.Call("drawArrays", gl.Get("TRIANGLES"), 0, g.shapeCount)
+	}
+}
+
+func (g *glyphInstances) release() {
+	deleteBuffers(g.shader, g.shape, g.shapeNormals, g.offsetBuf, g.scaleBuf, g.colorBuf)
+}
+
+// sphereGlyph returns the triangles and normals of a unit sphere with the
+// given number of latitude and longitude divisions.
+func sphereGlyph(stacks, slices int) (positions, normals []float32) {
+	vertex := func(i, j int) geom.Vec3 {
+		theta := math.Pi * float64(i) / float64(stacks)
+		phi := 2 * math.Pi * float64(j) / float64(slices)
+		return geom.Vec3{
+			float32(math.Sin(theta) * math.Cos(phi)),
+			float32(math.Cos(theta)),
+			float32(math.Sin(theta) * math.Sin(phi)),
+		}
+	}
+	for i := 0; i < stacks; i++ {
+		for j := 0; j < slices; j++ {
+			a, b := vertex(i, j), vertex(i+1, j)
+			c, d := vertex(i+1, j+1), vertex(i, j+1)
+			for _, p := range []geom.Vec3{a, b, c, a, c, d} {
+				positions = append(positions, p[:]...)
+			}
+		}
+	}
+	// On a unit sphere the normal is the position.
+	return positions, append([]float32(nil), positions...)
+}
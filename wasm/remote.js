@@ -0,0 +1,191 @@
+// Remote view for browsers that cannot run the viewer themselves (no
+// WebAssembly, or when asked for with ?remote): the server
+// renders the view and streams it as JPEG frames over a WebSocket, and
+// this script draws the frames on the canvas and sends input back. The
+// menu bar becomes a toolbar for choosing the dataset and coloring. Drag
+// to turn the view; R toggles rotation and 0 resets it. bootstrap.js
+// loads this script and calls remoteView.start.
+(() => {
+	"use strict";
+
+	const start = ({ setMessage, ready, fail }) => {
+		const canvas = document.getElementById("canvas");
+		const ctx = canvas.getContext("2d");
+		const status = document.getElementById("status");
+		if (!ctx || typeof WebSocket !== "function") {
+			fail("This browser can neither run the viewer nor show the remote view.");
+			return;
+		}
+		const setStatus = (text) => {
+			status.textContent = text;
+			status.style.display = text ? "block" : "none";
+		};
+
+		const url = new URL("api/render/ws", location.href);
+		url.protocol = url.protocol === "https:" ? "wss:" : "ws:";
+		const ws = new WebSocket(url.href);
+		const send = (msg) => {
+			if (ws.readyState === WebSocket.OPEN) {
+				ws.send(JSON.stringify(msg));
+			}
+		};
+
+		// Toolbar
+		const bar = document.getElementById("menubar");
+		bar.classList.add("remote-toolbar");
+		const select = (title, onChange) => {
+			const el = document.createElement("select");
+			el.title = title;
+			el.addEventListener("change", onChange);
+			bar.appendChild(el);
+			return el;
+		};
+		const setOptions = (el, values, selected) => {
+			el.textContent = "";
+			for (const value of values) {
+				const opt = document.createElement("option");
+				opt.value = opt.textContent = value;
+				el.appendChild(opt);
+			}
+			el.value = selected;
+		};
+		const label = document.createElement("span");
+		label.className = "remote-label";
+		label.textContent = "Remote view";
+		bar.appendChild(label);
+		const datasets = select("Dataset", () => load(datasets.value));
+		const colorBy = select("Color by", () => recolor());
+		const colormaps = select("Colormap", () => recolor());
+		const rotate = document.createElement("button");
+		rotate.textContent = "Rotate";
+		rotate.addEventListener("click", () => send({ type: "rotate" }));
+		bar.appendChild(rotate);
+		const fps = document.createElement("span");
+		fps.className = "remote-label";
+		bar.appendChild(fps);
+
+		const load = (name, options) => {
+			setStatus(`Loading ${name}…`);
+			send({ type: "load", dataset: name, options: options || "" });
+		};
+		const recolor = () => {
+			send({ type: "color", by: colorBy.value === "none" ? "" : colorBy.value, colormap: colormaps.value });
+		};
+
+		// Only the latest frame is drawn; frames arriving while one is
+		// decoding replace the pending one.
+		let pending = null;
+		let drawing = false;
+		let frames = 0;
+		let first = true;
+		const drawNext = () => {
+			const blob = pending;
+			pending = null;
+			drawing = !!blob;
+			if (!blob) {
+				return;
+			}
+			const src = URL.createObjectURL(blob);
+			const img = new Image();
+			img.onload = img.onerror = () => {
+				URL.revokeObjectURL(src);
+				if (img.naturalWidth) {
+					ctx.drawImage(img, 0, 0, canvas.width, canvas.height);
+					frames++;
+					if (first) {
+						first = false;
+						ready();
+					}
+				}
+				drawNext();
+			};
+			img.src = src;
+		};
+		setInterval(() => {
+			fps.textContent = `${frames} fps`;
+			frames = 0;
+		}, 1000);
+
+		ws.binaryType = "blob";
+		ws.onopen = async () => {
+			setMessage("Loading dataset…");
+			send({ type: "resize", width: canvas.width, height: canvas.height });
+			const params = new URLSearchParams(location.search);
+			let names = [];
+			try {
+				const resp = await fetch("api/datasets/");
+				names = await resp.json();
+			} catch (e) {
+				console.warn("dataset list:", e);
+			}
+			const name = params.get("dataset") || names[0];
+			if (!name) {
+				fail("The server has no datasets to show.");
+				return;
+			}
+			setOptions(datasets, names.indexOf(name) < 0 ? [name].concat(names) : names, name);
+			load(name, params.get("options"));
+		};
+		ws.onmessage = (e) => {
+			if (typeof e.data !== "string") {
+				pending = e.data;
+				if (!drawing) {
+					drawNext();
+				}
+				return;
+			}
+			const msg = JSON.parse(e.data);
+			if (msg.type === "loaded") {
+				setStatus("");
+				setOptions(colorBy, ["none"].concat(msg.attributes || []), msg.colorBy || "none");
+				if (!colormaps.options.length) {
+					setOptions(colormaps, msg.colormaps, "viridis");
+				}
+				label.textContent = `Remote view · ${msg.dataset} · ${msg.points} points`;
+				if (colormaps.value !== "viridis") {
+					recolor();
+				}
+			} else if (msg.type === "error") {
+				setStatus(msg.message);
+				if (first) {
+					fail(msg.message);
+				}
+			}
+		};
+		ws.onclose = () => {
+			if (first) {
+				fail("Could not connect to the remote view.");
+			} else {
+				setStatus("The remote view was disconnected. Reload the page to reconnect.");
+			}
+		};
+
+		// Input
+		let dragX = null;
+		canvas.addEventListener("pointerdown", (e) => {
+			dragX = e.clientX;
+			canvas.setPointerCapture(e.pointerId);
+		});
+		canvas.addEventListener("pointermove", (e) => {
+			if (dragX !== null) {
+				send({ type: "drag", dx: e.clientX - dragX });
+				dragX = e.clientX;
+			}
+		});
+		canvas.addEventListener("pointerup", () => {
+			dragX = null;
+		});
+		document.addEventListener("keydown", (e) => {
+			if (e.target.tagName === "SELECT" || e.ctrlKey || e.metaKey || e.altKey) {
+				return;
+			}
+			if (e.key === "r" || e.key === "R") {
+				send({ type: "rotate" });
+			} else if (e.key === "0") {
+				send({ type: "reset" });
+			}
+		});
+	};
+
+	window.remoteView = { start };
+})();
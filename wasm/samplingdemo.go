@@ -0,0 +1,412 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/geom"
+	"github.com/sbecker11/threedistvis-go/sampling"
+	"github.com/sbecker11/threedistvis-go/stats"
+)
+
+// samplingDemo is a teaching mode for sampling distributions. In "clt"
+// mode it repeatedly draws samples of size n from a source distribution
+// and accumulates the estimates, which gather inside the 95% ellipsoid of
+// their limiting Gaussian. In "lln" mode it grows a single sample and
+// traces the running estimate as it settles on the true value, while the
+// ellipsoid shrinks with the sample size.
+//
+// The demo replaces the dataset in the view while it runs:
+//
+//	scene
+//	├── data                 hidden
+//	└── sampling             centers the limit in the view
+//	    ├── estimates
+//	    └── ellipsoid        unit sphere mapped onto the 95% ellipsoid
+type samplingDemo struct {
+	v    *viewer
+	root js.Value
+	body js.Value
+
+	dist, estimator, mode, size js.Value // form controls
+	pause                       js.Value
+
+	node      *node
+	points    *pointSet
+	ellipsoid *node
+
+	rng     *rand.Rand
+	source  *sampling.Distribution
+	est     string
+	n       int
+	lln     bool
+	running bool
+
+	positions, colors []float32
+	estimates         stats.Welford
+	inside            int          // estimates within the ellipsoid
+	sample            [][3]float64 // the growing sample in lln mode
+	center            [3]float64   // of the limiting Gaussian
+	cov               [3][3]float64
+	chol              [3][3]float64
+	limit             bool // whether the estimator has a Gaussian limit
+}
+
+// Replicates in clt mode and draws in lln mode stop at these counts;
+// each frame adds at most maxDemoDraws draws.
+const (
+	maxReplicates = 5000
+	maxLLNDraws   = 100000
+	maxDemoDraws  = 20000
+)
+
+var theSampling *samplingDemo
+
+func initSamplingDemo(v *viewer) error {
+	d := &samplingDemo{v: v, root: document.Call("getElementById", "sampling-panel")}
+	theSampling = d
+	points, err := newPointSet(v.renderer)
+	if err != nil {
+		return err
+	}
+	d.points = points
+	positions, colors := wireSphere(colormap.RGB{R: 1, G: 1, B: 1})
+	wire, err := newLineSet(v.renderer, positions, colors)
+	if err != nil {
+		return err
+	}
+	d.node = v.scene.add(newNode("sampling", nil))
+	d.node.hidden = true
+	d.node.add(newNode("estimates", points))
+	d.ellipsoid = d.node.add(newNode("ellipsoid", wire))
+
+	d.root.Call("appendChild", element("div", "panel-title", "Sampling distributions"))
+	field := func(label string, control js.Value) js.Value {
+		row := element("label", "panel-row", label)
+		row.Call("appendChild", control)
+		d.root.Call("appendChild", row)
+		control.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			d.restart()
+			return nil
+		}))
+		return control
+	}
+	choice := func(values []string) js.Value {
+		sel := element("select", "", "")
+		for _, value := range values {
+			opt := element("option", "", value)
+			opt.Set("value", value)
+			sel.Call("appendChild", opt)
+		}
+		return sel
+	}
+	d.dist = field("Distribution", choice(sampling.Names()))
+	d.estimator = field("Estimator", choice(sampling.Estimators))
+	d.mode = field("Mode", choice([]string{"clt", "lln"}))
+	d.size = field("Sample size n", input("number", "30"))
+	d.size.Set("min", 1)
+
+	d.body = element("div", "", "")
+	d.root.Call("appendChild", d.body)
+	buttons := element("div", "panel-buttons", "")
+	d.root.Call("appendChild", buttons)
+	button := func(label string, fn func()) js.Value {
+		b := element("button", "", label)
+		b.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			fn()
+			return nil
+		}))
+		buttons.Call("appendChild", b)
+		return b
+	}
+	d.pause = button("Pause", func() {
+		d.running = !d.running
+		d.updatePause()
+	})
+	button("Restart", d.restart)
+	button("Close", d.stop)
+	return nil
+}
+
+// start shows the demo with the given settings, which fall back to the
+// form's current values where empty.
+func (d *samplingDemo) start(dist, estimator, mode, size string) {
+	for _, f := range []struct {
+		control js.Value
+		value   string
+	}{{d.dist, dist}, {d.estimator, estimator}, {d.mode, mode}, {d.size, size}} {
+		if f.value != "" {
+			f.control.Set("value", f.value)
+		}
+	}
+	theStats.stop()
+	thePattern.hide()
+	theEmbedding.stop()
+	d.v.data.hidden = true
+	d.node.hidden = false
+	d.v.demo = d
+	d.root.Get("style").Set("display", "block")
+	d.restart()
+}
+
+func (d *samplingDemo) stop() {
+	if d.v.demo != d {
+		return
+	}
+	d.v.demo = nil
+	d.running = false
+	d.node.hidden = true
+	d.v.data.hidden = false
+	d.root.Get("style").Set("display", "none")
+}
+
+// restart reads the form and starts accumulating from scratch.
+func (d *samplingDemo) restart() {
+	source, ok := sampling.Get(d.dist.Get("value").String())
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(d.size.Get("value").String())
+	if err != nil || n < 1 {
+		n = 1
+	} else if n > maxDemoDraws {
+		n = maxDemoDraws
+	}
+	d.source, d.est, d.n = source, d.estimator.Get("value").String(), n
+	d.lln = d.mode.Get("value").String() == "lln"
+	d.rng = rand.New(rand.NewSource(rand.Int63()))
+	d.positions, d.colors = nil, nil
+	d.estimates, d.inside, d.sample = stats.Welford{}, 0, nil
+	d.points.setPositions(nil)
+
+	// Fit the view to the limit at n, or at 10 draws when tracing; an
+	// estimator without a limit is framed by the median's.
+	viewN := n
+	if d.lln {
+		viewN = 10
+	}
+	center, cov, ok := source.Limit(d.est, viewN)
+	d.limit = ok
+	if !ok {
+		center, cov, _ = source.Limit("median", viewN)
+	}
+	d.center = center
+	var radius float64
+	for k := range cov {
+		radius = math.Max(radius, math.Sqrt(sampling.Chi2Level95*cov[k][k]))
+	}
+	scale := float32(0.6 / radius)
+	d.node.transform = geom.Scale(geom.Vec3{scale, scale, scale}).Mul(geom.Translate(vec3(center).Scale(-1)))
+	d.setEllipsoid(viewN)
+	d.running = true
+	d.updatePause()
+	d.render()
+}
+
+// setEllipsoid fits the wireframe to the 95% ellipsoid of the limit at
+// sample size n.
+func (d *samplingDemo) setEllipsoid(n int) {
+	center, cov, ok := d.source.Limit(d.est, n)
+	if ok {
+		d.chol, ok = sampling.Cholesky(cov)
+	}
+	d.ellipsoid.hidden = !ok
+	if !ok {
+		return
+	}
+	d.center, d.cov = center, cov
+	// Map the unit sphere through the Cholesky factor, scaled to the level.
+	r := float32(math.Sqrt(sampling.Chi2Level95))
+	m := geom.Identity()
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			m[4*j+i] = r * float32(d.chol[i][j])
+		}
+	}
+	d.ellipsoid.transform = geom.Translate(vec3(center)).Mul(m)
+}
+
+// step advances the demo by one animation frame.
+func (d *samplingDemo) step() {
+	if !d.running {
+		return
+	}
+	if d.lln {
+		d.stepLLN()
+	} else {
+		d.stepCLT()
+	}
+	d.points.setPositions(d.positions)
+	d.points.setColors(d.colors)
+	d.render()
+}
+
+func (d *samplingDemo) stepCLT() {
+	batch := maxDemoDraws / d.n
+	if batch > 20 {
+		batch = 20
+	} else if batch < 1 {
+		batch = 1
+	}
+	for i := 0; i < batch && int(d.estimates.N) < maxReplicates; i++ {
+		e, err := sampling.Estimate(d.est, d.source.Sample(d.n, d.rng))
+		if err != nil {
+			setStatus("Sampling: %v", err)
+			d.running = false
+			return
+		}
+		d.estimates.Add(e)
+		color := d.v.palette.At(0)
+		if d.limit {
+			if d.within(e) {
+				d.inside++
+			} else {
+				color = d.v.palette.At(1)
+			}
+		}
+		d.add(e, color)
+	}
+	if int(d.estimates.N) >= maxReplicates {
+		d.running = false
+		d.updatePause()
+	}
+}
+
+// stepLLN grows the sample by about 3%, so the trace has evenly spaced
+// points in log sample size.
+func (d *samplingDemo) stepLLN() {
+	k := len(d.sample)
+	grow := k * 3 / 100
+	if grow < 1 {
+		grow = 1
+	}
+	if grow > maxDemoDraws {
+		grow = maxDemoDraws
+	}
+	for i := 0; i < grow; i++ {
+		d.sample = append(d.sample, d.source.Draw(d.rng))
+	}
+	k = len(d.sample)
+	e, err := sampling.Estimate(d.est, d.sample)
+	if err != nil {
+		setStatus("Sampling: %v", err)
+		d.running = false
+		return
+	}
+	d.setEllipsoid(k)
+	t := math.Log(float64(k)) / math.Log(maxLLNDraws)
+	d.add(e, d.v.cmap.At(t))
+	if k >= maxLLNDraws {
+		d.running = false
+		d.updatePause()
+	}
+}
+
+func (d *samplingDemo) add(e [3]float64, c colormap.RGB) {
+	d.positions = append(d.positions, float32(e[0]), float32(e[1]), float32(e[2]))
+	d.colors = append(d.colors, float32(c.R), float32(c.G), float32(c.B))
+}
+
+// within reports whether e lies inside the current 95% ellipsoid.
+func (d *samplingDemo) within(e [3]float64) bool {
+	var dev [3]float64
+	for k := range dev {
+		dev[k] = e[k] - d.center[k]
+	}
+	return sampling.Mahalanobis2(d.chol, dev) <= sampling.Chi2Level95
+}
+
+func (d *samplingDemo) updatePause() {
+	if d.running {
+		d.pause.Set("textContent", "Pause")
+	} else {
+		d.pause.Set("textContent", "Resume")
+	}
+}
+
+// render compares the estimates with the theory.
+func (d *samplingDemo) render() {
+	d.body.Set("innerHTML", "")
+	row := func(label, value string) {
+		r := element("div", "panel-row", "")
+		r.Call("appendChild", element("span", "", label))
+		r.Call("appendChild", element("span", "stats-value", value))
+		d.body.Call("appendChild", r)
+	}
+	d.body.Call("appendChild", element("div", "legend-range", d.source.Description))
+	sd := func(cov [3][3]float64) string {
+		return vector([]float64{math.Sqrt(cov[0][0]), math.Sqrt(cov[1][1]), math.Sqrt(cov[2][2])})
+	}
+
+	if d.lln {
+		k := len(d.sample)
+		row("Draws", strconv.Itoa(k))
+		if k == 0 {
+			return
+		}
+		n := len(d.positions)
+		row("Estimate", vector([]float64{float64(d.positions[n-3]), float64(d.positions[n-2]), float64(d.positions[n-1])}))
+		if d.limit {
+			row("True value", vector(d.center[:]))
+			row("Std. error", sd(d.cov))
+		} else {
+			d.body.Call("appendChild", element("div", "legend-warning",
+				fmt.Sprintf("The %s does not exist for this distribution, so the law of large numbers does not apply.", d.est)))
+		}
+		return
+	}
+
+	row("Replicates", strconv.FormatInt(d.estimates.N, 10))
+	if d.estimates.N < 2 {
+		return
+	}
+	row("Mean of estimates", vector(d.estimates.Mean[:]))
+	row("Std. dev. of estimates", sd(d.estimates.Cov()))
+	if !d.limit {
+		d.body.Call("appendChild", element("div", "legend-warning",
+			fmt.Sprintf("The %s has no Gaussian limit for this distribution: the estimates do not settle however large n is.", d.est)))
+		return
+	}
+	row("Limit center", vector(d.center[:]))
+	row("Limit std. dev.", sd(d.cov))
+	row("Inside 95% ellipsoid", fmt.Sprintf("%.1f%%", 100*float64(d.inside)/float64(d.estimates.N)))
+}
+
+func vec3(p [3]float64) geom.Vec3 {
+	return geom.Vec3{float32(p[0]), float32(p[1]), float32(p[2])}
+}
+
+// wireSphere returns the line segments of a unit sphere's meridians and
+// parallels, in one color.
+func wireSphere(c colormap.RGB) (positions, colors []float32) {
+	const segments = 48
+	circle := func(at func(t float64) geom.Vec3) {
+		for i := 0; i < segments; i++ {
+			a := at(2 * math.Pi * float64(i) / segments)
+			b := at(2 * math.Pi * float64(i+1) / segments)
+			positions = append(positions, a[:]...)
+			positions = append(positions, b[:]...)
+			colors = append(colors, float32(c.R), float32(c.G), float32(c.B), float32(c.R), float32(c.G), float32(c.B))
+		}
+	}
+	for m := 0; m < 6; m++ {
+		phi := math.Pi * float64(m) / 6
+		circle(func(t float64) geom.Vec3 {
+			return geom.Vec3{float32(math.Cos(t) * math.Cos(phi)), float32(math.Sin(t)), float32(math.Cos(t) * math.Sin(phi))}
+		})
+	}
+	for p := 1; p < 6; p++ {
+		theta := math.Pi * float64(p) / 6
+		y, r := math.Cos(theta), math.Sin(theta)
+		circle(func(t float64) geom.Vec3 {
+			return geom.Vec3{float32(r * math.Cos(t)), float32(y), float32(r * math.Sin(t))}
+		})
+	}
+	return positions, colors
+}
@@ -0,0 +1,266 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/geom"
+)
+
+// A node is an element of the scene graph. Its transform places it relative
+// to its parent; its primitive, if any, is drawn with the combined
+// transform of the node and its ancestors. Overlays and analysis results
+// are added as nodes, so the render loop never needs to change.
+type node struct {
+	name      string
+	transform geom.Mat4
+	hidden    bool
+	primitive primitive
+	parent    *node
+	children  []*node
+}
+
+// A primitive is drawable geometry that owns its GPU buffers, textures and
+// shader. Primitives of a Canvas 2D renderer have no shader and keep their
+// data on the CPU instead.
+type primitive interface {
+	// draw renders the primitive with the given model transform.
+	draw(r *renderer, model geom.Mat4)
+	// release frees the primitive's GPU resources.
+	release()
+}
+
+func newNode(name string, p primitive) *node {
+	return &node{name: name, transform: geom.Identity(), primitive: p}
+}
+
+// add appends child to n and returns child.
+func (n *node) add(child *node) *node {
+	if child.parent != nil {
+		child.parent.detach(child)
+	}
+	child.parent = n
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *node) detach(child *node) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			child.parent = nil
+			return
+		}
+	}
+}
+
+// remove detaches child and releases the GPU resources of its subtree.
+func (n *node) remove(child *node) {
+	n.detach(child)
+	child.releaseAll()
+}
+
+func (n *node) releaseAll() {
+	if n.primitive != nil {
+		n.primitive.release()
+	}
+	for _, c := range n.children {
+		c.releaseAll()
+	}
+}
+
+// setPrimitive replaces the node's primitive, releasing the old one.
+func (n *node) setPrimitive(p primitive) {
+	if n.primitive != nil {
+		n.primitive.release()
+	}
+	n.primitive = p
+}
+
+// find returns the first node named name in n's subtree, or nil.
+func (n *node) find(name string) *node {
+	if n.name == name {
+		return n
+	}
+	for _, c := range n.children {
+		if f := c.find(name); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// renderer draws a scene graph with WebGL, or with the Canvas 2D API where
+// WebGL is not available. It compiles each primitive type's shader once and
+// holds the camera for the frame being drawn.
+type renderer struct {
+	gl      js.Value
+	shaders map[string]*shader
+	// instancing is the ANGLE_instanced_arrays extension, or null.
+	instancing js.Value
+	// canvas is set, and gl null, when drawing without WebGL.
+	canvas *canvas2D
+
+	// Set for each frame by render.
+	view, proj    geom.Mat4
+	width, height int // drawing buffer size in pixels
+}
+
+func newRenderer(gl js.Value) *renderer {
+	return &renderer{
+		gl:         gl,
+		shaders:    map[string]*shader{},
+		instancing: gl.Call("getExtension", "ANGLE_instanced_arrays"),
+	}
+}
+
+// newCanvasRenderer returns a renderer that draws on the CPU into a Canvas
+// 2D context.
+func newCanvasRenderer(ctx js.Value) *renderer {
+	return &renderer{
+		gl:         js.Null(),
+		shaders:    map[string]*shader{},
+		instancing: js.Null(),
+		canvas:     newCanvas2D(ctx),
+	}
+}
+
+// render draws the visible nodes below root.
+func (r *renderer) render(root *node, view, proj geom.Mat4) {
+	r.view, r.proj = view, proj
+	if c := r.canvas; c != nil {
+		canvas := c.ctx.Get("canvas")
+		r.width, r.height = canvas.Get("width").Int(), canvas.Get("height").Int()
+		c.begin(r.width, r.height)
+		r.visit(root, geom.Identity())
+		c.end()
+		return
+	}
+	r.width = r.gl.Get("drawingBufferWidth").Int()
+	r.height = r.gl.Get("drawingBufferHeight").Int()
+	r.visit(root, geom.Identity())
+}
+
+func (r *renderer) visit(n *node, parent geom.Mat4) {
+	if n.hidden {
+		return
+	}
+	model := parent.Mul(n.transform)
+	if n.primitive != nil {
+		n.primitive.draw(r, model)
+	}
+	for _, c := range n.children {
+		r.visit(c, model)
+	}
+}
+
+// shader is a linked program with cached attribute and uniform locations.
+type shader struct {
+	gl       js.Value
+	program  js.Value
+	attribs  map[string]int
+	uniforms map[string]js.Value
+}
+
+// shader returns the program registered under name, compiling it from the
+// given sources the first time.
+func (r *renderer) shader(name, vertexSource, fragmentSource string) (*shader, error) {
+	if s, ok := r.shaders[name]; ok {
+		return s, nil
+	}
+	program, err := linkProgram(r.gl, vertexSource, fragmentSource)
+	if err != nil {
+		return nil, errors.New(name + " shader: " + err.Error())
+	}
+	s := &shader{gl: r.gl, program: program, attribs: map[string]int{}, uniforms: map[string]js.Value{}}
+	r.shaders[name] = s
+	return s, nil
+}
+
+func (s *shader) attrib(name string) int {
+	loc, ok := s.attribs[name]
+	if !ok {
+		loc = s.gl.Call("getAttribLocation", s.program, name).Int()
+		s.attribs[name] = loc
+	}
+	return loc
+}
+
+func (s *shader) uniform(name string) js.Value {
+	loc, ok := s.uniforms[name]
+	if !ok {
+		loc = s.gl.Call("getUniformLocation", s.program, name)
+		s.uniforms[name] = loc
+	}
+	return loc
+}
+
+func (s *shader) use() {
+	s.gl.Call("useProgram", s.program)
+}
+
+// setMatrix sets a mat4 uniform.
+func (s *shader) setMatrix(name string, m geom.Mat4) {
+	s.gl.Call("uniformMatrix4fv", s.uniform(name), false, float32Array(m[:]))
+}
+
+// bind enables the named attribute and points it at buf, which holds size
+// floats per vertex. It returns the attribute location, or -1 if the
+// shader does not use the attribute.
+func (s *shader) bind(name string, buf js.Value, size int) int {
+	loc := s.attrib(name)
+	if loc < 0 {
+		return loc
+	}
+	gl := s.gl
+	gl.Call("bindBuffer", gl.Get("ARRAY_BUFFER"), buf)
+	gl.Call("enableVertexAttribArray", loc)
+	gl.Call("vertexAttribPointer", loc, size, gl.Get("FLOAT"), false, 0, 0)
+	return loc
+}
+
+// unbind disables attribute arrays enabled by bind.
+func (s *shader) unbind(locs ...int) {
+	for _, loc := range locs {
+		if loc >= 0 {
+			s.gl.Call("disableVertexAttribArray", loc)
+		}
+	}
+}
+
+// upload creates or refills an array buffer with data.
+func upload(gl, buf js.Value, data []float32) js.Value {
+	if !buf.Truthy() {
+		buf = gl.Call("createBuffer")
+	}
+	gl.Call("bindBuffer", gl.Get("ARRAY_BUFFER"), buf)
+	gl.Call("bufferData", gl.Get("ARRAY_BUFFER"), float32Array(data), gl.Get("STATIC_DRAW"))
+	return buf
+}
+
+// linkProgram compiles and links a shader program.
+func linkProgram(gl js.Value, vertexSource, fragmentSource string) (js.Value, error) {
+	program := gl.Call("createProgram")
+	for _, s := range []struct {
+		kind   string
+		source string
+	}{{"VERTEX_SHADER", vertexSource}, {"FRAGMENT_SHADER", fragmentSource}} {
+		shader := gl.Call("createShader", gl.Get(s.kind))
+		gl.Call("shaderSource", shader, s.source)
+		gl.Call("compileShader", shader)
+		if !gl.Call("getShaderParameter", shader, gl.Get("COMPILE_STATUS")).Bool() {
+			return js.Null(), errors.New(gl.Call("getShaderInfoLog", shader).String())
+		}
+		gl.Call("attachShader", program, shader)
+	}
+	// Some drivers need attribute 0 to be an enabled array; every shader
+	// has a per-vertex position.
+	gl.Call("bindAttribLocation", program, 0, "position")
+	gl.Call("linkProgram", program)
+	if !gl.Call("getProgramParameter", program, gl.Get("LINK_STATUS")).Bool() {
+		return js.Null(), errors.New(gl.Call("getProgramInfoLog", program).String())
+	}
+	return program, nil
+}
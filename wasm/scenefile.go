@@ -0,0 +1,131 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+)
+
+// sceneVersion is written to scene files and checked on open.
+const sceneVersion = 1
+
+// sceneState captures the view as a scene file: the dataset source and
+// everything needed to color and orient it the same way. The colormap is
+// stored in full so user colormaps travel with the file.
+func (v *viewer) sceneState() map[string]interface{} {
+	return map[string]interface{}{
+		"version": float64(sceneVersion),
+		"dataset": map[string]interface{}{
+			"name":    v.source.name,
+			"options": v.source.options,
+		},
+		"colorBy":  v.colorBy,
+		"colormap": v.cmap.ToJSON(),
+		"palette":  v.palette.Name,
+		"cvd":      v.cvd.String(),
+		"view": map[string]interface{}{
+			"angle":    float64(v.angle),
+			"rotating": v.rotating,
+		},
+		"surfaces": v.surfaceState(),
+		"notes":    v.noteState(),
+		"story":    v.story.state(),
+	}
+}
+
+// applyScene restores a state produced by sceneState, reloading the
+// dataset if it differs from the current one. It may block on the network.
+func (v *viewer) applyScene(state map[string]interface{}) error {
+	if version, _ := state["version"].(float64); version != sceneVersion {
+		return fmt.Errorf("unsupported scene version %v", state["version"])
+	}
+	if ds, ok := state["dataset"].(map[string]interface{}); ok {
+		name, _ := ds["name"].(string)
+		options, _ := ds["options"].(string)
+		if embedded, _ := ds["embedded"].(bool); embedded {
+			// A snapshot: the data came with the state.
+		} else if stream, ok := strings.CutPrefix(name, "stream/"); ok {
+			theStats.watch(stream)
+		} else if name != "" && (name != v.source.name || options != v.source.options) {
+			if err := loadDataset(v, name, options); err != nil {
+				return err
+			}
+		}
+	}
+	if def, ok := state["colormap"]; ok {
+		m, err := colormap.FromJSON(def)
+		if err != nil {
+			return err
+		}
+		if builtin, ok := colormap.Get(m.Name); ok {
+			m = builtin
+		} else if err := v.addColormap(m); err != nil {
+			return err
+		}
+		v.cmap = m
+	}
+	if name, ok := state["palette"].(string); ok {
+		if p, ok := colormap.GetPalette(name); ok {
+			v.palette = p
+		}
+	}
+	if name, ok := state["cvd"].(string); ok {
+		if d, err := colormap.ParseDeficiency(name); err == nil {
+			v.cvd = d
+		}
+	}
+	if view, ok := state["view"].(map[string]interface{}); ok {
+		angle, _ := view["angle"].(float64)
+		v.angle = float32(angle)
+		v.rotating, _ = view["rotating"].(bool)
+	}
+	if colorBy, ok := state["colorBy"].(string); ok {
+		v.colorBy = colorBy
+	}
+	if list, ok := state["surfaces"].([]interface{}); ok {
+		if err := v.applySurfaces(list); err != nil {
+			return err
+		}
+	}
+	if list, ok := state["notes"].([]interface{}); ok {
+		if err := v.applyNotes(list); err != nil {
+			return err
+		}
+	}
+	if list, ok := state["story"].([]interface{}); ok {
+		v.story.apply(list)
+	}
+	v.recolor()
+	return nil
+}
+
+func saveScene(v *viewer) {
+	b, err := encodeJSON(v.sceneState())
+	if err != nil {
+		setStatus("Save failed: %v", err)
+		return
+	}
+	name := v.source.name
+	if name == "" {
+		name = "scene"
+	}
+	downloadBytes(strings.ReplaceAll(name, "/", "-")+".scene.json", "application/json", b)
+}
+
+func openScene(v *viewer) {
+	pickFile(".json,application/json", func(name, text string) {
+		var state map[string]interface{}
+		if err := decodeJSON([]byte(text), &state); err != nil {
+			setStatus("%s: %v", name, err)
+			return
+		}
+		if err := v.applyScene(state); err != nil {
+			reportError(name, err)
+			return
+		}
+		savePrefs(v)
+	})
+}
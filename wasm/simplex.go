@@ -0,0 +1,81 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/compositional"
+	"github.com/sbecker11/threedistvis-go/geom"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/render"
+)
+
+// Clouds with part names are compositions shown in the simplex: a triangle
+// for three parts and a tetrahedron for four, with each vertex labeled by
+// the part that is 1 there.
+const (
+	simplexLabelOffset = 1.08 // of the vertex distance from the center
+	simplexGray        = 0.5
+)
+
+// setSimplex replaces the simplex frame with one for the current cloud, or
+// removes it if the cloud is not a composition in the simplex. For
+// compositions it also refits the view to the whole simplex, so the frame
+// does not move as the points change.
+func (v *viewer) setSimplex() {
+	if v.simplex != nil {
+		v.simplex.parent.remove(v.simplex)
+		v.simplex = nil
+	}
+	vertices := compositional.Vertices(len(v.cloud.Parts))
+	if vertices == nil {
+		return
+	}
+	if err := v.buildSimplex(vertices); err != nil {
+		reportError("Simplex failed", err)
+	}
+}
+
+func (v *viewer) buildSimplex(vertices [][3]float64) error {
+	simplex := newNode("simplex", nil)
+	box := pointcloud.New("", len(vertices))
+	var positions, colors []float32
+	for i, a := range vertices {
+		for _, b := range vertices[i+1:] {
+			for _, p := range [][3]float64{a, b} {
+				positions = append(positions, float32(p[0]), float32(p[1]), float32(p[2]))
+				colors = append(colors, simplexGray, simplexGray, simplexGray)
+			}
+		}
+		at := geom.Vec3{float32(a[0]), float32(a[1]), float32(a[2])}.Scale(simplexLabelOffset)
+		if err := addLabel(v.renderer, simplex, v.cloud.Parts[i], "#ffffff", at); err != nil {
+			return err
+		}
+		box.SetPoint(i, at[0], at[1], at[2])
+	}
+	edges, err := newLineSet(v.renderer, positions, colors)
+	if err != nil {
+		return err
+	}
+	simplex.primitive = edges
+	v.center, v.scale = render.Fit(box)
+	v.simplex = v.data.add(simplex)
+	return nil
+}
+
+// setTransform reloads the current composition dataset in the coordinates
+// of the named transform.
+func (v *viewer) setTransform(transform string) error {
+	if !strings.HasPrefix(v.source.name, "simplex/") {
+		return errors.New("the current dataset is not a composition")
+	}
+	params, err := url.ParseQuery(v.source.options)
+	if err != nil {
+		return err
+	}
+	params.Set("transform", transform)
+	return loadDataset(v, v.source.name, params.Encode())
+}
@@ -0,0 +1,141 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// A snapshot is a single HTML file holding the whole client and the current
+// view, which opens offline with full interactivity. Besides the page, its
+// styles and scripts, it embeds three script elements that are never
+// executed:
+//
+//	snapshot-wasm    the WASM client, base64
+//	snapshot-state   the scene state, JSON
+//	snapshot-data    the displayed cloud in the binary wire format, gzipped
+//	                 and base64
+//
+// bootstrap.js instantiates the embedded client and startup restores the
+// view from the state and data instead of the server.
+
+// offline is set when running from a snapshot, where there is no server to
+// talk to.
+var offline bool
+
+// exportSnapshot builds a snapshot of the current view and offers it for
+// download. It fetches the client files from the server and so blocks.
+func exportSnapshot(v *viewer) error {
+	if offline {
+		return errors.New("snapshots cannot be exported from a snapshot")
+	}
+	setStatus("Building snapshot…")
+	files := map[string]string{}
+	for _, name := range []string{"index.html", "styles.css", "wasm_exec.js", "bootstrap.js", "main.wasm"} {
+		b, err := fetchBytes(name)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		files[name] = string(b)
+	}
+
+	state := v.sceneState()
+	if ds, ok := state["dataset"].(map[string]interface{}); ok {
+		ds["embedded"] = true
+	}
+	stateJSON, err := encodeJSON(state)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	zw := gzip.NewWriter(&data)
+	if err := v.cloud.Encode(zw); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	// Inline the page's external files, checking each reference exists so
+	// a changed index.html fails loudly rather than producing a broken
+	// snapshot.
+	page := files["index.html"]
+	embedded := dataScript("snapshot-wasm", "application/octet-stream", base64.StdEncoding.EncodeToString([]byte(files["main.wasm"]))) +
+		dataScript("snapshot-state", "application/json", strings.ReplaceAll(string(stateJSON), "<", `\u003c`)) +
+		dataScript("snapshot-data", "application/octet-stream", base64.StdEncoding.EncodeToString(data.Bytes()))
+	for _, r := range []struct{ ref, inline string }{
+		{`<link rel="stylesheet" href="styles.css">`, "<style>\n" + escapeEnd(files["styles.css"], "</style") + "</style>"},
+		{`<script src="wasm_exec.js"></script>`, inlineScript(files["wasm_exec.js"])},
+		{`<script src="bootstrap.js"></script>`, embedded + inlineScript(files["bootstrap.js"])},
+	} {
+		if !strings.Contains(page, r.ref) {
+			return fmt.Errorf("index.html has no %s", r.ref)
+		}
+		page = strings.Replace(page, r.ref, r.inline, 1)
+	}
+
+	downloadBytes(strings.ReplaceAll(v.cloud.Name, "/", "-")+".snapshot.html", "text/html", []byte(page))
+	setStatus("")
+	return nil
+}
+
+func dataScript(id, kind, content string) string {
+	return fmt.Sprintf("<script id=%q type=%q>%s</script>\n\t", id, kind, content)
+}
+
+func inlineScript(js string) string {
+	return "<script>\n" + escapeEnd(js, "</script") + "</script>"
+}
+
+// escapeEnd keeps inlined text from closing its element early.
+func escapeEnd(text, end string) string {
+	return strings.ReplaceAll(text, end, `<\/`+end[2:])
+}
+
+// loadSnapshot restores the view embedded in a snapshot page. It reports
+// false if the page is not a snapshot.
+func loadSnapshot(v *viewer) (bool, error) {
+	stateEl := document.Call("getElementById", "snapshot-state")
+	dataEl := document.Call("getElementById", "snapshot-data")
+	if stateEl.IsNull() || dataEl.IsNull() {
+		return false, nil
+	}
+	offline = true
+	var state map[string]interface{}
+	if err := decodeJSON([]byte(stateEl.Get("textContent").String()), &state); err != nil {
+		return true, fmt.Errorf("snapshot state: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(dataEl.Get("textContent").String()))
+	if err != nil {
+		return true, fmt.Errorf("snapshot data: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return true, fmt.Errorf("snapshot data: %v", err)
+	}
+	c, err := pointcloud.Decode(zr)
+	if err != nil {
+		return true, fmt.Errorf("snapshot data: %v", err)
+	}
+	v.setCloud(c)
+	if ds, ok := state["dataset"].(map[string]interface{}); ok {
+		name, _ := ds["name"].(string)
+		options, _ := ds["options"].(string)
+		v.source = datasetSource{name, options}
+	}
+	if err := v.applyScene(state); err != nil {
+		return true, err
+	}
+	// A snapshot with a story opens as a presentation.
+	if len(v.story.slides) > 0 {
+		v.story.play(0)
+	}
+	return true, nil
+}
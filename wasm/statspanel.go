@@ -0,0 +1,283 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+)
+
+// statsPanel shows the statistics of a live stream as the server pushes
+// them, and keeps the displayed points in step with the stream's sliding
+// window. The statistics are maintained incrementally on the server; the
+// panel only renders snapshots.
+type statsPanel struct {
+	v          *viewer
+	root, body js.Value
+	stream     string
+	events     js.Value // EventSource while watching
+	onStats    js.Func
+	onDrift    js.Func
+	snap       map[string]interface{} // latest statistics
+	drift      map[string]interface{} // latest drift check, or nil
+
+	reloading  bool
+	lastReload time.Time
+}
+
+// streamReloadInterval limits how often the window's points are refetched.
+const streamReloadInterval = time.Second
+
+var theStats *statsPanel
+
+// streamNames caches the server's stream list for the watch prompt.
+var streamNames []string
+
+func fetchStreamNames() {
+	b, err := fetchBytes("api/streams/")
+	if err != nil {
+		return
+	}
+	decodeJSON(b, &streamNames)
+}
+
+func initStatsPanel(v *viewer) {
+	p := &statsPanel{v: v, root: document.Call("getElementById", "stats-panel")}
+	theStats = p
+	p.root.Call("appendChild", element("div", "panel-title", "Stream statistics"))
+	p.body = element("div", "", "")
+	p.root.Call("appendChild", p.body)
+	buttons := element("div", "panel-buttons", "")
+	stop := element("button", "", "Stop watching")
+	stop.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		p.stop()
+		return nil
+	}))
+	buttons.Call("appendChild", stop)
+	p.root.Call("appendChild", buttons)
+
+	p.onStats = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var snap map[string]interface{}
+		if err := decodeJSON([]byte(args[0].Get("data").String()), &snap); err != nil {
+			return nil
+		}
+		p.snap = snap
+		p.render()
+		if !p.reloading && time.Since(p.lastReload) >= streamReloadInterval {
+			p.reloading = true
+			go p.reload()
+		}
+		return nil
+	})
+	p.onDrift = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		var result map[string]interface{}
+		if err := decodeJSON([]byte(args[0].Get("data").String()), &result); err != nil {
+			return nil
+		}
+		p.drift = result
+		p.showDrift()
+		p.render()
+		return nil
+	})
+}
+
+// showDrift outlines the drifting region in the view while the stream is
+// drifting.
+func (p *statsPanel) showDrift() {
+	region, _ := p.drift["region"].(map[string]interface{})
+	if drifting, _ := p.drift["drifting"].(bool); !drifting || region == nil {
+		p.v.clearHighlight()
+		return
+	}
+	var min, max [3]float64
+	copy(min[:], numbers(region["min"]))
+	copy(max[:], numbers(region["max"]))
+	p.v.setHighlight(min, max)
+}
+
+// watch subscribes to the named stream, replacing any current one.
+func (p *statsPanel) watch(name string) {
+	p.stop()
+	theSampling.stop()
+	theEmbedding.stop()
+	p.stream = name
+	p.lastReload = time.Time{}
+	p.snap, p.drift = nil, nil
+	p.body.Set("innerHTML", "")
+	p.body.Call("appendChild", element("div", "", "Waiting for "+name+"…"))
+	p.events = js.Global().Get("EventSource").New("api/streams/" + name + "/events")
+	p.events.Call("addEventListener", "stats", p.onStats)
+	p.events.Call("addEventListener", "drift", p.onDrift)
+	p.root.Get("style").Set("display", "block")
+	p.v.source = datasetSource{"stream/" + name, ""}
+}
+
+func (p *statsPanel) stop() {
+	if p.events.Truthy() {
+		p.events.Call("close")
+		p.events = js.Undefined()
+	}
+	p.stream = ""
+	p.snap, p.drift = nil, nil
+	p.v.clearHighlight()
+	p.root.Get("style").Set("display", "none")
+}
+
+// monitorDrift starts drift monitoring of the watched stream against a
+// baseline dataset or, if baseline is empty, the current window.
+func (p *statsPanel) monitorDrift(method, threshold, baseline string) error {
+	if p.stream == "" {
+		return errors.New("no stream is being watched")
+	}
+	config := map[string]interface{}{"method": method, "baseline": baseline}
+	if threshold != "" {
+		t, err := strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			return err
+		}
+		config["threshold"] = t
+	}
+	body, err := encodeJSON(config)
+	if err != nil {
+		return err
+	}
+	_, err = sendJSON("POST", "api/streams/"+p.stream+"/drift", body)
+	return err
+}
+
+// reload fetches the stream's window and displays it, keeping the current
+// coloring attribute if the new cloud still has it.
+func (p *statsPanel) reload() {
+	defer func() { p.reloading = false }()
+	name := p.stream
+	b, err := fetchBytes("api/streams/" + name + "/points")
+	if err != nil || name != p.stream {
+		return
+	}
+	c, err := pointcloud.Decode(bytes.NewReader(b))
+	if err != nil {
+		reportError("Stream "+name, err)
+		return
+	}
+	keep := p.v.colorBy
+	p.v.setCloud(c)
+	if keep != "" && c.Attribute(keep) != nil && keep != p.v.colorBy {
+		p.v.colorBy = keep
+		p.v.recolor()
+	}
+	p.lastReload = time.Now()
+}
+
+// render fills the panel from the latest stats.Snapshot and drift result,
+// as decoded from JSON.
+func (p *statsPanel) render() {
+	snap := p.snap
+	if snap == nil {
+		return
+	}
+	p.body.Set("innerHTML", "")
+	row := func(label, value string) {
+		r := element("div", "panel-row", "")
+		r.Call("appendChild", element("span", "", label))
+		r.Call("appendChild", element("span", "stats-value", value))
+		p.body.Call("appendChild", r)
+	}
+	section := func(title string) {
+		p.body.Call("appendChild", element("div", "stats-section", title))
+	}
+	probs := numbers(snap["probs"])
+	describe := func(s map[string]interface{}) {
+		row("Points", fmt.Sprintf("%.0f", number(s["count"])))
+		row("Mean", vector(numbers(s["mean"])))
+		cov := numbers2(s["cov"])
+		var sd []float64
+		for k := range cov {
+			if k < len(cov[k]) {
+				sd = append(sd, math.Sqrt(math.Max(cov[k][k], 0)))
+			}
+		}
+		row("Std. dev.", vector(sd))
+		if len(cov) == 3 {
+			row("Cov xy, xz, yz", vector([]float64{cov[0][1], cov[0][2], cov[1][2]}))
+		}
+		for k, q := range numbers2(s["quantiles"]) {
+			var parts []string
+			for _, v := range q {
+				parts = append(parts, fmt.Sprintf("%.3g", v))
+			}
+			row(fmt.Sprintf("%c quantiles", "xyz"[k]), strings.Join(parts, " "))
+		}
+	}
+
+	section("Stream " + p.stream)
+	describe(snap)
+	row("Min", vector(numbers(snap["min"])))
+	row("Max", vector(numbers(snap["max"])))
+	if w, ok := snap["window"].(map[string]interface{}); ok {
+		section("Sliding window")
+		describe(w)
+	}
+	var levels []string
+	for _, q := range probs {
+		levels = append(levels, fmt.Sprintf("%g", q))
+	}
+	p.body.Call("appendChild", element("div", "legend-range", "Quantile levels: "+strings.Join(levels, " ")))
+
+	if d := p.drift; d != nil {
+		section("Drift")
+		label := "MMD²"
+		if d["method"] == "energy" {
+			label = "Energy coefficient"
+		}
+		row(label, fmt.Sprintf("%.4f / %.4f", number(d["statistic"]), number(d["threshold"])))
+		if drifting, _ := d["drifting"].(bool); drifting {
+			p.body.Call("appendChild", element("div", "legend-warning", "Distribution is drifting; the region that changed most is outlined."))
+			if region, ok := d["region"].(map[string]interface{}); ok {
+				row("Mass shift", fmt.Sprintf("%+.1f%%", 100*number(region["shift"])))
+			}
+		} else {
+			row("Status", "no drift")
+		}
+	}
+}
+
+// number, numbers and numbers2 read decoded JSON numbers, arrays and
+// nested arrays, treating anything else as zero or empty.
+func number(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+func numbers(v interface{}) []float64 {
+	list, _ := v.([]interface{})
+	out := make([]float64, len(list))
+	for i, x := range list {
+		out[i] = number(x)
+	}
+	return out
+}
+
+func numbers2(v interface{}) [][]float64 {
+	list, _ := v.([]interface{})
+	out := make([][]float64, len(list))
+	for i, x := range list {
+		out[i] = numbers(x)
+	}
+	return out
+}
+
+func vector(v []float64) string {
+	var parts []string
+	for _, x := range v {
+		parts = append(parts, fmt.Sprintf("%.4g", x))
+	}
+	return strings.Join(parts, ", ")
+}
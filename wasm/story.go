@@ -0,0 +1,398 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/markdown"
+)
+
+// story is a sequence of slides for presenting a dataset. Each slide is a
+// captured view (camera, coloring, layers, highlight and annotations) with
+// a Markdown caption and the duration of the transition into it. Stories
+// are edited in the story panel, played as a slideshow and saved in scene
+// files and snapshots.
+//
+// Moving to a slide switches the rest of the view at once and animates the
+// camera over the transition; the slide's spin resumes when it ends.
+type story struct {
+	v                 *viewer
+	panel             js.Value
+	list              js.Value // slide list
+	fields            js.Value // caption and duration of the selected slide
+	caption, duration js.Value
+
+	player        js.Value
+	playerCaption js.Value
+	counter       js.Value
+
+	slides  []*slide
+	current int // selected or showing slide, or -1
+	playing bool
+
+	// The camera transition in progress.
+	moving        bool
+	from, to      float32 // angles
+	start, length float64 // ms
+	spin          bool    // whether to rotate once arrived
+}
+
+type slide struct {
+	view     map[string]interface{} // see captureView
+	caption  string                 // Markdown
+	duration float64                // seconds
+}
+
+// defaultTransition is the transition duration of new slides, in seconds.
+const defaultTransition = 1.5
+
+var theStory *story
+
+func initStory(v *viewer) {
+	s := &story{
+		v:       v,
+		panel:   document.Call("getElementById", "story-panel"),
+		player:  document.Call("getElementById", "story-player"),
+		current: -1,
+	}
+	theStory = s
+	v.story = s
+
+	button := func(parent js.Value, label string, fn func()) {
+		b := element("button", "", label)
+		b.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			fn()
+			return nil
+		}))
+		parent.Call("appendChild", b)
+	}
+
+	s.panel.Call("appendChild", element("div", "panel-title", "Story"))
+	s.list = element("ol", "story-slides", "")
+	s.list.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		index := args[0].Get("target").Get("dataset").Get("index")
+		if i, err := strconv.Atoi(index.String()); err == nil && i < len(s.slides) {
+			s.current = i
+			s.renderList()
+			s.show(i)
+		}
+		return nil
+	}))
+	s.panel.Call("appendChild", s.list)
+	s.fields = element("div", "", "")
+	s.panel.Call("appendChild", s.fields)
+	s.caption = element("textarea", "story-caption", "")
+	s.caption.Set("placeholder", "Caption (Markdown)")
+	s.caption.Set("rows", 4)
+	s.caption.Call("addEventListener", "input", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if sl := s.selected(); sl != nil {
+			sl.caption = s.caption.Get("value").String()
+			s.renderList()
+		}
+		return nil
+	}))
+	s.fields.Call("appendChild", s.caption)
+	row := element("label", "panel-row", "Transition (s)")
+	s.duration = input("number", "")
+	s.duration.Set("min", 0)
+	s.duration.Set("step", 0.5)
+	s.duration.Call("addEventListener", "change", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if sl := s.selected(); sl != nil {
+			if d, err := strconv.ParseFloat(s.duration.Get("value").String(), 64); err == nil && d >= 0 {
+				sl.duration = d
+			}
+		}
+		return nil
+	}))
+	row.Call("appendChild", s.duration)
+	s.fields.Call("appendChild", row)
+
+	buttons := element("div", "panel-buttons", "")
+	s.panel.Call("appendChild", buttons)
+	button(buttons, "Add view", s.add)
+	button(buttons, "Update view", s.update)
+	button(buttons, "Delete", s.delete)
+	button(buttons, "Up", func() { s.move(-1) })
+	button(buttons, "Down", func() { s.move(1) })
+	button(buttons, "Play", func() { s.play(s.current) })
+	button(buttons, "Close", s.close)
+
+	s.playerCaption = element("div", "story-text", "")
+	s.player.Call("appendChild", s.playerCaption)
+	controls := element("div", "story-controls", "")
+	s.player.Call("appendChild", controls)
+	button(controls, "‹ Previous", s.prev)
+	s.counter = element("span", "story-counter", "")
+	controls.Call("appendChild", s.counter)
+	button(controls, "Next ›", s.next)
+	button(controls, "Exit", s.exit)
+
+	// Presentation keys work only while playing.
+	document.Call("addEventListener", "keydown", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if !s.playing {
+			return nil
+		}
+		event := args[0]
+		switch event.Get("key").String() {
+		case "ArrowRight", "PageDown", " ":
+			s.next()
+		case "ArrowLeft", "PageUp":
+			s.prev()
+		case "Escape":
+			s.exit()
+		default:
+			return nil
+		}
+		event.Call("preventDefault")
+		return nil
+	}))
+	s.renderList()
+}
+
+func (s *story) open() {
+	s.panel.Get("style").Set("display", "block")
+	s.renderList()
+}
+
+func (s *story) close() {
+	s.panel.Get("style").Set("display", "none")
+}
+
+func (s *story) selected() *slide {
+	if s.current < 0 || s.current >= len(s.slides) {
+		return nil
+	}
+	return s.slides[s.current]
+}
+
+// add captures the current view as a new slide after the selected one.
+func (s *story) add() {
+	sl := &slide{view: s.v.captureView(), duration: defaultTransition}
+	at := s.current + 1
+	s.slides = append(s.slides[:at], append([]*slide{sl}, s.slides[at:]...)...)
+	s.current = at
+	s.renderList()
+}
+
+// update replaces the selected slide's view with the current one.
+func (s *story) update() {
+	if sl := s.selected(); sl != nil {
+		sl.view = s.v.captureView()
+	}
+}
+
+func (s *story) delete() {
+	if s.selected() == nil {
+		return
+	}
+	s.slides = append(s.slides[:s.current], s.slides[s.current+1:]...)
+	if s.current == len(s.slides) {
+		s.current--
+	}
+	s.renderList()
+}
+
+// move moves the selected slide by delta places.
+func (s *story) move(delta int) {
+	j := s.current + delta
+	if s.selected() == nil || j < 0 || j >= len(s.slides) {
+		return
+	}
+	s.slides[s.current], s.slides[j] = s.slides[j], s.slides[s.current]
+	s.current = j
+	s.renderList()
+}
+
+// renderList redraws the slide list and the selected slide's fields.
+func (s *story) renderList() {
+	s.list.Set("innerHTML", "")
+	for i, sl := range s.slides {
+		title := strings.TrimLeft(strings.SplitN(strings.TrimSpace(sl.caption), "\n", 2)[0], "# ")
+		if title == "" {
+			title = "(no caption)"
+		}
+		item := element("li", "", title)
+		if i == s.current {
+			item.Set("className", "selected")
+		}
+		item.Get("dataset").Set("index", i)
+		s.list.Call("appendChild", item)
+	}
+	sl := s.selected()
+	if sl == nil {
+		s.fields.Get("style").Set("display", "none")
+		return
+	}
+	s.fields.Get("style").Set("display", "block")
+	if s.caption.Get("value").String() != sl.caption {
+		s.caption.Set("value", sl.caption)
+	}
+	s.duration.Set("value", strconv.FormatFloat(sl.duration, 'g', -1, 64))
+}
+
+// play shows the slideshow from slide i, or from the start if i is out of
+// range.
+func (s *story) play(i int) {
+	if len(s.slides) == 0 {
+		setStatus("The story has no slides; add views in Story › Edit story")
+		return
+	}
+	if i < 0 || i >= len(s.slides) {
+		i = 0
+	}
+	s.close()
+	s.playing = true
+	s.player.Get("style").Set("display", "block")
+	s.show(i)
+}
+
+func (s *story) next() {
+	if s.current+1 < len(s.slides) {
+		s.show(s.current + 1)
+	}
+}
+
+func (s *story) prev() {
+	if s.current > 0 {
+		s.show(s.current - 1)
+	}
+}
+
+func (s *story) exit() {
+	s.playing = false
+	s.player.Get("style").Set("display", "none")
+}
+
+// show moves to slide i.
+func (s *story) show(i int) {
+	s.current = i
+	sl := s.slides[i]
+	angle, spin := s.v.applyView(sl.view)
+	s.from, s.spin = s.v.angle, spin
+	// Turn the short way round.
+	s.to = s.from + float32(math.Remainder(float64(angle-s.from), 2*math.Pi))
+	s.start, s.length = now(), 1000*sl.duration
+	s.moving = true
+	s.v.rotating = false
+	if s.playing {
+		s.playerCaption.Set("innerHTML", markdown.ToHTML(sl.caption))
+		s.counter.Set("textContent", strconv.Itoa(i+1)+" / "+strconv.Itoa(len(s.slides)))
+	}
+}
+
+// step advances the camera transition; it is called every frame.
+func (s *story) step() {
+	if !s.moving {
+		return
+	}
+	t := 1.0
+	if s.length > 0 {
+		t = math.Min((now()-s.start)/s.length, 1)
+	}
+	ease := float32(t * t * (3 - 2*t))
+	s.v.angle = s.from + (s.to-s.from)*ease
+	if t == 1 {
+		s.moving = false
+		s.v.rotating = s.spin
+	}
+}
+
+func (s *story) state() []interface{} {
+	var list []interface{}
+	for _, sl := range s.slides {
+		list = append(list, map[string]interface{}{
+			"view":     sl.view,
+			"caption":  sl.caption,
+			"duration": sl.duration,
+		})
+	}
+	return list
+}
+
+func (s *story) apply(list []interface{}) {
+	s.exit()
+	s.slides, s.current = nil, -1
+	for _, item := range list {
+		m, _ := item.(map[string]interface{})
+		sl := &slide{duration: defaultTransition}
+		sl.view, _ = m["view"].(map[string]interface{})
+		sl.caption, _ = m["caption"].(string)
+		if d, ok := m["duration"].(float64); ok && d >= 0 {
+			sl.duration = d
+		}
+		if sl.view != nil {
+			s.slides = append(s.slides, sl)
+		}
+	}
+	if len(s.slides) > 0 {
+		s.current = 0
+	}
+	s.renderList()
+}
+
+// captureView records what a slide shows. Layers are surface visibility
+// in order; the highlight is its min and max corners.
+func (v *viewer) captureView() map[string]interface{} {
+	var layers []interface{}
+	for _, l := range v.surfaces {
+		layers = append(layers, !l.node.hidden)
+	}
+	view := map[string]interface{}{
+		"angle":    float64(v.angle),
+		"rotating": v.rotating,
+		"colorBy":  v.colorBy,
+		"colormap": v.cmap.Name,
+		"axes":     !v.scene.find("axes").hidden,
+		"points":   !v.data.find("points").hidden,
+		"layers":   layers,
+		"notes":    v.noteState(),
+	}
+	if !v.highlight.hidden {
+		b := v.highlightBox
+		view["highlight"] = []interface{}{b[0][0], b[0][1], b[0][2], b[1][0], b[1][1], b[1][2]}
+	}
+	return view
+}
+
+// applyView shows a captured view except for the camera, returning its
+// angle and whether it rotates so the caller can animate to them.
+func (v *viewer) applyView(view map[string]interface{}) (angle float32, rotating bool) {
+	if name, ok := view["colorBy"].(string); ok && (name == "" || v.cloud.Attribute(name) != nil) {
+		v.colorBy = name
+	}
+	if name, ok := view["colormap"].(string); ok {
+		if m, ok := v.lookupColormap(name); ok {
+			v.cmap = m
+		}
+	}
+	if shown, ok := view["axes"].(bool); ok {
+		v.scene.find("axes").hidden = !shown
+	}
+	if shown, ok := view["points"].(bool); ok {
+		v.data.find("points").hidden = !shown
+	}
+	layers, _ := view["layers"].([]interface{})
+	for i, l := range v.surfaces {
+		if i < len(layers) {
+			shown, _ := layers[i].(bool)
+			l.node.hidden = !shown
+		}
+	}
+	if b, ok := floats(view["highlight"], 6); ok {
+		v.setHighlight([3]float64{b[0], b[1], b[2]}, [3]float64{b[3], b[4], b[5]})
+	} else {
+		v.clearHighlight()
+	}
+	notes, _ := view["notes"].([]interface{})
+	if err := v.applyNotes(notes); err != nil {
+		setStatus("Story: %v", err)
+	}
+	v.recolor()
+	a, _ := view["angle"].(float64)
+	rotating, _ = view["rotating"].(bool)
+	return float32(a), rotating
+}
@@ -0,0 +1,199 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/sbecker11/threedistvis-go/expr"
+	"github.com/sbecker11/threedistvis-go/surface"
+)
+
+// surfaceKinds lists the kinds of formula surfaces with the prompts for
+// their formula and domain and their default resolution.
+var surfaceKinds = []struct {
+	name, title, formula, domain, resolution string
+}{
+	{"explicit", "Add surface z = f(x, y)", "z = f(x, y), e.g. exp(-(x^2 + y^2))",
+		"Domain x0, x1, y0, y1 (Enter for the data bounds)", "64"},
+	{"parametric", "Add parametric surface", "x; y; z in u and v, e.g. cos(u)*sin(v); sin(u)*sin(v); cos(v)",
+		"Domain u0, u1, v0, v1 (Enter for 0, 2*pi, 0, 2*pi)", "64"},
+	{"implicit", "Add implicit surface f(x, y, z) = 0", "f(x, y, z), e.g. x^2 + y^2 + z^2 - 1",
+		"Domain x0, x1, y0, y1, z0, z1 (Enter for the data bounds)", "40"},
+}
+
+// maxSurfaceResolution bounds the grid size of a surface; implicit
+// surfaces sample the formula at the cube of it.
+const maxSurfaceResolution = 128
+
+// A surfaceLayer is a surface defined by a formula, drawn as a shaded mesh
+// in data coordinates and colored by height.
+type surfaceLayer struct {
+	kind       string
+	formula    string
+	domain     string // comma-separated bounds; "" for the default
+	resolution int
+	mesh       *surface.Mesh
+	node       *node
+}
+
+// addSurface builds a surface and adds it to the scene.
+func (v *viewer) addSurface(kind, formula, domain string, resolution int) error {
+	if resolution < 2 || resolution > maxSurfaceResolution {
+		return fmt.Errorf("resolution must be between 2 and %d", maxSurfaceResolution)
+	}
+	bounds, err := v.surfaceDomain(kind, domain)
+	if err != nil {
+		return err
+	}
+	mesh, err := buildSurface(kind, formula, bounds, resolution)
+	if err != nil {
+		return err
+	}
+	if mesh.Triangles() == 0 {
+		return fmt.Errorf("surface %q is empty over its domain", formula)
+	}
+	prim, err := newTriangleMesh(v.renderer, mesh.Positions, mesh.Normals, surfaceColors(v, mesh))
+	if err != nil {
+		return err
+	}
+	layer := &surfaceLayer{
+		kind:       kind,
+		formula:    formula,
+		domain:     domain,
+		resolution: resolution,
+		mesh:       mesh,
+		node:       v.data.add(newNode("surface", prim)),
+	}
+	v.surfaces = append(v.surfaces, layer)
+	return nil
+}
+
+// surfaceDomain parses domain, a comma-separated list of constant formulas,
+// or returns the default: the data bounds for explicit and implicit
+// surfaces and [0, 2π] × [0, 2π] for parametric ones.
+func (v *viewer) surfaceDomain(kind, domain string) ([]float64, error) {
+	want := 4
+	if kind == "implicit" {
+		want = 6
+	}
+	if strings.TrimSpace(domain) == "" {
+		if kind == "parametric" {
+			return []float64{0, 2 * math.Pi, 0, 2 * math.Pi}, nil
+		}
+		lo, hi := v.cloud.Bounds()
+		var bounds []float64
+		for k := 0; k < want/2; k++ {
+			bounds = append(bounds, float64(lo[k]), float64(hi[k]))
+		}
+		return bounds, nil
+	}
+	parts := strings.Split(domain, ",")
+	if len(parts) != want {
+		return nil, fmt.Errorf("%s surfaces need %d bounds, got %d", kind, want, len(parts))
+	}
+	bounds := make([]float64, want)
+	for i, p := range parts {
+		var err error
+		if bounds[i], err = expr.Const(strings.TrimSpace(p)); err != nil {
+			return nil, err
+		}
+	}
+	return bounds, nil
+}
+
+// buildSurface parses the formula for the kind of surface and triangulates
+// it over bounds.
+func buildSurface(kind, formula string, b []float64, n int) (*surface.Mesh, error) {
+	switch kind {
+	case "explicit":
+		f, err := expr.Parse(strings.TrimPrefix(strings.TrimSpace(formula), "z ="), "x", "y")
+		if err != nil {
+			return nil, err
+		}
+		return surface.Explicit(func(x, y float64) float64 { return f.Eval(x, y) }, b[0], b[1], b[2], b[3], n), nil
+	case "parametric":
+		parts := strings.Split(formula, ";")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("parametric surfaces need three formulas separated by ';'")
+		}
+		var fs [3]*expr.Expr
+		for k, p := range parts {
+			var err error
+			if fs[k], err = expr.Parse(strings.TrimSpace(p), "u", "v"); err != nil {
+				return nil, err
+			}
+		}
+		return surface.Parametric(func(u, v float64) (float64, float64, float64) {
+			return fs[0].Eval(u, v), fs[1].Eval(u, v), fs[2].Eval(u, v)
+		}, b[0], b[1], b[2], b[3], n), nil
+	case "implicit":
+		f, err := expr.Parse(strings.TrimSuffix(strings.TrimSpace(formula), "= 0"), "x", "y", "z")
+		if err != nil {
+			return nil, err
+		}
+		return surface.Implicit(func(x, y, z float64) float64 { return f.Eval(x, y, z) },
+			[3]float64{b[0], b[2], b[4]}, [3]float64{b[1], b[3], b[5]}, n), nil
+	}
+	return nil, fmt.Errorf("unknown surface kind %q", kind)
+}
+
+// surfaceColors maps the mesh's heights through the current colormap.
+func surfaceColors(v *viewer, m *surface.Mesh) []float32 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, z := range m.Values {
+		lo, hi = math.Min(lo, float64(z)), math.Max(hi, float64(z))
+	}
+	colors := make([]float32, 3*len(m.Values))
+	for i, z := range m.Values {
+		c := v.cmap.At(v.cmap.Normalize(float64(z), lo, hi))
+		colors[3*i], colors[3*i+1], colors[3*i+2] = float32(c.R), float32(c.G), float32(c.B)
+	}
+	return colors
+}
+
+// recolorSurfaces reapplies the colormap to every surface.
+func (v *viewer) recolorSurfaces() {
+	for _, s := range v.surfaces {
+		s.node.primitive.(*triangleMesh).setColors(surfaceColors(v, s.mesh))
+	}
+}
+
+func (v *viewer) clearSurfaces() {
+	for _, s := range v.surfaces {
+		v.data.remove(s.node)
+	}
+	v.surfaces = nil
+}
+
+// surfaceState and applySurfaces save and restore the surface layers in
+// scene files.
+func (v *viewer) surfaceState() []interface{} {
+	var list []interface{}
+	for _, s := range v.surfaces {
+		list = append(list, map[string]interface{}{
+			"kind":       s.kind,
+			"formula":    s.formula,
+			"domain":     s.domain,
+			"resolution": float64(s.resolution),
+		})
+	}
+	return list
+}
+
+func (v *viewer) applySurfaces(list []interface{}) error {
+	v.clearSurfaces()
+	for _, item := range list {
+		s, _ := item.(map[string]interface{})
+		kind, _ := s["kind"].(string)
+		formula, _ := s["formula"].(string)
+		domain, _ := s["domain"].(string)
+		resolution, _ := s["resolution"].(float64)
+		if err := v.addSurface(kind, formula, domain, int(resolution)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"syscall/js"
+)
+
+// span times a client operation such as loading and rendering a dataset.
+// Requests made within it carry its context in a traceparent header, so
+// the server's spans join the same trace; finished spans are sent to the
+// server, which exports them with its own.
+type span struct {
+	traceID, spanID, parentID string
+	name                      string
+	start                     float64 // ms since the epoch
+	attrs                     map[string]interface{}
+}
+
+// randomHex returns n random bytes in hex. Trace IDs only need to be
+// unique, not unpredictable.
+func randomHex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, 2*n)
+	for i := range b {
+		b[i] = digits[rand.Intn(16)]
+	}
+	return string(b)
+}
+
+// startSpan starts a span as a child of parent, or of a new trace if parent
+// is nil.
+func startSpan(name string, parent *span) *span {
+	s := &span{name: name, spanID: randomHex(8), start: now(), attrs: map[string]interface{}{}}
+	if parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return s
+}
+
+func now() float64 {
+	return js.Global().Get("Date").Call("now").Float()
+}
+
+// traceparent is the W3C header value naming s as the parent.
+func (s *span) traceparent() string {
+	return "00-" + s.traceID + "-" + s.spanID + "-01"
+}
+
+// end finishes the span, failed if err is not nil, and sends it to the
+// server in the background.
+func (s *span) end(err error) {
+	if offline {
+		return
+	}
+	record := map[string]interface{}{
+		"traceId":      s.traceID,
+		"spanId":       s.spanID,
+		"parentSpanId": s.parentID,
+		"name":         s.name,
+		"start":        s.start,
+		"end":          now(),
+		"attributes":   s.attrs,
+	}
+	if err != nil {
+		record["error"] = err.Error()
+	}
+	go func() {
+		if body, err := encodeJSON([]interface{}{record}); err == nil {
+			sendJSON("POST", "api/client/spans", body)
+		}
+	}()
+}
+
+// tracedError is an error from a traced operation. Its message names the
+// trace so users can quote it, and error reports link to it.
+type tracedError struct {
+	err             error
+	traceID, spanID string
+}
+
+func (e *tracedError) Error() string {
+	return fmt.Sprintf("%v (trace %s)", e.err, e.traceID)
+}
+
+func (e *tracedError) Unwrap() error { return e.err }
+
+// traced attaches s to err unless err is nil or already traced.
+func traced(err error, s *span) error {
+	var t *tracedError
+	if err == nil || errors.As(err, &t) {
+		return err
+	}
+	return &tracedError{err: err, traceID: s.traceID, spanID: s.spanID}
+}
+
+// reportError shows err in the status bar as "what: err" and reports it to
+// the server with its trace, if it has one.
+func reportError(what string, err error) {
+	setStatus("%s: %v", what, err)
+	if offline {
+		return
+	}
+	report := map[string]interface{}{
+		"message": err.Error(),
+		"context": what,
+		"url":     js.Global().Get("location").Get("href").String(),
+	}
+	var t *tracedError
+	if errors.As(err, &t) {
+		report["message"] = t.err.Error()
+		report["traceId"], report["spanId"] = t.traceID, t.spanID
+	}
+	go func() {
+		if body, err := encodeJSON(report); err == nil {
+			sendJSON("POST", "api/client/errors", body)
+		}
+	}()
+}
@@ -0,0 +1,298 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/colormap"
+	"github.com/sbecker11/threedistvis-go/geom"
+	"github.com/sbecker11/threedistvis-go/pointcloud"
+	"github.com/sbecker11/threedistvis-go/render"
+)
+
+// viewer draws the current point cloud, colored by one of its attributes,
+// together with overlays, as a scene graph:
+//
+//	scene
+//	├── axes                 hidden until toggled
+//	└── data                 normalizes data coordinates to the view
+//	    ├── points           the cloud
+//	    │   └── lattice      bubbles and marginals of discrete distributions
+//	    ├── simplex          frame and part labels of compositions
+//	    ├── voronoi          Delaunay edges and the picked Voronoi cell
+//	    ├── highlight        outlined region, hidden until set
+//	    ├── notes            annotation labels
+//	    └── …                overlays in data coordinates
+type viewer struct {
+	canvas   js.Value
+	renderer *renderer
+	scene    *node
+	data     *node
+	points   *pointSet
+
+	cloud      *pointcloud.Cloud
+	center     [3]float32 // data point shown at the origin
+	scale      float32    // data units to view units
+	source     datasetSource
+	colorBy    string    // attribute name, or "" for uniform white
+	categories []float32 // distinct values of colorBy if it is categorical
+	cmap       *colormap.Colormap
+	userMaps   []*colormap.Colormap // edited or imported colormaps
+	palette    *colormap.Palette
+	angle      float32
+	rotating   bool
+
+	cvd  colormap.Deficiency
+	post *cvdPass
+
+	highlight    *node
+	highlightBox [2][3]float64 // min and max corners while shown
+	notes        *node
+	noteList     []note
+	surfaces     []*surfaceLayer
+	lattice      *node // bubble lattice, or nil
+	bubbles      *glyphInstances
+	simplex      *node         // simplex frame of compositions, or nil
+	voronoi      *tessellation // Delaunay triangulation of a region, or nil
+	demo         *samplingDemo // running teaching demo, or nil
+	story        *story
+}
+
+// datasetSource records where the current cloud was loaded from, so scene
+// files can reload it.
+type datasetSource struct {
+	name    string
+	options string // query string passed to the datasets API
+}
+
+// newViewer returns a viewer drawing on canvas with r.
+func newViewer(canvas js.Value, r *renderer) (*viewer, error) {
+	v := &viewer{
+		canvas:   canvas,
+		renderer: r,
+		scene:    newNode("scene", nil),
+		rotating: true,
+	}
+	var err error
+	if v.points, err = newPointSet(v.renderer); err != nil {
+		return nil, err
+	}
+	v.data = v.scene.add(newNode("data", nil))
+	v.data.add(newNode("points", v.points))
+	highlight, err := newLineSet(v.renderer, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	v.highlight = v.data.add(newNode("highlight", highlight))
+	v.highlight.hidden = true
+	v.notes = v.data.add(newNode("notes", nil))
+	axes, err := newAxes(v.renderer)
+	if err != nil {
+		return nil, err
+	}
+	v.scene.add(axes).hidden = true
+
+	v.cmap, _ = colormap.Get("viridis")
+	v.palette, _ = colormap.GetPalette("tab10")
+	if gl := r.gl; r.canvas == nil {
+		if v.post, err = newCVDPass(gl); err != nil {
+			return nil, err
+		}
+		gl.Call("clearColor", 0.0, 0.0, 0.0, 1.0)
+		gl.Call("enable", gl.Get("DEPTH_TEST"))
+	}
+
+	// Start with 100 random points until a dataset is loaded
+	c := pointcloud.New("random", 100)
+	for i := range c.Positions {
+		c.Positions[i] = rand.Float32()*2 - 1
+	}
+	v.setCloud(c)
+	return v, nil
+}
+
+// setCloud replaces the displayed points. The data node centers and scales
+// them to fit the view; the first intrinsic attribute is used for coloring.
+// Discrete distributions are drawn as a bubble lattice instead of points,
+// and compositions inside the simplex of their parts.
+func (v *viewer) setCloud(c *pointcloud.Cloud) {
+	v.cloud = c
+	v.clearVoronoi()
+	v.colorBy = render.DefaultAttribute(c)
+	v.center, v.scale = render.Fit(c)
+	v.setLattice()
+	v.setSimplex()
+	v.data.transform = render.DataTransform(v.center, v.scale)
+	if v.lattice != nil {
+		v.points.setPositions(nil)
+	} else {
+		v.points.setPositions(c.Positions)
+	}
+	v.recolor()
+}
+
+// refit redisplays the current cloud after its points have moved, fitting
+// the view to their new extent. Overlays computed from the old positions
+// are removed.
+func (v *viewer) refit() {
+	v.clearVoronoi()
+	v.center, v.scale = render.Fit(v.cloud)
+	v.data.transform = render.DataTransform(v.center, v.scale)
+	v.points.setPositions(v.cloud.Positions)
+}
+
+// recolor uploads per-point colors for the current attribute, using the
+// categorical palette for categorical attributes and the colormap
+// otherwise. Points where the attribute is NaN are drawn gray.
+func (v *viewer) recolor() {
+	values := v.cloud.Attribute(v.colorBy)
+	v.categories = render.Categories(values)
+	colors := render.Colors(v.cloud.Len(), values, v.categories, v.cmap, v.palette)
+	v.points.setColors(colors)
+	if v.bubbles != nil {
+		v.bubbles.setColors(colors)
+	}
+	v.recolorSurfaces()
+	v.updateLegend()
+}
+
+// lookupColormap finds a user or built-in colormap by name.
+func (v *viewer) lookupColormap(name string) (*colormap.Colormap, bool) {
+	for _, m := range v.userMaps {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return colormap.Get(name)
+}
+
+// colormapNames lists user colormaps followed by the built-in ones.
+func (v *viewer) colormapNames() []string {
+	var names []string
+	for _, m := range v.userMaps {
+		names = append(names, m.Name)
+	}
+	return append(names, colormap.Names()...)
+}
+
+// addColormap adds or replaces a user colormap. Built-in names are reserved.
+func (v *viewer) addColormap(m *colormap.Colormap) error {
+	if _, ok := colormap.Get(m.Name); ok {
+		return errors.New("colormap name " + m.Name + " is taken by a built-in colormap")
+	}
+	for i, u := range v.userMaps {
+		if u.Name == m.Name {
+			v.userMaps[i] = m
+			return nil
+		}
+	}
+	v.userMaps = append(v.userMaps, m)
+	return nil
+}
+
+// frame advances the animation and draws one frame.
+func (v *viewer) frame() {
+	if v.rotating {
+		v.angle += 0.01
+	}
+	if v.demo != nil {
+		v.demo.step()
+	}
+	if v.story != nil {
+		v.story.step()
+	}
+	width, height := v.canvas.Get("width").Int(), v.canvas.Get("height").Int()
+	if c := v.renderer.canvas; c != nil {
+		c.cvd = v.cvd
+		v.renderer.render(v.scene, v.viewMatrix(), v.projection(width, height))
+		return
+	}
+	gl := v.renderer.gl
+	if v.cvd != colormap.NormalVision {
+		v.post.begin(width, height)
+	}
+	gl.Call("clear", gl.Get("COLOR_BUFFER_BIT").Int()|gl.Get("DEPTH_BUFFER_BIT").Int())
+	v.renderer.render(v.scene, v.viewMatrix(), v.projection(width, height))
+	if v.cvd != colormap.NormalVision {
+		v.post.end(v.cvd)
+	}
+}
+
+// viewMatrix rotates the scene about the vertical axis.
+func (v *viewer) viewMatrix() geom.Mat4 {
+	return render.View(v.angle)
+}
+
+// projection keeps the unit sphere in view whatever the canvas aspect
+// ratio.
+func (v *viewer) projection(width, height int) geom.Mat4 {
+	return render.Projection(width, height)
+}
+
+// highlightColor outlines boxes shown with setHighlight.
+var highlightColor = colormap.RGB{R: 1, G: 0.55, B: 0.1}
+
+// setHighlight outlines the box from min to max, in data coordinates.
+func (v *viewer) setHighlight(min, max [3]float64) {
+	var positions, colors []float32
+	corner := func(i int) {
+		for k := 0; k < 3; k++ {
+			if i>>k&1 == 0 {
+				positions = append(positions, float32(min[k]))
+			} else {
+				positions = append(positions, float32(max[k]))
+			}
+		}
+		colors = append(colors, float32(highlightColor.R), float32(highlightColor.G), float32(highlightColor.B))
+	}
+	// Corners are numbered by bits (x, y, z); edges join corners that
+	// differ in one bit.
+	for i := 0; i < 8; i++ {
+		for k := 0; k < 3; k++ {
+			if j := i | 1<<k; j != i {
+				corner(i)
+				corner(j)
+			}
+		}
+	}
+	v.highlight.primitive.(*lineSet).set(positions, colors)
+	v.highlight.hidden = false
+	v.highlightBox = [2][3]float64{min, max}
+}
+
+func (v *viewer) clearHighlight() {
+	v.highlight.hidden = true
+}
+
+// axisColors are the colors of the x, y and z axes.
+var axisColors = []colormap.RGB{{R: 0.9, G: 0.3, B: 0.3}, {R: 0.3, G: 0.8, B: 0.3}, {R: 0.35, G: 0.5, B: 1}}
+
+// newAxes returns a node with the x, y and z axes of the view, colored red,
+// green and blue, and labeled at their ends.
+func newAxes(r *renderer) (*node, error) {
+	axes := newNode("axes", nil)
+	var positions, colors []float32
+	for k, c := range axisColors {
+		var end geom.Vec3
+		end[k] = 1
+		positions = append(positions, 0, 0, 0)
+		positions = append(positions, end[:]...)
+		for i := 0; i < 2; i++ {
+			colors = append(colors, float32(c.R), float32(c.G), float32(c.B))
+		}
+		label, err := newTextLabel(r, string("xyz"[k]), c.Hex(), end.Scale(1.05))
+		if err != nil {
+			return nil, err
+		}
+		axes.add(newNode(string("xyz"[k]), label))
+	}
+	lines, err := newLineSet(r, positions, colors)
+	if err != nil {
+		return nil, err
+	}
+	axes.primitive = lines
+	return axes, nil
+}
@@ -0,0 +1,226 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"syscall/js"
+
+	"github.com/sbecker11/threedistvis-go/delaunay"
+	"github.com/sbecker11/threedistvis-go/geom"
+)
+
+// tessellation is the Delaunay triangulation of the points of the current
+// cloud inside a region, drawn as its edges, with the Voronoi cell of a
+// point shown when the point is clicked.
+type tessellation struct {
+	tri    *delaunay.Triangulation
+	points []int // cloud index of each triangulated point
+	node   *node
+	edges  *node
+	cell   *node // picked Voronoi cell, hidden until a pick
+}
+
+const (
+	// maxDelaunayPoints bounds the points triangulated in the browser,
+	// which takes several seconds at the limit.
+	maxDelaunayPoints = 20000
+	// pickRadius is how far from a point, in CSS pixels, a click picks it.
+	pickRadius   = 10
+	delaunayGray = 0.35
+)
+
+// Attributes set from the Voronoi cells. The density is 1/(nV) for n
+// points, an estimate of the probability density that, unlike a kernel
+// estimate, adapts its resolution to the local spacing of the points.
+const (
+	voronoiVolume  = "voronoi volume"
+	voronoiDensity = "voronoi density"
+)
+
+// initVoronoi picks Voronoi cells with clicks on the canvas.
+func initVoronoi(v *viewer) {
+	v.canvas.Call("addEventListener", "click", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if v.voronoi != nil {
+			rect := v.canvas.Call("getBoundingClientRect")
+			x := args[0].Get("clientX").Float() - rect.Get("left").Float()
+			y := args[0].Get("clientY").Float() - rect.Get("top").Float()
+			v.pickCell(x, y, rect.Get("width").Float())
+		}
+		return nil
+	}))
+}
+
+// parseRegion parses "x, y, z; x, y, z", the minimum and maximum corners
+// of a box in data coordinates.
+func parseRegion(s string) (min, max [3]float64, err error) {
+	corners := strings.Split(s, ";")
+	if len(corners) != 2 {
+		return min, max, fmt.Errorf("region %q: want min x, y, z; max x, y, z", s)
+	}
+	if min, err = parsePoint(corners[0]); err == nil {
+		max, err = parsePoint(corners[1])
+	}
+	return min, max, err
+}
+
+// defaultRegion is the highlighted box if one is shown, or all points.
+func (v *viewer) defaultRegion() string {
+	if v.highlight.hidden {
+		return "all"
+	}
+	return formatPoint(v.highlightBox[0]) + "; " + formatPoint(v.highlightBox[1])
+}
+
+// tessellate triangulates the points of the current cloud in region, "all"
+// or a box as parsed by parseRegion, shows the Delaunay edges and colors
+// the points by the density estimated from their Voronoi cells. Points
+// outside the region, and those whose cells are unbounded or reach past
+// the outermost points, get NaN.
+func (v *viewer) tessellate(region string) error {
+	inside := func(p [3]float64) bool { return true }
+	if region != "all" {
+		min, max, err := parseRegion(region)
+		if err != nil {
+			return err
+		}
+		inside = func(p [3]float64) bool {
+			for k := range p {
+				if p[k] < min[k] || p[k] > max[k] {
+					return false
+				}
+			}
+			return true
+		}
+		v.setHighlight(min, max)
+	}
+	t := &tessellation{}
+	var positions [][3]float64
+	for i := 0; i < v.cloud.Len(); i++ {
+		x, y, z := v.cloud.Point(i)
+		if p := [3]float64{float64(x), float64(y), float64(z)}; inside(p) {
+			positions = append(positions, p)
+			t.points = append(t.points, i)
+		}
+	}
+	if len(positions) == 0 {
+		return fmt.Errorf("no points in region %s", region)
+	}
+	if len(positions) > maxDelaunayPoints {
+		return fmt.Errorf("%d points in the region; select a region with at most %d", len(positions), maxDelaunayPoints)
+	}
+	setStatus("Triangulating %d points…", len(positions))
+	defer setStatus("")
+	var err error
+	if t.tri, err = delaunay.Triangulate(positions); err != nil {
+		return err
+	}
+
+	volume, density := make([]float32, v.cloud.Len()), make([]float32, v.cloud.Len())
+	for i := range volume {
+		volume[i], density[i] = float32(math.NaN()), float32(math.NaN())
+	}
+	n := float64(len(t.points))
+	for j, vol := range t.tri.Volumes() {
+		volume[t.points[j]], density[t.points[j]] = float32(vol), float32(1/(n*vol))
+	}
+	v.cloud.SetAttribute(voronoiVolume, volume)
+	v.cloud.SetAttribute(voronoiDensity, density)
+
+	var lines, colors []float32
+	for _, e := range t.tri.Edges() {
+		for _, j := range e {
+			p := positions[j]
+			lines = append(lines, float32(p[0]), float32(p[1]), float32(p[2]))
+			colors = append(colors, delaunayGray, delaunayGray, delaunayGray)
+		}
+	}
+	edges, err := newLineSet(v.renderer, lines, colors)
+	if err != nil {
+		return err
+	}
+	cell, err := newLineSet(v.renderer, nil, nil)
+	if err != nil {
+		edges.release()
+		return err
+	}
+	v.clearVoronoi()
+	t.node = newNode("voronoi", nil)
+	t.edges = t.node.add(newNode("delaunay", edges))
+	t.cell = t.node.add(newNode("cell", cell))
+	t.cell.hidden = true
+	v.data.add(t.node)
+	v.voronoi = t
+	v.colorBy = voronoiDensity
+	v.recolor()
+	return nil
+}
+
+// clearVoronoi removes the tessellation, keeping the attributes computed
+// from it.
+func (v *viewer) clearVoronoi() {
+	if v.voronoi != nil {
+		v.data.remove(v.voronoi.node)
+		v.voronoi = nil
+	}
+}
+
+// pickCell shows the Voronoi cell of the triangulated point drawn nearest
+// to (x, y), in CSS pixels from the top left of the canvas shown width
+// pixels wide, if one is within pickRadius.
+func (v *viewer) pickCell(x, y, shownWidth float64) {
+	t := v.voronoi
+	width, height := v.canvas.Get("width").Int(), v.canvas.Get("height").Int()
+	ratio := float64(width) / shownWidth
+	x, y = x*ratio, y*ratio
+	mvp := v.projection(width, height).Mul(v.viewMatrix()).Mul(v.data.transform)
+	best, bestDist := -1, math.Pow(pickRadius*ratio, 2)
+	for j, i := range t.points {
+		px, py, pz := v.cloud.Point(i)
+		cx, cy, _, cw := mvp.Apply4(geom.Vec3{px, py, pz})
+		if cw <= 0 {
+			continue
+		}
+		sx := (float64(cx/cw) + 1) / 2 * float64(width)
+		sy := (1 - float64(cy/cw)) / 2 * float64(height)
+		if d := (sx-x)*(sx-x) + (sy-y)*(sy-y); d < bestDist {
+			best, bestDist = j, d
+		}
+	}
+	if best < 0 {
+		t.cell.hidden = true
+		return
+	}
+	faces, ok := t.tri.Cell(best)
+	if !ok {
+		t.cell.hidden = true
+		setStatus("Point %d is on the convex hull; its Voronoi cell is unbounded", t.points[best])
+		return
+	}
+	var lines, colors []float32
+	for _, face := range faces {
+		for k, a := range face {
+			b := face[(k+1)%len(face)]
+			lines = append(lines, float32(a[0]), float32(a[1]), float32(a[2]), float32(b[0]), float32(b[1]), float32(b[2]))
+			for m := 0; m < 2; m++ {
+				colors = append(colors, float32(highlightColor.R), float32(highlightColor.G), float32(highlightColor.B))
+			}
+		}
+	}
+	t.cell.primitive.(*lineSet).set(lines, colors)
+	t.cell.hidden = false
+	if vol := v.cloud.Attribute(voronoiVolume)[t.points[best]]; math.IsNaN(float64(vol)) {
+		setStatus("Point %d: Voronoi cell of %d faces reaching past the outermost points", t.points[best], len(faces))
+	} else {
+		setStatus("Point %d: Voronoi cell of %d faces, volume %.4g", t.points[best], len(faces), vol)
+	}
+}
+
+// toggleDelaunay shows or hides the Delaunay edges.
+func (v *viewer) toggleDelaunay() {
+	if v.voronoi != nil {
+		v.voronoi.edges.hidden = !v.voronoi.edges.hidden
+	}
+}
@@ -0,0 +1,237 @@
+// Package websocket is a minimal server side of the WebSocket protocol
+// (RFC 6455): the upgrade handshake and reading and writing whole
+// messages. It supports what the remote view needs and no extensions.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Message types.
+const (
+	Text   = 1
+	Binary = 2
+)
+
+// Control and continuation opcodes.
+const (
+	opContinuation = 0
+	opClose        = 8
+	opPing         = 9
+	opPong         = 10
+)
+
+// MaxMessage bounds the size of messages read from the client.
+const MaxMessage = 1 << 20
+
+// acceptGUID is appended to the client's key to compute the accept header.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned by ReadMessage when the client closes the
+// connection.
+var ErrClosed = errors.New("websocket: closed by client")
+
+// Conn is an upgraded connection. One goroutine may read while others
+// write.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu sync.Mutex
+	bw  *bufio.Writer
+}
+
+// Upgrade completes the WebSocket handshake for r. On failure it has
+// already replied with an HTTP error. Browsers may open WebSockets to any
+// site, so requests from pages of another origin are refused; requests
+// without an Origin header come from other clients and are accepted.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!headerHasToken(r.Header, "Connection", "upgrade") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin WebSocket request", http.StatusForbidden)
+		return nil, errors.New("websocket: cross-origin request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket upgrade unsupported", http.StatusInternalServerError)
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, br: rw.Reader, bw: rw.Writer}, nil
+}
+
+// sameOrigin reports whether r has no Origin header or one whose host is
+// the host r was sent to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, reassembling
+// fragments and answering pings. It returns ErrClosed once the client
+// closes the connection.
+func (c *Conn) ReadMessage() (kind int, data []byte, err error) {
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case opClose:
+			c.writeFrame(opClose, nil)
+			return 0, nil, ErrClosed
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opContinuation:
+			if kind == 0 {
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+		case Text, Binary:
+			if kind != 0 {
+				return 0, nil, errors.New("websocket: expected a continuation frame")
+			}
+			kind = int(op)
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+		if len(data)+len(payload) > MaxMessage {
+			return 0, nil, fmt.Errorf("websocket: message larger than %d bytes", MaxMessage)
+		}
+		data = append(data, payload...)
+		if fin {
+			return kind, data, nil
+		}
+	}
+}
+
+// readFrame reads one frame. Client frames must be masked.
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0f
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("websocket: unmasked client frame")
+	}
+	n := uint64(head[1] & 0x7f)
+	// Control frames may not be fragmented and carry at most 125 bytes
+	// (RFC 6455, section 5.5).
+	if op >= opClose && (!fin || n > 125) {
+		return false, 0, nil, fmt.Errorf("websocket: fragmented or oversized control frame (opcode %d)", op)
+	}
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > MaxMessage {
+		return false, 0, nil, fmt.Errorf("websocket: frame larger than %d bytes", MaxMessage)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends data as one unfragmented message of the given kind.
+func (c *Conn) WriteMessage(kind int, data []byte) error {
+	return c.writeFrame(byte(kind), data)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	head := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126)
+		head = binary.BigEndian.AppendUint16(head, uint16(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+	if _, err := c.bw.Write(head); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(payload); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// Close sends a close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.writeFrame(opClose, nil)
+	return c.conn.Close()
+}
@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pipe returns a server Conn and the client end of its connection.
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+	return &Conn{conn: server, br: bufio.NewReader(server), bw: bufio.NewWriter(server)}, client
+}
+
+// clientFrame encodes a masked frame as a client sends it.
+func clientFrame(fin bool, op byte, payload []byte) []byte {
+	b := []byte{op}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x80|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0x80|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	b = append(b, mask...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+// readServerFrame decodes an unmasked frame as the server sends it.
+func readServerFrame(r io.Reader) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	return head[0]&0x80 != 0, head[0] & 0x0f, payload, err
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("0123456789"), 7000) // needs the 64-bit length
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		kind    int
+		message []byte
+	}{
+		{"text", [][]byte{clientFrame(true, Text, []byte("hello"))}, Text, []byte("hello")},
+		{"empty", [][]byte{clientFrame(true, Binary, nil)}, Binary, []byte{}},
+		{"16-bit length", [][]byte{clientFrame(true, Binary, long[:300])}, Binary, long[:300]},
+		{"64-bit length", [][]byte{clientFrame(true, Binary, long)}, Binary, long},
+		{"fragments", [][]byte{
+			clientFrame(false, Text, []byte("he")),
+			clientFrame(false, opContinuation, []byte("ll")),
+			clientFrame(true, opContinuation, []byte("o")),
+		}, Text, []byte("hello")},
+		{"pong between fragments", [][]byte{
+			clientFrame(false, Text, []byte("he")),
+			clientFrame(true, opPong, []byte("x")),
+			clientFrame(true, opContinuation, []byte("llo")),
+		}, Text, []byte("hello")},
+	}
+	for _, tt := range tests {
+		c, client := pipe(t)
+		go client.Write(bytes.Join(tt.frames, nil))
+		kind, data, err := c.ReadMessage()
+		if err != nil || kind != tt.kind || !bytes.Equal(data, tt.message) {
+			t.Errorf("%s: ReadMessage = %d, %d bytes, %v; want %d, %d bytes", tt.name, kind, len(data), err, tt.kind, len(tt.message))
+		}
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 0xffff, 0x10000} {
+		c, client := pipe(t)
+		data := bytes.Repeat([]byte{'a'}, n)
+		go c.WriteMessage(Binary, data)
+		fin, op, payload, err := readServerFrame(client)
+		if err != nil || !fin || op != Binary || !bytes.Equal(payload, data) {
+			t.Errorf("%d bytes: got fin %v, op %d, %d bytes, %v", n, fin, op, len(payload), err)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	c, client := pipe(t)
+	go func() {
+		client.Write(clientFrame(true, opPing, []byte("are you there")))
+		readServerFrame(client) // the pong
+		client.Write(clientFrame(true, Text, []byte("yes")))
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, data, err := c.ReadMessage(); err != nil || string(data) != "yes" {
+			t.Errorf("ReadMessage after ping = %q, %v", data, err)
+		}
+	}()
+	<-done
+
+	c, client = pipe(t)
+	go client.Write(clientFrame(true, opPing, []byte("ping")))
+	go c.ReadMessage()
+	fin, op, payload, err := readServerFrame(client)
+	if err != nil || !fin || op != opPong || string(payload) != "ping" {
+		t.Errorf("pong = %v, %d, %q, %v", fin, op, payload, err)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	unmasked := clientFrame(true, Text, []byte("hi"))
+	unmasked[1] &^= 0x80
+	unmasked = append(unmasked[:2], []byte("hi")...)
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"unmasked", [][]byte{unmasked}},
+		{"fragmented ping", [][]byte{clientFrame(false, opPing, []byte("x"))}},
+		{"fragmented close", [][]byte{clientFrame(false, opClose, nil)}},
+		{"oversized ping", [][]byte{clientFrame(true, opPing, make([]byte, 126))}},
+		{"oversized pong", [][]byte{clientFrame(true, opPong, make([]byte, 200))}},
+		{"oversized frame", [][]byte{clientFrame(true, Binary, make([]byte, MaxMessage+1))}},
+		{"oversized message", [][]byte{
+			clientFrame(false, Binary, make([]byte, MaxMessage)),
+			clientFrame(true, opContinuation, []byte("x")),
+		}},
+		{"unexpected continuation", [][]byte{clientFrame(true, opContinuation, []byte("x"))}},
+		{"missing continuation", [][]byte{clientFrame(false, Text, []byte("a")), clientFrame(true, Text, []byte("b"))}},
+		{"unknown opcode", [][]byte{clientFrame(true, 3, nil)}},
+	}
+	// A valid message follows the bad frames, so a reader that accepts them
+	// returns it instead of blocking.
+	after := clientFrame(true, Text, []byte("after"))
+	for _, tt := range tests {
+		c, client := pipe(t)
+		go func() {
+			client.Write(append(bytes.Join(tt.frames, nil), after...))
+			io.Copy(io.Discard, client)
+		}()
+		if _, data, err := c.ReadMessage(); err == nil || errors.Is(err, ErrClosed) {
+			t.Errorf("%s: ReadMessage = %q, %v; want an error", tt.name, data, err)
+		}
+		c.conn.Close()
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, client := pipe(t)
+	go client.Write(clientFrame(true, opClose, []byte{0x03, 0xe8}))
+	go func() {
+		if _, op, _, _ := readServerFrame(client); op != opClose {
+			t.Errorf("reply to close has opcode %d", op)
+		}
+	}()
+	if _, _, err := c.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Errorf("ReadMessage after close = %v, want ErrClosed", err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if kind, data, err := c.ReadMessage(); err == nil {
+			c.WriteMessage(kind, data)
+		}
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Write(conn)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The accept value for this key is the example in RFC 6455.
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: %s, accept %q", resp.Status, resp.Header.Get("Sec-WebSocket-Accept"))
+	}
+	conn.Write(clientFrame(true, Text, []byte("echo")))
+	if _, op, payload, err := readServerFrame(br); err != nil || op != Text || string(payload) != "echo" {
+		t.Errorf("echo = %d, %q, %v", op, payload, err)
+	}
+}